@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/fasthttp/router"
+	"github.com/valyala/fasthttp"
+	"github.com/valyala/fasthttp/fasthttputil"
+	"repo/internal/pkg/auth"
+	"repo/internal/pkg/config"
+	"repo/internal/pkg/domain"
+	"repo/internal/pkg/lifecycle"
+)
+
+// sessionClient sends requests with a bearer token or a session cookie
+type sessionClient struct {
+	t      *testing.T
+	client *fasthttp.Client
+}
+
+func (sc sessionClient) do(method, path, body string, setToken func(*fasthttp.Request)) (int, *fasthttp.Response) {
+	sc.t.Helper()
+	req, resp := fasthttp.AcquireRequest(), &fasthttp.Response{}
+	defer fasthttp.ReleaseRequest(req)
+	req.Header.SetMethod(method)
+	req.SetRequestURI("http://forum" + path)
+	req.SetBodyString(body)
+	if setToken != nil {
+		setToken(req)
+	}
+	if err := sc.client.Do(req, resp); err != nil {
+		sc.t.Fatalf("%s %s: %v", method, path, err)
+	}
+	return resp.StatusCode(), resp
+}
+
+func bearer(token string) func(*fasthttp.Request) {
+	return func(req *fasthttp.Request) { req.Header.Set("Authorization", "Bearer "+token) }
+}
+
+func cookie(token string) func(*fasthttp.Request) {
+	return func(req *fasthttp.Request) { req.Header.SetCookie(auth.CookieName, token) }
+}
+
+func TestSessions(t *testing.T) {
+	s := memoryStorage()
+	r := router.New()
+	if _, err := routes(r, s, lifecycle.NewServer(nil), config.Default()); err != nil {
+		t.Fatal(err)
+	}
+	ln := fasthttputil.NewInmemoryListener()
+	srv := &fasthttp.Server{Handler: authenticate(s.auth, time.Second, r.Handler)}
+	go srv.Serve(ln)
+	defer srv.Shutdown()
+	sc := sessionClient{t: t, client: &fasthttp.Client{Dial: func(string) (net.Conn, error) { return ln.Dial() }}}
+
+	if status, _ := sc.do("POST", "/api/auth/register", `{"nickname":"alice","fullname":"Alice","email":"alice@example.com","password":"correct horse"}`, nil); status != 201 {
+		t.Fatalf("register answered %d", status)
+	}
+	for _, body := range []string{`{"nickname":"alice","password":"wrong password"}`, `{"nickname":"nobody","password":"correct horse"}`} {
+		if status, _ := sc.do("POST", "/api/auth/login", body, nil); status != 401 {
+			t.Errorf("login %s answered %d, want 401", body, status)
+		}
+	}
+
+	status, resp := sc.do("POST", "/api/auth/login", `{"nickname":"ALICE","password":"correct horse"}`, nil)
+	var session domain.Session
+	if status != 200 || json.Unmarshal(resp.Body(), &session) != nil || session.Token == "" || session.Nickname != "alice" {
+		t.Fatalf("login answered %d %s", status, resp.Body())
+	}
+	set := &fasthttp.Cookie{}
+	set.SetKey(auth.CookieName)
+	if !resp.Header.Cookie(set) || string(set.Value()) != session.Token || !set.HTTPOnly() {
+		t.Errorf("login set cookie %q, want the HttpOnly session token", set.String())
+	}
+
+	me := func(setToken func(*fasthttp.Request)) int {
+		status, _ := sc.do("GET", "/api/auth/me", "", setToken)
+		return status
+	}
+	if got := me(nil); got != 401 {
+		t.Errorf("anonymous /me answered %d", got)
+	}
+	if got := me(bearer("forged")); got != 401 {
+		t.Errorf("/me with an unknown token answered %d", got)
+	}
+	if got := me(cookie(session.Token)); got != 200 {
+		t.Errorf("/me with the session cookie answered %d", got)
+	}
+	if got := me(bearer(session.Token)); got != 200 {
+		t.Errorf("/me with the bearer token answered %d", got)
+	}
+
+	expired := "expired-token"
+	if err := s.auth.AddSession(context.Background(), "alice", auth.HashToken(expired), time.Now().Add(-time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	if got := me(bearer(expired)); got != 401 {
+		t.Errorf("/me with an expired session answered %d", got)
+	}
+
+	if status, _ := sc.do("POST", "/api/auth/logout", "", cookie(session.Token)); status != 200 {
+		t.Errorf("logout answered %d", status)
+	}
+	if got := me(bearer(session.Token)); got != 401 {
+		t.Errorf("/me after logout answered %d", got)
+	}
+	if status, _ := sc.do("POST", "/api/auth/logout", "", nil); status != 401 {
+		t.Errorf("anonymous logout answered %d", status)
+	}
+}
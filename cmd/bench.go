@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/rs/zerolog/log"
+	"os"
+	"os/signal"
+	"repo/internal/pkg/bench"
+	"repo/internal/pkg/config"
+	"syscall"
+)
+
+// usage: main bench [flags]
+// Seeds the target, drives the mix for bench.duration and prints the measures.
+// With bench.check it exits 1 when the target serves something else than was written.
+func benchCommand(cfg config.Config) {
+	b, err := bench.New(cfg.Bench)
+	if err != nil {
+		log.Fatal().Msg(err.Error())
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	log.Info().Str("target", cfg.Bench.Target).Msg("seeding")
+	if err = b.Seed(ctx); err != nil {
+		log.Fatal().Msg(err.Error())
+	}
+	log.Info().Int("concurrency", cfg.Bench.Concurrency).Dur("duration", cfg.Bench.Duration).Msg("running")
+	report := b.Run(ctx)
+	if err = report.Print(os.Stdout); err != nil {
+		log.Fatal().Msg(err.Error())
+	}
+	if !cfg.Bench.Check {
+		return
+	}
+
+	problems, err := b.Check(context.Background())
+	if err != nil {
+		log.Fatal().Msg(err.Error())
+	}
+	for _, p := range problems {
+		fmt.Println("mismatch:", p)
+	}
+	if len(problems) > 0 {
+		stop()
+		os.Exit(1)
+	}
+	fmt.Println("check passed")
+}
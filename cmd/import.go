@@ -0,0 +1,99 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"github.com/rs/zerolog/log"
+	"io"
+	"os"
+	"os/signal"
+	"repo/internal/pkg/config"
+	"repo/internal/pkg/domain"
+	"repo/internal/pkg/importer"
+	repository7 "repo/internal/pkg/importer/repository"
+	"strings"
+	"syscall"
+)
+
+// usage: main import [flags] kind=path ...
+// Kinds are users, forums, threads, posts and votes, imported in this order
+// whatever the order of the arguments. Files ending in .csv are read as CSV,
+// others as JSON Lines; - reads standard input.
+func importCommand(cfg config.Config) {
+	files := map[string]string{}
+	for _, arg := range cfg.Args {
+		kind, path := splitImportArg(arg)
+		if path == "" || !isImportKind(kind) {
+			log.Fatal().Msgf("invalid import argument %q, expected kind=path with kind one of %s", arg, strings.Join(domain.ImportKinds, ", "))
+		}
+		if _, ok := files[kind]; ok {
+			log.Fatal().Msgf("%s given twice", kind)
+		}
+		files[kind] = path
+	}
+	if len(files) == 0 {
+		log.Fatal().Msg("nothing to import, pass kind=path arguments")
+	}
+
+	p, err := connect(cfg.DB)
+	if err != nil {
+		log.Fatal().Msgf("error connecting:" + err.Error())
+	}
+	defer p.Close()
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	ir := repository7.NewImportRep(p)
+
+	for _, kind := range domain.ImportKinds {
+		path, ok := files[kind]
+		if !ok {
+			continue
+		}
+		result, err := importFile(ctx, &ir, kind, path)
+		if err != nil {
+			log.Fatal().Msgf("importing %s from %s: %s", kind, path, err)
+		}
+		fmt.Printf("%s: read %d, imported %d, rejected %d\n", kind, result.Read, result.Imported, result.Rejected)
+		for _, r := range result.Rejections {
+			fmt.Printf("  %s:%d: %s\n", path, r.Line, r.Reason)
+		}
+		if len(result.Rejections) < result.Rejected {
+			fmt.Printf("  and %d more\n", result.Rejected-len(result.Rejections))
+		}
+	}
+}
+
+func isImportKind(kind string) bool {
+	for _, k := range domain.ImportKinds {
+		if k == kind {
+			return true
+		}
+	}
+	return false
+}
+
+func splitImportArg(arg string) (string, string) {
+	i := strings.IndexByte(arg, '=')
+	if i < 0 {
+		return arg, ""
+	}
+	return arg[:i], arg[i+1:]
+}
+
+func importFile(ctx context.Context, ir domain.ImportRepository, kind, path string) (domain.ImportResult, error) {
+	var in io.Reader = os.Stdin
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return domain.ImportResult{}, err
+		}
+		defer f.Close()
+		in = f
+	}
+	source, err := importer.NewSource(kind, importer.FormatOf(path), bufio.NewReaderSize(in, 1<<20))
+	if err != nil {
+		return domain.ImportResult{}, err
+	}
+	return ir.Import(ctx, source)
+}
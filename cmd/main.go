@@ -2,26 +2,45 @@ package main
 
 import (
 	"context"
+	"errors"
+	"flag"
 	"fmt"
 	"github.com/fasthttp/router"
+	"github.com/jackc/pgx/v4"
 	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 	"github.com/valyala/fasthttp"
+	"os"
+	"repo/internal/pkg/auth"
+	delivery4 "repo/internal/pkg/auth/delivery"
+	repository4 "repo/internal/pkg/auth/repository"
+	"repo/internal/pkg/config"
+	"repo/internal/pkg/cursor"
+	"repo/internal/pkg/domain"
+	delivery6 "repo/internal/pkg/history/delivery"
+	repository6 "repo/internal/pkg/history/repository"
+	"repo/internal/pkg/lifecycle"
+	"repo/internal/pkg/logging"
+	"repo/internal/pkg/memory"
+	"repo/internal/pkg/metrics"
+	delivery5 "repo/internal/pkg/moderation/delivery"
+	repository5 "repo/internal/pkg/moderation/repository"
+	"repo/internal/pkg/openapi"
 	delivery2 "repo/internal/pkg/forum/delivery"
+	"repo/internal/pkg/health"
+	delivery7 "repo/internal/pkg/importer/delivery"
+	repository7 "repo/internal/pkg/importer/repository"
 	repository2 "repo/internal/pkg/forum/repository"
+	delivery3 "repo/internal/pkg/search/delivery"
+	repository3 "repo/internal/pkg/search/repository"
 	"repo/internal/pkg/user/delivery"
 	"repo/internal/pkg/user/repository"
+	"repo/internal/pkg/utils"
+	"strings"
+	"time"
 )
 
-type DBcfg struct {
-	User string
-	Host string
-	Port int
-	Pass string
-	Name string
-}
-
-
 func middleware(next fasthttp.RequestHandler) fasthttp.RequestHandler {
 	return func(ctx *fasthttp.RequestCtx) {
 		ctx.Response.Header.Set("Content-Type", "application/json")
@@ -29,38 +48,191 @@ func middleware(next fasthttp.RequestHandler) fasthttp.RequestHandler {
 	}
 }
 
+// authenticate attaches the nickname of a valid session to the request.
+// Requests without a session, or with an expired one, continue anonymously.
+func authenticate(ar domain.AuthRepository, timeout time.Duration, next fasthttp.RequestHandler) fasthttp.RequestHandler {
+	return func(ctx *fasthttp.RequestCtx) {
+		if token := auth.Token(ctx); token != "" {
+			c, cancel := context.Background(), context.CancelFunc(func() {})
+			if timeout > 0 {
+				c, cancel = context.WithTimeout(c, timeout)
+			}
+			nickname, err := ar.SessionUser(c, auth.HashToken(token))
+			cancel()
+			if err == nil {
+				auth.SetNickname(ctx, nickname)
+			} else if !errors.Is(err, domain.ErrNotFound) {
+				logging.FromRequest(ctx).Error().Err(err).Msg("session lookup failed")
+			}
+		}
+		next(ctx)
+	}
+}
+
+// usage: main [serve|migrate|bench|import] [flags] [args]
 func main() {
-	cfg := DBcfg{
-		User: "docker",
-		Host: "localhost",
-		Port: 5432,
-		Pass: "docker",
-		Name: "docker",
+	args := os.Args[1:]
+	command := "serve"
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		command, args = args[0], args[1:]
+	}
+
+	cfg, err := config.Load(args)
+	if errors.Is(err, flag.ErrHelp) {
+		return
 	}
-	r := router.New()
-	connString := fmt.Sprintf("user=%s password=%s host=%s port=%d dbname=%s", cfg.User, cfg.Pass, cfg.Host, cfg.Port, cfg.Name)
-	connConf, err := pgxpool.ParseConfig(connString)
 	if err != nil {
-		log.Error().Msgf(err.Error())
+		log.Fatal().Msg(err.Error())
+	}
+	level, _ := zerolog.ParseLevel(cfg.Log.Level)
+	zerolog.SetGlobalLevel(level)
+	zerolog.DefaultContextLogger = &log.Logger
+
+	if cfg.PrintConfig {
+		fmt.Print(cfg.String())
 		return
 	}
-	connConf.MaxConns = 100
+
+	switch command {
+	case "serve":
+		serve(cfg)
+	case "migrate":
+		migrateCommand(cfg)
+	case "bench":
+		benchCommand(cfg)
+	case "import":
+		importCommand(cfg)
+	default:
+		log.Fatal().Msgf("unknown command %q, expected serve, migrate, bench or import", command)
+	}
+}
+
+func connect(cfg config.DB) (*pgxpool.Pool, error) {
+	connConf, err := pgxpool.ParseConfig(cfg.ConnString())
+	if err != nil {
+		return nil, err
+	}
+	connConf.MaxConns = cfg.MaxConns
 	connConf.ConnConfig.PreferSimpleProtocol = true
+	connConf.ConnConfig.Logger = logging.PgxLogger{}
+	connConf.ConnConfig.LogLevel = pgx.LogLevelError
 
-	p, err := pgxpool.ConnectConfig(context.Background(), connConf)
+	return pgxpool.ConnectConfig(context.Background(), connConf)
+}
 
-	//handlers live here
-	ur := repository.NewUserRep(p)
-	delivery.NewUserHandler(r, &ur)
+// storage holds the repositories the handlers are served from. Moderation,
+// history, search and import need PostgreSQL, they are nil with memory storage
+// and their routes are not served.
+type storage struct {
+	pool       *pgxpool.Pool
+	users      domain.UserRepository
+	auth       domain.AuthRepository
+	forums     domain.ForumRepository
+	history    domain.HistoryRepository
+	moderation domain.ModerationRepository
+	search     domain.SearchRepository
+	imports    domain.ImportRepository
+}
 
+func postgresStorage(p *pgxpool.Pool) storage {
+	ur := repository.NewUserRep(p)
+	ar := repository4.NewAuthRep(p)
 	fr := repository2.NewForumRep(p, &ur)
-	delivery2.NewForumHandler(r, &fr)
+	hr := repository6.NewHistoryRep(p)
+	mr := repository5.NewModerationRep(p)
+	sr := repository3.NewSearchRep(p)
+	ir := repository7.NewImportRep(p)
+	return storage{pool: p, users: &ur, auth: &ar, forums: &fr, history: &hr, moderation: &mr, search: &sr, imports: &ir}
+}
 
+func memoryStorage() storage {
+	s := memory.NewStore()
+	ur := memory.NewUserRep(s)
+	ar := memory.NewAuthRep(s)
+	fr := memory.NewForumRep(s)
+	return storage{users: &ur, auth: &ar, forums: &fr}
+}
+
+func serve(cfg config.Config) {
+	r := router.New()
+	r.SaveMatchedRoutePath = true
+	var s storage
+	if cfg.Storage == "memory" {
+		log.Warn().Msg("serving from memory: data is lost on exit, moderation, history, search and import are off")
+		s = memoryStorage()
+	} else {
+		p, err := connect(cfg.DB)
+		if err != nil {
+			log.Fatal().Msgf("error connecting:"+err.Error())
+		}
+		s = postgresStorage(p)
+	}
+
+	handler := authenticate(s.auth, cfg.Server.RequestTimeout, r.Handler)
+	handler = logging.Middleware(log.Logger, cfg.Log.Sample, metrics.Middleware(handler))
+	srv := lifecycle.NewServer(middleware(handler))
+	srv.DrainDelay = cfg.Server.DrainDelay
+	srv.ShutdownTimeout = cfg.Server.ShutdownTimeout
+	if s.pool != nil {
+		srv.OnShutdown(s.pool.Close)
+		metrics.RegisterPool(s.pool)
+	}
+
+	missing, err := routes(r, s, srv, cfg)
 	if err != nil {
-		log.Error().Msgf("error connecting:"+err.Error())
+		log.Fatal().Msgf("error building the OpenAPI document: %s", err)
 	}
-	err = fasthttp.ListenAndServe(":5000", middleware(r.Handler))
+	if len(missing) > 0 {
+		log.Warn().Strs("routes", missing).Msg("routes missing from the OpenAPI document")
+	}
+
+	err = srv.ListenAndServe(cfg.Server.Addr)
 	if err != nil {
 		log.Error().Msgf("error listening:"+err.Error())
 	}
 }
+
+// routes registers every handler on r and loads the OpenAPI document from
+// the result. It returns the routes the document has no description of.
+func routes(r *router.Router, s storage, srv *lifecycle.Server, cfg config.Config) ([]string, error) {
+	spec := &openapi.Spec{}
+	r.GET("/api/openapi.json", spec.Handler)
+
+	checker := health.NewChecker(cfg.Server.ReadyTimeout, srv.Ready)
+	if s.pool != nil {
+		checker.Add("database", health.Database(s.pool))
+		checker.Add("migrations", health.Migrations(s.pool))
+	}
+	r.GET("/healthz", health.LiveHandler)
+	r.GET("/readyz", checker.ReadyHandler)
+	r.GET("/metrics", metrics.Handler())
+
+	timeouts := utils.Timeouts{Base: srv.Context(), Default: cfg.Server.RequestTimeout, Routes: cfg.Server.RouteTimeouts}
+
+	//handlers live here
+	authz := auth.NewAuthorizer(s.auth, cfg.Auth.Enforce)
+	delivery.NewUserHandler(r, s.users, timeouts, authz)
+
+	delivery4.NewAuthHandler(r, s.auth, s.users, timeouts, cfg.Auth.SessionTTL, cfg.Auth.SecureCookie)
+
+	if cfg.Server.CursorSecret == "" {
+		log.Warn().Msg("server.cursor_secret is not set, pagination cursors are valid for this process only")
+	}
+	cursors := cursor.NewCodec(cfg.Server.CursorSecret)
+	delivery2.NewForumHandler(r, s.forums, timeouts, cursors, authz)
+
+	if s.history != nil {
+		delivery6.NewHistoryHandler(r, s.history, s.forums, timeouts)
+	}
+	if s.moderation != nil {
+		delivery5.NewModerationHandler(r, s.moderation, s.forums, timeouts, authz, cursors)
+	}
+	if s.search != nil {
+		delivery3.NewSearchHandler(r, s.search, timeouts, cursors)
+	}
+	if s.imports != nil {
+		delivery7.NewImportHandler(r, s.imports, timeouts, authz)
+	}
+
+	return spec.Load(r.List())
+}
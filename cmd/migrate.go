@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/rs/zerolog/log"
+	"repo/internal/pkg/config"
+	"repo/internal/pkg/migrate"
+	"strconv"
+)
+
+// usage: main migrate [flags] up | down [steps] | status | profile [bench|durable]
+func migrateCommand(cfg config.Config) {
+	p, err := connect(cfg.DB)
+	if err != nil {
+		log.Fatal().Msgf("error connecting:"+err.Error())
+	}
+	defer p.Close()
+
+	ctx := context.Background()
+	runner := migrate.NewRunner(p)
+	action := "up"
+	if len(cfg.Args) > 0 {
+		action = cfg.Args[0]
+	}
+
+	switch action {
+	case "up":
+		err = runner.UpKeepingProfile(ctx, cfg.DB.Profile)
+	case "profile":
+		profile := cfg.DB.Profile
+		if len(cfg.Args) > 1 {
+			profile = cfg.Args[1]
+		}
+		if profile == "" {
+			log.Fatal().Msg("no profile to apply, pass bench or durable or set db.profile")
+		}
+		err = runner.ApplyProfile(ctx, profile)
+	case "down":
+		steps := 1
+		if len(cfg.Args) > 1 {
+			steps, err = strconv.Atoi(cfg.Args[1])
+			if err != nil || steps < 1 {
+				log.Fatal().Msgf("invalid number of steps %q", cfg.Args[1])
+			}
+		}
+		err = runner.Down(ctx, steps)
+	case "status":
+		var statuses []migrate.Status
+		statuses, err = runner.Status(ctx)
+		for _, st := range statuses {
+			state := "pending"
+			if st.Applied {
+				state = "applied"
+			}
+			fmt.Printf("%04d_%s\t%s\n", st.Version, st.Name, state)
+		}
+		if err == nil {
+			var profile string
+			profile, err = runner.Profile(ctx)
+			if profile == "" {
+				profile = "none"
+			}
+			fmt.Printf("profile\t%s\n", profile)
+		}
+	default:
+		log.Fatal().Msgf("unknown migrate action %q, expected up, down, status or profile", action)
+	}
+	if err != nil {
+		log.Fatal().Msg(err.Error())
+	}
+}
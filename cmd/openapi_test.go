@@ -0,0 +1,49 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/fasthttp/router"
+	"github.com/valyala/fasthttp"
+	"repo/internal/pkg/config"
+	"repo/internal/pkg/lifecycle"
+	"repo/internal/pkg/openapi"
+)
+
+func TestOpenAPIDescribesEveryRoute(t *testing.T) {
+	r := router.New()
+	missing, err := routes(r, postgresStorage(nil), lifecycle.NewServer(nil), config.Default())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, route := range missing {
+		t.Errorf("%s is registered but not described in openapi.Routes", route)
+	}
+
+	registered := map[string]bool{}
+	for method, paths := range r.List() {
+		for _, path := range paths {
+			registered[method+" "+path] = true
+		}
+	}
+	for route := range openapi.Routes {
+		if !registered[route] {
+			t.Errorf("%s is described in openapi.Routes but not registered", route)
+		}
+	}
+
+	ctx := &fasthttp.RequestCtx{}
+	ctx.Request.SetRequestURI("/api/openapi.json")
+	r.Handler(ctx)
+	var doc openapi.Document
+	if err := json.Unmarshal(ctx.Response.Body(), &doc); err != nil {
+		t.Fatalf("serving the document: %v", err)
+	}
+	if _, ok := doc.Paths["/api/post/{id}/details"]["get"]; !ok {
+		t.Errorf("document paths %v lack GET /api/post/{id}/details", doc.Paths)
+	}
+	if _, ok := doc.Components.Schemas["Thread"]; !ok {
+		t.Errorf("document lacks the Thread schema")
+	}
+}
@@ -0,0 +1,80 @@
+// Package auth hashes passwords and session tokens and carries the
+// authenticated nickname of a request.
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"strings"
+
+	"github.com/valyala/fasthttp"
+	"golang.org/x/crypto/bcrypt"
+	"repo/internal/pkg/domain"
+)
+
+// CookieName is the cookie holding the session token, clients that do not keep
+// cookies send it as "Authorization: Bearer <token>" instead.
+const CookieName = "session"
+
+const nicknameKey = "auth.nickname"
+
+// dummyHash is compared against when a user has no credentials, so that a login
+// takes as long for unknown users as for a wrong password.
+var dummyHash, _ = bcrypt.GenerateFromPassword([]byte("dummy password"), bcrypt.DefaultCost)
+
+// compareHash is bcrypt.CompareHashAndPassword, tests watch the hashes compared
+var compareHash = bcrypt.CompareHashAndPassword
+
+func HashPassword(password string) (string, error) {
+	// bcrypt only looks at the first 72 bytes
+	if len(password) > 72 {
+		return "", domain.NewError(domain.ErrInvalid, "password must be at most 72 bytes")
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	return string(hash), err
+}
+
+// CheckPassword reports whether password matches hash. An empty hash never matches.
+func CheckPassword(hash string, password string) bool {
+	if hash == "" {
+		compareHash(dummyHash, []byte(password))
+		return false
+	}
+	return compareHash([]byte(hash), []byte(password)) == nil
+}
+
+// NewToken returns a random session token and the hash it is stored under.
+func NewToken() (string, []byte, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", nil, err
+	}
+	token := base64.RawURLEncoding.EncodeToString(raw)
+	return token, HashToken(token), nil
+}
+
+func HashToken(token string) []byte {
+	sum := sha256.Sum256([]byte(token))
+	return sum[:]
+}
+
+// Token extracts the session token of a request, the Authorization header
+// taking precedence over the cookie.
+func Token(ctx *fasthttp.RequestCtx) string {
+	header := string(ctx.Request.Header.Peek("Authorization"))
+	if len(header) > 7 && strings.EqualFold(header[:7], "bearer ") {
+		return strings.TrimSpace(header[7:])
+	}
+	return string(ctx.Request.Header.Cookie(CookieName))
+}
+
+func SetNickname(ctx *fasthttp.RequestCtx, nickname string) {
+	ctx.SetUserValue(nicknameKey, nickname)
+}
+
+// Nickname is the authenticated user of the request, empty for anonymous requests.
+func Nickname(ctx *fasthttp.RequestCtx) string {
+	nickname, _ := ctx.UserValue(nicknameKey).(string)
+	return nickname
+}
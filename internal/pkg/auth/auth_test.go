@@ -0,0 +1,101 @@
+package auth
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/valyala/fasthttp"
+	"repo/internal/pkg/domain"
+)
+
+func TestPasswords(t *testing.T) {
+	hash, err := HashPassword("correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hash == "correct horse" || !strings.HasPrefix(hash, "$2") {
+		t.Errorf("HashPassword = %q, want a bcrypt hash", hash)
+	}
+	if !CheckPassword(hash, "correct horse") {
+		t.Error("the right password does not match")
+	}
+	if CheckPassword(hash, "battery staple") {
+		t.Error("a wrong password matches")
+	}
+	if other, _ := HashPassword("correct horse"); other == hash {
+		t.Error("hashes are not salted")
+	}
+	if _, err = HashPassword(strings.Repeat("x", 73)); !errors.Is(err, domain.ErrInvalid) {
+		t.Errorf("HashPassword of 73 bytes = %v, want invalid", err)
+	}
+}
+
+func TestMissingUserComparesDummyHash(t *testing.T) {
+	var compared [][]byte
+	saved := compareHash
+	defer func() { compareHash = saved }()
+	compareHash = func(hash, password []byte) error {
+		compared = append(compared, hash)
+		return nil
+	}
+
+	// a user without credentials never logs in, but costs a bcrypt comparison all the same
+	if CheckPassword("", "anything") {
+		t.Error("an empty hash matches")
+	}
+	if len(compared) != 1 || !bytes.Equal(compared[0], dummyHash) {
+		t.Errorf("compared %q, want the dummy hash", compared)
+	}
+}
+
+func TestNewToken(t *testing.T) {
+	token, hash, err := NewToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil || len(raw) != 32 {
+		t.Errorf("token %q is not 32 random bytes: %v", token, err)
+	}
+	sum := sha256.Sum256([]byte(token))
+	if !bytes.Equal(hash, sum[:]) || !bytes.Equal(HashToken(token), hash) {
+		t.Errorf("stored hash %x, want the sha256 of the token %x", hash, sum)
+	}
+	other, _, _ := NewToken()
+	if other == token {
+		t.Error("two tokens are equal")
+	}
+}
+
+func TestToken(t *testing.T) {
+	cases := []struct {
+		name          string
+		authorization string
+		cookie        string
+		want          string
+	}{
+		{"anonymous", "", "", ""},
+		{"cookie", "", "from-cookie", "from-cookie"},
+		{"bearer", "Bearer from-header", "", "from-header"},
+		{"bearer any case", "bEaReR  from-header ", "", "from-header"},
+		{"header first", "Bearer from-header", "from-cookie", "from-header"},
+		{"other scheme", "Basic dXNlcjpwYXNz", "from-cookie", "from-cookie"},
+		{"empty bearer", "Bearer ", "", ""},
+	}
+	for _, c := range cases {
+		var ctx fasthttp.RequestCtx
+		if c.authorization != "" {
+			ctx.Request.Header.Set("Authorization", c.authorization)
+		}
+		if c.cookie != "" {
+			ctx.Request.Header.SetCookie(CookieName, c.cookie)
+		}
+		if got := Token(&ctx); got != c.want {
+			t.Errorf("%s: Token = %q, want %q", c.name, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,42 @@
+package auth
+
+import (
+	"github.com/valyala/fasthttp"
+	"repo/internal/pkg/domain"
+	"repo/internal/pkg/policy"
+	"repo/internal/pkg/utils"
+)
+
+// Authorizer runs policy checks for the caller of a request.
+type Authorizer struct {
+	ar domain.AuthRepository
+	// Enforce off lets every request through, as before authentication existed
+	Enforce bool
+}
+
+func NewAuthorizer(ar domain.AuthRepository, enforce bool) Authorizer {
+	return Authorizer{ar: ar, Enforce: enforce}
+}
+
+// Authorize checks edits of existing content, it lets everything through
+// unless enforcement is on.
+func (az Authorizer) Authorize(ctx *fasthttp.RequestCtx, forum string, check func(policy.Actor) error) error {
+	if !az.Enforce {
+		return nil
+	}
+	return az.Check(ctx, forum, check)
+}
+
+// Check resolves the actor of the request with its roles in forum and
+// returns the verdict of check, whether enforcement is on or not.
+func (az Authorizer) Check(ctx *fasthttp.RequestCtx, forum string, check func(policy.Actor) error) error {
+	actor := policy.Actor{Nickname: Nickname(ctx)}
+	if actor.Authenticated() {
+		admin, moderator, err := az.ar.Roles(utils.Context(ctx), actor.Nickname, forum)
+		if err != nil {
+			return err
+		}
+		actor.Admin, actor.Moderator = admin, moderator
+	}
+	return check(actor)
+}
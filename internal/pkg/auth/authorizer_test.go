@@ -0,0 +1,70 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/valyala/fasthttp"
+	"repo/internal/pkg/domain"
+	"repo/internal/pkg/policy"
+)
+
+// roles answers Roles from fixed sets, the other methods are not used by the Authorizer
+type roles struct {
+	domain.AuthRepository
+	admins     map[string]bool
+	moderators map[string]bool
+	err        error
+}
+
+func (r roles) Roles(ctx context.Context, nickname string, forum string) (bool, bool, error) {
+	return r.admins[nickname], r.moderators[nickname+"@"+forum], r.err
+}
+
+func TestAuthorizer(t *testing.T) {
+	repo := roles{admins: map[string]bool{"root": true}, moderators: map[string]bool{"mod@go": true}}
+	post := domain.Post{Author: "alice", Forum: "go"}
+	edit := func(a policy.Actor) error { return policy.CanEditPost(a, post) }
+
+	cases := []struct {
+		actor   string
+		enforce bool
+		// the verdicts of Authorize and Check, nil when allowed
+		authorize, check error
+	}{
+		{"", false, nil, domain.ErrUnauthorized},
+		{"", true, domain.ErrUnauthorized, domain.ErrUnauthorized},
+		{"bob", false, nil, domain.ErrForbidden},
+		{"bob", true, domain.ErrForbidden, domain.ErrForbidden},
+		{"alice", true, nil, nil},
+		{"mod", true, nil, nil},
+		{"root", true, nil, nil},
+	}
+	for _, c := range cases {
+		var ctx fasthttp.RequestCtx
+		if c.actor != "" {
+			SetNickname(&ctx, c.actor)
+		}
+		az := NewAuthorizer(repo, c.enforce)
+		if err := az.Authorize(&ctx, "go", edit); !errors.Is(err, c.authorize) {
+			t.Errorf("%q, enforce %v: Authorize = %v, want %v", c.actor, c.enforce, err, c.authorize)
+		}
+		if err := az.Check(&ctx, "go", edit); !errors.Is(err, c.check) {
+			t.Errorf("%q, enforce %v: Check = %v, want %v", c.actor, c.enforce, err, c.check)
+		}
+	}
+
+	// roles are per forum
+	var ctx fasthttp.RequestCtx
+	SetNickname(&ctx, "mod")
+	if err := NewAuthorizer(repo, true).Check(&ctx, "rust", edit); !errors.Is(err, domain.ErrForbidden) {
+		t.Errorf("moderator of another forum: Check = %v", err)
+	}
+
+	// a failing role lookup is not taken for a denial
+	broken := roles{err: errors.New("boom")}
+	if err := NewAuthorizer(broken, true).Check(&ctx, "go", edit); err == nil || errors.Is(err, domain.ErrForbidden) {
+		t.Errorf("Check with a failing lookup = %v", err)
+	}
+}
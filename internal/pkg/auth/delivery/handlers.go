@@ -0,0 +1,132 @@
+package delivery
+
+import (
+	"errors"
+	"github.com/fasthttp/router"
+	"github.com/valyala/fasthttp"
+	"repo/internal/pkg/auth"
+	"repo/internal/pkg/domain"
+	"repo/internal/pkg/utils"
+	"time"
+)
+
+type AuthHandler struct {
+	ar domain.AuthRepository
+	ur domain.UserRepository
+	// sessionTTL is the lifetime of a login
+	sessionTTL   time.Duration
+	secureCookie bool
+}
+
+func NewAuthHandler(r *router.Router, ar domain.AuthRepository, ur domain.UserRepository, t utils.Timeouts, sessionTTL time.Duration, secureCookie bool) {
+	handler := AuthHandler{ar: ar, ur: ur, sessionTTL: sessionTTL, secureCookie: secureCookie}
+	route := t.Router(r)
+	route.POST("/api/auth/register", handler.Register)
+	route.POST("/api/auth/login", handler.Login)
+	route.POST("/api/auth/logout", handler.Logout)
+	route.GET("/api/auth/me", handler.Me)
+}
+
+func (ah *AuthHandler) Register(ctx *fasthttp.RequestCtx) {
+	c := utils.Context(ctx)
+	var reg domain.Registration
+	if !utils.ParseBody(ctx, &reg) {
+		return
+	}
+	hash, err := auth.HashPassword(reg.Password)
+	if err != nil {
+		utils.SendError(err, ctx)
+		return
+	}
+	err = ah.ar.Register(c, reg.User, hash)
+	if errors.Is(err, domain.ErrConflict) {
+		users, err := ah.ur.GetUserByNickOrEmail(c, reg.Nickname, reg.Email)
+		if err != nil {
+			utils.SendError(err, ctx)
+			return
+		}
+		utils.Send(409, users, ctx)
+		return
+	}
+	if err != nil {
+		utils.SendError(err, ctx)
+		return
+	}
+	utils.Send(201, reg.User, ctx)
+}
+
+func (ah *AuthHandler) Login(ctx *fasthttp.RequestCtx) {
+	c := utils.Context(ctx)
+	var creds domain.Credentials
+	if !utils.ParseBody(ctx, &creds) {
+		return
+	}
+	nickname, hash, err := ah.ar.PasswordHash(c, creds.Nickname)
+	if err != nil && !errors.Is(err, domain.ErrNotFound) {
+		utils.SendError(err, ctx)
+		return
+	}
+	// unknown users and wrong passwords are told apart neither by answer nor by timing
+	if !auth.CheckPassword(hash, creds.Password) {
+		utils.Send(401, domain.Response{Message: "Wrong nickname or password"}, ctx)
+		return
+	}
+
+	token, tokenHash, err := auth.NewToken()
+	if err != nil {
+		utils.SendError(err, ctx)
+		return
+	}
+	session := domain.Session{Nickname: nickname, Token: token, Expires: time.Now().Add(ah.sessionTTL)}
+	err = ah.ar.AddSession(c, nickname, tokenHash, session.Expires)
+	if err != nil {
+		utils.SendError(err, ctx)
+		return
+	}
+	ah.setCookie(ctx, token, session.Expires)
+	utils.Send(200, session, ctx)
+}
+
+func (ah *AuthHandler) Logout(ctx *fasthttp.RequestCtx) {
+	c := utils.Context(ctx)
+	token := auth.Token(ctx)
+	if token == "" {
+		utils.SendError(domain.NewError(domain.ErrUnauthorized, "Not logged in"), ctx)
+		return
+	}
+	err := ah.ar.DeleteSession(c, auth.HashToken(token))
+	if err != nil {
+		utils.SendError(err, ctx)
+		return
+	}
+	ah.setCookie(ctx, "", time.Unix(0, 0))
+	utils.Send(200, domain.Response{Message: "Logged out"}, ctx)
+}
+
+func (ah *AuthHandler) Me(ctx *fasthttp.RequestCtx) {
+	c := utils.Context(ctx)
+	nickname := auth.Nickname(ctx)
+	if nickname == "" {
+		utils.SendError(domain.NewError(domain.ErrUnauthorized, "Not logged in"), ctx)
+		return
+	}
+	users, err := ah.ur.GetUser(c, nickname)
+	if err != nil {
+		utils.SendError(err, ctx)
+		return
+	}
+	utils.Send(200, users[0], ctx)
+}
+
+func (ah *AuthHandler) setCookie(ctx *fasthttp.RequestCtx, token string, expires time.Time) {
+	cookie := fasthttp.AcquireCookie()
+	defer fasthttp.ReleaseCookie(cookie)
+	cookie.SetKey(auth.CookieName)
+	cookie.SetValue(token)
+	cookie.SetPath("/")
+	cookie.SetExpire(expires)
+	cookie.SetHTTPOnly(true)
+	cookie.SetSameSite(fasthttp.CookieSameSiteLaxMode)
+	cookie.SetSecure(ah.secureCookie)
+	ctx.Response.Header.SetCookie(cookie)
+}
@@ -0,0 +1,92 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"repo/internal/pkg/domain"
+	"repo/internal/pkg/metrics"
+	"repo/internal/pkg/utils"
+	"time"
+)
+
+type AuthRepository struct {
+	dbm *pgxpool.Pool
+}
+
+func NewAuthRep(pool *pgxpool.Pool) AuthRepository {
+	return AuthRepository{dbm: pool}
+}
+
+// Register creates the user and their credentials together.
+func (ar *AuthRepository) Register(ctx context.Context, user domain.User, passwordHash string) error {
+	defer metrics.Query("auth", "Register")()
+	tx, err := ar.dbm.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx, "INSERT INTO users (nickname, fullname, about, email) VALUES ($1, $2, $3, $4)",
+		user.Nickname, user.FullName, user.About, user.Email)
+	if pgErr := utils.PgError(err); pgErr != nil && pgErr.Code == utils.UniqueViolation {
+		return domain.NewError(domain.ErrConflict, "User with nickname %s or email %s already exists", user.Nickname, user.Email)
+	}
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(ctx, "INSERT INTO credentials (Nickname, PasswordHash) VALUES ($1, $2)", user.Nickname, passwordHash)
+	if err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+func (ar *AuthRepository) PasswordHash(ctx context.Context, nickname string) (string, string, error) {
+	defer metrics.Query("auth", "PasswordHash")()
+	var registered, hash string
+	err := ar.dbm.QueryRow(ctx, "SELECT Nickname, PasswordHash FROM credentials WHERE Nickname = $1", nickname).Scan(&registered, &hash)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", "", domain.NewError(domain.ErrNotFound, "No credentials for user: %s", nickname)
+	}
+	return registered, hash, err
+}
+
+func (ar *AuthRepository) AddSession(ctx context.Context, nickname string, tokenHash []byte, expires time.Time) error {
+	defer metrics.Query("auth", "AddSession")()
+	// expired sessions of the user are cleaned up on the next login
+	_, err := ar.dbm.Exec(ctx, "DELETE FROM sessions WHERE Nickname = $1 AND Expires <= now()", nickname)
+	if err != nil {
+		return err
+	}
+	_, err = ar.dbm.Exec(ctx, "INSERT INTO sessions (TokenHash, Nickname, Expires) VALUES ($1, $2, $3)", tokenHash, nickname, expires)
+	return err
+}
+
+func (ar *AuthRepository) SessionUser(ctx context.Context, tokenHash []byte) (string, error) {
+	defer metrics.Query("auth", "SessionUser")()
+	var nickname string
+	err := ar.dbm.QueryRow(ctx, "SELECT Nickname FROM sessions WHERE TokenHash = $1 AND Expires > now()", tokenHash).Scan(&nickname)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", domain.NewError(domain.ErrNotFound, "Session not found or expired")
+	}
+	return nickname, err
+}
+
+// Roles treats the owner of a forum as one of its moderators.
+func (ar *AuthRepository) Roles(ctx context.Context, nickname string, forum string) (bool, bool, error) {
+	defer metrics.Query("auth", "Roles")()
+	query := "SELECT COALESCE((SELECT IsAdmin FROM credentials WHERE Nickname = $1), false)," +
+		" EXISTS(SELECT 1 FROM Forum WHERE Slug = $2 AND Usr = $1)" +
+		" OR EXISTS(SELECT 1 FROM forum_moderators WHERE Forum = $2 AND Nickname = $1)"
+	var admin, moderator bool
+	err := ar.dbm.QueryRow(ctx, query, nickname, forum).Scan(&admin, &moderator)
+	return admin, moderator, err
+}
+
+func (ar *AuthRepository) DeleteSession(ctx context.Context, tokenHash []byte) error {
+	defer metrics.Query("auth", "DeleteSession")()
+	_, err := ar.dbm.Exec(ctx, "DELETE FROM sessions WHERE TokenHash = $1", tokenHash)
+	return err
+}
@@ -0,0 +1,76 @@
+//go:build integration
+
+package repository
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"repo/internal/pkg/auth"
+	"repo/internal/pkg/domain"
+	"repo/internal/pkg/testdb"
+)
+
+var db *testdb.Cluster
+
+func TestMain(m *testing.M) {
+	os.Exit(testdb.Main(m, &db))
+}
+
+func TestSessions(t *testing.T) {
+	db.Reset(t)
+	ctx := context.Background()
+	ar := NewAuthRep(db.Pool)
+
+	hash, err := auth.HashPassword("correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = ar.Register(ctx, domain.User{Nickname: "Alice", FullName: "Alice", Email: "alice@example.com"}, hash); err != nil {
+		t.Fatal(err)
+	}
+	if err = ar.Register(ctx, domain.User{Nickname: "alice", FullName: "x", Email: "x@example.com"}, hash); !errors.Is(err, domain.ErrConflict) {
+		t.Errorf("registering a taken nickname = %v", err)
+	}
+	nickname, stored, err := ar.PasswordHash(ctx, "ALICE")
+	if err != nil || nickname != "Alice" || !auth.CheckPassword(stored, "correct horse") {
+		t.Errorf("PasswordHash = %q, %q, %v", nickname, stored, err)
+	}
+	if _, _, err = ar.PasswordHash(ctx, "nobody"); !errors.Is(err, domain.ErrNotFound) {
+		t.Errorf("PasswordHash of a missing user = %v", err)
+	}
+
+	// only the sha256 of the token is stored
+	token, tokenHash, err := auth.NewToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = ar.AddSession(ctx, "Alice", tokenHash, time.Now().Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	var plain int
+	if err = db.Pool.QueryRow(ctx, "SELECT COUNT(*) FROM sessions WHERE TokenHash = $1", []byte(token)).Scan(&plain); err != nil || plain != 0 {
+		t.Errorf("the token is stored as is: %d, %v", plain, err)
+	}
+	if got, err := ar.SessionUser(ctx, auth.HashToken(token)); err != nil || got != "Alice" {
+		t.Errorf("SessionUser = %q, %v", got, err)
+	}
+
+	expired := auth.HashToken("expired")
+	if err = ar.AddSession(ctx, "Alice", expired, time.Now().Add(-time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = ar.SessionUser(ctx, expired); !errors.Is(err, domain.ErrNotFound) {
+		t.Errorf("SessionUser of an expired session = %v", err)
+	}
+
+	if err = ar.DeleteSession(ctx, tokenHash); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = ar.SessionUser(ctx, tokenHash); !errors.Is(err, domain.ErrNotFound) {
+		t.Errorf("SessionUser after logout = %v", err)
+	}
+}
@@ -0,0 +1,244 @@
+// Package bench drives a load of reads and writes against a running forum
+// server and measures it. Everything it writes lives in forums seeded for the
+// run, so that it can check afterwards what the server reports of them.
+package bench
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	mathrand "math/rand"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/valyala/fasthttp"
+	"repo/internal/pkg/config"
+	"repo/internal/pkg/cursor"
+)
+
+// requestTimeout bounds a single request, a server slower than this counts as failing
+const requestTimeout = 10 * time.Second
+
+// Bench is one run: the data it seeded and what it wrote since.
+type Bench struct {
+	cfg    config.Bench
+	target string
+	client *fasthttp.Client
+	mix    []weighted
+	// run prefixes the names of everything seeded, runs against the same server do not collide
+	run string
+
+	users   []string
+	forums  []forum
+	threads []thread
+
+	mu sync.Mutex
+	// posts are the ids created per thread, in the order they were answered
+	posts map[int32][]int64
+	// authors are the users that posted per forum, seeded threads included
+	authors map[string]map[string]bool
+	// votes is the last voice of each user per thread
+	votes map[voteKey]int32
+	// unsure threads saw a write fail in transit, it may or may not have been applied
+	unsure map[int32]bool
+}
+
+type forum struct {
+	slug    string
+	threads int
+}
+
+type thread struct {
+	id    int32
+	forum string
+}
+
+type voteKey struct {
+	user   string
+	thread int32
+}
+
+// New checks the mix of cfg, nothing is sent before Seed.
+func New(cfg config.Bench) (*Bench, error) {
+	mix, err := parseMix(cfg.Mix)
+	if err != nil {
+		return nil, err
+	}
+	run := make([]byte, 3)
+	if _, err = rand.Read(run); err != nil {
+		return nil, err
+	}
+	return &Bench{
+		cfg:     cfg,
+		target:  strings.TrimRight(cfg.Target, "/"),
+		client:  &fasthttp.Client{MaxConnsPerHost: cfg.Concurrency},
+		mix:     mix,
+		run:     hex.EncodeToString(run),
+		posts:   map[int32][]int64{},
+		authors: map[string]map[string]bool{},
+		votes:   map[voteKey]int32{},
+		unsure:  map[int32]bool{},
+	}, nil
+}
+
+// weighted is an operation with the cumulative weight of the mix up to it
+type weighted struct {
+	op  op
+	cum int
+}
+
+// parseMix reads "name=weight,..." into the operations to pick from.
+// Operations left out of the mix are not run.
+func parseMix(s string) ([]weighted, error) {
+	var mix []weighted
+	total := 0
+	seen := map[string]bool{}
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		name, weight := part, "1"
+		if i := strings.IndexByte(part, '='); i >= 0 {
+			name, weight = strings.TrimSpace(part[:i]), strings.TrimSpace(part[i+1:])
+		}
+		o, ok := ops[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown bench operation %q, expected one of %s", name, strings.Join(opNames(), ", "))
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("bench operation %q is weighted twice", name)
+		}
+		seen[name] = true
+		w, err := strconv.Atoi(weight)
+		if err != nil || w < 0 {
+			return nil, fmt.Errorf("invalid weight %q of bench operation %q", weight, name)
+		}
+		if w == 0 {
+			continue
+		}
+		total += w
+		mix = append(mix, weighted{op: o, cum: total})
+	}
+	if total == 0 {
+		return nil, fmt.Errorf("the bench mix %q runs nothing", s)
+	}
+	return mix, nil
+}
+
+func opNames() []string {
+	names := make([]string, 0, len(ops))
+	for name := range ops {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (b *Bench) pick(rnd *mathrand.Rand) op {
+	n := rnd.Intn(b.mix[len(b.mix)-1].cum)
+	i := sort.Search(len(b.mix), func(i int) bool { return b.mix[i].cum > n })
+	return b.mix[i].op
+}
+
+// Run drives the mix with cfg.Concurrency requests in flight until
+// cfg.Duration is over or ctx is done. Seed must have succeeded.
+func (b *Bench) Run(ctx context.Context) Report {
+	ctx, cancel := context.WithTimeout(ctx, b.cfg.Duration)
+	defer cancel()
+
+	workers := make([]*worker, b.cfg.Concurrency)
+	var wg sync.WaitGroup
+	start := time.Now()
+	for i := range workers {
+		w := &worker{
+			b:     b,
+			rnd:   mathrand.New(mathrand.NewSource(time.Now().UnixNano() + int64(i))),
+			stats: map[string]*stats{},
+		}
+		// a user votes from one worker only, the last voice sent is the one kept
+		for u := i; u < len(b.users); u += len(workers) {
+			w.voters = append(w.voters, b.users[u])
+		}
+		workers[i] = w
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for ctx.Err() == nil {
+				b.pick(w.rnd)(w)
+			}
+		}()
+	}
+	wg.Wait()
+
+	merged := map[string]*stats{}
+	for _, w := range workers {
+		for name, st := range w.stats {
+			if merged[name] == nil {
+				merged[name] = &stats{}
+			}
+			merged[name].merge(st)
+		}
+	}
+	return newReport(time.Since(start), merged)
+}
+
+// worker sends one request at a time and keeps the measures of its own
+type worker struct {
+	b      *Bench
+	rnd    *mathrand.Rand
+	stats  map[string]*stats
+	voters []string
+}
+
+// call sends a request and records it under endpoint. A transport error or
+// an answer other than 2xx counts as an error. out is decoded from a 2xx body.
+func (w *worker) call(endpoint, method, path string, body, out interface{}) (int, error) {
+	st := w.stats[endpoint]
+	if st == nil {
+		st = &stats{}
+		w.stats[endpoint] = st
+	}
+	start := time.Now()
+	status, err := w.b.send(method, path, body, out)
+	st.add(time.Since(start), err != nil || status/100 != 2)
+	return status, err
+}
+
+// send is a request outside of the measures. out is decoded from a 2xx body.
+func (b *Bench) send(method, path string, body, out interface{}) (int, error) {
+	status, _, err := b.sendPage(method, path, body, out)
+	return status, err
+}
+
+// sendPage is send returning the next page cursor of a listing as well
+func (b *Bench) sendPage(method, path string, body, out interface{}) (int, string, error) {
+	req, resp := fasthttp.AcquireRequest(), fasthttp.AcquireResponse()
+	defer fasthttp.ReleaseRequest(req)
+	defer fasthttp.ReleaseResponse(resp)
+	req.Header.SetMethod(method)
+	req.SetRequestURI(b.target + path)
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return 0, "", err
+		}
+		req.Header.SetContentType("application/json")
+		req.SetBody(data)
+	}
+	if err := b.client.DoTimeout(req, resp, requestTimeout); err != nil {
+		return 0, "", fmt.Errorf("%s %s: %w", method, path, err)
+	}
+	status := resp.StatusCode()
+	if out != nil && status/100 == 2 {
+		if err := json.Unmarshal(resp.Body(), out); err != nil {
+			return status, "", fmt.Errorf("%s %s: decoding the answer: %w", method, path, err)
+		}
+	}
+	return status, string(resp.Header.Peek(cursor.Header)), nil
+}
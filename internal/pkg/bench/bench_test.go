@@ -0,0 +1,155 @@
+package bench
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fasthttp/router"
+	"github.com/valyala/fasthttp"
+	"github.com/valyala/fasthttp/fasthttputil"
+	"repo/internal/pkg/auth"
+	"repo/internal/pkg/config"
+	"repo/internal/pkg/cursor"
+	forumDelivery "repo/internal/pkg/forum/delivery"
+	"repo/internal/pkg/memory"
+	userDelivery "repo/internal/pkg/user/delivery"
+	"repo/internal/pkg/utils"
+)
+
+func TestParseMix(t *testing.T) {
+	mix, err := parseMix(" vote=2, thread_posts ,status=0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(mix) != 2 || mix[0].cum != 2 || mix[1].cum != 3 {
+		t.Fatalf("got %+v, want vote up to 2 and thread_posts up to 3", mix)
+	}
+
+	for _, bad := range []string{"", "status=0", "nothing=1", "vote=-1", "vote=x", "vote=1,vote=2"} {
+		if _, err := parseMix(bad); err == nil {
+			t.Errorf("parseMix(%q) accepted it", bad)
+		}
+	}
+}
+
+func TestPercentile(t *testing.T) {
+	var sorted []time.Duration
+	for i := 1; i <= 200; i++ {
+		sorted = append(sorted, time.Duration(i))
+	}
+	for p, want := range map[int]time.Duration{50: 100, 95: 190, 99: 198, 100: 200} {
+		if got := percentile(sorted, p); got != want {
+			t.Errorf("p%d = %d, want %d", p, got, want)
+		}
+	}
+	if got := percentile(sorted[:1], 99); got != 1 {
+		t.Errorf("p99 of one latency = %d, want it", got)
+	}
+	if got := percentile(nil, 50); got != 0 {
+		t.Errorf("p50 of nothing = %d, want 0", got)
+	}
+}
+
+// memoryServer serves the user and forum handlers from memory through an in-memory listener
+func memoryServer(t *testing.T) func(string) (net.Conn, error) {
+	t.Helper()
+	store := memory.NewStore()
+	ur := memory.NewUserRep(store)
+	ar := memory.NewAuthRep(store)
+	fr := memory.NewForumRep(store)
+	r := router.New()
+	timeouts := utils.Timeouts{Default: time.Second}
+	authz := auth.NewAuthorizer(&ar, true)
+	userDelivery.NewUserHandler(r, &ur, timeouts, authz)
+	forumDelivery.NewForumHandler(r, &fr, timeouts, cursor.NewCodec("bench"), authz)
+
+	ln := fasthttputil.NewInmemoryListener()
+	srv := &fasthttp.Server{Handler: r.Handler}
+	go srv.Serve(ln)
+	t.Cleanup(func() {
+		srv.Shutdown()
+		ln.Close()
+	})
+	return func(string) (net.Conn, error) { return ln.Dial() }
+}
+
+func TestRunAndCheck(t *testing.T) {
+	cfg := config.Default().Bench
+	cfg.Target = "http://forum/"
+	cfg.Concurrency = 4
+	cfg.Duration = 300 * time.Millisecond
+	cfg.Users, cfg.Forums, cfg.Threads = 6, 2, 5
+	cfg.Batch = 3
+	cfg.Mix = "post_create=3,vote=3,thread_posts=1,post_details=1,forum_users=1"
+	b, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.client.Dial = memoryServer(t)
+
+	ctx := context.Background()
+	if err = b.Seed(ctx); err != nil {
+		t.Fatal(err)
+	}
+	report := b.Run(ctx)
+	if report.Total.Requests == 0 {
+		t.Fatal("no request was sent")
+	}
+	if report.Total.Errors != 0 {
+		t.Errorf("%d requests failed", report.Total.Errors)
+	}
+	for _, e := range report.Endpoints {
+		if e.P50 > e.P95 || e.P95 > e.P99 {
+			t.Errorf("%s: percentiles out of order: %s %s %s", e.Name, e.P50, e.P95, e.P99)
+		}
+	}
+	var out bytes.Buffer
+	if err = report.Print(&out); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "post_create") || !strings.Contains(out.String(), "total") {
+		t.Errorf("report misses rows:\n%s", out.String())
+	}
+
+	problems, err := b.Check(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range problems {
+		t.Error(p)
+	}
+	if len(b.posts) == 0 || len(b.votes) == 0 {
+		t.Errorf("nothing was written to check: %d threads with posts, %d votes", len(b.posts), len(b.votes))
+	}
+}
+
+func TestCheckReportsDifferences(t *testing.T) {
+	cfg := config.Default().Bench
+	cfg.Target = "http://forum"
+	cfg.Users, cfg.Forums, cfg.Threads = 2, 1, 1
+	b, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.client.Dial = memoryServer(t)
+	ctx := context.Background()
+	if err = b.Seed(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// a vote and a post the server never saw
+	id := b.threads[0].id
+	b.votes[voteKey{user: b.users[0], thread: id}] = 1
+	b.posts[id] = []int64{42}
+	problems, err := b.Check(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(problems) != 3 {
+		t.Errorf("got %q, want the posts of the forum, the votes and the post of the thread", problems)
+	}
+}
@@ -0,0 +1,166 @@
+package bench
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+
+	"repo/internal/pkg/domain"
+)
+
+// checkPage is the page size of the listings read by Check
+const checkPage = 100
+
+// Check compares what the server serves of the seeded forums with what the
+// run wrote, and returns the differences. Threads that saw a write fail in
+// transit are left out, the write may or may not have been applied.
+func (b *Bench) Check(ctx context.Context) ([]string, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var problems []string
+	report := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	unsureForums := map[string]bool{}
+	posts := map[string]int64{}
+	for _, t := range b.threads {
+		if b.unsure[t.id] {
+			unsureForums[t.forum] = true
+		}
+		posts[t.forum] += int64(len(b.posts[t.id]))
+	}
+
+	for _, f := range b.forums {
+		var got domain.Forum
+		if err := b.get(ctx, fmt.Sprintf("/api/forum/%s/details", f.slug), &got); err != nil {
+			return problems, err
+		}
+		if got.Threads != int32(f.threads) {
+			report("forum %s: %d threads, want %d", f.slug, got.Threads, f.threads)
+		}
+		if unsureForums[f.slug] {
+			continue
+		}
+		if got.Posts != posts[f.slug] {
+			report("forum %s: %d posts, want %d", f.slug, got.Posts, posts[f.slug])
+		}
+
+		var page, users []domain.User
+		path := fmt.Sprintf("/api/forum/%s/users?limit=%d", f.slug, checkPage)
+		if err := b.pages(ctx, path, &page, func() { users = append(users, page...) }); err != nil {
+			return problems, err
+		}
+		if len(users) != len(b.authors[f.slug]) {
+			report("forum %s: %d users, want %d", f.slug, len(users), len(b.authors[f.slug]))
+		}
+		for _, u := range users {
+			if !b.authors[f.slug][u.Nickname] {
+				report("forum %s: lists user %s who did not post in it", f.slug, u.Nickname)
+			}
+		}
+	}
+
+	votes := map[int32]int32{}
+	for key, voice := range b.votes {
+		votes[key.thread] += voice
+	}
+	for _, t := range b.threads {
+		if b.unsure[t.id] {
+			continue
+		}
+		var got domain.Thread
+		if err := b.get(ctx, fmt.Sprintf("/api/thread/%d/details", t.id), &got); err != nil {
+			return problems, err
+		}
+		if got.Votes != votes[t.id] {
+			report("thread %d: %d votes, want %d", t.id, got.Votes, votes[t.id])
+		}
+		if err := b.checkTree(ctx, t, report); err != nil {
+			return problems, err
+		}
+	}
+	return problems, nil
+}
+
+// checkTree reads the posts of t in tree order: every post created must be
+// listed once, after its parent.
+func (b *Bench) checkTree(ctx context.Context, t thread, report func(string, ...interface{})) error {
+	var page, listed []domain.Post
+	path := fmt.Sprintf("/api/thread/%d/posts?sort=tree&limit=%d", t.id, checkPage)
+	if err := b.pages(ctx, path, &page, func() { listed = append(listed, page...) }); err != nil {
+		return err
+	}
+
+	want := map[int64]bool{}
+	for _, id := range b.posts[t.id] {
+		want[id] = true
+	}
+	seen := map[int64]bool{}
+	for _, p := range listed {
+		switch {
+		case seen[p.Id]:
+			report("thread %d: post %d is listed twice", t.id, p.Id)
+		case !want[p.Id]:
+			report("thread %d: lists post %d that was not created in it", t.id, p.Id)
+		case p.Parent != 0 && !seen[p.Parent]:
+			report("thread %d: post %d is listed before its parent %d", t.id, p.Id, p.Parent)
+		}
+		seen[p.Id] = true
+	}
+	var missing []int64
+	for id := range want {
+		if !seen[id] {
+			missing = append(missing, id)
+		}
+	}
+	if len(missing) > 0 {
+		sort.Slice(missing, func(i, j int) bool { return missing[i] < missing[j] })
+		report("thread %d: %d posts are not listed, first %d", t.id, len(missing), missing[0])
+	}
+	return nil
+}
+
+// get reads path, which must answer 200
+func (b *Bench) get(ctx context.Context, path string, out interface{}) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	status, err := b.send(http.MethodGet, path, nil, out)
+	if err != nil {
+		return fmt.Errorf("checking: %w", err)
+	}
+	if status != http.StatusOK {
+		return fmt.Errorf("checking: GET %s answered %d", path, status)
+	}
+	return nil
+}
+
+// pages reads a listing page by page into out, following the next page
+// cursors, and calls add after each page.
+func (b *Bench) pages(ctx context.Context, path string, out interface{}, add func()) error {
+	next := ""
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		page := path
+		if next != "" {
+			page += "&cursor=" + url.QueryEscape(next)
+		}
+		status, cur, err := b.sendPage(http.MethodGet, page, nil, out)
+		if err != nil {
+			return fmt.Errorf("checking: %w", err)
+		}
+		if status != http.StatusOK {
+			return fmt.Errorf("checking: GET %s answered %d", page, status)
+		}
+		add()
+		if cur == "" {
+			return nil
+		}
+		next = cur
+	}
+}
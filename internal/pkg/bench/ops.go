@@ -0,0 +1,142 @@
+package bench
+
+import (
+	"fmt"
+	"net/http"
+
+	"repo/internal/pkg/domain"
+)
+
+// op sends one request of the mix
+type op func(w *worker)
+
+// ops are the operations a mix may weigh, by the endpoint name they are reported under
+var ops = map[string]op{
+	"post_create":    postCreate,
+	"vote":           vote,
+	"forum_details":  forumDetails,
+	"forum_users":    forumUsers,
+	"forum_threads":  forumThreads,
+	"thread_details": threadDetails,
+	"thread_posts":   threadPosts,
+	"post_details":   postDetails,
+	"user_profile":   userProfile,
+	"status":         serviceStatus,
+}
+
+var postSorts = []string{"flat", "tree", "parent_tree"}
+
+func (w *worker) thread() thread {
+	return w.b.threads[w.rnd.Intn(len(w.b.threads))]
+}
+
+func (w *worker) forum() forum {
+	return w.b.forums[w.rnd.Intn(len(w.b.forums))]
+}
+
+func (w *worker) user() string {
+	return w.b.users[w.rnd.Intn(len(w.b.users))]
+}
+
+func (w *worker) desc() bool {
+	return w.rnd.Intn(2) == 0
+}
+
+// postCreate adds a batch of posts to a thread, half of them replying to a
+// post created earlier in it.
+func postCreate(w *worker) {
+	t := w.thread()
+	w.b.mu.Lock()
+	known := w.b.posts[t.id]
+	w.b.mu.Unlock()
+
+	batch := make([]domain.Post, w.b.cfg.Batch)
+	for i := range batch {
+		batch[i] = domain.Post{Author: w.user(), Message: fmt.Sprintf("bench %s post %d", w.b.run, w.rnd.Int63())}
+		if len(known) > 0 && w.rnd.Intn(2) == 0 {
+			batch[i].Parent = known[w.rnd.Intn(len(known))]
+		}
+	}
+	var created []domain.Post
+	status, err := w.call("post_create", http.MethodPost, fmt.Sprintf("/api/thread/%d/create", t.id), batch, &created)
+
+	w.b.mu.Lock()
+	defer w.b.mu.Unlock()
+	switch {
+	case err != nil:
+		w.b.unsure[t.id] = true
+	case status == http.StatusCreated:
+		for _, p := range created {
+			w.b.posts[t.id] = append(w.b.posts[t.id], p.Id)
+			w.b.authors[t.forum][p.Author] = true
+		}
+	}
+}
+
+// vote sends the voice of one of the users of the worker, a worker without
+// users of its own reads the thread instead.
+func vote(w *worker) {
+	if len(w.voters) == 0 {
+		threadDetails(w)
+		return
+	}
+	t := w.thread()
+	v := domain.Vote{Nickname: w.voters[w.rnd.Intn(len(w.voters))], Voice: 1}
+	if w.rnd.Intn(3) == 0 {
+		v.Voice = -1
+	}
+	status, err := w.call("vote", http.MethodPost, fmt.Sprintf("/api/thread/%d/vote", t.id), v, nil)
+
+	w.b.mu.Lock()
+	defer w.b.mu.Unlock()
+	switch {
+	case err != nil:
+		w.b.unsure[t.id] = true
+	case status == http.StatusOK:
+		w.b.votes[voteKey{user: v.Nickname, thread: t.id}] = v.Voice
+	}
+}
+
+func forumDetails(w *worker) {
+	w.call("forum_details", http.MethodGet, fmt.Sprintf("/api/forum/%s/details", w.forum().slug), nil, nil)
+}
+
+func forumUsers(w *worker) {
+	w.call("forum_users", http.MethodGet, fmt.Sprintf("/api/forum/%s/users?limit=20&desc=%t", w.forum().slug, w.desc()), nil, nil)
+}
+
+func forumThreads(w *worker) {
+	w.call("forum_threads", http.MethodGet, fmt.Sprintf("/api/forum/%s/threads?limit=20&desc=%t", w.forum().slug, w.desc()), nil, nil)
+}
+
+func threadDetails(w *worker) {
+	w.call("thread_details", http.MethodGet, fmt.Sprintf("/api/thread/%d/details", w.thread().id), nil, nil)
+}
+
+func threadPosts(w *worker) {
+	sort := postSorts[w.rnd.Intn(len(postSorts))]
+	w.call("thread_posts", http.MethodGet, fmt.Sprintf("/api/thread/%d/posts?limit=20&sort=%s&desc=%t", w.thread().id, sort, w.desc()), nil, nil)
+}
+
+// postDetails reads a post created by the run with everything related to it,
+// until there is one it reads a thread instead.
+func postDetails(w *worker) {
+	t := w.thread()
+	w.b.mu.Lock()
+	known := w.b.posts[t.id]
+	w.b.mu.Unlock()
+	if len(known) == 0 {
+		threadDetails(w)
+		return
+	}
+	id := known[w.rnd.Intn(len(known))]
+	w.call("post_details", http.MethodGet, fmt.Sprintf("/api/post/%d/details?related=user,forum,thread", id), nil, nil)
+}
+
+func userProfile(w *worker) {
+	w.call("user_profile", http.MethodGet, fmt.Sprintf("/api/user/%s/profile", w.user()), nil, nil)
+}
+
+func serviceStatus(w *worker) {
+	w.call("status", http.MethodGet, "/api/service/status", nil, nil)
+}
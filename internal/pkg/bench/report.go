@@ -0,0 +1,112 @@
+package bench
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"text/tabwriter"
+	"time"
+)
+
+// stats are the measures of one endpoint
+type stats struct {
+	latencies []time.Duration
+	errors    int
+}
+
+func (s *stats) add(latency time.Duration, failed bool) {
+	s.latencies = append(s.latencies, latency)
+	if failed {
+		s.errors++
+	}
+}
+
+func (s *stats) merge(other *stats) {
+	s.latencies = append(s.latencies, other.latencies...)
+	s.errors += other.errors
+}
+
+// Endpoint sums up the requests of one endpoint, errors included in the latencies.
+type Endpoint struct {
+	Name     string
+	Requests int
+	Errors   int
+	// Throughput is in requests per second over the whole run
+	Throughput    float64
+	P50, P95, P99 time.Duration
+}
+
+// Report is the outcome of Run, endpoints by name and their total.
+type Report struct {
+	Elapsed   time.Duration
+	Endpoints []Endpoint
+	Total     Endpoint
+}
+
+func newReport(elapsed time.Duration, byName map[string]*stats) Report {
+	r := Report{Elapsed: elapsed}
+	all := &stats{}
+	for name, st := range byName {
+		r.Endpoints = append(r.Endpoints, summarize(name, st, elapsed))
+		all.merge(st)
+	}
+	sort.Slice(r.Endpoints, func(i, j int) bool { return r.Endpoints[i].Name < r.Endpoints[j].Name })
+	r.Total = summarize("total", all, elapsed)
+	return r
+}
+
+func summarize(name string, st *stats, elapsed time.Duration) Endpoint {
+	sort.Slice(st.latencies, func(i, j int) bool { return st.latencies[i] < st.latencies[j] })
+	e := Endpoint{
+		Name:     name,
+		Requests: len(st.latencies),
+		Errors:   st.errors,
+		P50:      percentile(st.latencies, 50),
+		P95:      percentile(st.latencies, 95),
+		P99:      percentile(st.latencies, 99),
+	}
+	if elapsed > 0 {
+		e.Throughput = float64(e.Requests) / elapsed.Seconds()
+	}
+	return e
+}
+
+// percentile is the nearest-rank percentile p of sorted latencies
+func percentile(sorted []time.Duration, p int) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := (p*len(sorted) + 99) / 100
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
+
+// Print writes the report as a table, one endpoint per row.
+func (r Report) Print(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintf(tw, "endpoint\trequests\terrors\treq/s\tp50\tp95\tp99\t\n")
+	rows := append(append([]Endpoint(nil), r.Endpoints...), r.Total)
+	for _, e := range rows {
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%.1f\t%s\t%s\t%s\t\n", e.Name, e.Requests, e.Errors, e.Throughput,
+			round(e.P50), round(e.P95), round(e.P99))
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintf(w, "elapsed %s\n", r.Elapsed.Round(time.Millisecond))
+	return err
+}
+
+// round keeps three significant digits or so of a latency
+func round(d time.Duration) time.Duration {
+	switch {
+	case d >= time.Second:
+		return d.Round(time.Millisecond)
+	case d >= time.Millisecond:
+		return d.Round(10 * time.Microsecond)
+	default:
+		return d.Round(time.Microsecond)
+	}
+}
@@ -0,0 +1,67 @@
+package bench
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"repo/internal/pkg/domain"
+)
+
+// Seed creates the users, forums and threads of the run, named after it.
+// Forums and threads go to the seeded users in turn.
+func (b *Bench) Seed(ctx context.Context) error {
+	for i := 0; i < b.cfg.Users; i++ {
+		nickname := fmt.Sprintf("b%s_u%d", b.run, i)
+		user := domain.User{Nickname: nickname, FullName: "Bench user " + nickname, Email: nickname + "@bench.example"}
+		if err := b.seed(ctx, "/api/user/"+nickname+"/create", user, nil); err != nil {
+			return err
+		}
+		b.users = append(b.users, nickname)
+	}
+
+	for i := 0; i < b.cfg.Forums; i++ {
+		f := domain.Forum{Title: fmt.Sprintf("Bench forum %d", i), User: b.users[i%len(b.users)], Slug: fmt.Sprintf("b%s-f%d", b.run, i)}
+		if err := b.seed(ctx, "/api/forum/create", f, nil); err != nil {
+			return err
+		}
+		b.forums = append(b.forums, forum{slug: f.Slug})
+		b.authors[f.Slug] = map[string]bool{}
+	}
+
+	for i := 0; i < b.cfg.Threads; i++ {
+		f := &b.forums[i%len(b.forums)]
+		t := domain.Thread{
+			Title:   fmt.Sprintf("Bench thread %d", i),
+			Forum:   f.slug,
+			Author:  b.users[i%len(b.users)],
+			Message: "bench " + b.run,
+			Slug:    fmt.Sprintf("b%s-t%d", b.run, i),
+			Created: time.Now(),
+		}
+		var created domain.Thread
+		if err := b.seed(ctx, "/api/forum/"+f.slug+"/create", t, &created); err != nil {
+			return err
+		}
+		f.threads++
+		b.threads = append(b.threads, thread{id: created.Id, forum: f.slug})
+		b.authors[f.slug][t.Author] = true
+	}
+	return nil
+}
+
+// seed sends a creation that must succeed
+func (b *Bench) seed(ctx context.Context, path string, body, out interface{}) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	status, err := b.send(http.MethodPost, path, body, out)
+	if err != nil {
+		return fmt.Errorf("seeding: %w", err)
+	}
+	if status != http.StatusCreated {
+		return fmt.Errorf("seeding: POST %s answered %d", path, status)
+	}
+	return nil
+}
@@ -0,0 +1,318 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog"
+	"gopkg.in/yaml.v3"
+)
+
+// EnvPrefix is prepended to every environment variable read by Load.
+const EnvPrefix = "FORUM_"
+
+const mask = "******"
+
+type DB struct {
+	User     string `yaml:"user"`
+	Host     string `yaml:"host"`
+	Port     int    `yaml:"port"`
+	Pass     string `yaml:"password"`
+	Name     string `yaml:"name"`
+	MaxConns int32  `yaml:"max_conns"`
+	// Profile is the storage profile migrations converge the schema to, bench (unlogged tables) or durable.
+	// When empty migrate up keeps the profile the schema is in.
+	Profile string `yaml:"profile"`
+}
+
+type Server struct {
+	Addr string `yaml:"addr"`
+	// DrainDelay is how long the server reports not ready before it stops accepting connections.
+	DrainDelay      time.Duration `yaml:"drain_delay"`
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout"`
+	// ReadyTimeout bounds each check of /readyz.
+	ReadyTimeout time.Duration `yaml:"ready_timeout"`
+	// RequestTimeout bounds the database work of a request, RouteTimeouts overrides it per route pattern.
+	RequestTimeout time.Duration            `yaml:"request_timeout"`
+	RouteTimeouts  map[string]time.Duration `yaml:"route_timeouts"`
+	// CursorSecret signs pagination cursors. When empty a random secret is used
+	// and cursors do not survive a restart or work across instances.
+	CursorSecret string `yaml:"cursor_secret"`
+}
+
+type Auth struct {
+	// SessionTTL is how long a login stays valid.
+	SessionTTL time.Duration `yaml:"session_ttl"`
+	// SecureCookie marks the session cookie Secure, enable it when served over HTTPS.
+	SecureCookie bool `yaml:"secure_cookie"`
+	// Enforce turns on the ownership checks of edits. Without it anyone may edit
+	// anything, as the original API allowed.
+	Enforce bool `yaml:"enforce"`
+}
+
+type Log struct {
+	// Level is the minimum level written: debug, info, warn or error.
+	Level string `yaml:"level"`
+	// Sample logs one in Sample successful requests to the access log, 0 or 1 logs all of them.
+	Sample int `yaml:"sample"`
+}
+
+// Bench configures the bench command, a load generator run against a server.
+type Bench struct {
+	// Target is the base URL of the server under load.
+	Target string `yaml:"target"`
+	// Concurrency is the number of requests in flight.
+	Concurrency int           `yaml:"concurrency"`
+	Duration    time.Duration `yaml:"duration"`
+	// Users, Forums and Threads are seeded before the load starts.
+	Users   int `yaml:"users"`
+	Forums  int `yaml:"forums"`
+	Threads int `yaml:"threads"`
+	// Batch is the number of posts created per request.
+	Batch int `yaml:"batch"`
+	// Mix weighs the endpoints driven, e.g. "post_create=1,thread_posts=4".
+	Mix string `yaml:"mix"`
+	// Check compares the counters and listings served afterwards with what was written.
+	Check bool `yaml:"check"`
+}
+
+// Config is the effective configuration of the service.
+// Values are resolved with the precedence defaults < config file < environment < flags.
+type Config struct {
+	// Storage is where the data lives: postgres, or memory for tests and demos.
+	Storage string `yaml:"storage"`
+	DB      DB     `yaml:"db"`
+	Server  Server `yaml:"server"`
+	Auth    Auth   `yaml:"auth"`
+	Log     Log    `yaml:"log"`
+	Bench   Bench  `yaml:"bench"`
+
+	// PrintConfig asks main to dump the effective config and exit.
+	PrintConfig bool `yaml:"-"`
+	// Args are the positional arguments left after the flags.
+	Args []string `yaml:"-"`
+}
+
+func Default() Config {
+	return Config{
+		Storage: "postgres",
+		DB: DB{
+			User:     "docker",
+			Host:     "localhost",
+			Port:     5432,
+			Pass:     "docker",
+			Name:     "docker",
+			MaxConns: 100,
+		},
+		Server: Server{
+			Addr:            ":5000",
+			ShutdownTimeout: 15 * time.Second,
+			ReadyTimeout:    time.Second,
+			RequestTimeout:  5 * time.Second,
+		},
+		Auth: Auth{
+			SessionTTL: 30 * 24 * time.Hour,
+			Enforce:    true,
+		},
+		Log: Log{
+			Level: "info",
+		},
+		Bench: Bench{
+			Target:      "http://localhost:5000",
+			Concurrency: 16,
+			Duration:    30 * time.Second,
+			Users:       100,
+			Forums:      5,
+			Threads:     50,
+			Batch:       10,
+			Mix:         "post_create=10,vote=10,thread_details=15,thread_posts=25,forum_details=10,forum_threads=10,forum_users=5,post_details=10,user_profile=5",
+		},
+	}
+}
+
+// ConnString is a postgres:// URL, so values with spaces, quotes or @ need no
+// quoting in the config. A host starting with / is a unix socket directory.
+func (db DB) ConnString() string {
+	u := url.URL{
+		Scheme: "postgres",
+		User:   url.UserPassword(db.User, db.Pass),
+		Host:   net.JoinHostPort(db.Host, strconv.Itoa(db.Port)),
+		Path:   "/" + db.Name,
+	}
+	if strings.HasPrefix(db.Host, "/") {
+		u.Host = ""
+		u.RawQuery = url.Values{"host": {db.Host}, "port": {strconv.Itoa(db.Port)}}.Encode()
+	}
+	return u.String()
+}
+
+// Load builds the config from the command line arguments (without the program name),
+// the file passed with --config (or FORUM_CONFIG) and FORUM_* environment variables.
+func Load(args []string) (Config, error) {
+	cfg := Default()
+	opts := options(&cfg)
+
+	fs := flag.NewFlagSet("forum", flag.ContinueOnError)
+	path := fs.String("config", os.Getenv(EnvPrefix+"CONFIG"), "path to the YAML config file")
+	fs.BoolVar(&cfg.PrintConfig, "print-config", false, "print the effective config with secrets masked and exit")
+	// flags are only recorded here and applied after the file and environment
+	flagValues := map[string]string{}
+	for _, opt := range opts {
+		name := opt.flag
+		fs.Func(name, opt.usage+" (env "+EnvPrefix+opt.env+")", func(s string) error {
+			flagValues[name] = s
+			return nil
+		})
+	}
+	if err := fs.Parse(args); err != nil {
+		return Config{}, err
+	}
+	cfg.Args = fs.Args()
+
+	if *path != "" {
+		if err := cfg.loadFile(*path); err != nil {
+			return Config{}, err
+		}
+	}
+	for _, opt := range opts {
+		env, ok := os.LookupEnv(EnvPrefix + opt.env)
+		if !ok {
+			continue
+		}
+		if err := opt.set(env); err != nil {
+			return Config{}, fmt.Errorf("env %s%s: %w", EnvPrefix, opt.env, err)
+		}
+	}
+	for _, opt := range opts {
+		value, ok := flagValues[opt.flag]
+		if !ok {
+			continue
+		}
+		if err := opt.set(value); err != nil {
+			return Config{}, fmt.Errorf("flag --%s: %w", opt.flag, err)
+		}
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return Config{}, err
+	}
+	return cfg, nil
+}
+
+// loadFile reads a YAML config file. TOML is not supported, a file of another
+// extension is rejected rather than misread.
+func (c *Config) loadFile(path string) error {
+	if ext := filepath.Ext(path); ext != ".yaml" && ext != ".yml" {
+		return fmt.Errorf("config file %s: only YAML (.yaml, .yml) is supported, got %q", path, ext)
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("config file: %w", err)
+	}
+	if err = yaml.Unmarshal(data, c); err != nil {
+		return fmt.Errorf("config file %s: %w", path, err)
+	}
+	return nil
+}
+
+func (c Config) Validate() error {
+	var errs []error
+	if c.Storage != "postgres" && c.Storage != "memory" {
+		errs = append(errs, fmt.Errorf("storage must be postgres or memory, got %q", c.Storage))
+	}
+	if c.DB.User == "" {
+		errs = append(errs, errors.New("db.user must be set"))
+	}
+	if c.DB.Host == "" {
+		errs = append(errs, errors.New("db.host must be set"))
+	}
+	if c.DB.Name == "" {
+		errs = append(errs, errors.New("db.name must be set"))
+	}
+	if c.DB.Port <= 0 || c.DB.Port > 65535 {
+		errs = append(errs, fmt.Errorf("db.port %d is out of range", c.DB.Port))
+	}
+	if c.DB.MaxConns < 1 {
+		errs = append(errs, fmt.Errorf("db.max_conns must be positive, got %d", c.DB.MaxConns))
+	}
+	if c.DB.Profile != "" && c.DB.Profile != "bench" && c.DB.Profile != "durable" {
+		errs = append(errs, fmt.Errorf("db.profile must be empty, bench or durable, got %q", c.DB.Profile))
+	}
+	if _, _, err := net.SplitHostPort(c.Server.Addr); err != nil {
+		errs = append(errs, fmt.Errorf("server.addr: %w", err))
+	}
+	if c.Server.DrainDelay < 0 {
+		errs = append(errs, errors.New("server.drain_delay must not be negative"))
+	}
+	if c.Server.ShutdownTimeout <= 0 {
+		errs = append(errs, errors.New("server.shutdown_timeout must be positive"))
+	}
+	if c.Server.ReadyTimeout <= 0 {
+		errs = append(errs, errors.New("server.ready_timeout must be positive"))
+	}
+	if c.Server.RequestTimeout < 0 {
+		errs = append(errs, errors.New("server.request_timeout must not be negative"))
+	}
+	for route, d := range c.Server.RouteTimeouts {
+		if d < 0 {
+			errs = append(errs, fmt.Errorf("server.route_timeouts[%s] must not be negative", route))
+		}
+	}
+	if c.Auth.SessionTTL <= 0 {
+		errs = append(errs, errors.New("auth.session_ttl must be positive"))
+	}
+	if _, err := zerolog.ParseLevel(c.Log.Level); err != nil || c.Log.Level == "" {
+		errs = append(errs, fmt.Errorf("log.level %q is not a level", c.Log.Level))
+	}
+	if c.Log.Sample < 0 {
+		errs = append(errs, errors.New("log.sample must not be negative"))
+	}
+	if c.Bench.Concurrency < 1 {
+		errs = append(errs, fmt.Errorf("bench.concurrency must be positive, got %d", c.Bench.Concurrency))
+	}
+	if c.Bench.Duration <= 0 {
+		errs = append(errs, errors.New("bench.duration must be positive"))
+	}
+	if c.Bench.Users < 1 || c.Bench.Forums < 1 || c.Bench.Threads < 1 {
+		errs = append(errs, errors.New("bench.users, bench.forums and bench.threads must be positive"))
+	}
+	if c.Bench.Batch < 1 {
+		errs = append(errs, fmt.Errorf("bench.batch must be positive, got %d", c.Bench.Batch))
+	}
+	if len(errs) == 0 {
+		return nil
+	}
+	msg := "invalid config:"
+	for _, err := range errs {
+		msg += "\n\t" + err.Error()
+	}
+	return errors.New(msg)
+}
+
+// Masked returns a copy safe for printing.
+func (c Config) Masked() Config {
+	if c.DB.Pass != "" {
+		c.DB.Pass = mask
+	}
+	if c.Server.CursorSecret != "" {
+		c.Server.CursorSecret = mask
+	}
+	return c
+}
+
+func (c Config) String() string {
+	out, err := yaml.Marshal(c.Masked())
+	if err != nil {
+		return err.Error()
+	}
+	return string(out)
+}
@@ -0,0 +1,192 @@
+package config
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+func writeFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "forum.yaml")
+	if err := ioutil.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestPrecedence(t *testing.T) {
+	path := writeFile(t, `
+db:
+  host: file
+  port: 6000
+  name: filedb
+  profile: durable
+server:
+  route_timeouts:
+    /api/forum/create: 2s
+`)
+	t.Setenv(EnvPrefix+"DB_HOST", "env")
+	t.Setenv(EnvPrefix+"DB_PORT", "7000")
+	t.Setenv(EnvPrefix+"DB_MAX_CONNS", "20")
+	t.Setenv(EnvPrefix+"LOG_LEVEL", "warn")
+
+	cfg, err := Load([]string{"--config", path, "--db-host=flag", "--addr=:8080", "--auth-enforce=false", "migrate", "up"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		name      string
+		got, want interface{}
+	}{
+		{"default", cfg.DB.User, "docker"},
+		{"file over default", cfg.DB.Name, "filedb"},
+		{"file over default", cfg.DB.Profile, "durable"},
+		{"file over default", cfg.Server.RouteTimeouts, map[string]time.Duration{"/api/forum/create": 2 * time.Second}},
+		{"env over file", cfg.DB.Port, 7000},
+		{"env over default", cfg.DB.MaxConns, int32(20)},
+		{"env over default", cfg.Log.Level, "warn"},
+		{"flag over env", cfg.DB.Host, "flag"},
+		{"flag over default", cfg.Server.Addr, ":8080"},
+		{"flag over default", cfg.Auth.Enforce, false},
+		{"positional arguments", cfg.Args, []string{"migrate", "up"}},
+	}
+	for _, c := range cases {
+		if !reflect.DeepEqual(c.got, c.want) {
+			t.Errorf("%s: got %v, want %v", c.name, c.got, c.want)
+		}
+	}
+}
+
+func TestConfigFromEnv(t *testing.T) {
+	t.Setenv(EnvPrefix+"CONFIG", writeFile(t, "db:\n  name: fromenv\n"))
+	cfg, err := Load(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.DB.Name != "fromenv" {
+		t.Errorf("db.name = %q, want the one of the %sCONFIG file", cfg.DB.Name, EnvPrefix)
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	cases := []struct {
+		name string
+		args []string
+		env  map[string]string
+		want string
+	}{
+		{"missing file", []string{"--config", filepath.Join(t.TempDir(), "missing.yaml")}, nil, "config file"},
+		{"bad yaml", []string{"--config", writeFile(t, "db: [")}, nil, "forum.yaml"},
+		{"toml", []string{"--config", filepath.Join(t.TempDir(), "forum.toml")}, nil, "only YAML"},
+		{"bad env", nil, map[string]string{"DB_PORT": "many"}, "env " + EnvPrefix + "DB_PORT"},
+		{"bad flag", []string{"--request-timeout=soon"}, nil, "flag --request-timeout"},
+		{"unknown flag", []string{"--no-such-flag"}, nil, "no-such-flag"},
+		{"invalid value", []string{"--db-profile=fast"}, nil, "invalid config"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			for k, v := range c.env {
+				t.Setenv(EnvPrefix+k, v)
+			}
+			_, err := Load(c.args)
+			if err == nil || !strings.Contains(err.Error(), c.want) {
+				t.Errorf("%s: Load = %v, want an error mentioning %q", c.name, err, c.want)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	cases := []struct {
+		name   string
+		change func(*Config)
+		want   string
+	}{
+		{"defaults", func(*Config) {}, ""},
+		{"memory storage", func(c *Config) { c.Storage = "memory" }, ""},
+		{"storage", func(c *Config) { c.Storage = "sqlite" }, `storage must be postgres or memory, got "sqlite"`},
+		{"db.user", func(c *Config) { c.DB.User = "" }, "db.user must be set"},
+		{"db.host", func(c *Config) { c.DB.Host = "" }, "db.host must be set"},
+		{"db.name", func(c *Config) { c.DB.Name = "" }, "db.name must be set"},
+		{"db.port", func(c *Config) { c.DB.Port = 70000 }, "db.port 70000 is out of range"},
+		{"db.max_conns", func(c *Config) { c.DB.MaxConns = 0 }, "db.max_conns must be positive, got 0"},
+		{"db.profile empty", func(c *Config) { c.DB.Profile = "" }, ""},
+		{"db.profile bench", func(c *Config) { c.DB.Profile = "bench" }, ""},
+		{"db.profile durable", func(c *Config) { c.DB.Profile = "durable" }, ""},
+		{"db.profile", func(c *Config) { c.DB.Profile = "fast" }, `db.profile must be empty, bench or durable, got "fast"`},
+		{"server.addr", func(c *Config) { c.Server.Addr = "5000" }, "server.addr"},
+		{"server.drain_delay", func(c *Config) { c.Server.DrainDelay = -time.Second }, "server.drain_delay must not be negative"},
+		{"server.shutdown_timeout", func(c *Config) { c.Server.ShutdownTimeout = 0 }, "server.shutdown_timeout must be positive"},
+		{"server.ready_timeout", func(c *Config) { c.Server.ReadyTimeout = 0 }, "server.ready_timeout must be positive"},
+		{"server.request_timeout", func(c *Config) { c.Server.RequestTimeout = -time.Second }, "server.request_timeout must not be negative"},
+		{"server.route_timeouts", func(c *Config) { c.Server.RouteTimeouts = map[string]time.Duration{"/api/x": -1} }, "server.route_timeouts[/api/x] must not be negative"},
+		{"auth.session_ttl", func(c *Config) { c.Auth.SessionTTL = 0 }, "auth.session_ttl must be positive"},
+		{"log.level", func(c *Config) { c.Log.Level = "loud" }, `log.level "loud" is not a level`},
+		{"log.level empty", func(c *Config) { c.Log.Level = "" }, `log.level "" is not a level`},
+		{"log.sample", func(c *Config) { c.Log.Sample = -1 }, "log.sample must not be negative"},
+		{"bench.concurrency", func(c *Config) { c.Bench.Concurrency = 0 }, "bench.concurrency must be positive, got 0"},
+		{"bench.duration", func(c *Config) { c.Bench.Duration = 0 }, "bench.duration must be positive"},
+		{"bench.users", func(c *Config) { c.Bench.Forums = 0 }, "bench.users, bench.forums and bench.threads must be positive"},
+		{"bench.batch", func(c *Config) { c.Bench.Batch = 0 }, "bench.batch must be positive, got 0"},
+	}
+	for _, c := range cases {
+		cfg := Default()
+		c.change(&cfg)
+		err := cfg.Validate()
+		switch {
+		case c.want == "" && err != nil:
+			t.Errorf("%s: Validate = %v, want nil", c.name, err)
+		case c.want != "" && (err == nil || !strings.Contains(err.Error(), "\n\t"+c.want)):
+			t.Errorf("%s: Validate = %v, want %q", c.name, err, c.want)
+		}
+	}
+}
+
+func TestValidateListsEveryError(t *testing.T) {
+	cfg := Default()
+	cfg.DB.Port = 0
+	cfg.Server.Addr = ""
+	want := "invalid config:\n\tdb.port 0 is out of range\n\tserver.addr: missing port in address"
+	if err := cfg.Validate(); err == nil || err.Error() != want {
+		t.Errorf("Validate = %v, want %q", err, want)
+	}
+}
+
+func TestMasked(t *testing.T) {
+	cfg := Default()
+	cfg.Server.CursorSecret = "s3cret"
+	out := cfg.String()
+	if strings.Contains(out, "s3cret") || strings.Contains(out, "password: docker") {
+		t.Errorf("String leaks a secret:\n%s", out)
+	}
+	if cfg.DB.Pass != "docker" {
+		t.Error("Masked changed the config it was called on")
+	}
+}
+
+func TestConnString(t *testing.T) {
+	cases := []struct {
+		name string
+		db   DB
+		host string
+	}{
+		{"tcp", DB{User: "forum user", Pass: `p@ss word' = "x"`, Host: "db.internal", Port: 6432, Name: "forum db"}, "db.internal"},
+		{"socket", DB{User: "forum", Pass: "secret", Host: "/var/run/postgresql", Port: 5433, Name: "forum"}, "/var/run/postgresql"},
+	}
+	for _, c := range cases {
+		parsed, err := pgxpool.ParseConfig(c.db.ConnString())
+		if err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+		cc := parsed.ConnConfig
+		if cc.User != c.db.User || cc.Password != c.db.Pass || cc.Host != c.host || cc.Port != uint16(c.db.Port) || cc.Database != c.db.Name {
+			t.Errorf("%s: parsed %s@%s:%d/%s password %q, want %+v", c.name, cc.User, cc.Host, cc.Port, cc.Database, cc.Password, c.db)
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package config
+
+import (
+	"strconv"
+	"time"
+)
+
+// option binds a config field to its flag and environment variable names
+type option struct {
+	flag  string
+	env   string
+	usage string
+	set   func(string) error
+}
+
+func options(cfg *Config) []option {
+	return []option{
+		{flag: "storage", env: "STORAGE", usage: "where the data lives: postgres or memory", set: setString(&cfg.Storage)},
+		{flag: "db-user", env: "DB_USER", usage: "database user", set: setString(&cfg.DB.User)},
+		{flag: "db-host", env: "DB_HOST", usage: "database host", set: setString(&cfg.DB.Host)},
+		{flag: "db-port", env: "DB_PORT", usage: "database port", set: setInt(&cfg.DB.Port)},
+		{flag: "db-password", env: "DB_PASSWORD", usage: "database password", set: setString(&cfg.DB.Pass)},
+		{flag: "db-name", env: "DB_NAME", usage: "database name", set: setString(&cfg.DB.Name)},
+		{flag: "db-max-conns", env: "DB_MAX_CONNS", usage: "connection pool size", set: setInt32(&cfg.DB.MaxConns)},
+		{flag: "db-profile", env: "DB_PROFILE", usage: "storage profile applied by migrate: bench or durable, empty keeps the current one", set: setString(&cfg.DB.Profile)},
+		{flag: "addr", env: "SERVER_ADDR", usage: "HTTP listen address", set: setString(&cfg.Server.Addr)},
+		{flag: "drain-delay", env: "SERVER_DRAIN_DELAY", usage: "time to report not ready before closing the listener", set: setDuration(&cfg.Server.DrainDelay)},
+		{flag: "request-timeout", env: "SERVER_REQUEST_TIMEOUT", usage: "default deadline for database work of a request, 0 disables", set: setDuration(&cfg.Server.RequestTimeout)},
+		{flag: "cursor-secret", env: "SERVER_CURSOR_SECRET", usage: "key signing pagination cursors", set: setString(&cfg.Server.CursorSecret)},
+		{flag: "shutdown-timeout", env: "SERVER_SHUTDOWN_TIMEOUT", usage: "deadline for draining in-flight requests", set: setDuration(&cfg.Server.ShutdownTimeout)},
+		{flag: "ready-timeout", env: "SERVER_READY_TIMEOUT", usage: "deadline of each readiness check", set: setDuration(&cfg.Server.ReadyTimeout)},
+		{flag: "session-ttl", env: "AUTH_SESSION_TTL", usage: "lifetime of a login session", set: setDuration(&cfg.Auth.SessionTTL)},
+		{flag: "secure-cookie", env: "AUTH_SECURE_COOKIE", usage: "send the session cookie over HTTPS only", set: setBool(&cfg.Auth.SecureCookie)},
+		{flag: "auth-enforce", env: "AUTH_ENFORCE", usage: "require the author, a moderator or an admin for edits", set: setBool(&cfg.Auth.Enforce)},
+		{flag: "log-level", env: "LOG_LEVEL", usage: "minimum log level: debug, info, warn or error", set: setString(&cfg.Log.Level)},
+		{flag: "log-sample", env: "LOG_SAMPLE", usage: "log one in N successful requests, 0 logs all", set: setInt(&cfg.Log.Sample)},
+		{flag: "bench-target", env: "BENCH_TARGET", usage: "base URL of the server the bench command loads", set: setString(&cfg.Bench.Target)},
+		{flag: "bench-concurrency", env: "BENCH_CONCURRENCY", usage: "requests in flight during the bench", set: setInt(&cfg.Bench.Concurrency)},
+		{flag: "bench-duration", env: "BENCH_DURATION", usage: "how long the bench drives load", set: setDuration(&cfg.Bench.Duration)},
+		{flag: "bench-users", env: "BENCH_USERS", usage: "users seeded before the bench", set: setInt(&cfg.Bench.Users)},
+		{flag: "bench-forums", env: "BENCH_FORUMS", usage: "forums seeded before the bench", set: setInt(&cfg.Bench.Forums)},
+		{flag: "bench-threads", env: "BENCH_THREADS", usage: "threads seeded before the bench", set: setInt(&cfg.Bench.Threads)},
+		{flag: "bench-batch", env: "BENCH_BATCH", usage: "posts created per request", set: setInt(&cfg.Bench.Batch)},
+		{flag: "bench-mix", env: "BENCH_MIX", usage: "endpoint weights, e.g. post_create=1,thread_posts=4", set: setString(&cfg.Bench.Mix)},
+		{flag: "bench-check", env: "BENCH_CHECK", usage: "check the served counters and listings after the bench", set: setBool(&cfg.Bench.Check)},
+	}
+}
+
+func setString(dst *string) func(string) error {
+	return func(s string) error {
+		*dst = s
+		return nil
+	}
+}
+
+func setInt(dst *int) func(string) error {
+	return func(s string) error {
+		v, err := strconv.Atoi(s)
+		if err != nil {
+			return err
+		}
+		*dst = v
+		return nil
+	}
+}
+
+func setInt32(dst *int32) func(string) error {
+	return func(s string) error {
+		v, err := strconv.ParseInt(s, 10, 32)
+		if err != nil {
+			return err
+		}
+		*dst = int32(v)
+		return nil
+	}
+}
+
+func setBool(dst *bool) func(string) error {
+	return func(s string) error {
+		v, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		*dst = v
+		return nil
+	}
+}
+
+func setDuration(dst *time.Duration) func(string) error {
+	return func(s string) error {
+		v, err := time.ParseDuration(s)
+		if err != nil {
+			return err
+		}
+		*dst = v
+		return nil
+	}
+}
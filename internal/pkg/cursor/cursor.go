@@ -0,0 +1,76 @@
+// Package cursor turns the sort key of a listing page into an opaque,
+// HMAC-signed next-page token and back.
+package cursor
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+
+	"repo/internal/pkg/domain"
+)
+
+// Header carries the token of the next page of a listing, it is passed back as ?cursor=
+const Header = "X-Next-Cursor"
+
+// ErrInvalid rejects a forged, damaged or foreign token, it is of kind domain.ErrInvalid (400)
+var ErrInvalid = domain.NewError(domain.ErrInvalid, "invalid cursor")
+
+type Codec struct {
+	secret []byte
+}
+
+// NewCodec signs cursors with secret. An empty secret is replaced by a random one,
+// so cursors only stay valid for the lifetime of the process.
+func NewCodec(secret string) Codec {
+	key := []byte(secret)
+	if len(key) == 0 {
+		key = make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			panic(err)
+		}
+	}
+	return Codec{secret: key}
+}
+
+// envelope binds the key to the listing it was issued for
+type envelope struct {
+	Scope string        `json:"s"`
+	Key   domain.Cursor `json:"k"`
+}
+
+// Encode issues a token for key. scope names the listing, e.g. "threads:forum-slug:desc",
+// and a token is only accepted back for the same scope.
+func (c Codec) Encode(scope string, key domain.Cursor) string {
+	payload, _ := json.Marshal(envelope{Scope: scope, Key: key})
+	return base64.RawURLEncoding.EncodeToString(payload) + "." + base64.RawURLEncoding.EncodeToString(c.sign(payload))
+}
+
+func (c Codec) Decode(scope string, token string) (domain.Cursor, error) {
+	dot := strings.IndexByte(token, '.')
+	if dot < 0 {
+		return domain.Cursor{}, ErrInvalid
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(token[:dot])
+	if err != nil {
+		return domain.Cursor{}, ErrInvalid
+	}
+	mac, err := base64.RawURLEncoding.DecodeString(token[dot+1:])
+	if err != nil || !hmac.Equal(mac, c.sign(payload)) {
+		return domain.Cursor{}, ErrInvalid
+	}
+	var env envelope
+	if err = json.Unmarshal(payload, &env); err != nil || env.Scope != scope {
+		return domain.Cursor{}, ErrInvalid
+	}
+	return env.Key, nil
+}
+
+func (c Codec) sign(payload []byte) []byte {
+	h := hmac.New(sha256.New, c.secret)
+	h.Write(payload)
+	return h.Sum(nil)
+}
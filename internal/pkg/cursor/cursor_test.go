@@ -0,0 +1,100 @@
+package cursor
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"repo/internal/pkg/domain"
+	"repo/internal/pkg/utils"
+)
+
+func TestRoundTrip(t *testing.T) {
+	c := NewCodec("secret")
+	keys := []domain.Cursor{
+		{},
+		{Nickname: "alice"},
+		{Created: time.Date(2021, 3, 4, 5, 6, 7, 8, time.UTC), Id: 42, Pinned: true},
+		{Created: time.Date(2021, 3, 4, 5, 6, 7, 999999999, time.FixedZone("MSK", 3*60*60))},
+		{Path: []int64{1, 5, 9}, Id: 9},
+		{Rank: 0.25, Kind: "post", Id: 7},
+	}
+	for _, key := range keys {
+		got, err := c.Decode("threads:go:desc", c.Encode("threads:go:desc", key))
+		if err != nil {
+			t.Errorf("Decode(Encode(%+v)) = %v", key, err)
+			continue
+		}
+		if !got.Created.Equal(key.Created) {
+			t.Errorf("created %v, want %v", got.Created, key.Created)
+		}
+		got.Created = key.Created
+		if !reflect.DeepEqual(got, key) {
+			t.Errorf("Decode(Encode(%+v)) = %+v", key, got)
+		}
+	}
+}
+
+func TestCreatedField(t *testing.T) {
+	created := time.Date(2021, 3, 4, 5, 6, 7, 8, time.UTC)
+	token := NewCodec("secret").Encode("threads:go:desc", domain.Cursor{Created: created, Id: 42})
+	payload, err := base64.RawURLEncoding.DecodeString(token[:strings.IndexByte(token, '.')])
+	if err != nil {
+		t.Fatal(err)
+	}
+	var env struct {
+		Key map[string]interface{} `json:"k"`
+	}
+	if err = json.Unmarshal(payload, &env); err != nil {
+		t.Fatal(err)
+	}
+	if env.Key["created"] != created.Format(time.RFC3339Nano) {
+		t.Errorf("key %s, want the creation time as \"created\"", payload)
+	}
+}
+
+func TestDecodeRejects(t *testing.T) {
+	c := NewCodec("secret")
+	const scope = "posts:1:tree"
+	token := c.Encode(scope, domain.Cursor{Id: 42})
+	dot := strings.IndexByte(token, '.')
+	payload, mac := token[:dot], token[dot+1:]
+	forged := base64.RawURLEncoding.EncodeToString([]byte(`{"s":"posts:1:tree","k":{"created":"0001-01-01T00:00:00Z","i":1}}`))
+
+	cases := []struct {
+		name  string
+		codec Codec
+		scope string
+		token string
+	}{
+		{"empty", c, scope, ""},
+		{"no mac", c, scope, payload},
+		{"truncated mac", c, scope, payload + "." + mac[:len(mac)-4]},
+		{"forged mac", c, scope, payload + "." + base64.RawURLEncoding.EncodeToString(make([]byte, 32))},
+		{"mac not base64", c, scope, payload + ".!!"},
+		{"payload not base64", c, scope, "!!." + mac},
+		{"changed payload", c, scope, forged + "." + mac},
+		{"other scope", c, "posts:2:tree", token},
+		{"wrong secret", NewCodec("other"), scope, token},
+	}
+	for _, tc := range cases {
+		_, err := tc.codec.Decode(tc.scope, tc.token)
+		if !errors.Is(err, domain.ErrInvalid) {
+			t.Errorf("%s: Decode = %v, want domain.ErrInvalid", tc.name, err)
+		}
+		if status := utils.StatusOf(err); status != 400 {
+			t.Errorf("%s: status %d, want 400", tc.name, status)
+		}
+	}
+}
+
+func TestRandomSecrets(t *testing.T) {
+	a, b := NewCodec(""), NewCodec("")
+	if _, err := b.Decode("s", a.Encode("s", domain.Cursor{Id: 1})); !errors.Is(err, domain.ErrInvalid) {
+		t.Errorf("a token of another process decoded: %v", err)
+	}
+}
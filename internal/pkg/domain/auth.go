@@ -0,0 +1,38 @@
+package domain
+
+import (
+	"context"
+	"time"
+)
+
+// Registration is a new user together with the password they will log in with.
+type Registration struct {
+	User
+	Password string `json:"password" validate:"required,min=8,max=72"`
+}
+
+type Credentials struct {
+	Nickname string `json:"nickname" validate:"required,nickname"`
+	Password string `json:"password" validate:"required"`
+}
+
+type Session struct {
+	Nickname string    `json:"nickname"`
+	Token    string    `json:"token"`
+	Expires  time.Time `json:"expires"`
+}
+
+// AuthRepository stores password hashes and sessions. Sessions are looked up by
+// a hash of their token, the token itself is never stored.
+type AuthRepository interface {
+	Register(ctx context.Context, user User, passwordHash string) error
+	// PasswordHash returns the nickname as registered along with its password hash
+	PasswordHash(ctx context.Context, nickname string) (string, string, error)
+
+	AddSession(ctx context.Context, nickname string, tokenHash []byte, expires time.Time) error
+	SessionUser(ctx context.Context, tokenHash []byte) (string, error)
+	DeleteSession(ctx context.Context, tokenHash []byte) error
+
+	// Roles tells whether nickname is an admin and whether they moderate forum
+	Roles(ctx context.Context, nickname string, forum string) (admin bool, moderator bool, err error)
+}
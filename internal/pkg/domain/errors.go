@@ -1,5 +1,50 @@
 package domain
 
+import (
+	"errors"
+	"fmt"
+)
+
 type Response struct {
 	Message string `json:"message"`
 }
+
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// ValidationResponse is the 400 body listing every invalid field of a payload.
+type ValidationResponse struct {
+	Message string       `json:"message"`
+	Errors  []FieldError `json:"errors"`
+}
+
+// Kinds of failures repositories report. Delivery maps each kind to one HTTP status.
+var (
+	ErrNotFound      = errors.New("not found")
+	ErrConflict      = errors.New("conflict")
+	ErrInvalidParent = errors.New("invalid parent")
+	ErrUserMissing   = errors.New("user missing")
+	ErrInvalid       = errors.New("invalid request")
+	ErrUnauthorized  = errors.New("unauthorized")
+	ErrForbidden     = errors.New("forbidden")
+)
+
+// Error is a failure of a known kind with a message fit for the client.
+type Error struct {
+	Kind    error
+	Message string
+}
+
+func NewError(kind error, format string, args ...interface{}) error {
+	return &Error{Kind: kind, Message: fmt.Sprintf(format, args...)}
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+func (e *Error) Unwrap() error {
+	return e.Kind
+}
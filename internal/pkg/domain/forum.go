@@ -1,35 +1,47 @@
 package domain
 
-import "time"
+import (
+	"context"
+	"time"
+)
 
 type Forum struct {
-	Title   string `json:"title"`
-	User    string `json:"user"`
-	Slug    string `json:"slug"`
+	Title   string `json:"title" validate:"required"`
+	User    string `json:"user" validate:"required,nickname"`
+	Slug    string `json:"slug" validate:"required,slug"`
 	Posts   int64  `json:"posts"`
 	Threads int32  `json:"threads"`
 }
 
 type Thread struct {
 	Id      int32  `json:"id"`
-	Title   string `json:"title"`
+	Title   string `json:"title" validate:"required"`
 	Forum   string `json:"forum"`
-	Message string `json:"message"`
-	Author  string `json:"author"`
+	Message string `json:"message" validate:"required"`
+	Author  string `json:"author" validate:"required,nickname"`
 	Votes   int32  `json:"votes"`
-	Slug    string `json:"slug"`
+	Slug    string `json:"slug" validate:"slug"`
 	Created time.Time `json:"created"`
+	// Pinned threads are listed before the others
+	Pinned bool `json:"pinned,omitempty"`
+	// Locked threads take no new posts
+	Locked bool `json:"locked,omitempty"`
 }
 
 type Post struct {
 	Id       int64  `json:"id"`
 	Parent   int64  `json:"parent"`
-	Author   string `json:"author"`
-	Message  string `json:"message"`
+	Author   string `json:"author" validate:"required,nickname"`
+	Message  string `json:"message" validate:"required"`
 	IsEdited bool   `json:"isEdited"`
 	Forum    string `json:"forum"`
 	Thread   int32  `json:"thread"`
 	Created  time.Time `json:"created"`
+	// Hidden and deleted posts are rendered with an empty message
+	Hidden  bool `json:"hidden,omitempty"`
+	Deleted bool `json:"deleted,omitempty"`
+	// Path is the materialized path (treeOrder) of the post, root id first
+	Path []int64 `json:"-"`
 }
 
 type PostFull struct {
@@ -40,8 +52,8 @@ type PostFull struct {
 }
 
 type Vote struct {
-	Nickname string `json:"nickname"`
-	Voice    int32  `json:"voice"`
+	Nickname string `json:"nickname" validate:"required,nickname"`
+	Voice    int32  `json:"voice" validate:"required,oneof=-1 1"`
 	IdThread int64  `json:"-"`
 }
 
@@ -50,30 +62,60 @@ type Status struct {
 	Forums int `json:"forum"`
 	Posts int `json:"post"`
 	Threads int `json:"thread"`
+	Votes int `json:"vote"`
+	PostsLastHour int `json:"postsLastHour"`
+	// forums with the most posts, largest first
+	TopForums []Forum `json:"topForums"`
 }
 
 type ForumRepository interface {
-	AddForum(forum Forum) (Forum,error)
-	GetForum(slug string) (Forum, error)
-	GetUsers(slug string, limit int, since string, desc bool) ([]User, error)
+	AddForum(ctx context.Context, forum Forum) (Forum,error)
+	GetForum(ctx context.Context, slug string) (Forum, error)
+	GetUsers(ctx context.Context, slug string, limit int, since string, desc bool, after *Cursor) ([]User, error)
 
-	AddThread(thread Thread) (Thread, error)
-	GetThreads(slug string, since string, desc bool, limit int) ([]Thread, error)
-	CheckThreads(slug string) (bool, error)
-	GetThreadIdBySlug(slug string) (int, error)
-	AddPosts(id int, forumSlug string, posts []Post) ([]Post, error)
-	GetPosts(id int, limit int, since int, sort string, desc bool) ([]Post, error)
-	GetThreadInfo(id int) (Thread, error)
-	UpdateThread(thread Thread) (Thread, error)
+	AddThread(ctx context.Context, thread Thread) (Thread, error)
+	GetThreads(ctx context.Context, slug string, since string, desc bool, limit int, after *Cursor) ([]Thread, error)
+	GetThreadIdBySlug(ctx context.Context, slug string) (int, error)
+	AddPosts(ctx context.Context, id int, forumSlug string, posts []Post) ([]Post, error)
+	GetPosts(ctx context.Context, id int, limit int, since int, sort string, desc bool, after *Cursor) ([]Post, error)
+	GetThreadInfo(ctx context.Context, id int) (Thread, error)
+	// editor is recorded in the revision history, empty when unknown
+	UpdateThread(ctx context.Context, thread Thread, editor string) (Thread, error)
 
-	VoteThread(vote Vote) error
-	UpdateVote(vote Vote) error
+	VoteThread(ctx context.Context, vote Vote) error
+	UpdateVote(ctx context.Context, vote Vote) error
 
-	GetPost(post Post, related []string) (PostFull, error)
-	UpdatePost(post Post) (Post, error)
+	GetPost(ctx context.Context, post Post, related []string) (PostFull, error)
+	UpdatePost(ctx context.Context, post Post, editor string) (Post, error)
 
-	ServiceClear() error
-	ServiceStatus() (Status, error)
+	// Deleted posts stay in the tree as tombstones, deleted threads and forums are no longer served.
+	// Purging removes them for good along with everything below them.
+	// A moderator or an admin acting on content that is not theirs passes the
+	// audit entry, recorded in the moderation log along with the change; nil otherwise.
+	DeletePost(ctx context.Context, id int64, audit *ModerationAction) error
+	DeleteThread(ctx context.Context, id int, audit *ModerationAction) error
+	DeleteForum(ctx context.Context, slug string, audit *ModerationAction) error
+	PurgePost(ctx context.Context, id int64, audit *ModerationAction) error
+	// PurgeThread sets the forum of the audit entry, deleted threads are purged by id only
+	PurgeThread(ctx context.Context, id int, audit *ModerationAction) error
+	PurgeForum(ctx context.Context, slug string, audit *ModerationAction) error
 
+	ServiceClear(ctx context.Context) error
+	// ServiceStatus reads the row counts from the trigger maintained counters,
+	// exact counts every table instead. top is the number of TopForums.
+	ServiceStatus(ctx context.Context, exact bool, top int) (Status, error)
 
+
+}
+
+// Cursor is the full sort key of the last row of a listing page, the next
+// page starts strictly after it. Only the fields of the listing's sort are set.
+type Cursor struct {
+	Nickname string    `json:"n,omitempty"`
+	Created  time.Time `json:"created,omitempty"`
+	Id       int64     `json:"i,omitempty"`
+	Path     []int64   `json:"p,omitempty"`
+	Rank     float32   `json:"r,omitempty"`
+	Kind     string    `json:"t,omitempty"`
+	Pinned   bool      `json:"pin,omitempty"`
 }
@@ -0,0 +1,39 @@
+package domain
+
+import (
+	"context"
+	"time"
+)
+
+// Revision is one version of a post or thread, version 1 being the original.
+type Revision struct {
+	Version  int       `json:"version"`
+	Title    string    `json:"title,omitempty"`
+	Message  string    `json:"message"`
+	EditedBy string    `json:"editedBy,omitempty"`
+	Created  time.Time `json:"created"`
+}
+
+// Diff operations
+const (
+	DiffEqual  = "equal"
+	DiffInsert = "insert"
+	DiffDelete = "delete"
+)
+
+type DiffOp struct {
+	Op   string `json:"op"`
+	Text string `json:"text"`
+}
+
+type RevisionDiff struct {
+	From    int      `json:"from"`
+	To      int      `json:"to"`
+	Title   []DiffOp `json:"title,omitempty"`
+	Message []DiffOp `json:"message"`
+}
+
+type HistoryRepository interface {
+	PostHistory(ctx context.Context, id int64) ([]Revision, error)
+	ThreadHistory(ctx context.Context, id int) ([]Revision, error)
+}
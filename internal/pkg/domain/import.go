@@ -0,0 +1,53 @@
+package domain
+
+import "context"
+
+// Kinds of rows an import takes, in the order they have to be imported:
+// each kind refers to rows of the kinds before it.
+const (
+	ImportUsers   = "users"
+	ImportForums  = "forums"
+	ImportThreads = "threads"
+	ImportPosts   = "posts"
+	ImportVotes   = "votes"
+)
+
+var ImportKinds = []string{ImportUsers, ImportForums, ImportThreads, ImportPosts, ImportVotes}
+
+// ImportRow is one row of an import. Value is a User, Forum, Thread, Post or
+// Vote, according to the kind; a row that could not be read carries the
+// Reason it is rejected instead.
+type ImportRow struct {
+	Line   int
+	Value  interface{}
+	Reason string
+}
+
+// ImportSource reads the rows of one kind.
+type ImportSource interface {
+	Kind() string
+	// Next returns the next row, false once the input is over
+	Next() (ImportRow, bool)
+	// Err is the failure that ended the input early, if any
+	Err() error
+}
+
+// Rejection is a row left out of an import and why.
+type Rejection struct {
+	Line   int    `json:"line"`
+	Reason string `json:"reason"`
+}
+
+type ImportResult struct {
+	Kind     string `json:"kind"`
+	Read     int    `json:"read"`
+	Imported int    `json:"imported"`
+	Rejected int    `json:"rejected"`
+	// Rejections lists the first rejected rows by line
+	Rejections []Rejection `json:"rejections"`
+}
+
+type ImportRepository interface {
+	// Import adds the valid rows of source as a whole or not at all
+	Import(ctx context.Context, source ImportSource) (ImportResult, error)
+}
@@ -0,0 +1,77 @@
+package domain
+
+import (
+	"context"
+	"time"
+)
+
+// Moderation actions as recorded in the audit log
+const (
+	ActionAddModerator    = "add_moderator"
+	ActionRemoveModerator = "remove_moderator"
+	ActionLock            = "lock"
+	ActionUnlock          = "unlock"
+	ActionPin             = "pin"
+	ActionUnpin           = "unpin"
+	ActionHide            = "hide"
+	ActionUnhide          = "unhide"
+	ActionDelete          = "delete"
+	ActionDeleteThread    = "delete_thread"
+	ActionDeleteForum     = "delete_forum"
+	ActionPurgePost       = "purge_post"
+	ActionPurgeThread     = "purge_thread"
+	ActionPurgeForum      = "purge_forum"
+	ActionBan             = "ban"
+	ActionUnban           = "unban"
+)
+
+type Moderator struct {
+	Forum    string    `json:"forum"`
+	Nickname string    `json:"nickname" validate:"required,nickname"`
+	AddedBy  string    `json:"addedBy,omitempty"`
+	Created  time.Time `json:"created"`
+}
+
+type Ban struct {
+	Forum    string    `json:"forum"`
+	Nickname string    `json:"nickname" validate:"required,nickname"`
+	BannedBy string    `json:"bannedBy,omitempty"`
+	Reason   string    `json:"reason" validate:"max=500"`
+	Created  time.Time `json:"created"`
+}
+
+// ModerationAction is an entry of the audit log. Target is the thread id,
+// post id or nickname acted on.
+type ModerationAction struct {
+	Id        int64     `json:"id"`
+	Forum     string    `json:"forum"`
+	Moderator string    `json:"moderator"`
+	Action    string    `json:"action"`
+	Target    string    `json:"target"`
+	Reason    string    `json:"reason,omitempty"`
+	Created   time.Time `json:"created"`
+}
+
+// Reason is the optional body of a moderation action.
+type Reason struct {
+	Reason string `json:"reason" validate:"max=500"`
+}
+
+// ModerationRepository applies moderation actions and records each one in the
+// audit log in the same transaction. by is the nickname of the moderator.
+type ModerationRepository interface {
+	AddModerator(ctx context.Context, forum string, nickname string, by string) (Moderator, error)
+	RemoveModerator(ctx context.Context, forum string, nickname string, by string) error
+	GetModerators(ctx context.Context, forum string) ([]Moderator, error)
+
+	LockThread(ctx context.Context, thread Thread, locked bool, by string, reason string) error
+	PinThread(ctx context.Context, thread Thread, pinned bool, by string, reason string) error
+
+	HidePost(ctx context.Context, post Post, hidden bool, by string, reason string) error
+
+	BanUser(ctx context.Context, ban Ban) (Ban, error)
+	UnbanUser(ctx context.Context, forum string, nickname string, by string) error
+	GetBans(ctx context.Context, forum string) ([]Ban, error)
+
+	GetLog(ctx context.Context, forum string, limit int, after *Cursor) ([]ModerationAction, error)
+}
@@ -0,0 +1,38 @@
+package domain
+
+import (
+	"context"
+	"time"
+)
+
+const (
+	SearchThreads = "thread"
+	SearchPosts   = "post"
+)
+
+type SearchQuery struct {
+	Query  string
+	Forum  string
+	Author string
+	// Kind restricts the search to SearchThreads or SearchPosts, empty searches both
+	Kind  string
+	Since string
+	Until string
+	Limit int
+}
+
+type SearchHit struct {
+	Kind    string    `json:"kind"`
+	Id      int64     `json:"id"`
+	Thread  int32     `json:"thread"`
+	Forum   string    `json:"forum"`
+	Author  string    `json:"author"`
+	Title   string    `json:"title,omitempty"`
+	Snippet string    `json:"snippet"`
+	Rank    float32   `json:"rank"`
+	Created time.Time `json:"created"`
+}
+
+type SearchRepository interface {
+	Search(ctx context.Context, query SearchQuery, after *Cursor) ([]SearchHit, error)
+}
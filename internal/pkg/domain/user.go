@@ -1,15 +1,17 @@
 package domain
 
+import "context"
+
 type User struct {
-	Nickname string `json:"nickname"`
-	FullName string `json:"fullname"`
+	Nickname string `json:"nickname" validate:"required,nickname"`
+	FullName string `json:"fullname" validate:"required"`
 	About    string `json:"about"`
-	Email    string `json:"email"`
+	Email    string `json:"email" validate:"required,format=email"`
 }
 
 type UserRepository interface {
-	AddUser(user User) error
-	GetUserByNickOrEmail(nickname string, email string) ([]User, error)
-	GetUser(nickname string) ([]User, error)
-	UpdateUser(user User) (User, error)
+	AddUser(ctx context.Context, user User) error
+	GetUserByNickOrEmail(ctx context.Context, nickname string, email string) ([]User, error)
+	GetUser(ctx context.Context, nickname string) ([]User, error)
+	UpdateUser(ctx context.Context, user User) (User, error)
 }
@@ -0,0 +1,277 @@
+package delivery
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fasthttp/router"
+	"github.com/valyala/fasthttp"
+	"github.com/valyala/fasthttp/fasthttputil"
+	"repo/internal/pkg/auth"
+	"repo/internal/pkg/cursor"
+	"repo/internal/pkg/domain"
+	"repo/internal/pkg/memory"
+	userDelivery "repo/internal/pkg/user/delivery"
+	"repo/internal/pkg/utils"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files of the contract tests")
+
+// actorHeader names the caller of a contract request, standing in for a session
+const actorHeader = "X-Test-Nickname"
+
+// exchange is one request of the contract and the status it must answer.
+// The body answered is compared with testdata/contract/<name>.json.
+type exchange struct {
+	name   string
+	method string
+	// {cursor} is replaced by the X-Next-Cursor of the previous response
+	path   string
+	body   string
+	actor  string
+	status int
+}
+
+// golden is what a golden file records of a response
+type golden struct {
+	Status int             `json:"status"`
+	Cursor bool            `json:"cursor,omitempty"`
+	Body   json.RawMessage `json:"body"`
+}
+
+// contractServer serves the user and forum handlers from memory through an
+// in-memory listener, with a stopped clock so that responses are reproducible.
+func contractServer(t *testing.T) (*fasthttp.Client, *memory.Store) {
+	t.Helper()
+	store := memory.NewStore()
+	store.Now = func() time.Time { return time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC) }
+	ur := memory.NewUserRep(store)
+	ar := memory.NewAuthRep(store)
+	fr := memory.NewForumRep(store)
+	if err := ar.Register(context.Background(), domain.User{Nickname: "root", FullName: "Root", Email: "root@forum.example"}, ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := ar.SetAdmin("root", true); err != nil {
+		t.Fatal(err)
+	}
+
+	r := router.New()
+	timeouts := utils.Timeouts{Default: time.Second}
+	authz := auth.NewAuthorizer(&ar, false)
+	userDelivery.NewUserHandler(r, &ur, timeouts, authz)
+	NewForumHandler(r, &fr, timeouts, cursor.NewCodec("contract"), authz)
+
+	ln := fasthttputil.NewInmemoryListener()
+	srv := &fasthttp.Server{Handler: func(ctx *fasthttp.RequestCtx) {
+		if nickname := ctx.Request.Header.Peek(actorHeader); len(nickname) > 0 {
+			auth.SetNickname(ctx, string(nickname))
+		}
+		r.Handler(ctx)
+	}}
+	go srv.Serve(ln)
+	t.Cleanup(func() {
+		srv.Shutdown()
+		ln.Close()
+	})
+	return &fasthttp.Client{Dial: func(string) (net.Conn, error) { return ln.Dial() }}, store
+}
+
+func TestForumContract(t *testing.T) {
+	client, _ := contractServer(t)
+	next := ""
+	for _, ex := range forumContract {
+		req, resp := fasthttp.AcquireRequest(), fasthttp.AcquireResponse()
+		req.Header.SetMethod(ex.method)
+		req.SetRequestURI("http://forum" + strings.Replace(ex.path, "{cursor}", next, 1))
+		if ex.actor != "" {
+			req.Header.Set(actorHeader, ex.actor)
+		}
+		if ex.body != "" {
+			req.Header.SetContentType("application/json")
+			req.SetBodyString(ex.body)
+		}
+		if err := client.Do(req, resp); err != nil {
+			t.Fatalf("%s: %v", ex.name, err)
+		}
+		next = string(resp.Header.Peek(cursor.Header))
+		got := golden{Status: resp.StatusCode(), Cursor: next != "", Body: append([]byte(nil), resp.Body()...)}
+		fasthttp.ReleaseRequest(req)
+		fasthttp.ReleaseResponse(resp)
+
+		if got.Status != ex.status {
+			t.Errorf("%s: %s %s answered %d, want %d: %s", ex.name, ex.method, ex.path, got.Status, ex.status, got.Body)
+		}
+		checkGolden(t, ex.name, got)
+	}
+}
+
+func checkGolden(t *testing.T, name string, got golden) {
+	t.Helper()
+	if !json.Valid(got.Body) {
+		t.Errorf("%s: body is not JSON: %s", name, got.Body)
+		return
+	}
+	out, err := json.MarshalIndent(got, "", "  ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	out = append(out, '\n')
+	path := filepath.Join("testdata", "contract", name+".json")
+	if *update {
+		if err = os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err = ioutil.WriteFile(path, out, 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	want, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Errorf("%s: %v, run the tests with -update to create it", name, err)
+		return
+	}
+	if !bytes.Equal(out, want) {
+		t.Errorf("%s: response differs from %s\ngot:\n%s\nwant:\n%s", name, path, out, want)
+	}
+}
+
+// forumContract runs in order, each exchange sees the data left by the previous ones.
+var forumContract = []exchange{
+	// users
+	{name: "user_create", method: "POST", path: "/api/user/alice/create", status: 201,
+		body: `{"fullname":"Alice Liddell","about":"curious","email":"alice@example.com"}`},
+	{name: "user_create_bob", method: "POST", path: "/api/user/Bob/create", status: 201,
+		body: `{"fullname":"Bob","email":"bob@example.com"}`},
+	{name: "user_create_conflict", method: "POST", path: "/api/user/ALICE/create", status: 409,
+		body: `{"fullname":"Other","email":"BOB@example.com"}`},
+	{name: "user_create_invalid", method: "POST", path: "/api/user/carol/create", status: 400,
+		body: `{"fullname":"Carol","email":"not an email"}`},
+	{name: "user_get", method: "GET", path: "/api/user/ALICE/profile", status: 200},
+	{name: "user_get_missing", method: "GET", path: "/api/user/nobody/profile", status: 404},
+	{name: "user_update", method: "POST", path: "/api/user/alice/profile", status: 200,
+		body: `{"about":"late"}`},
+	{name: "user_update_email_taken", method: "POST", path: "/api/user/alice/profile", status: 409,
+		body: `{"email":"bob@example.com"}`},
+	{name: "user_update_missing", method: "POST", path: "/api/user/nobody/profile", status: 404,
+		body: `{"about":"x"}`},
+
+	// forums
+	{name: "forum_create", method: "POST", path: "/api/forum/create", status: 201,
+		body: `{"title":"Wonderland","user":"ALICE","slug":"wonderland"}`},
+	{name: "forum_create_conflict", method: "POST", path: "/api/forum/create", status: 409,
+		body: `{"title":"Other","user":"bob","slug":"WONDERLAND"}`},
+	{name: "forum_create_user_missing", method: "POST", path: "/api/forum/create", status: 404,
+		body: `{"title":"Nowhere","user":"nobody","slug":"nowhere"}`},
+	{name: "forum_create_empty", method: "POST", path: "/api/forum/create", status: 201,
+		body: `{"title":"Empty","user":"bob","slug":"empty"}`},
+	{name: "forum_get", method: "GET", path: "/api/forum/Wonderland/details", status: 200},
+	{name: "forum_get_missing", method: "GET", path: "/api/forum/nowhere/details", status: 404},
+
+	// threads
+	{name: "thread_create", method: "POST", path: "/api/forum/wonderland/create", status: 201,
+		body: `{"title":"Rabbit hole","author":"alice","message":"Down we go","slug":"rabbit","created":"2021-01-01T10:00:00Z"}`},
+	{name: "thread_create_second", method: "POST", path: "/api/forum/wonderland/create", status: 201,
+		body: `{"title":"Tea party","author":"bob","message":"Why is a raven like a writing desk?","created":"2021-01-02T10:00:00Z"}`},
+	{name: "thread_create_conflict", method: "POST", path: "/api/forum/wonderland/create", status: 409,
+		body: `{"title":"Again","author":"bob","message":"m","slug":"RABBIT","created":"2021-01-03T10:00:00Z"}`},
+	{name: "thread_create_forum_missing", method: "POST", path: "/api/forum/nowhere/create", status: 404,
+		body: `{"title":"T","author":"bob","message":"m","created":"2021-01-03T10:00:00Z"}`},
+	{name: "thread_create_author_missing", method: "POST", path: "/api/forum/wonderland/create", status: 404,
+		body: `{"title":"T","author":"nobody","message":"m","created":"2021-01-03T10:00:00Z"}`},
+	{name: "thread_create_invalid", method: "POST", path: "/api/forum/wonderland/create", status: 400,
+		body: `{"author":"bob","message":"no title"}`},
+	{name: "threads_list", method: "GET", path: "/api/forum/wonderland/threads", status: 200},
+	{name: "threads_list_desc_limit", method: "GET", path: "/api/forum/wonderland/threads?desc=true&limit=1", status: 200},
+	{name: "threads_list_next_page", method: "GET", path: "/api/forum/wonderland/threads?desc=true&limit=1&cursor={cursor}", status: 200},
+	{name: "threads_list_since", method: "GET", path: "/api/forum/wonderland/threads?since=2021-01-02T10:00:00Z", status: 200},
+	{name: "threads_list_empty_forum", method: "GET", path: "/api/forum/empty/threads", status: 200},
+	{name: "threads_list_forum_missing", method: "GET", path: "/api/forum/nowhere/threads", status: 404},
+	{name: "threads_list_bad_since", method: "GET", path: "/api/forum/wonderland/threads?since=yesterday", status: 400},
+	{name: "thread_get_by_slug", method: "GET", path: "/api/thread/Rabbit/details", status: 200},
+	{name: "thread_get_by_id", method: "GET", path: "/api/thread/2/details", status: 200},
+	{name: "thread_get_missing", method: "GET", path: "/api/thread/404/details", status: 404},
+	{name: "thread_update", method: "POST", path: "/api/thread/rabbit/details", status: 200,
+		body: `{"message":"Down, down, down"}`},
+	{name: "thread_update_missing", method: "POST", path: "/api/thread/nowhere/details", status: 404,
+		body: `{"title":"x"}`},
+
+	// posts
+	{name: "posts_create", method: "POST", path: "/api/thread/rabbit/create", status: 201,
+		body: `[{"author":"alice","message":"first"},{"author":"bob","message":"second"}]`},
+	{name: "posts_create_replies", method: "POST", path: "/api/thread/1/create", status: 201,
+		body: `[{"author":"bob","message":"reply to first","parent":1},{"author":"alice","message":"reply to reply","parent":3}]`},
+	{name: "posts_create_empty", method: "POST", path: "/api/thread/rabbit/create", status: 201, body: `[]`},
+	{name: "posts_create_other_parent", method: "POST", path: "/api/thread/2/create", status: 409,
+		body: `[{"author":"bob","message":"wrong thread","parent":1}]`},
+	{name: "posts_create_author_missing", method: "POST", path: "/api/thread/rabbit/create", status: 404,
+		body: `[{"author":"nobody","message":"who"}]`},
+	{name: "posts_create_thread_missing", method: "POST", path: "/api/thread/nowhere/create", status: 404,
+		body: `[{"author":"bob","message":"where"}]`},
+	{name: "posts_flat", method: "GET", path: "/api/thread/rabbit/posts?sort=flat", status: 200},
+	{name: "posts_flat_desc_since", method: "GET", path: "/api/thread/rabbit/posts?sort=flat&desc=true&since=4", status: 200},
+	{name: "posts_tree", method: "GET", path: "/api/thread/rabbit/posts?sort=tree&limit=2", status: 200},
+	{name: "posts_tree_next_page", method: "GET", path: "/api/thread/rabbit/posts?sort=tree&limit=2&cursor={cursor}", status: 200},
+	{name: "posts_parent_tree", method: "GET", path: "/api/thread/1/posts?sort=parent_tree&limit=1&desc=true", status: 200},
+	{name: "posts_empty_thread", method: "GET", path: "/api/thread/2/posts", status: 200},
+	{name: "posts_thread_missing", method: "GET", path: "/api/thread/nowhere/posts", status: 404},
+	{name: "post_get", method: "GET", path: "/api/post/3/details", status: 200},
+	{name: "post_get_related", method: "GET", path: "/api/post/3/details?related=user,forum,thread", status: 200},
+	{name: "post_get_missing", method: "GET", path: "/api/post/404/details", status: 404},
+	{name: "post_update", method: "POST", path: "/api/post/3/details", status: 200,
+		body: `{"message":"edited reply"}`},
+	{name: "post_update_same", method: "POST", path: "/api/post/2/details", status: 200,
+		body: `{"message":"second"}`},
+	{name: "post_update_missing", method: "POST", path: "/api/post/404/details", status: 404,
+		body: `{"message":"x"}`},
+
+	// votes
+	{name: "vote", method: "POST", path: "/api/thread/rabbit/vote", status: 200,
+		body: `{"nickname":"bob","voice":1}`},
+	{name: "vote_change", method: "POST", path: "/api/thread/1/vote", status: 200,
+		body: `{"nickname":"BOB","voice":-1}`},
+	{name: "vote_other_user", method: "POST", path: "/api/thread/1/vote", status: 200,
+		body: `{"nickname":"alice","voice":-1}`},
+	{name: "vote_user_missing", method: "POST", path: "/api/thread/1/vote", status: 404,
+		body: `{"nickname":"nobody","voice":1}`},
+	{name: "vote_thread_missing", method: "POST", path: "/api/thread/nowhere/vote", status: 404,
+		body: `{"nickname":"bob","voice":1}`},
+	{name: "vote_invalid", method: "POST", path: "/api/thread/1/vote", status: 400,
+		body: `{"nickname":"bob","voice":2}`},
+
+	// forum users and status
+	{name: "forum_users", method: "GET", path: "/api/forum/wonderland/users", status: 200},
+	{name: "forum_users_desc_since", method: "GET", path: "/api/forum/wonderland/users?desc=true&since=bob", status: 200},
+	{name: "forum_users_empty_forum", method: "GET", path: "/api/forum/empty/users", status: 200},
+	{name: "forum_users_missing", method: "GET", path: "/api/forum/nowhere/users", status: 404},
+	{name: "status", method: "GET", path: "/api/service/status", status: 200},
+	{name: "status_exact_top", method: "GET", path: "/api/service/status?exact=true&top=1", status: 200},
+
+	// deleting
+	{name: "post_delete_anonymous", method: "DELETE", path: "/api/post/2", status: 401},
+	{name: "post_delete_other_user", method: "DELETE", path: "/api/post/2", actor: "nobody", status: 403},
+	{name: "post_delete", method: "DELETE", path: "/api/post/2", actor: "bob", status: 200},
+	{name: "post_update_deleted", method: "POST", path: "/api/post/2/details", status: 409,
+		body: `{"message":"back"}`},
+	{name: "post_purge", method: "DELETE", path: "/api/post/1?purge=true", actor: "root", status: 200},
+	{name: "posts_after_purge", method: "GET", path: "/api/thread/rabbit/posts?sort=tree", status: 200},
+	{name: "thread_delete", method: "DELETE", path: "/api/thread/2", actor: "bob", status: 200},
+	{name: "thread_get_deleted", method: "GET", path: "/api/thread/2/details", status: 404},
+	{name: "thread_purge_not_admin", method: "DELETE", path: "/api/thread/2?purge=true", actor: "bob", status: 403},
+	{name: "thread_purge", method: "DELETE", path: "/api/thread/2?purge=true", actor: "root", status: 200},
+	{name: "forum_delete", method: "DELETE", path: "/api/forum/wonderland", actor: "alice", status: 200},
+	{name: "forum_get_deleted", method: "GET", path: "/api/forum/wonderland/details", status: 404},
+	{name: "forum_delete_missing", method: "DELETE", path: "/api/forum/wonderland", actor: "alice", status: 404},
+	{name: "status_after_delete", method: "GET", path: "/api/service/status?top=5", status: 200},
+	{name: "clear", method: "POST", path: "/api/service/clear", status: 200},
+	{name: "status_after_clear", method: "GET", path: "/api/service/status", status: 200},
+}
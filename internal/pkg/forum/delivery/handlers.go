@@ -1,73 +1,81 @@
 package delivery
 
 import (
-	"encoding/json"
+	"context"
 	"errors"
-	"fmt"
 	"github.com/fasthttp/router"
-	"github.com/jackc/pgconn"
 	"github.com/valyala/fasthttp"
+	"repo/internal/pkg/auth"
+	"repo/internal/pkg/cursor"
 	"repo/internal/pkg/domain"
+	"repo/internal/pkg/policy"
 	"repo/internal/pkg/utils"
+	"repo/internal/pkg/validation"
 	"strconv"
 	"strings"
 )
 
-var (
-	ForeignKeyViolation          = "23503"
-	UniqueViolation              = "23505"
-)
-
 type ForumHandler struct {
-	fr domain.ForumRepository
+	fr      domain.ForumRepository
+	cursors cursor.Codec
+	authz   auth.Authorizer
 }
 
-func NewForumHandler(r *router.Router, fr domain.ForumRepository) {
-	handler := ForumHandler{fr: fr}
+func NewForumHandler(r *router.Router, fr domain.ForumRepository, t utils.Timeouts, cursors cursor.Codec, authz auth.Authorizer) {
+	handler := ForumHandler{fr: fr, cursors: cursors, authz: authz}
+	route := t.Router(r)
 	// forum funcs
-	r.POST("/api/forum/create", handler.AddForum)
-	r.GET("/api/forum/{slug}/details", handler.GetForum)
-	r.GET("/api/forum/{slug}/users", handler.GetUsers)
+	route.POST("/api/forum/create", handler.AddForum)
+	route.GET("/api/forum/{slug}/details", handler.GetForum)
+	route.GET("/api/forum/{slug}/users", handler.GetUsers)
+	route.DELETE("/api/forum/{slug}", handler.DeleteForum)
 
 	// thread funcs
-	r.POST("/api/forum/{slug}/create", handler.AddThread)
-	r.GET("/api/forum/{slug}/threads", handler.GetThreads)
-	r.GET("/api/thread/{slug_or_id}/details", handler.GetThread)
-	r.POST("/api/thread/{slug_or_id}/details", handler.UpdateThread)
+	route.POST("/api/forum/{slug}/create", handler.AddThread)
+	route.GET("/api/forum/{slug}/threads", handler.GetThreads)
+	route.GET("/api/thread/{slug_or_id}/details", handler.GetThread)
+	route.POST("/api/thread/{slug_or_id}/details", handler.UpdateThread)
+	route.DELETE("/api/thread/{slug_or_id}", handler.DeleteThread)
 
 	// post funcs
-	r.POST("/api/thread/{slug_or_id}/create", handler.AddPosts)
-	r.GET("/api/thread/{slug_or_id}/posts", handler.GetPosts)
-	r.GET("/api/post/{id:[0-9]+}/details", handler.GetPost)
-	r.POST("/api/post/{id:[0-9]+}/details", handler.UpdatePost)
+	route.POST("/api/thread/{slug_or_id}/create", handler.AddPosts)
+	route.GET("/api/thread/{slug_or_id}/posts", handler.GetPosts)
+	route.GET("/api/post/{id:[0-9]+}/details", handler.GetPost)
+	route.POST("/api/post/{id:[0-9]+}/details", handler.UpdatePost)
+	route.DELETE("/api/post/{id:[0-9]+}", handler.DeletePost)
 
 	// vote funcs
-	r.POST("/api/thread/{slug_or_id}/vote", handler.VoteThread)
+	route.POST("/api/thread/{slug_or_id}/vote", handler.VoteThread)
 
 	// service funcs
-	r.GET("/api/service/status", handler.Status)
-	r.POST("/api/service/clear", handler.Clear)
+	route.GET("/api/service/status", handler.Status)
+	route.POST("/api/service/clear", handler.Clear)
 }
 
 func (fh *ForumHandler) AddForum (ctx *fasthttp.RequestCtx) {
+	c := utils.Context(ctx)
 	forum := domain.Forum{}
-	err := json.Unmarshal(ctx.PostBody(), &forum)
-	if err != nil {
-		utils.Send(500, err.Error(), ctx)
+	if !utils.ParseBody(ctx, &forum) {
 		return
 	}
-	fr, err := fh.fr.AddForum(forum)
-	if err != nil {
-		var pgErr *pgconn.PgError
-		if errors.As(err, &pgErr) {
-			if pgErr.Code == UniqueViolation  {
-				old, _ := fh.fr.GetForum(forum.Slug)
-				utils.Send(409, old, ctx)
-				return
-			}
+	fr, err := fh.fr.AddForum(c, forum)
+	if errors.Is(err, domain.ErrConflict) {
+		old, lookupErr := fh.fr.GetForum(c, forum.Slug)
+		if errors.Is(lookupErr, domain.ErrNotFound) {
+			// the slug belongs to a deleted forum
+			utils.SendError(err, ctx)
+			return
 		}
-		resp := domain.Response{Message: fmt.Sprintf("Can't find user by id %s", forum.User)}
-		utils.Send(404, resp, ctx)
+		err = lookupErr
+		if err != nil {
+			utils.SendError(err, ctx)
+			return
+		}
+		utils.Send(409, old, ctx)
+		return
+	}
+	if err != nil {
+		utils.SendError(err, ctx)
 		return
 	}
 	utils.Send(201, fr, ctx)
@@ -75,15 +83,15 @@ func (fh *ForumHandler) AddForum (ctx *fasthttp.RequestCtx) {
 }
 
 func (fh *ForumHandler) GetForum (ctx *fasthttp.RequestCtx) {
+	c := utils.Context(ctx)
 	slug, ok := ctx.UserValue("slug").(string)
 	if !ok {
 		utils.Send(400, "bad request", ctx)
 		return
 	}
-	fr, err := fh.fr.GetForum(slug)
+	fr, err := fh.fr.GetForum(c, slug)
 	if err != nil {
-		resp := domain.Response{Message: fmt.Sprintf("Can't find forum with slug: %s", slug)}
-		utils.Send(404, resp, ctx)
+		utils.SendError(err, ctx)
 		return
 	}
 	utils.Send(200, fr, ctx)
@@ -91,6 +99,7 @@ func (fh *ForumHandler) GetForum (ctx *fasthttp.RequestCtx) {
 }
 
 func (fh *ForumHandler) GetUsers (ctx *fasthttp.RequestCtx) {
+	c := utils.Context(ctx)
 	slug, ok := ctx.UserValue("slug").(string)
 	if !ok {
 		utils.Send(400, "bad request", ctx)
@@ -107,65 +116,70 @@ func (fh *ForumHandler) GetUsers (ctx *fasthttp.RequestCtx) {
 		utils.Send(400, "bad request", ctx)
 		return
 	}
-	_, err = fh.fr.GetForum(slug)
+	scope := usersScope(slug, desc)
+	after, ok := fh.after(ctx, scope)
+	if !ok {
+		return
+	}
+	_, err = fh.fr.GetForum(c, slug)
 	if err != nil {
-		resp := domain.Response{Message: fmt.Sprintf("Can't find forum with slug: %s", slug)}
-		utils.Send(404, resp, ctx)
+		utils.SendError(err, ctx)
 		return
 	}
-	fr, err := fh.fr.GetUsers(slug, limit, since, desc)
+	fr, err := fh.fr.GetUsers(c, slug, limit, since, desc, after)
 	if err != nil {
-		utils.Send(200, make([]domain.User,0,0), ctx)
+		utils.SendError(err, ctx)
 		return
 	}
+	fh.nextUsers(ctx, scope, limit, fr)
 	utils.Send(200, fr, ctx)
 	return
 }
 
 func (fh *ForumHandler) AddThread (ctx *fasthttp.RequestCtx) {
+	c := utils.Context(ctx)
 	slug, ok := ctx.UserValue("slug").(string)
 	if !ok {
 		utils.Send(400, "bad request", ctx)
 		return
 	}
 	thread := domain.Thread{Forum: slug}
-	err := json.Unmarshal(ctx.PostBody(), &thread)
-	if err != nil {
-		utils.Send(500, err.Error(), ctx)
+	if !utils.ParseBody(ctx, &thread) {
 		return
 	}
-	th, err := fh.fr.AddThread(thread)
-	if err != nil {
-		var pgErr *pgconn.PgError
-		if errors.As(err, &pgErr) {
-			if pgErr.Code == UniqueViolation  {
-				id, _ := fh.fr.GetThreadIdBySlug(thread.Slug)
-				old, _ := fh.fr.GetThreadInfo(id)
-				utils.Send(409, old, ctx)
-				return
-			}
+	th, err := fh.fr.AddThread(c, thread)
+	if errors.Is(err, domain.ErrConflict) {
+		old, lookupErr := fh.threadBySlugOrId(c, thread.Slug)
+		if errors.Is(lookupErr, domain.ErrNotFound) {
+			// the slug belongs to a deleted thread
+			utils.SendError(err, ctx)
+			return
 		}
-		resp := domain.Response{Message: fmt.Sprintf("Can't find user by id %s", thread.Author)}
-		utils.Send(404, resp, ctx)
+		err = lookupErr
+		if err != nil {
+			utils.SendError(err, ctx)
+			return
+		}
+		utils.Send(409, old, ctx)
+		return
+	}
+	if err != nil {
+		utils.SendError(err, ctx)
 		return
 	}
 	utils.Send(201, th, ctx)
 }
 
 func (fh *ForumHandler) GetThread (ctx *fasthttp.RequestCtx) {
+	c := utils.Context(ctx)
 	slug, ok := ctx.UserValue("slug_or_id").(string)
 	if !ok {
 		utils.Send(400, "bad request", ctx)
 		return
 	}
-	id, err := strconv.Atoi(slug)
-	if err != nil {
-		id, _ = fh.fr.GetThreadIdBySlug(slug)
-	}
-	th, err := fh.fr.GetThreadInfo(id)
+	th, err := fh.threadBySlugOrId(c, slug)
 	if err != nil {
-		resp := domain.Response{Message: fmt.Sprintf("Can't find thread with slug or id: %s", slug)}
-		utils.Send(404, resp, ctx)
+		utils.SendError(err, ctx)
 		return
 	}
 	utils.Send(200, th, ctx)
@@ -173,12 +187,18 @@ func (fh *ForumHandler) GetThread (ctx *fasthttp.RequestCtx) {
 }
 
 func (fh *ForumHandler) GetThreads (ctx *fasthttp.RequestCtx) {
+	c := utils.Context(ctx)
 	slug, ok := ctx.UserValue("slug").(string)
 	if !ok {
 		utils.Send(400, "bad request", ctx)
 		return
 	}
 	since := utils.GetQueryString(ctx, "since")
+	if since != "" && !validation.Format("date-time", since) {
+		resp := domain.ValidationResponse{Message: "validation failed", Errors: []domain.FieldError{{Field: "since", Message: "must be a valid date-time"}}}
+		utils.Send(400, resp, ctx)
+		return
+	}
 	desc, err := utils.GetQueryBool(ctx, "desc")
 	if err != nil {
 		utils.Send(400, "bad request", ctx)
@@ -189,42 +209,55 @@ func (fh *ForumHandler) GetThreads (ctx *fasthttp.RequestCtx) {
 		utils.Send(400, "bad request", ctx)
 		return
 	}
-	thrs, err := fh.fr.GetThreads(slug, since, desc, limit)
-	if err != nil || len(thrs) == 0 {
-		// as len(thrs) == 0 can indicate both empty result and no forum threads - check existence
-		notNull, _ := fh.fr.CheckThreads(slug)
-		if notNull {
-			utils.Send(200, make([]domain.Thread, 0, 0),ctx)
+	scope := threadsScope(slug, desc)
+	after, ok := fh.after(ctx, scope)
+	if !ok {
+		return
+	}
+	thrs, err := fh.fr.GetThreads(c, slug, since, desc, limit, after)
+	if err != nil {
+		utils.SendError(err, ctx)
+		return
+	}
+	if len(thrs) == 0 {
+		// empty result of an existing forum is not an error
+		_, err = fh.fr.GetForum(c, slug)
+		if err != nil {
+			utils.SendError(err, ctx)
 			return
 		}
-		resp := domain.Response{Message: fmt.Sprintf("Can't find threads of forum: %s", slug)}
-		utils.Send(404, resp, ctx)
-		return
 	}
+	fh.nextThreads(ctx, scope, limit, thrs)
 	utils.Send(200, thrs, ctx)
 	return
 }
 
 func (fh *ForumHandler) UpdateThread (ctx *fasthttp.RequestCtx) {
+	c := utils.Context(ctx)
 	slug, ok := ctx.UserValue("slug_or_id").(string)
 	if !ok {
 		utils.Send(400, "bad request", ctx)
 		return
 	}
-	id, err := strconv.Atoi(slug)
+	current, err := fh.threadBySlugOrId(c, slug)
 	if err != nil {
-		id, _ = fh.fr.GetThreadIdBySlug(slug)
+		utils.SendError(err, ctx)
+		return
 	}
-	thread := domain.Thread{Id: int32(id)}
-	err = json.Unmarshal(ctx.PostBody(), &thread)
+	err = fh.authz.Authorize(ctx, current.Forum, func(a policy.Actor) error {
+		return policy.CanEditThread(a, current)
+	})
 	if err != nil {
-		utils.Send(500, err.Error(), ctx)
+		utils.SendError(err, ctx)
 		return
 	}
-	th, err := fh.fr.UpdateThread(thread)
+	thread := domain.Thread{Id: current.Id}
+	if !utils.ParseBodyPartial(ctx, &thread) {
+		return
+	}
+	th, err := fh.fr.UpdateThread(c, thread, auth.Nickname(ctx))
 	if err != nil {
-		resp := domain.Response{Message: fmt.Sprintf("Can't find threads of forum: %s", slug)}
-		utils.Send(404, resp, ctx)
+		utils.SendError(err, ctx)
 		return
 	}
 	utils.Send(200, th, ctx)
@@ -232,41 +265,29 @@ func (fh *ForumHandler) UpdateThread (ctx *fasthttp.RequestCtx) {
 }
 
 func (fh *ForumHandler) AddPosts (ctx *fasthttp.RequestCtx) {
+	c := utils.Context(ctx)
 	slug, ok := ctx.UserValue("slug_or_id").(string)
 	if !ok {
 		utils.Send(400, "bad request", ctx)
 		return
 	}
-	id, err := strconv.Atoi(slug)
-	if err != nil {
-		id, err= fh.fr.GetThreadIdBySlug(slug)
-	}
-	tr, err := fh.fr.GetThreadInfo(id)
-
+	tr, err := fh.threadBySlugOrId(c, slug)
 	if err != nil {
-		resp := domain.Response{Message: fmt.Sprintf("thread of id is missing %d", id)}
-		utils.Send(404, resp, ctx)
+		utils.SendError(err, ctx)
 		return
 	}
 
 	posts := []domain.Post{}
-	err = json.Unmarshal(ctx.PostBody(), &posts)
+	if !utils.ParseBody(ctx, &posts) {
+		return
+	}
 	if len(posts) == 0{
 		utils.Send(201, []domain.Post{}, ctx)
 		return
 	}
-	ps, err := fh.fr.AddPosts(id, tr.Forum, posts)
+	ps, err := fh.fr.AddPosts(c, int(tr.Id), tr.Forum, posts)
 	if err != nil {
-		var pgErr *pgconn.PgError
-		if errors.As(err, &pgErr) {
-			if pgErr.Code == UniqueViolation {
-				resp := domain.Response{Message: fmt.Sprintf("Parent is absent")}
-				utils.Send(409, resp, ctx)
-				return
-			}
-		}
-		resp := domain.Response{Message: fmt.Sprintf("thread of id is missing %d", id)}
-		utils.Send(404, resp, ctx)
+		utils.SendError(err, ctx)
 		return
 	}
 	utils.Send(201, ps, ctx)
@@ -274,24 +295,15 @@ func (fh *ForumHandler) AddPosts (ctx *fasthttp.RequestCtx) {
 }
 
 func (fh *ForumHandler) GetPosts (ctx *fasthttp.RequestCtx) {
+	c := utils.Context(ctx)
 	slug, ok := ctx.UserValue("slug_or_id").(string)
 	if !ok {
 		utils.Send(400, "bad request", ctx)
 		return
 	}
-	id, err := strconv.Atoi(slug)
+	tr, err := fh.threadBySlugOrId(c, slug)
 	if err != nil {
-		id, err = fh.fr.GetThreadIdBySlug(slug)
-		if err != nil {
-			resp := domain.Response{Message: fmt.Sprintf("No thread of id %d", id)}
-			utils.Send(404, resp, ctx)
-			return
-		}
-	}
-	_, err = fh.fr.GetThreadInfo(id)
-	if err != nil {
-		resp := domain.Response{Message: fmt.Sprintf("No thread of id %d", id)}
-		utils.Send(404, resp, ctx)
+		utils.SendError(err, ctx)
 		return
 	}
 	limit, err := utils.GetQueryInt(ctx, "limit")
@@ -314,18 +326,23 @@ func (fh *ForumHandler) GetPosts (ctx *fasthttp.RequestCtx) {
 		utils.Send(400, "bad request", ctx)
 		return
 	}
-	posts, err := fh.fr.GetPosts(id, limit, since, sort, desc)
+	scope := postsScope(tr.Id, sort, desc)
+	after, ok := fh.after(ctx, scope)
+	if !ok {
+		return
+	}
+	posts, err := fh.fr.GetPosts(c, int(tr.Id), limit, since, sort, desc, after)
 	if err != nil {
-		fmt.Println(err.Error())
-		resp := domain.Response{Message: fmt.Sprintf("No thread of id %d", id)}
-		utils.Send(404, resp, ctx)
+		utils.SendError(err, ctx)
 		return
 	}
+	fh.nextPosts(ctx, scope, sort, limit, posts)
 	utils.Send(200, posts, ctx)
 	return
 }
 
 func (fh *ForumHandler) GetPost (ctx *fasthttp.RequestCtx) {
+	c := utils.Context(ctx)
 	slug, ok := ctx.UserValue("id").(string)
 	if !ok {
 		utils.Send(400, "bad request", ctx)
@@ -336,10 +353,9 @@ func (fh *ForumHandler) GetPost (ctx *fasthttp.RequestCtx) {
 		return
 	}
 	related := string(ctx.QueryArgs().Peek("related"))
-	post, err := fh.fr.GetPost(domain.Post{Id: int64(id)}, strings.Split(related, ","))
+	post, err := fh.fr.GetPost(c, domain.Post{Id: int64(id)}, strings.Split(related, ","))
 	if err != nil {
-		resp := domain.Response{Message: fmt.Sprintf("No post of id %d", id)}
-		utils.Send(404, resp, ctx)
+		utils.SendError(err, ctx)
 		return
 	}
 	utils.Send(200,post, ctx)
@@ -347,6 +363,7 @@ func (fh *ForumHandler) GetPost (ctx *fasthttp.RequestCtx) {
 }
 
 func (fh *ForumHandler) UpdatePost (ctx *fasthttp.RequestCtx) {
+	c := utils.Context(ctx)
 	slug, ok := ctx.UserValue("id").(string)
 	if !ok {
 		utils.Send(400, "bad request", ctx)
@@ -356,16 +373,27 @@ func (fh *ForumHandler) UpdatePost (ctx *fasthttp.RequestCtx) {
 	if err != nil {
 		return
 	}
+	if fh.authz.Enforce {
+		current, err := fh.fr.GetPost(c, domain.Post{Id: int64(id)}, nil)
+		if err != nil {
+			utils.SendError(err, ctx)
+			return
+		}
+		err = fh.authz.Authorize(ctx, current.Post.Forum, func(a policy.Actor) error {
+			return policy.CanEditPost(a, *current.Post)
+		})
+		if err != nil {
+			utils.SendError(err, ctx)
+			return
+		}
+	}
 	post := domain.Post{Id:int64(id)}
-	err = json.Unmarshal(ctx.PostBody(), &post)
-	if err != nil {
-		utils.Send(500, err.Error(), ctx)
+	if !utils.ParseBodyPartial(ctx, &post) {
 		return
 	}
-	edit, err := fh.fr.UpdatePost(post)
+	edit, err := fh.fr.UpdatePost(c, post, auth.Nickname(ctx))
 	if err != nil {
-		resp := domain.Response{Message: fmt.Sprintf("No post of id %d", id)}
-		utils.Send(404, resp, ctx)
+		utils.SendError(err, ctx)
 		return
 	}
 	utils.Send(200, edit, ctx)
@@ -373,45 +401,60 @@ func (fh *ForumHandler) UpdatePost (ctx *fasthttp.RequestCtx) {
 }
 
 func (fh *ForumHandler) VoteThread (ctx *fasthttp.RequestCtx) {
+	c := utils.Context(ctx)
 	slug, ok := ctx.UserValue("slug_or_id").(string)
 	if !ok {
 		utils.Send(400, "bad request", ctx)
 		return
 	}
-	id, err := strconv.Atoi(slug)
+	id, err := fh.threadId(c, slug)
 	if err != nil {
-		id, _ = fh.fr.GetThreadIdBySlug(slug)
+		utils.SendError(err, ctx)
+		return
 	}
 	vote := domain.Vote{IdThread: int64(id)}
-	err = json.Unmarshal(ctx.PostBody(), &vote)
+	if !utils.ParseBody(ctx, &vote) {
+		return
+	}
+	err = fh.fr.VoteThread(c, vote)
+	if errors.Is(err, domain.ErrConflict) {
+		err = fh.fr.UpdateVote(c, vote)
+	}
 	if err != nil {
-		utils.Send(500, err.Error(), ctx)
+		utils.SendError(err, ctx)
 		return
 	}
-	err = fh.fr.VoteThread(vote)
+	th, err := fh.fr.GetThreadInfo(c, id)
 	if err != nil {
-		var pgErr *pgconn.PgError
-		if errors.As(err, &pgErr) {
-			if pgErr.Code == UniqueViolation {
-				err = fh.fr.UpdateVote(vote)
-				th, _ := fh.fr.GetThreadInfo(id)
-				utils.Send(200, th, ctx)
-				return
-			}
-		}
-		resp := domain.Response{Message: fmt.Sprintf("No thread of id %d", id)}
-		utils.Send(404, resp, ctx)
+		utils.SendError(err, ctx)
 		return
 	}
-	th, err := fh.fr.GetThreadInfo(id)
 	utils.Send(200, th, ctx)
 	return
 }
 
+const maxTopForums = 100
+
+// Status answers from the counters kept by triggers, ?exact=true counts every
+// table instead. ?top= lists that many forums by post count, none by default.
 func (fh *ForumHandler) Status (ctx *fasthttp.RequestCtx) {
-	info, err := fh.fr.ServiceStatus()
+	c := utils.Context(ctx)
+	exact, err := utils.GetQueryBool(ctx, "exact")
+	if err != nil {
+		utils.Send(400, domain.Response{Message: "exact must be a boolean"}, ctx)
+		return
+	}
+	top := 0
+	if ctx.QueryArgs().Has("top") {
+		top, err = utils.GetQueryInt(ctx, "top")
+		if err != nil || top < 0 || top > maxTopForums {
+			utils.Send(400, domain.Response{Message: "top must be between 0 and 100"}, ctx)
+			return
+		}
+	}
+	info, err := fh.fr.ServiceStatus(c, exact, top)
 	if err != nil {
-		utils.Send(404, err.Error(), ctx)
+		utils.SendError(err, ctx)
 		return
 	}
 	utils.Send(200, info, ctx)
@@ -419,11 +462,203 @@ func (fh *ForumHandler) Status (ctx *fasthttp.RequestCtx) {
 }
 
 func (fh *ForumHandler) Clear (ctx *fasthttp.RequestCtx) {
-	err := fh.fr.ServiceClear()
+	c := utils.Context(ctx)
+	err := fh.fr.ServiceClear(c)
 	if err != nil {
-		utils.Send(404, err.Error(), ctx)
+		utils.SendError(err, ctx)
 		return
 	}
 	utils.Send(200, "done", ctx)
 	return
-}
\ No newline at end of file
+}
+
+// DeleteForum deletes the forum with its threads, ?purge=true removes them for good
+func (fh *ForumHandler) DeleteForum (ctx *fasthttp.RequestCtx) {
+	c := utils.Context(ctx)
+	slug, ok := ctx.UserValue("slug").(string)
+	if !ok {
+		utils.Send(400, "bad request", ctx)
+		return
+	}
+	purge, err := utils.GetQueryBool(ctx, "purge")
+	if err != nil {
+		utils.Send(400, "bad request", ctx)
+		return
+	}
+	forum, err := fh.fr.GetForum(c, slug)
+	if purge && errors.Is(err, domain.ErrNotFound) {
+		// a deleted forum can still be purged
+		forum, err = domain.Forum{Slug: slug}, nil
+	}
+	if err != nil {
+		utils.SendError(err, ctx)
+		return
+	}
+	var entry *domain.ModerationAction
+	err = fh.authz.Check(ctx, forum.Slug, func(a policy.Actor) error {
+		if purge {
+			entry = audited(a, "", forum.Slug, domain.ActionPurgeForum, forum.Slug)
+			return policy.CanPurge(a)
+		}
+		entry = audited(a, forum.User, forum.Slug, domain.ActionDeleteForum, forum.Slug)
+		return policy.CanDeleteForum(a, forum)
+	})
+	if err != nil {
+		utils.SendError(err, ctx)
+		return
+	}
+	if purge {
+		err = fh.fr.PurgeForum(c, forum.Slug, entry)
+	} else {
+		err = fh.fr.DeleteForum(c, forum.Slug, entry)
+	}
+	if err != nil {
+		utils.SendError(err, ctx)
+		return
+	}
+	utils.Send(200, domain.Response{Message: "Forum " + forum.Slug + " deleted"}, ctx)
+}
+
+// DeleteThread deletes the thread, ?purge=true removes it for good with its posts and votes
+func (fh *ForumHandler) DeleteThread (ctx *fasthttp.RequestCtx) {
+	c := utils.Context(ctx)
+	slug, ok := ctx.UserValue("slug_or_id").(string)
+	if !ok {
+		utils.Send(400, "bad request", ctx)
+		return
+	}
+	purge, err := utils.GetQueryBool(ctx, "purge")
+	if err != nil {
+		utils.Send(400, "bad request", ctx)
+		return
+	}
+	if purge {
+		// deleted threads are not found by slug any more, purge takes ids
+		id, err := strconv.Atoi(slug)
+		if err != nil {
+			id, err = fh.fr.GetThreadIdBySlug(c, slug)
+		}
+		var entry *domain.ModerationAction
+		if err == nil {
+			err = fh.authz.Check(ctx, "", func(a policy.Actor) error {
+				entry = audited(a, "", "", domain.ActionPurgeThread, strconv.Itoa(id))
+				return policy.CanPurge(a)
+			})
+		}
+		if err == nil {
+			err = fh.fr.PurgeThread(c, id, entry)
+		}
+		if err != nil {
+			utils.SendError(err, ctx)
+			return
+		}
+		utils.Send(200, domain.Response{Message: "Thread " + slug + " purged"}, ctx)
+		return
+	}
+	thread, err := fh.threadBySlugOrId(c, slug)
+	if err != nil {
+		utils.SendError(err, ctx)
+		return
+	}
+	var entry *domain.ModerationAction
+	err = fh.authz.Check(ctx, thread.Forum, func(a policy.Actor) error {
+		entry = audited(a, thread.Author, thread.Forum, domain.ActionDeleteThread, strconv.Itoa(int(thread.Id)))
+		return policy.CanDeleteThread(a, thread)
+	})
+	if err != nil {
+		utils.SendError(err, ctx)
+		return
+	}
+	err = fh.fr.DeleteThread(c, int(thread.Id), entry)
+	if err != nil {
+		utils.SendError(err, ctx)
+		return
+	}
+	utils.Send(200, domain.Response{Message: "Thread " + slug + " deleted"}, ctx)
+}
+
+// DeletePost turns the post into a tombstone and answers with it, ?purge=true
+// removes the post and its replies for good
+func (fh *ForumHandler) DeletePost (ctx *fasthttp.RequestCtx) {
+	c := utils.Context(ctx)
+	param, ok := ctx.UserValue("id").(string)
+	if !ok {
+		utils.Send(400, "bad request", ctx)
+		return
+	}
+	id, err := strconv.ParseInt(param, 10, 64)
+	if err != nil {
+		utils.Send(400, "bad request", ctx)
+		return
+	}
+	purge, err := utils.GetQueryBool(ctx, "purge")
+	if err != nil {
+		utils.Send(400, "bad request", ctx)
+		return
+	}
+	full, err := fh.fr.GetPost(c, domain.Post{Id: id}, nil)
+	if err != nil {
+		utils.SendError(err, ctx)
+		return
+	}
+	post := *full.Post
+	var entry *domain.ModerationAction
+	err = fh.authz.Check(ctx, post.Forum, func(a policy.Actor) error {
+		if purge {
+			entry = audited(a, "", post.Forum, domain.ActionPurgePost, param)
+			return policy.CanPurge(a)
+		}
+		entry = audited(a, post.Author, post.Forum, domain.ActionDelete, param)
+		return policy.CanDeletePost(a, post)
+	})
+	if err != nil {
+		utils.SendError(err, ctx)
+		return
+	}
+	if purge {
+		err = fh.fr.PurgePost(c, id, entry)
+		if err != nil {
+			utils.SendError(err, ctx)
+			return
+		}
+		utils.Send(200, domain.Response{Message: "Post " + param + " purged"}, ctx)
+		return
+	}
+	err = fh.fr.DeletePost(c, id, entry)
+	if err != nil {
+		utils.SendError(err, ctx)
+		return
+	}
+	full, err = fh.fr.GetPost(c, domain.Post{Id: id}, nil)
+	if err != nil {
+		utils.SendError(err, ctx)
+		return
+	}
+	utils.Send(200, full.Post, ctx)
+}
+
+// audited is the moderation log entry of a deletion or purge. Only the owner
+// acting on their own content goes unrecorded, purges have no owner.
+func audited(a policy.Actor, owner string, forum string, action string, target string) *domain.ModerationAction {
+	if owner != "" && a.Is(owner) {
+		return nil
+	}
+	return &domain.ModerationAction{Forum: forum, Moderator: a.Nickname, Action: action, Target: target}
+}
+
+// threadId resolves the {slug_or_id} path parameter
+func (fh *ForumHandler) threadId(c context.Context, slugOrId string) (int, error) {
+	id, err := strconv.Atoi(slugOrId)
+	if err != nil {
+		return fh.fr.GetThreadIdBySlug(c, slugOrId)
+	}
+	return id, nil
+}
+
+func (fh *ForumHandler) threadBySlugOrId(c context.Context, slugOrId string) (domain.Thread, error) {
+	id, err := fh.threadId(c, slugOrId)
+	if err != nil {
+		return domain.Thread{}, err
+	}
+	return fh.fr.GetThreadInfo(c, id)
+}
@@ -0,0 +1,68 @@
+package delivery
+
+import (
+	"testing"
+
+	"github.com/valyala/fasthttp"
+	"repo/internal/pkg/domain"
+)
+
+// call sends a request as actor and returns the status answered
+func call(t *testing.T, client *fasthttp.Client, method, path, actor, body string) int {
+	t.Helper()
+	req, resp := fasthttp.AcquireRequest(), fasthttp.AcquireResponse()
+	defer fasthttp.ReleaseRequest(req)
+	defer fasthttp.ReleaseResponse(resp)
+	req.Header.SetMethod(method)
+	req.SetRequestURI("http://forum" + path)
+	if actor != "" {
+		req.Header.Set(actorHeader, actor)
+	}
+	if body != "" {
+		req.Header.SetContentType("application/json")
+		req.SetBodyString(body)
+	}
+	if err := client.Do(req, resp); err != nil {
+		t.Fatalf("%s %s: %v", method, path, err)
+	}
+	return resp.StatusCode()
+}
+
+func TestModeratorDeletesAreAudited(t *testing.T) {
+	client, store := contractServer(t)
+	for _, c := range []struct{ method, path, actor, body string }{
+		{"POST", "/api/user/alice/create", "", `{"fullname":"Alice","email":"alice@example.com"}`},
+		{"POST", "/api/user/bob/create", "", `{"fullname":"Bob","email":"bob@example.com"}`},
+		{"POST", "/api/forum/create", "", `{"title":"Wonderland","user":"alice","slug":"wonderland"}`},
+		{"POST", "/api/forum/wonderland/create", "", `{"title":"Tea","author":"bob","message":"m","created":"2021-01-01T10:00:00Z"}`},
+		{"POST", "/api/forum/wonderland/create", "", `{"title":"Hole","author":"bob","message":"m","created":"2021-01-02T10:00:00Z"}`},
+		{"POST", "/api/thread/1/create", "", `[{"author":"bob","message":"first"},{"author":"bob","message":"second"}]`},
+		// bob deletes his own post, alice moderates the forum she owns, root is an admin
+		{"DELETE", "/api/post/1", "bob", ""},
+		{"DELETE", "/api/post/2", "alice", ""},
+		{"DELETE", "/api/thread/1", "alice", ""},
+		{"DELETE", "/api/thread/2?purge=true", "root", ""},
+		{"DELETE", "/api/forum/wonderland", "root", ""},
+	} {
+		if status := call(t, client, c.method, c.path, c.actor, c.body); status >= 300 {
+			t.Fatalf("%s %s as %q answered %d", c.method, c.path, c.actor, status)
+		}
+	}
+
+	want := []domain.ModerationAction{
+		{Forum: "wonderland", Moderator: "alice", Action: domain.ActionDelete, Target: "2"},
+		{Forum: "wonderland", Moderator: "alice", Action: domain.ActionDeleteThread, Target: "1"},
+		{Forum: "wonderland", Moderator: "root", Action: domain.ActionPurgeThread, Target: "2"},
+		{Forum: "wonderland", Moderator: "root", Action: domain.ActionDeleteForum, Target: "wonderland"},
+	}
+	got := store.ModerationLog()
+	if len(got) != len(want) {
+		t.Fatalf("moderation log %+v, want %+v", got, want)
+	}
+	for i, w := range want {
+		g := got[i]
+		if g.Forum != w.Forum || g.Moderator != w.Moderator || g.Action != w.Action || g.Target != w.Target {
+			t.Errorf("entry %d = %+v, want %+v", i, g, w)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package delivery
+
+import (
+	"fmt"
+	"github.com/valyala/fasthttp"
+	"repo/internal/pkg/cursor"
+	"repo/internal/pkg/domain"
+	"repo/internal/pkg/utils"
+	"strings"
+)
+
+func usersScope(slug string, desc bool) string {
+	return fmt.Sprintf("users:%s:%t", strings.ToLower(slug), desc)
+}
+
+func threadsScope(slug string, desc bool) string {
+	return fmt.Sprintf("threads:%s:%t", strings.ToLower(slug), desc)
+}
+
+func postsScope(thread int32, sort string, desc bool) string {
+	if sort == "" {
+		sort = "flat"
+	}
+	return fmt.Sprintf("posts:%d:%s:%t", thread, sort, desc)
+}
+
+// after decodes the cursor query parameter. It answers 400 and returns false
+// when the token is forged or was issued for another listing.
+func (fh *ForumHandler) after(ctx *fasthttp.RequestCtx, scope string) (*domain.Cursor, bool) {
+	token := utils.GetQueryString(ctx, "cursor")
+	if token == "" {
+		return nil, true
+	}
+	key, err := fh.cursors.Decode(scope, token)
+	if err != nil {
+		utils.SendError(err, ctx)
+		return nil, false
+	}
+	return &key, true
+}
+
+func (fh *ForumHandler) setNext(ctx *fasthttp.RequestCtx, scope string, key domain.Cursor) {
+	ctx.Response.Header.Set(cursor.Header, fh.cursors.Encode(scope, key))
+}
+
+// A full page may be followed by another one, a short page is the last.
+
+func (fh *ForumHandler) nextUsers(ctx *fasthttp.RequestCtx, scope string, limit int, users []domain.User) {
+	if limit > 0 && len(users) == limit {
+		fh.setNext(ctx, scope, domain.Cursor{Nickname: users[len(users)-1].Nickname})
+	}
+}
+
+func (fh *ForumHandler) nextThreads(ctx *fasthttp.RequestCtx, scope string, limit int, threads []domain.Thread) {
+	if limit > 0 && len(threads) == limit {
+		last := threads[len(threads)-1]
+		fh.setNext(ctx, scope, domain.Cursor{Pinned: last.Pinned, Created: last.Created, Id: int64(last.Id)})
+	}
+}
+
+func (fh *ForumHandler) nextPosts(ctx *fasthttp.RequestCtx, scope string, sort string, limit int, posts []domain.Post) {
+	if limit <= 0 || len(posts) == 0 {
+		return
+	}
+	last := posts[len(posts)-1]
+	switch sort {
+	case "parent_tree":
+		// limit counts root posts here
+		roots := 0
+		for i, post := range posts {
+			if i == 0 || post.Path[0] != posts[i-1].Path[0] {
+				roots++
+			}
+		}
+		if roots == limit {
+			fh.setNext(ctx, scope, domain.Cursor{Id: last.Path[0]})
+		}
+	case "tree":
+		if len(posts) == limit {
+			fh.setNext(ctx, scope, domain.Cursor{Path: last.Path})
+		}
+	default:
+		if len(posts) == limit {
+			fh.setNext(ctx, scope, domain.Cursor{Id: last.Id})
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package delivery
+
+import (
+	"context"
+	"testing"
+
+	"github.com/valyala/fasthttp"
+	"repo/internal/pkg/domain"
+)
+
+// statusRepo records the arguments of ServiceStatus, the other methods are not used
+type statusRepo struct {
+	domain.ForumRepository
+	exact bool
+	top   int
+}
+
+func (r *statusRepo) ServiceStatus(ctx context.Context, exact bool, top int) (domain.Status, error) {
+	r.exact, r.top = exact, top
+	return domain.Status{TopForums: []domain.Forum{}}, nil
+}
+
+func TestStatusArguments(t *testing.T) {
+	cases := []struct {
+		query  string
+		status int
+		exact  bool
+		top    int
+	}{
+		{"", fasthttp.StatusOK, false, 0},
+		{"exact=true", fasthttp.StatusOK, true, 0},
+		{"exact=false&top=3", fasthttp.StatusOK, false, 3},
+		{"top=0", fasthttp.StatusOK, false, 0},
+		{"top=100", fasthttp.StatusOK, false, 100},
+		{"top=101", fasthttp.StatusBadRequest, false, -1},
+		{"top=-1", fasthttp.StatusBadRequest, false, -1},
+		{"top=many", fasthttp.StatusBadRequest, false, -1},
+		{"exact=maybe", fasthttp.StatusBadRequest, false, -1},
+	}
+	for _, c := range cases {
+		repo := &statusRepo{top: -1}
+		fh := ForumHandler{fr: repo}
+		var ctx fasthttp.RequestCtx
+		ctx.Request.SetRequestURI("/api/service/status?" + c.query)
+		fh.Status(&ctx)
+		if got := ctx.Response.StatusCode(); got != c.status {
+			t.Errorf("%q: status %d, want %d", c.query, got, c.status)
+		}
+		if repo.exact != c.exact || repo.top != c.top {
+			t.Errorf("%q: ServiceStatus(exact=%v, top=%d), want (%v, %d)", c.query, repo.exact, repo.top, c.exact, c.top)
+		}
+	}
+}
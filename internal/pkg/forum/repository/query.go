@@ -0,0 +1,178 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"repo/internal/pkg/domain"
+	"strconv"
+	"strings"
+)
+
+// query composes a SELECT out of fixed SQL fragments.
+// Caller supplied values never become part of the SQL text, they are only
+// ever bound as positional parameters.
+type query struct {
+	args  *[]interface{}
+	sel   string
+	where []string
+	order []string
+	limit string
+}
+
+func newQuery(sel string) *query {
+	return &query{args: &[]interface{}{}, sel: sel}
+}
+
+// sub starts a nested query sharing the parameter list of q, to be embedded with String.
+func (q *query) sub(sel string) *query {
+	return &query{args: q.args, sel: sel}
+}
+
+func (q *query) param(value interface{}) string {
+	*q.args = append(*q.args, value)
+	return fmt.Sprintf("$%d", len(*q.args))
+}
+
+// Where adds a condition joined with AND. Every "?" in cond is replaced by
+// the placeholder of the next value.
+func (q *query) Where(cond string, values ...interface{}) *query {
+	parts := strings.Split(cond, "?")
+	if len(parts)-1 != len(values) {
+		panic(fmt.Sprintf("query: %d placeholders in %q, got %d values", len(parts)-1, cond, len(values)))
+	}
+	var b strings.Builder
+	b.WriteString(parts[0])
+	for i, value := range values {
+		b.WriteString(q.param(value))
+		b.WriteString(parts[i+1])
+	}
+	q.where = append(q.where, b.String())
+	return q
+}
+
+func (q *query) OrderBy(columns ...string) *query {
+	q.order = append(q.order, columns...)
+	return q
+}
+
+// Limit bounds the result, a non-positive n means no limit.
+func (q *query) Limit(n int) *query {
+	if n > 0 {
+		q.limit = q.param(n)
+	}
+	return q
+}
+
+func (q *query) String() string {
+	var b strings.Builder
+	b.WriteString(q.sel)
+	if len(q.where) > 0 {
+		b.WriteString(" WHERE ")
+		b.WriteString(strings.Join(q.where, " AND "))
+	}
+	if len(q.order) > 0 {
+		b.WriteString(" ORDER BY ")
+		b.WriteString(strings.Join(q.order, ", "))
+	}
+	if q.limit != "" {
+		b.WriteString(" LIMIT ")
+		b.WriteString(q.limit)
+	}
+	return b.String()
+}
+
+func (q *query) Build() (string, []interface{}) {
+	return q.String(), *q.args
+}
+
+func direction(desc bool) string {
+	if desc {
+		return " DESC"
+	}
+	return ""
+}
+
+// after picks the comparison that continues a listing past since
+func after(desc bool) string {
+	if desc {
+		return "<"
+	}
+	return ">"
+}
+
+const postColumns = "SELECT " + postFields + ", treeOrder FROM Posts"
+
+var errNoSort = errors.New("NoSort")
+
+// The listings continue after a cursor when one is given, after since otherwise.
+
+func usersQuery(slug string, limit int, since string, desc bool, cur *domain.Cursor) *query {
+	q := newQuery("SELECT u.nickname, u.fullname, u.about, u.email FROM users as u inner join forumUsers as f on u.nickname = f.nickname").
+		Where("f.slug = ?", slug)
+	if cur != nil {
+		q.Where("f.nickname "+after(desc)+" ?::citext", cur.Nickname)
+	} else if since != "" {
+		q.Where("f.nickname "+after(desc)+" ?::citext", since)
+	}
+	return q.OrderBy("u.nickname" + direction(desc)).Limit(limit)
+}
+
+func threadsQuery(slug string, since string, desc bool, limit int, cur *domain.Cursor) *query {
+	q := newQuery("SELECT "+threadColumns+" FROM Threads").
+		Where("forum = ?", slug).Where("NOT IsDeleted")
+	if cur != nil {
+		// pinned threads come first whatever the direction,
+		// id breaks ties between threads created at the same time
+		q.Where("(IsPinned < ?::boolean OR (IsPinned = ?::boolean AND (created, id) "+after(desc)+" (?::timestamptz, ?)))",
+			cur.Pinned, cur.Pinned, cur.Created, cur.Id)
+	} else if since != "" {
+		// unlike the other listings since is inclusive here
+		q.Where("created "+after(desc)+"= ?::timestamptz", since)
+	}
+	return q.OrderBy("IsPinned DESC", "created"+direction(desc), "id"+direction(desc)).Limit(limit)
+}
+
+func postsQuery(id int, limit int, since int, sort string, desc bool, cur *domain.Cursor) (*query, error) {
+	q := newQuery(postColumns)
+	switch sort {
+	case "flat", "":
+		q.Where("Thread = ?", id)
+		if cur != nil {
+			q.Where("id "+after(desc)+" ?", cur.Id)
+		} else if since > 0 {
+			q.Where("id "+after(desc)+" ?", since)
+		}
+		q.OrderBy("id" + direction(desc)).Limit(limit)
+	case "tree":
+		q.Where("Thread = ?", id)
+		if cur != nil {
+			q.Where("treeOrder "+after(desc)+" ?::bigint[]", pathLiteral(cur.Path))
+		} else if since > 0 {
+			q.Where("treeOrder "+after(desc)+" (SELECT treeOrder FROM Posts WHERE id = ?)", since)
+		}
+		q.OrderBy("treeOrder"+direction(desc), "id"+direction(desc)).Limit(limit)
+	case "parent_tree":
+		roots := q.sub("SELECT Id FROM Posts").Where("Thread = ?", id).Where("Parent IS NULL")
+		if cur != nil {
+			// the key of a parent_tree page is its last root post
+			roots.Where("Id "+after(desc)+" ?", cur.Id)
+		} else if since > 0 {
+			roots.Where("treeOrder[1] "+after(desc)+" (SELECT treeOrder[1] FROM Posts WHERE id = ?)", since)
+		}
+		roots.OrderBy("Id" + direction(desc)).Limit(limit)
+		q.Where("treeOrder[1] IN ("+roots.String()+")").
+			OrderBy("treeOrder[1]"+direction(desc), "treeOrder", "id")
+	default:
+		return nil, errNoSort
+	}
+	return q, nil
+}
+
+// pathLiteral formats a materialized path as a PostgreSQL array literal
+func pathLiteral(path []int64) string {
+	parts := make([]string, len(path))
+	for i, id := range path {
+		parts[i] = strconv.FormatInt(id, 10)
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
@@ -0,0 +1,164 @@
+package repository
+
+import (
+	"repo/internal/pkg/domain"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+var hostile = []string{
+	"' OR '1'='1",
+	"x'; DROP TABLE users; --",
+	"2021-01-01' UNION SELECT nickname, email, about, fullname, 1, 1, 1, now() FROM users --",
+	"$1",
+	"?",
+	`\'; SELECT pg_sleep(10); --`,
+}
+
+// assertBound checks that value only reaches the database as a parameter:
+// the SQL text must not depend on it.
+func assertBound(t *testing.T, build func(string) (string, []interface{}), value string) {
+	t.Helper()
+	want, _ := build("benign")
+	sql, args := build(value)
+	if sql != want {
+		t.Errorf("SQL depends on %q:\n got %s\nwant %s", value, sql, want)
+	}
+	for _, arg := range args {
+		if arg == value {
+			return
+		}
+	}
+	t.Errorf("value %q is not bound as a parameter, args %v", value, args)
+}
+
+func assertPlaceholders(t *testing.T, sql string, args []interface{}) {
+	t.Helper()
+	for i := range args {
+		if !strings.Contains(sql, "$"+strconv.Itoa(i+1)) {
+			t.Errorf("parameter $%d unused in %s", i+1, sql)
+		}
+	}
+	if strings.Contains(sql, "$"+strconv.Itoa(len(args)+1)) {
+		t.Errorf("placeholder $%d has no value in %s", len(args)+1, sql)
+	}
+}
+
+func TestUsersQueryBindsSince(t *testing.T) {
+	for _, since := range hostile {
+		for _, desc := range []bool{false, true} {
+			assertBound(t, func(v string) (string, []interface{}) {
+				return usersQuery("forum", 10, v, desc, nil).Build()
+			}, since)
+			sql, args := usersQuery("forum", 10, since, desc, nil).Build()
+			assertPlaceholders(t, sql, args)
+		}
+	}
+}
+
+func TestThreadsQueryBindsSince(t *testing.T) {
+	for _, since := range hostile {
+		for _, desc := range []bool{false, true} {
+			assertBound(t, func(v string) (string, []interface{}) {
+				return threadsQuery("forum", v, desc, 10, nil).Build()
+			}, since)
+			sql, args := threadsQuery("forum", since, desc, 10, nil).Build()
+			assertPlaceholders(t, sql, args)
+		}
+	}
+}
+
+func TestSlugIsBound(t *testing.T) {
+	for _, slug := range hostile {
+		assertBound(t, func(v string) (string, []interface{}) {
+			return usersQuery(v, 0, "", false, nil).Build()
+		}, slug)
+		assertBound(t, func(v string) (string, []interface{}) {
+			return threadsQuery(v, "", false, 0, nil).Build()
+		}, slug)
+	}
+}
+
+func TestPostsQuery(t *testing.T) {
+	cases := []struct {
+		sort  string
+		since int
+		limit int
+		desc  bool
+		want  string
+	}{
+		{"flat", 0, 0, false, postColumns + " WHERE Thread = $1 ORDER BY id"},
+		{"", 5, 3, true, postColumns + " WHERE Thread = $1 AND id < $2 ORDER BY id DESC LIMIT $3"},
+		{"tree", 5, 3, false, postColumns + " WHERE Thread = $1 AND treeOrder > (SELECT treeOrder FROM Posts WHERE id = $2) ORDER BY treeOrder, id LIMIT $3"},
+		{"parent_tree", 5, 3, true, postColumns + " WHERE treeOrder[1] IN (SELECT Id FROM Posts WHERE Thread = $1 AND Parent IS NULL AND treeOrder[1] < (SELECT treeOrder[1] FROM Posts WHERE id = $2) ORDER BY Id DESC LIMIT $3) ORDER BY treeOrder[1] DESC, treeOrder, id"},
+	}
+	for _, c := range cases {
+		q, err := postsQuery(42, c.limit, c.since, c.sort, c.desc, nil)
+		if err != nil {
+			t.Fatalf("sort %q: %v", c.sort, err)
+		}
+		sql, args := q.Build()
+		if sql != c.want {
+			t.Errorf("sort %q:\n got %s\nwant %s", c.sort, sql, c.want)
+		}
+		assertPlaceholders(t, sql, args)
+	}
+}
+
+func TestPostsQueryCursor(t *testing.T) {
+	cases := []struct {
+		sort string
+		cur  domain.Cursor
+		want string
+	}{
+		{"flat", domain.Cursor{Id: 7}, postColumns + " WHERE Thread = $1 AND id > $2 ORDER BY id LIMIT $3"},
+		{"tree", domain.Cursor{Path: []int64{1, 7}}, postColumns + " WHERE Thread = $1 AND treeOrder > $2::bigint[] ORDER BY treeOrder, id LIMIT $3"},
+		{"parent_tree", domain.Cursor{Id: 7}, postColumns + " WHERE treeOrder[1] IN (SELECT Id FROM Posts WHERE Thread = $1 AND Parent IS NULL AND Id > $2 ORDER BY Id LIMIT $3) ORDER BY treeOrder[1], treeOrder, id"},
+	}
+	for _, c := range cases {
+		// since is ignored once a cursor is given
+		q, err := postsQuery(42, 3, 5, c.sort, false, &c.cur)
+		if err != nil {
+			t.Fatalf("sort %q: %v", c.sort, err)
+		}
+		sql, args := q.Build()
+		if sql != c.want {
+			t.Errorf("sort %q:\n got %s\nwant %s", c.sort, sql, c.want)
+		}
+		assertPlaceholders(t, sql, args)
+	}
+	if got := pathLiteral([]int64{1, 7}); got != "{1,7}" {
+		t.Errorf("pathLiteral = %s", got)
+	}
+}
+
+func TestThreadsQueryCursorBreaksTies(t *testing.T) {
+	created := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	sql, args := threadsQuery("forum", "2020-01-01T00:00:00Z", true, 10, &domain.Cursor{Created: created, Id: 3}).Build()
+	want := "SELECT " + threadColumns + " FROM Threads WHERE forum = $1 AND NOT IsDeleted" +
+		" AND (IsPinned < $2::boolean OR (IsPinned = $3::boolean AND (created, id) < ($4::timestamptz, $5)))" +
+		" ORDER BY IsPinned DESC, created DESC, id DESC LIMIT $6"
+	if sql != want {
+		t.Errorf("\n got %s\nwant %s", sql, want)
+	}
+	assertPlaceholders(t, sql, args)
+}
+
+func TestPostsQueryRejectsUnknownSort(t *testing.T) {
+	for _, sort := range append(hostile, "tree; DROP TABLE posts") {
+		if _, err := postsQuery(1, 0, 0, sort, false, nil); err != errNoSort {
+			t.Errorf("sort %q: expected errNoSort, got %v", sort, err)
+		}
+	}
+}
+
+func TestWherePanicsOnArgumentMismatch(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("expected panic")
+		}
+	}()
+	newQuery("SELECT 1").Where("a = ? AND b = ?", 1)
+}
@@ -5,14 +5,39 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"github.com/jackc/pgx/v4"
 	"github.com/jackc/pgx/v4/pgxpool"
 	"repo/internal/pkg/domain"
+	"repo/internal/pkg/metrics"
+	"repo/internal/pkg/utils"
 	"strings"
 	"time"
 )
 
 
 
+// threadColumns lists what scanThread reads, Threads has more columns than that
+const threadColumns = "Id, Title, Forum, Message, Author, Votes, Slug, Created, IsPinned, IsLocked"
+
+// postFields lists what scanPost reads. Hidden and deleted posts lose their text.
+const postFields = "Id, COALESCE(Parent, 0), Author, CASE WHEN IsHidden OR IsDeleted THEN '' ELSE Message END," +
+	" IsEdited, Forum, Thread, Created, IsHidden, IsDeleted"
+
+func scanThread(row pgx.Row, thread *domain.Thread) error {
+	// as slug is optional, and pgx cannot read null strings
+	slug := sql.NullString{}
+	err := row.Scan(&thread.Id, &thread.Title, &thread.Forum, &thread.Message, &thread.Author, &thread.Votes, &slug, &thread.Created,
+		&thread.Pinned, &thread.Locked)
+	thread.Slug = slug.String
+	return err
+}
+
+func scanPost(row pgx.Row, post *domain.Post, extra ...interface{}) error {
+	dest := []interface{}{&post.Id, &post.Parent, &post.Author, &post.Message, &post.IsEdited, &post.Forum, &post.Thread, &post.Created,
+		&post.Hidden, &post.Deleted}
+	return row.Scan(append(dest, extra...)...)
+}
+
 type ForumRepository struct {
 	dbm *pgxpool.Pool
 	userRep domain.UserRepository
@@ -22,49 +47,48 @@ func NewForumRep (pool *pgxpool.Pool, ur domain.UserRepository) ForumRepository
 	return ForumRepository{dbm: pool, userRep: ur}
 }
 
-func (f *ForumRepository) AddForum(forum domain.Forum) (domain.Forum,error) {
-	query := "INSERT INTO forum (Title, Usr, Slug) VALUES ($1, $2, $3) RETURNING *;"
+func (f *ForumRepository) AddForum(ctx context.Context, forum domain.Forum) (domain.Forum,error) {
+	defer metrics.Query("forum", "AddForum")()
+	query := "INSERT INTO forum (Title, Usr, Slug) VALUES ($1, $2, $3) RETURNING Title, Usr, Slug, Posts, Threads;"
 
 	var newForum domain.Forum
-	user, err := f.userRep.GetUser(forum.User)
-	if err != nil || len(user) == 0 {
-		return domain.Forum{}, errors.New("NO SUCH USER")
+	user, err := f.userRep.GetUser(ctx, forum.User)
+	if errors.Is(err, domain.ErrNotFound) {
+		return domain.Forum{}, domain.NewError(domain.ErrUserMissing, "Can't find user by nickname: %s", forum.User)
 	}
-	row := f.dbm.QueryRow(context.Background(), query, forum.Title, user[0].Nickname, forum.Slug)
+	if err != nil {
+		return domain.Forum{}, err
+	}
+	row := f.dbm.QueryRow(ctx, query, forum.Title, user[0].Nickname, forum.Slug)
 	err = row.Scan(&newForum.Title, &newForum.User, &newForum.Slug, &newForum.Posts, &newForum.Threads)
+	if pgErr := utils.PgError(err); pgErr != nil && pgErr.Code == utils.UniqueViolation {
+		return domain.Forum{}, domain.NewError(domain.ErrConflict, "Forum with slug %s already exists", forum.Slug)
+	}
 	if err != nil {
 		return domain.Forum{}, err
 	}
 	return newForum, err
 }
 
-func (f *ForumRepository) GetForum(slug string) (domain.Forum, error) {
-	query := "SELECT Title, Usr, Slug, Posts, Threads from Forum WHERE slug=$1"
+func (f *ForumRepository) GetForum(ctx context.Context, slug string) (domain.Forum, error) {
+	defer metrics.Query("forum", "GetForum")()
+	query := "SELECT Title, Usr, Slug, Posts, Threads from Forum WHERE slug=$1 AND NOT IsDeleted"
 	var forum domain.Forum
-	row:= f.dbm.QueryRow(context.Background(), query, slug)
+	row:= f.dbm.QueryRow(ctx, query, slug)
 	err := row.Scan(&forum.Title, &forum.User, &forum.Slug, &forum.Posts, &forum.Threads)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return domain.Forum{}, domain.NewError(domain.ErrNotFound, "Can't find forum with slug: %s", slug)
+	}
 	if err != nil {
 		return domain.Forum{}, err
 	}
 	return forum, err
 }
 
-func (f *ForumRepository) GetUsers(slug string, limit int, since string, desc bool) ([]domain.User, error) {
-	query := "SELECT u.nickname, u.fullname, u.about, u.email FROM users as u inner join forumUsers as f on u.nickname = f.nickname WHERE f.slug =$1 "
-	if desc {
-		if since != "" {
-			query += fmt.Sprintf(" AND f.nickname < '%s' ", since)
-		}
-		query += " ORDER BY u.nickname desc "
-	} else {
-		if since != "" {
-			query += fmt.Sprintf(" AND f.nickname > '%s' ", since)
-		}
-		query +=  " ORDER BY u.nickname "
-	}
-	query += "LIMIT NULLIF($2, 0)"
-
-	rows, err := f.dbm.Query(context.Background(),query, slug, limit)
+func (f *ForumRepository) GetUsers(ctx context.Context, slug string, limit int, since string, desc bool, after *domain.Cursor) ([]domain.User, error) {
+	defer metrics.Query("forum", "GetUsers")()
+	query, args := usersQuery(slug, limit, since, desc, after).Build()
+	rows, err := f.dbm.Query(ctx, query, args...)
 	if err != nil {
 		return []domain.User{}, err
 	}
@@ -82,10 +106,11 @@ func (f *ForumRepository) GetUsers(slug string, limit int, since string, desc bo
 	return users, nil
 }
 
-func (f *ForumRepository) AddThread(thread domain.Thread) (domain.Thread, error) {
-	query := "INSERT INTO Threads (Title, Forum, Message, Author, Slug, Created)  VALUES ($1, $2, $3, $4, $5, $6) RETURNING *"
+func (f *ForumRepository) AddThread(ctx context.Context, thread domain.Thread) (domain.Thread, error) {
+	defer metrics.Query("forum", "AddThread")()
+	query := "INSERT INTO Threads (Title, Forum, Message, Author, Slug, Created)  VALUES ($1, $2, $3, $4, $5, $6) RETURNING " + threadColumns
 	newThread := domain.Thread{}
-	forum, err := f.GetForum(thread.Forum)
+	forum, err := f.GetForum(ctx, thread.Forum)
 	if err != nil {
 		return domain.Thread{}, err
 	}
@@ -93,11 +118,17 @@ func (f *ForumRepository) AddThread(thread domain.Thread) (domain.Thread, error)
 	if thread.Slug == "" {
 		insert = nil
 	}
-	row := f.dbm.QueryRow(context.Background(), query, thread.Title, forum.Slug, thread.Message, thread.Author, insert, thread.Created)
-	slug := sql.NullString{}
-	err = row.Scan(&newThread.Id, &newThread.Title, &newThread.Forum, &newThread.Message, &newThread.Author, &newThread.Votes, &slug, &newThread.Created)
-	if slug.Valid {
-		newThread.Slug = slug.String
+	row := f.dbm.QueryRow(ctx, query, thread.Title, forum.Slug, thread.Message, thread.Author, insert, thread.Created)
+	err = scanThread(row, &newThread)
+	if pgErr := utils.PgError(err); pgErr != nil {
+		switch pgErr.Code {
+		case utils.UniqueViolation:
+			return domain.Thread{}, domain.NewError(domain.ErrConflict, "Thread with slug %s already exists", thread.Slug)
+		case utils.ForeignKeyViolation:
+			return domain.Thread{}, domain.NewError(domain.ErrUserMissing, "Can't find user by nickname: %s", thread.Author)
+		case utils.UserBanned:
+			return domain.Thread{}, domain.NewError(domain.ErrForbidden, "Author is banned from forum %s", forum.Slug)
+		}
 	}
 	if err != nil {
 		return domain.Thread{}, err
@@ -105,21 +136,10 @@ func (f *ForumRepository) AddThread(thread domain.Thread) (domain.Thread, error)
 	return newThread, nil
 }
 
-func (f *ForumRepository) GetThreads(slug string, since string, desc bool, limit int) ([]domain.Thread, error) {
-	query := "SELECT Id, Title, Forum, Message, Author, Votes, Slug, Created FROM Threads  WHERE forum = $1 "
-	if desc {
-		if since != "" {
-			query += fmt.Sprintf(" AND created <= '%s' ", since)
-		}
-		query += " ORDER BY created desc "
-	} else {
-		if since != "" {
-			query += fmt.Sprintf(" AND created >= '%s' ", since)
-		}
-		query += " ORDER BY created asc "
-	}
-	query += " LIMIT NULLIF($2, 0)"
-	rows, err := f.dbm.Query(context.Background(),query, slug, limit)
+func (f *ForumRepository) GetThreads(ctx context.Context, slug string, since string, desc bool, limit int, after *domain.Cursor) ([]domain.Thread, error) {
+	defer metrics.Query("forum", "GetThreads")()
+	query, args := threadsQuery(slug, since, desc, limit, after).Build()
+	rows, err := f.dbm.Query(ctx, query, args...)
 	if err != nil {
 		return []domain.Thread{}, err
 	}
@@ -128,11 +148,7 @@ func (f *ForumRepository) GetThreads(slug string, since string, desc bool, limit
 	threads := []domain.Thread{}
 	for rows.Next() {
 		newThread := domain.Thread{}
-		slug := sql.NullString{}
-		err = rows.Scan(&newThread.Id, &newThread.Title, &newThread.Forum, &newThread.Message, &newThread.Author, &newThread.Votes, &slug, &newThread.Created)
-		if slug.Valid {
-			newThread.Slug = slug.String
-		}
+		err = scanThread(rows, &newThread)
 		if err != nil {
 			return []domain.Thread{}, err
 		}
@@ -141,25 +157,26 @@ func (f *ForumRepository) GetThreads(slug string, since string, desc bool, limit
 	return threads, nil
 }
 
-func (f *ForumRepository) CheckThreads(slug string) (bool, error) {
-	query := "SELECT EXISTS(SELECT 1 FROM Threads WHERE forum=$1)"
-	notNull := false
-	err := f.dbm.QueryRow(context.Background(), query, slug).Scan(&notNull)
-	return notNull, err
-}
-
-func (f *ForumRepository) GetThreadIdBySlug(slug string) (int, error) {
-	query := "SELECT Id FROM Threads WHERE slug = $1"
-	row := f.dbm.QueryRow(context.Background(), query, slug)
+func (f *ForumRepository) GetThreadIdBySlug(ctx context.Context, slug string) (int, error) {
+	defer metrics.Query("forum", "GetThreadIdBySlug")()
+	query := "SELECT Id FROM Threads WHERE slug = $1 AND NOT IsDeleted"
+	row := f.dbm.QueryRow(ctx, query, slug)
 	newThread := domain.Thread{}
 	err := row.Scan(&newThread.Id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return -1, domain.NewError(domain.ErrNotFound, "Can't find thread with slug: %s", slug)
+	}
 	if err != nil {
 		return -1, err
 	}
 	return int(newThread.Id), err
 }
 
-func (f *ForumRepository) AddPosts(id int, forumSlug string, posts []domain.Post) ([]domain.Post, error) {
+func (f *ForumRepository) AddPosts(ctx context.Context, id int, forumSlug string, posts []domain.Post) ([]domain.Post, error) {
+	defer metrics.Query("forum", "AddPosts")()
+	if err := f.checkModeration(ctx, id, forumSlug, posts); err != nil {
+		return []domain.Post{}, err
+	}
 	query := "INSERT INTO Posts (Parent, Author, Message, Forum, Thread, Created) VALUES"
 	var values []interface{}
 	var valuesID []string
@@ -175,135 +192,99 @@ func (f *ForumRepository) AddPosts(id int, forumSlug string, posts []domain.Post
 			forumSlug, id, createdTime)
 	}
 	query += strings.Join(valuesID[:], ",")
-	query +=	" RETURNING Id, Parent, Author, Message, Forum, Thread, Created"
-	rows, err := f.dbm.Query(context.Background(),query, values...)
-	defer func() {
-		if rows != nil {
-			rows.Close()
-		}
-	}()
+	query +=	" RETURNING Id, COALESCE(Parent, 0), Author, Message, Forum, Thread, Created"
+	rows, err := f.dbm.Query(ctx,query, values...)
 	if err != nil {
-		return newPosts, err
+		return newPosts, postsError(err)
 	}
+	defer rows.Close()
 
 	for rows.Next() {
 		newPost := domain.Post{}
 		err := rows.Scan(&newPost.Id, &newPost.Parent, &newPost.Author, &newPost.Message,
 			&newPost.Forum, &newPost.Thread, &newPost.Created)
 		if err != nil {
-			return newPosts, err
+			return newPosts, postsError(err)
 		}
 		newPosts = append(newPosts, newPost)
 	}
+	if err = rows.Err(); err != nil {
+		return []domain.Post{}, postsError(err)
+	}
 	return newPosts, nil
 }
 
-func (f *ForumRepository) GetPosts(id int, limit int, since int, sort string, desc bool) ([]domain.Post, error) {
-	switch sort {
-	case "flat", "":
-		query:= "SELECT Id, Parent, Author, Message, IsEdited, Forum, Thread, Created FROM Posts WHERE Thread = $1"
-		if desc {
-			if since > 0 {
-				query += fmt.Sprintf(" AND id < %d ", since)
-			}
-			query += " ORDER BY id DESC "
-		} else {
-			if since > 0 {
-				query += fmt.Sprintf(" AND id > %d ", since)
-			}
-			query += " ORDER BY id "
-		}
-		query += " LIMIT NULLIF($2, 0)"
-		posts := []domain.Post{}
-		rows, err  := f.dbm.Query(context.Background(), query, id, limit)
-		defer rows.Close()
-		if err != nil {
-			return posts, err
-		}
-		for rows.Next() {
-			gotten := domain.Post{}
-			err = rows.Scan(&gotten.Id, &gotten.Parent, &gotten.Author, &gotten.Message, &gotten.IsEdited, &gotten.Forum, &gotten.Thread, &gotten.Created)
-			if err!=nil {
-				return posts, err
-			}
-			posts = append(posts, gotten)
-		}
-		return posts, nil
-	case "tree":
-		query := "SELECT Id, Parent, Author, Message, IsEdited, Forum, Thread, Created FROM Posts WHERE thread=$1 "
-		if desc {
-			if since > 0 {
-				query += fmt.Sprintf(" AND treeOrder < (SELECT treeOrder FROM Posts WHERE id = %d)", since)
-			}
-			query += " ORDER BY treeOrder DESC, id DESC"
-		} else {
-			if since > 0 {
-				query += fmt.Sprintf(" AND treeOrder > (SELECT treeOrder FROM Posts WHERE id = %d)", since)
-			}
-			query += " ORDER BY treeOrder, id "
-		}
-		if limit > 0 {
-			query += " LIMIT $2"
-		}
-		posts := []domain.Post{}
-		rows, err  := f.dbm.Query(context.Background(), query, id, limit)
-		defer rows.Close()
-		if err != nil {
-			return posts, err
-		}
-		for rows.Next() {
-			gotten := domain.Post{}
-			err = rows.Scan(&gotten.Id, &gotten.Parent, &gotten.Author, &gotten.Message, &gotten.IsEdited, &gotten.Forum, &gotten.Thread, &gotten.Created)
-			posts = append(posts, gotten)
-		}
-		return posts, nil
-	case "parent_tree":
-		query := "SELECT Id, Parent, Author, Message, IsEdited, Forum, Thread, Created FROM Posts WHERE "
-		query += " treeOrder[1] IN (SELECT ID FROM Posts WHERE Thread =$1 AND Parent=0 "
-		if desc {
-			if since > 0 {
-				query += fmt.Sprintf(" AND treeOrder[1] < (SELECT treeOrder[1] FROM Posts WHERE id = %d) ", since)
-			}
-			query += " ORDER BY Id DESC"
-			if limit > 0 {
-				query += " LIMIT $2 "
-			}
-			query += " ) ORDER BY treeOrder[1] DESC, treeOrder, id"
-		} else {
-			if since > 0 {
-				query += fmt.Sprintf("AND treeOrder[1] > (SELECT treeOrder[1] FROM Posts WHERE id = %d) ", since)
-			}
-			query += " ORDER BY Id"
-			if limit > 0 {
-				query += " LIMIT $2 "
-			}
-			query += " ) ORDER BY treeOrder[1],treeOrder, id "
-		}
-		posts := []domain.Post{}
-		rows, err  := f.dbm.Query(context.Background(), query, id, limit)
-		defer rows.Close()
+// checkModeration rejects posts to a locked thread or by an author banned from the forum,
+// with one lookup for the whole batch
+func (f *ForumRepository) checkModeration(ctx context.Context, id int, forumSlug string, posts []domain.Post) error {
+	authors := make([]string, 0, len(posts))
+	for _, element := range posts {
+		authors = append(authors, element.Author)
+	}
+	query := "SELECT IsLocked, EXISTS (SELECT 1 FROM forum_bans WHERE Forum = $2 AND Nickname = ANY($3::text[]::citext[]))" +
+		" FROM Threads WHERE Id = $1"
+	var locked, banned bool
+	err := f.dbm.QueryRow(ctx, query, id, forumSlug, authors).Scan(&locked, &banned)
+	switch {
+	case errors.Is(err, pgx.ErrNoRows):
+		return domain.NewError(domain.ErrNotFound, "Can't find thread with id: %d", id)
+	case err != nil:
+		return err
+	case locked:
+		return domain.NewError(domain.ErrForbidden, "Thread is locked")
+	case banned:
+		return domain.NewError(domain.ErrForbidden, "Author is banned from this forum")
+	}
+	return nil
+}
+
+// postsError translates failures of the batched post insert, which surface on the first row read.
+func postsError(err error) error {
+	pgErr := utils.PgError(err)
+	if pgErr == nil {
+		return err
+	}
+	switch pgErr.Code {
+	case utils.InvalidParent:
+		return domain.NewError(domain.ErrInvalidParent, "Parent post was created in another thread")
+	case utils.ForeignKeyViolation:
+		return domain.NewError(domain.ErrUserMissing, "Can't find post author by nickname")
+	}
+	return err
+}
+
+func (f *ForumRepository) GetPosts(ctx context.Context, id int, limit int, since int, sort string, desc bool, after *domain.Cursor) ([]domain.Post, error) {
+	defer metrics.Query("forum", "GetPosts")()
+	q, err := postsQuery(id, limit, since, sort, desc, after)
+	if err != nil {
+		return nil, domain.NewError(domain.ErrInvalid, "Unknown sort: %s", sort)
+	}
+	query, args := q.Build()
+	posts := []domain.Post{}
+	rows, err := f.dbm.Query(ctx, query, args...)
+	if err != nil {
+		return posts, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		gotten := domain.Post{}
+		err = scanPost(rows, &gotten, &gotten.Path)
 		if err != nil {
 			return posts, err
 		}
-		for rows.Next() {
-			gotten := domain.Post{}
-			err = rows.Scan(&gotten.Id, &gotten.Parent, &gotten.Author, &gotten.Message, &gotten.IsEdited, &gotten.Forum, &gotten.Thread, &gotten.Created)
-			posts = append(posts, gotten)
-		}
-		return posts, nil
-	default:
-		return nil, errors.New("NoSort")
+		posts = append(posts, gotten)
 	}
+	return posts, rows.Err()
 }
 
-func (f *ForumRepository) GetThreadInfo(id int) (domain.Thread, error) {
-	query := "SELECT Id, Title, Forum, Message, Author, Votes, Slug, Created  FROM threads Where ID = $1"
-	rows := f.dbm.QueryRow(context.Background(),query, id)
+func (f *ForumRepository) GetThreadInfo(ctx context.Context, id int) (domain.Thread, error) {
+	defer metrics.Query("forum", "GetThreadInfo")()
+	query := "SELECT " + threadColumns + " FROM threads Where ID = $1 AND NOT IsDeleted"
+	rows := f.dbm.QueryRow(ctx,query, id)
 	newThread := domain.Thread{}
-	slug := sql.NullString{}
-	err := rows.Scan(&newThread.Id, &newThread.Title, &newThread.Forum, &newThread.Message, &newThread.Author, &newThread.Votes, &slug, &newThread.Created)
-	if slug.Valid {
-		newThread.Slug = slug.String
+	err := scanThread(rows, &newThread)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return domain.Thread{}, domain.NewError(domain.ErrNotFound, "Can't find thread with id: %d", id)
 	}
 	if err != nil {
 		return domain.Thread{}, err
@@ -312,34 +293,66 @@ func (f *ForumRepository) GetThreadInfo(id int) (domain.Thread, error) {
 
 }
 
-func (f *ForumRepository) UpdateThread(thread domain.Thread) (domain.Thread, error) {
+func (f *ForumRepository) UpdateThread(ctx context.Context, thread domain.Thread, editor string) (domain.Thread, error) {
+	defer metrics.Query("forum", "UpdateThread")()
 	query := "UPDATE threads SET Title = COALESCE(NULLIF($1, ''), Title), " +
-		" Message = COALESCE(NULLIF($2, ''), Message) WHERE id = $3 RETURNING *"
-	rows := f.dbm.QueryRow(context.Background(),query, thread.Title, thread.Message, thread.Id)
+		" Message = COALESCE(NULLIF($2, ''), Message), EditedBy = NULLIF($4, '') WHERE id = $3 AND NOT IsDeleted RETURNING " + threadColumns
+	rows := f.dbm.QueryRow(ctx,query, thread.Title, thread.Message, thread.Id, editor)
 	newThread := domain.Thread{}
-	err := rows.Scan(&newThread.Id, &newThread.Title, &newThread.Forum, &newThread.Message, &newThread.Author, &newThread.Votes, &newThread.Slug, &newThread.Created)
+	err := scanThread(rows, &newThread)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return domain.Thread{}, domain.NewError(domain.ErrNotFound, "Can't find thread with id: %d", thread.Id)
+	}
 	if err != nil {
 		return domain.Thread{}, err
 	}
 	return newThread, err
 }
 
-func (f *ForumRepository) VoteThread(vote domain.Vote) error {
-	query := "INSERT INTO Votes (Nickname, Voice, IdThread) VALUES ($1, $2, $3)"
-	_, err := f.dbm.Exec(context.Background(),query, vote.Nickname, vote.Voice, vote.IdThread)
-	return err
+func (f *ForumRepository) VoteThread(ctx context.Context, vote domain.Vote) error {
+	defer metrics.Query("forum", "VoteThread")()
+	// a deleted thread takes no votes, the insert finds no row to copy
+	query := "INSERT INTO Votes (Nickname, Voice, IdThread) SELECT $1::text, $2::int, Id FROM Threads WHERE Id = $3 AND NOT IsDeleted"
+	tag, err := f.dbm.Exec(ctx,query, vote.Nickname, vote.Voice, vote.IdThread)
+	if err == nil && tag.RowsAffected() == 0 {
+		return domain.NewError(domain.ErrNotFound, "Can't find thread with id: %d", vote.IdThread)
+	}
+	return voteError(err, vote)
 }
-func (f *ForumRepository) UpdateVote(vote domain.Vote) error {
+func (f *ForumRepository) UpdateVote(ctx context.Context, vote domain.Vote) error {
+	defer metrics.Query("forum", "UpdateVote")()
 	query:= "UPDATE Votes SET Voice = $1 WHERE IdThread = $2 AND Nickname = $3"
-	_, err := f.dbm.Exec(context.Background(),query, vote.Voice, vote.IdThread, vote.Nickname)
+	_, err := f.dbm.Exec(ctx,query, vote.Voice, vote.IdThread, vote.Nickname)
+	return voteError(err, vote)
+}
+
+func voteError(err error, vote domain.Vote) error {
+	pgErr := utils.PgError(err)
+	if pgErr == nil {
+		return err
+	}
+	switch {
+	case pgErr.Code == utils.UniqueViolation:
+		return domain.NewError(domain.ErrConflict, "User %s already voted for thread %d", vote.Nickname, vote.IdThread)
+	case pgErr.Code == utils.ForeignKeyViolation && pgErr.ConstraintName == "votes_nickname_fkey":
+		return domain.NewError(domain.ErrUserMissing, "Can't find user by nickname: %s", vote.Nickname)
+	case pgErr.Code == utils.ForeignKeyViolation:
+		return domain.NewError(domain.ErrNotFound, "Can't find thread with id: %d", vote.IdThread)
+	}
 	return err
 }
 
-func (f *ForumRepository) GetPost(post domain.Post, related []string) (domain.PostFull, error) {
-	query:= "SELECT Id, Parent, Author, Message, IsEdited, Forum, Thread, Created from Posts WHERE id = $1"
-	row :=  f.dbm.QueryRow(context.Background(), query, post.Id)
+func (f *ForumRepository) GetPost(ctx context.Context, post domain.Post, related []string) (domain.PostFull, error) {
+	defer metrics.Query("forum", "GetPost")()
+	// posts of a deleted thread are gone with it
+	query:= "SELECT " + postFields + " from Posts WHERE id = $1" +
+		" AND NOT EXISTS (SELECT 1 FROM Threads WHERE Threads.Id = Posts.Thread AND Threads.IsDeleted)"
+	row :=  f.dbm.QueryRow(ctx, query, post.Id)
 	gotten := domain.Post{}
-	err := row.Scan(&gotten.Id, &gotten.Parent, &gotten.Author, &gotten.Message, &gotten.IsEdited, &gotten.Forum, &gotten.Thread, &gotten.Created)
+	err := scanPost(row, &gotten)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return domain.PostFull{}, domain.NewError(domain.ErrNotFound, "Can't find post with id: %d", post.Id)
+	}
 	if err != nil {
 		return domain.PostFull{}, err
 	}
@@ -347,19 +360,19 @@ func (f *ForumRepository) GetPost(post domain.Post, related []string) (domain.Po
 	
 	for _, relType := range related {
 		if relType == "user" {
-			us, err := f.userRep.GetUser(gotten.Author)
+			us, err := f.userRep.GetUser(ctx, gotten.Author)
 			if err != nil {
 				return result, err
 			}
 			result.Author = &us[0]
 		} else if relType == "forum" {
-			fr, err := f.GetForum(gotten.Forum)
+			fr, err := f.GetForum(ctx, gotten.Forum)
 			if err != nil {
 				return result, err
 			}
 			result.Forum = &fr
 		} else if relType == "thread" {
-			th, err := f.GetThreadInfo(int(gotten.Thread))
+			th, err := f.GetThreadInfo(ctx, int(gotten.Thread))
 			if err != nil {
 				return result, err
 			}
@@ -369,39 +382,241 @@ func (f *ForumRepository) GetPost(post domain.Post, related []string) (domain.Po
 	return result, nil
 }
 
-func (f *ForumRepository) UpdatePost(post domain.Post) (domain.Post, error) {
-	old, err := f.GetPost(domain.Post{Id:post.Id}, []string{})
+func (f *ForumRepository) UpdatePost(ctx context.Context, post domain.Post, editor string) (domain.Post, error) {
+	defer metrics.Query("forum", "UpdatePost")()
+	old, err := f.GetPost(ctx, domain.Post{Id:post.Id}, []string{})
 	if err != nil {
 		return domain.Post{}, err
 	}
+	if old.Post.Deleted {
+		return domain.Post{}, domain.NewError(domain.ErrConflict, "Post %d was deleted", post.Id)
+	}
 	if old.Post.Message == post.Message || post.Message == "" {
 		return *old.Post, err
 	}
-	query := "UPDATE Posts SET message = $1, isEdited = true WHERE id = $2 RETURNING Id, Parent, Author, Message, IsEdited, Forum, Thread, Created"
-	row :=  f.dbm.QueryRow(context.Background(), query, post.Message, post.Id)
+	query := "UPDATE Posts SET message = $1, isEdited = true, EditedBy = NULLIF($3, '') WHERE id = $2 RETURNING " + postFields
+	row :=  f.dbm.QueryRow(ctx, query, post.Message, post.Id, editor)
 	gotten := domain.Post{}
-	err = row.Scan(&gotten.Id, &gotten.Parent, &gotten.Author, &gotten.Message, &gotten.IsEdited, &gotten.Forum, &gotten.Thread, &gotten.Created)
+	err = scanPost(row, &gotten)
 	if err != nil {
 		return domain.Post{}, err
 	}
 	return gotten, nil
 }
 
-func (f *ForumRepository) ServiceClear() error {
-	query := `TRUNCATE Users, Forum, Threads, Posts, Votes, forumUsers`
-	_, err := f.dbm.Exec(context.Background(),query)
+// audit records a deletion by a moderator or an admin in the moderation log, within the tx of the change
+func audit(ctx context.Context, tx pgx.Tx, entry *domain.ModerationAction) error {
+	if entry == nil {
+		return nil
+	}
+	_, err := tx.Exec(ctx, "INSERT INTO moderation_log (Forum, Moderator, Action, Target, Reason) VALUES ($1, $2, $3, $4, $5)",
+		entry.Forum, entry.Moderator, entry.Action, entry.Target, entry.Reason)
 	return err
 }
 
-func (f *ForumRepository) ServiceStatus() (domain.Status,error) {
-	query := "SELECT * FROM (SELECT COUNT(*) FROM Forum) as forumCount, (SELECT COUNT(*) FROM Threads) as threadCount, (SELECT COUNT(*) FROM Users) as userCount, (SELECT COUNT(*) FROM Posts) as postCount"
-	row := f.dbm.QueryRow(context.Background(), query)
-	st := domain.Status{}
-	err := row.Scan(&st.Forums, &st.Threads, &st.Users, &st.Posts)
+func (f *ForumRepository) DeletePost(ctx context.Context, id int64, entry *domain.ModerationAction) error {
+	defer metrics.Query("forum", "DeletePost")()
+	tx, err := f.dbm.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+	tag, err := tx.Exec(ctx, "UPDATE Posts SET IsDeleted = true, Message = '' WHERE Id = $1 AND NOT IsDeleted", id)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		// deleting twice is not an error, the tombstone is still there
+		var exists bool
+		err = tx.QueryRow(ctx, "SELECT EXISTS(SELECT 1 FROM Posts WHERE Id = $1)", id).Scan(&exists)
+		if err == nil && !exists {
+			err = domain.NewError(domain.ErrNotFound, "Can't find post with id: %d", id)
+		}
+		return err
+	}
+	if err = audit(ctx, tx, entry); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+func (f *ForumRepository) DeleteThread(ctx context.Context, id int, entry *domain.ModerationAction) error {
+	defer metrics.Query("forum", "DeleteThread")()
+	tx, err := f.dbm.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+	tag, err := tx.Exec(ctx, "UPDATE Threads SET IsDeleted = true WHERE Id = $1 AND NOT IsDeleted", id)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return domain.NewError(domain.ErrNotFound, "Can't find thread with id: %d", id)
+	}
+	if err = audit(ctx, tx, entry); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+func (f *ForumRepository) DeleteForum(ctx context.Context, slug string, entry *domain.ModerationAction) error {
+	defer metrics.Query("forum", "DeleteForum")()
+	tx, err := f.dbm.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+	tag, err := tx.Exec(ctx, "UPDATE Forum SET IsDeleted = true WHERE Slug = $1 AND NOT IsDeleted", slug)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return domain.NewError(domain.ErrNotFound, "Can't find forum with slug: %s", slug)
+	}
+	if _, err = tx.Exec(ctx, "UPDATE Threads SET IsDeleted = true WHERE Forum = $1 AND NOT IsDeleted", slug); err != nil {
+		return err
+	}
+	if err = audit(ctx, tx, entry); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// PurgePost removes the post with all its replies, the posts whose path goes through it.
+func (f *ForumRepository) PurgePost(ctx context.Context, id int64, entry *domain.ModerationAction) error {
+	defer metrics.Query("forum", "PurgePost")()
+	tx, err := f.dbm.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+	query := "DELETE FROM Posts WHERE Thread = (SELECT Thread FROM Posts WHERE Id = $1) AND treeOrder @> ARRAY[$1::bigint]"
+	tag, err := tx.Exec(ctx, query, id)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return domain.NewError(domain.ErrNotFound, "Can't find post with id: %d", id)
+	}
+	if err = audit(ctx, tx, entry); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+func (f *ForumRepository) PurgeThread(ctx context.Context, id int, entry *domain.ModerationAction) error {
+	defer metrics.Query("forum", "PurgeThread")()
+	tx, err := f.dbm.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+	for _, query := range []string{
+		"DELETE FROM Posts WHERE Thread = $1",
+		"DELETE FROM Votes WHERE IdThread = $1",
+	} {
+		if _, err = tx.Exec(ctx, query, id); err != nil {
+			return err
+		}
+	}
+	var forum string
+	err = tx.QueryRow(ctx, "DELETE FROM Threads WHERE Id = $1 RETURNING Forum", id).Scan(&forum)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return domain.NewError(domain.ErrNotFound, "Can't find thread with id: %d", id)
+	}
+	if err != nil {
+		return err
+	}
+	if entry != nil {
+		entry.Forum = forum
+	}
+	if err = audit(ctx, tx, entry); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+func (f *ForumRepository) PurgeForum(ctx context.Context, slug string, entry *domain.ModerationAction) error {
+	defer metrics.Query("forum", "PurgeForum")()
+	tx, err := f.dbm.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+	// referencing tables first
+	for _, query := range []string{
+		"DELETE FROM Posts WHERE Forum = $1",
+		"DELETE FROM Votes WHERE IdThread IN (SELECT Id FROM Threads WHERE Forum = $1)",
+		"DELETE FROM Threads WHERE Forum = $1",
+		"DELETE FROM forumUsers WHERE Slug = $1",
+		"DELETE FROM forum_moderators WHERE Forum = $1",
+		"DELETE FROM forum_bans WHERE Forum = $1",
+	} {
+		if _, err = tx.Exec(ctx, query, slug); err != nil {
+			return err
+		}
+	}
+	tag, err := tx.Exec(ctx, "DELETE FROM Forum WHERE Slug = $1", slug)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return domain.NewError(domain.ErrNotFound, "Can't find forum with slug: %s", slug)
+	}
+	if err = audit(ctx, tx, entry); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+func (f *ForumRepository) ServiceClear(ctx context.Context) error {
+	defer metrics.Query("forum", "ServiceClear")()
+	// CASCADE reaches the tables referencing these, such as sessions and moderation
+	query := `TRUNCATE Users, Forum, Threads, Posts, Votes, forumUsers CASCADE`
+	_, err := f.dbm.Exec(ctx,query)
+	return err
+}
+
+// livePosts selects the posts the status counts
+const livePosts = "NOT IsDeleted AND NOT EXISTS (SELECT 1 FROM Threads WHERE Threads.Id = Posts.Thread AND Threads.IsDeleted)"
+
+func (f *ForumRepository) ServiceStatus(ctx context.Context, exact bool, top int) (domain.Status,error) {
+	defer metrics.Query("forum", "ServiceStatus")()
+	query := `SELECT COALESCE(SUM(Value) FILTER (WHERE Name = 'forum'), 0), COALESCE(SUM(Value) FILTER (WHERE Name = 'thread'), 0),
+		COALESCE(SUM(Value) FILTER (WHERE Name = 'user'), 0), COALESCE(SUM(Value) FILTER (WHERE Name = 'post'), 0),
+		COALESCE(SUM(Value) FILTER (WHERE Name = 'vote'), 0) FROM service_counters`
+	if exact {
+		// what the counters count: no deleted content, no posts of deleted threads
+		query = "SELECT * FROM (SELECT COUNT(*) FROM Forum WHERE NOT IsDeleted) as forumCount, (SELECT COUNT(*) FROM Threads WHERE NOT IsDeleted) as threadCount, (SELECT COUNT(*) FROM Users) as userCount, (SELECT COUNT(*) FROM Posts WHERE " + livePosts + ") as postCount, (SELECT COUNT(*) FROM Votes) as voteCount"
+	}
+	row := f.dbm.QueryRow(ctx, query)
+	st := domain.Status{TopForums: []domain.Forum{}}
+	err := row.Scan(&st.Forums, &st.Threads, &st.Users, &st.Posts, &st.Votes)
+	if err != nil {
+		return domain.Status{}, err
+	}
+	// a range scan of postCreatedIndex
+	err = f.dbm.QueryRow(ctx, "SELECT COUNT(*) FROM Posts WHERE Created > now() - interval '1 hour' AND " + livePosts).Scan(&st.PostsLastHour)
+	if err != nil {
+		return domain.Status{}, err
+	}
+	if top <= 0 {
+		return st, nil
+	}
+	rows, err := f.dbm.Query(ctx, "SELECT Title, Usr, Slug, Posts, Threads FROM Forum WHERE NOT IsDeleted ORDER BY Posts DESC, Slug LIMIT $1", top)
 	if err != nil {
 		return domain.Status{}, err
 	}
-	return st, err
+	defer rows.Close()
+	for rows.Next() {
+		var forum domain.Forum
+		if err = rows.Scan(&forum.Title, &forum.User, &forum.Slug, &forum.Posts, &forum.Threads); err != nil {
+			return domain.Status{}, err
+		}
+		st.TopForums = append(st.TopForums, forum)
+	}
+	return st, rows.Err()
 }
 
 
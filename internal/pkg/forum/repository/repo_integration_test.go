@@ -0,0 +1,747 @@
+//go:build integration
+
+package repository
+
+import (
+	"context"
+	"errors"
+	"os"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+
+	"repo/internal/pkg/domain"
+	"repo/internal/pkg/testdb"
+	userRepository "repo/internal/pkg/user/repository"
+)
+
+var db *testdb.Cluster
+
+func TestMain(m *testing.M) {
+	os.Exit(testdb.Main(m, &db))
+}
+
+var ctx = context.Background()
+
+// setup empties the database and creates the users alice, bob and carol and the forum "go" owned by alice.
+func setup(t *testing.T) *ForumRepository {
+	t.Helper()
+	db.Reset(t)
+	ur := userRepository.NewUserRep(db.Pool)
+	for _, nick := range []string{"alice", "bob", "carol"} {
+		if err := ur.AddUser(ctx, domain.User{Nickname: nick, FullName: nick, Email: nick + "@example.com"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	fr := NewForumRep(db.Pool, &ur)
+	if _, err := fr.AddForum(ctx, domain.Forum{Title: "Go", User: "alice", Slug: "go"}); err != nil {
+		t.Fatal(err)
+	}
+	return &fr
+}
+
+func mustThread(t *testing.T, fr *ForumRepository, thread domain.Thread) domain.Thread {
+	t.Helper()
+	if thread.Forum == "" {
+		thread.Forum = "go"
+	}
+	if thread.Created.IsZero() {
+		thread.Created = time.Now()
+	}
+	if thread.Message == "" {
+		thread.Message = "message of " + thread.Title
+	}
+	created, err := fr.AddThread(ctx, thread)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return created
+}
+
+func mustPosts(t *testing.T, fr *ForumRepository, thread domain.Thread, posts ...domain.Post) []domain.Post {
+	t.Helper()
+	created, err := fr.AddPosts(ctx, int(thread.Id), thread.Forum, posts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return created
+}
+
+func mustForum(t *testing.T, fr *ForumRepository, slug string) domain.Forum {
+	t.Helper()
+	forum, err := fr.GetForum(ctx, slug)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return forum
+}
+
+func ids(posts []domain.Post) []int64 {
+	res := make([]int64, len(posts))
+	for i, p := range posts {
+		res[i] = p.Id
+	}
+	return res
+}
+
+func equal(a, b []int64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestForums(t *testing.T) {
+	fr := setup(t)
+
+	forum, err := fr.AddForum(ctx, domain.Forum{Title: "Rust", User: "BOB", Slug: "rust"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if forum.User != "bob" {
+		t.Errorf("forum owner %q, want the nickname as registered", forum.User)
+	}
+	if _, err = fr.AddForum(ctx, domain.Forum{Title: "again", User: "bob", Slug: "RUST"}); !errors.Is(err, domain.ErrConflict) {
+		t.Errorf("AddForum with a taken slug = %v", err)
+	}
+	if _, err = fr.AddForum(ctx, domain.Forum{Title: "x", User: "nobody", Slug: "x"}); !errors.Is(err, domain.ErrUserMissing) {
+		t.Errorf("AddForum by a missing user = %v", err)
+	}
+	if got := mustForum(t, fr, "Rust"); got != forum {
+		t.Errorf("GetForum = %v, want %v", got, forum)
+	}
+	if _, err = fr.GetForum(ctx, "missing"); !errors.Is(err, domain.ErrNotFound) {
+		t.Errorf("GetForum of a missing forum = %v", err)
+	}
+}
+
+// TestErrorStatuses follows failures from PostgreSQL through the domain errors
+// to the status and message the client gets.
+func TestErrorStatuses(t *testing.T) {
+	fr := setup(t)
+	thread := mustThread(t, fr, domain.Thread{Title: "one", Author: "alice", Slug: "one"})
+	other := mustThread(t, fr, domain.Thread{Title: "other", Author: "alice"})
+	root := mustPosts(t, fr, other, domain.Post{Author: "bob", Message: "root"})[0]
+
+	cases := []struct {
+		name    string
+		call    func() error
+		kind    error
+		status  int
+		message string
+	}{
+		{"forum by a missing user", func() error {
+			_, err := fr.AddForum(ctx, domain.Forum{Title: "x", User: "nobody", Slug: "x"})
+			return err
+		}, domain.ErrUserMissing, 404, "Can't find user by nickname: nobody"},
+		{"forum slug taken", func() error {
+			_, err := fr.AddForum(ctx, domain.Forum{Title: "again", User: "bob", Slug: "GO"})
+			return err
+		}, domain.ErrConflict, 409, "Forum with slug GO already exists"},
+		{"missing forum", func() error {
+			_, err := fr.GetForum(ctx, "missing")
+			return err
+		}, domain.ErrNotFound, 404, "Can't find forum with slug: missing"},
+		{"thread slug taken", func() error {
+			_, err := fr.AddThread(ctx, domain.Thread{Title: "t", Forum: "go", Author: "bob", Message: "m", Slug: "one", Created: time.Now()})
+			return err
+		}, domain.ErrConflict, 409, "Thread with slug one already exists"},
+		{"thread by a missing user", func() error {
+			_, err := fr.AddThread(ctx, domain.Thread{Title: "t", Forum: "go", Author: "nobody", Message: "m", Created: time.Now()})
+			return err
+		}, domain.ErrUserMissing, 404, "Can't find user by nickname: nobody"},
+		{"parent in another thread", func() error {
+			_, err := fr.AddPosts(ctx, int(thread.Id), thread.Forum, []domain.Post{{Parent: root.Id, Author: "bob", Message: "m"}})
+			return err
+		}, domain.ErrInvalidParent, 409, "Parent post was created in another thread"},
+		{"post by a missing user", func() error {
+			_, err := fr.AddPosts(ctx, int(thread.Id), thread.Forum, []domain.Post{{Author: "nobody", Message: "m"}})
+			return err
+		}, domain.ErrUserMissing, 404, "Can't find post author by nickname"},
+		{"vote by a missing user", func() error {
+			return fr.VoteThread(ctx, domain.Vote{Nickname: "nobody", Voice: 1, IdThread: int64(thread.Id)})
+		}, domain.ErrUserMissing, 404, "Can't find user by nickname: nobody"},
+	}
+	for _, c := range cases {
+		err := c.call()
+		if !errors.Is(err, c.kind) {
+			t.Errorf("%s: error %v is not %v", c.name, err, c.kind)
+			continue
+		}
+		if status, message := sent(t, err); status != c.status || message != c.message {
+			t.Errorf("%s: answered %d %q, want %d %q", c.name, status, message, c.status, c.message)
+		}
+	}
+}
+
+func TestThreads(t *testing.T) {
+	fr := setup(t)
+	base := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	first := mustThread(t, fr, domain.Thread{Title: "first", Author: "bob", Slug: "first", Created: base})
+	second := mustThread(t, fr, domain.Thread{Title: "second", Author: "carol", Created: base.Add(time.Hour)})
+	third := mustThread(t, fr, domain.Thread{Title: "third", Author: "bob", Forum: "GO", Created: base.Add(2 * time.Hour)})
+	if third.Forum != "go" {
+		t.Errorf("thread forum %q, want the slug as registered", third.Forum)
+	}
+	if second.Slug != "" {
+		t.Errorf("thread without a slug got %q", second.Slug)
+	}
+
+	// forumAddThread counts the threads, forumAddUser records the authors
+	if forum := mustForum(t, fr, "go"); forum.Threads != 3 {
+		t.Errorf("forum counts %d threads, want 3", forum.Threads)
+	}
+	users, err := fr.GetUsers(ctx, "go", 0, "", false, nil)
+	if err != nil || len(users) != 2 || users[0].Nickname != "bob" || users[1].Nickname != "carol" {
+		t.Errorf("GetUsers = %v, %v, want bob and carol", users, err)
+	}
+	users, err = fr.GetUsers(ctx, "go", 1, "carol", true, nil)
+	if err != nil || len(users) != 1 || users[0].Nickname != "bob" {
+		t.Errorf("GetUsers since carol desc = %v, %v, want bob", users, err)
+	}
+
+	if _, err = fr.AddThread(ctx, domain.Thread{Title: "dup", Forum: "go", Author: "bob", Message: "m", Slug: "FIRST", Created: base}); !errors.Is(err, domain.ErrConflict) {
+		t.Errorf("AddThread with a taken slug = %v", err)
+	}
+	if _, err = fr.AddThread(ctx, domain.Thread{Title: "x", Forum: "go", Author: "nobody", Message: "m", Created: base}); !errors.Is(err, domain.ErrUserMissing) {
+		t.Errorf("AddThread by a missing user = %v", err)
+	}
+	if _, err = fr.AddThread(ctx, domain.Thread{Title: "x", Forum: "missing", Author: "bob", Message: "m", Created: base}); !errors.Is(err, domain.ErrNotFound) {
+		t.Errorf("AddThread to a missing forum = %v", err)
+	}
+
+	id, err := fr.GetThreadIdBySlug(ctx, "First")
+	if err != nil || id != int(first.Id) {
+		t.Errorf("GetThreadIdBySlug = %d, %v, want %d", id, err, first.Id)
+	}
+	if _, err = fr.GetThreadIdBySlug(ctx, "missing"); !errors.Is(err, domain.ErrNotFound) {
+		t.Errorf("GetThreadIdBySlug of a missing thread = %v", err)
+	}
+	info, err := fr.GetThreadInfo(ctx, int(first.Id))
+	if err != nil || info.Title != "first" || !info.Created.Equal(base) {
+		t.Errorf("GetThreadInfo = %v, %v", info, err)
+	}
+
+	list, err := fr.GetThreads(ctx, "go", "", false, 2, nil)
+	if err != nil || len(list) != 2 || list[0].Id != first.Id || list[1].Id != second.Id {
+		t.Errorf("GetThreads = %v, %v, want first and second", list, err)
+	}
+	// since is inclusive
+	list, err = fr.GetThreads(ctx, "go", base.Add(time.Hour).Format(time.RFC3339), true, 0, nil)
+	if err != nil || len(list) != 2 || list[0].Id != second.Id || list[1].Id != first.Id {
+		t.Errorf("GetThreads since second desc = %v, %v, want second and first", list, err)
+	}
+
+	// empty fields are kept
+	updated, err := fr.UpdateThread(ctx, domain.Thread{Id: first.Id, Message: "edited"}, "bob")
+	if err != nil || updated.Title != "first" || updated.Message != "edited" {
+		t.Errorf("UpdateThread = %v, %v", updated, err)
+	}
+	if _, err = fr.UpdateThread(ctx, domain.Thread{Id: 1 << 30, Title: "x"}, ""); !errors.Is(err, domain.ErrNotFound) {
+		t.Errorf("UpdateThread of a missing thread = %v", err)
+	}
+}
+
+func TestVotes(t *testing.T) {
+	fr := setup(t)
+	thread := mustThread(t, fr, domain.Thread{Title: "vote", Author: "alice"})
+	votes := func() int32 {
+		t.Helper()
+		info, err := fr.GetThreadInfo(ctx, int(thread.Id))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return info.Votes
+	}
+	vote := func(nick string, voice int32) domain.Vote {
+		return domain.Vote{Nickname: nick, Voice: voice, IdThread: int64(thread.Id)}
+	}
+
+	// threadAddVote adds the voice, threadChangeVote swings it by twice the new voice
+	steps := []struct {
+		name string
+		do   func() error
+		want int32
+	}{
+		{"bob up", func() error { return fr.VoteThread(ctx, vote("bob", 1)) }, 1},
+		{"carol up", func() error { return fr.VoteThread(ctx, vote("carol", 1)) }, 2},
+		{"bob down", func() error { return fr.UpdateVote(ctx, vote("bob", -1)) }, 0},
+		{"bob down again", func() error { return fr.UpdateVote(ctx, vote("bob", -1)) }, 0},
+		{"carol down", func() error { return fr.UpdateVote(ctx, vote("carol", -1)) }, -2},
+		{"bob up", func() error { return fr.UpdateVote(ctx, vote("bob", 1)) }, 0},
+	}
+	for _, s := range steps {
+		if err := s.do(); err != nil {
+			t.Fatalf("%s: %v", s.name, err)
+		}
+		if got := votes(); got != s.want {
+			t.Errorf("after %s votes = %d, want %d", s.name, got, s.want)
+		}
+	}
+
+	if err := fr.VoteThread(ctx, vote("bob", 1)); !errors.Is(err, domain.ErrConflict) {
+		t.Errorf("second VoteThread = %v, want a conflict", err)
+	}
+	if err := fr.VoteThread(ctx, vote("nobody", 1)); !errors.Is(err, domain.ErrUserMissing) {
+		t.Errorf("VoteThread by a missing user = %v", err)
+	}
+	if err := fr.VoteThread(ctx, domain.Vote{Nickname: "bob", Voice: 1, IdThread: 1 << 30}); !errors.Is(err, domain.ErrNotFound) {
+		t.Errorf("VoteThread for a missing thread = %v", err)
+	}
+}
+
+func TestPostTree(t *testing.T) {
+	fr := setup(t)
+	thread := mustThread(t, fr, domain.Thread{Title: "tree", Author: "alice"})
+	other := mustThread(t, fr, domain.Thread{Title: "other", Author: "alice"})
+
+	roots := mustPosts(t, fr, thread, domain.Post{Author: "bob", Message: "a"}, domain.Post{Author: "carol", Message: "b"})
+	a, b := roots[0], roots[1]
+	if a.Parent != 0 || a.Forum != "go" || a.Thread != thread.Id {
+		t.Errorf("root post %+v", a)
+	}
+	a1 := mustPosts(t, fr, thread, domain.Post{Parent: a.Id, Author: "alice", Message: "a1"})[0]
+	a11 := mustPosts(t, fr, thread, domain.Post{Parent: a1.Id, Author: "bob", Message: "a11"})[0]
+	b1 := mustPosts(t, fr, thread, domain.Post{Parent: b.Id, Author: "bob", Message: "b1"})[0]
+	a2 := mustPosts(t, fr, thread, domain.Post{Parent: a.Id, Author: "bob", Message: "a2"})[0]
+
+	// forumCheckPost builds the materialized paths
+	tree, err := fr.GetPosts(ctx, int(thread.Id), 0, 0, "tree", false, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []int64{a.Id, a1.Id, a11.Id, a2.Id, b.Id, b1.Id}; !equal(ids(tree), want) {
+		t.Errorf("tree order %v, want %v", ids(tree), want)
+	}
+	if want := []int64{a.Id, a1.Id, a11.Id}; !equal(tree[2].Path, want) {
+		t.Errorf("path of a11 %v, want %v", tree[2].Path, want)
+	}
+
+	flat, err := fr.GetPosts(ctx, int(thread.Id), 3, int(a1.Id), "flat", false, nil)
+	if want := []int64{a11.Id, b1.Id, a2.Id}; err != nil || !equal(ids(flat), want) {
+		t.Errorf("flat since a1 = %v, %v, want %v", ids(flat), err, want)
+	}
+	// tree since is exclusive and continues in path order
+	tree, err = fr.GetPosts(ctx, int(thread.Id), 2, int(a11.Id), "tree", false, nil)
+	if want := []int64{a2.Id, b.Id}; err != nil || !equal(ids(tree), want) {
+		t.Errorf("tree since a11 = %v, %v, want %v", ids(tree), err, want)
+	}
+	// parent_tree limits the number of root posts
+	parents, err := fr.GetPosts(ctx, int(thread.Id), 1, 0, "parent_tree", true, nil)
+	if want := []int64{b.Id, b1.Id}; err != nil || !equal(ids(parents), want) {
+		t.Errorf("parent_tree desc = %v, %v, want %v", ids(parents), err, want)
+	}
+	if _, err = fr.GetPosts(ctx, int(thread.Id), 0, 0, "sideways", false, nil); !errors.Is(err, domain.ErrInvalid) {
+		t.Errorf("GetPosts with an unknown sort = %v", err)
+	}
+
+	if forum := mustForum(t, fr, "go"); forum.Posts != 6 {
+		t.Errorf("forum counts %d posts, want 6", forum.Posts)
+	}
+	users, err := fr.GetUsers(ctx, "go", 0, "", false, nil)
+	if err != nil || len(users) != 3 {
+		t.Errorf("GetUsers = %v, %v, want every post author", users, err)
+	}
+
+	if _, err = fr.AddPosts(ctx, int(other.Id), "go", []domain.Post{{Parent: a.Id, Author: "bob", Message: "x"}}); !errors.Is(err, domain.ErrInvalidParent) {
+		t.Errorf("reply to a post of another thread = %v", err)
+	}
+	if _, err = fr.AddPosts(ctx, int(thread.Id), "go", []domain.Post{{Author: "nobody", Message: "x"}}); !errors.Is(err, domain.ErrUserMissing) {
+		t.Errorf("post by a missing user = %v", err)
+	}
+	// a failed batch adds nothing
+	if forum := mustForum(t, fr, "go"); forum.Posts != 6 {
+		t.Errorf("forum counts %d posts after failed batches, want 6", forum.Posts)
+	}
+}
+
+func TestPostDetails(t *testing.T) {
+	fr := setup(t)
+	thread := mustThread(t, fr, domain.Thread{Title: "details", Author: "alice"})
+	post := mustPosts(t, fr, thread, domain.Post{Author: "bob", Message: "hello"})[0]
+
+	full, err := fr.GetPost(ctx, domain.Post{Id: post.Id}, []string{"user", "forum", "thread"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if full.Post.Message != "hello" || full.Author.Nickname != "bob" || full.Forum.Slug != "go" || full.Thread.Id != thread.Id {
+		t.Errorf("GetPost = %+v", full)
+	}
+	if full, err = fr.GetPost(ctx, domain.Post{Id: post.Id}, nil); err != nil || full.Author != nil {
+		t.Errorf("GetPost without related = %+v, %v", full, err)
+	}
+	if _, err = fr.GetPost(ctx, domain.Post{Id: 1 << 40}, nil); !errors.Is(err, domain.ErrNotFound) {
+		t.Errorf("GetPost of a missing post = %v", err)
+	}
+
+	// the same message is not an edit
+	same, err := fr.UpdatePost(ctx, domain.Post{Id: post.Id, Message: "hello"}, "bob")
+	if err != nil || same.IsEdited {
+		t.Errorf("UpdatePost with the same message = %+v, %v", same, err)
+	}
+	edited, err := fr.UpdatePost(ctx, domain.Post{Id: post.Id, Message: "hello, world"}, "bob")
+	if err != nil || !edited.IsEdited || edited.Message != "hello, world" {
+		t.Errorf("UpdatePost = %+v, %v", edited, err)
+	}
+	if _, err = fr.UpdatePost(ctx, domain.Post{Id: 1 << 40, Message: "x"}, ""); !errors.Is(err, domain.ErrNotFound) {
+		t.Errorf("UpdatePost of a missing post = %v", err)
+	}
+}
+
+func TestDeleteAndPurge(t *testing.T) {
+	fr := setup(t)
+	thread := mustThread(t, fr, domain.Thread{Title: "doomed", Author: "alice", Slug: "doomed"})
+	kept := mustThread(t, fr, domain.Thread{Title: "kept", Author: "alice"})
+	root := mustPosts(t, fr, thread, domain.Post{Author: "bob", Message: "root"})[0]
+	reply := mustPosts(t, fr, thread, domain.Post{Parent: root.Id, Author: "bob", Message: "reply"})[0]
+	mustPosts(t, fr, kept, domain.Post{Author: "bob", Message: "one"}, domain.Post{Author: "bob", Message: "two"})
+
+	// a deleted post stays as a tombstone and is no longer counted
+	if err := fr.DeletePost(ctx, reply.Id, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := fr.DeletePost(ctx, reply.Id, nil); err != nil {
+		t.Errorf("DeletePost of a deleted post = %v", err)
+	}
+	if err := fr.DeletePost(ctx, 1<<40, nil); !errors.Is(err, domain.ErrNotFound) {
+		t.Errorf("DeletePost of a missing post = %v", err)
+	}
+	full, err := fr.GetPost(ctx, domain.Post{Id: reply.Id}, nil)
+	if err != nil || !full.Post.Deleted || full.Post.Message != "" {
+		t.Errorf("deleted post = %+v, %v", full.Post, err)
+	}
+	if _, err = fr.UpdatePost(ctx, domain.Post{Id: reply.Id, Message: "back"}, ""); !errors.Is(err, domain.ErrConflict) {
+		t.Errorf("UpdatePost of a deleted post = %v", err)
+	}
+	if forum := mustForum(t, fr, "go"); forum.Posts != 3 {
+		t.Errorf("forum counts %d posts after a deletion, want 3", forum.Posts)
+	}
+
+	// deleting a thread takes its live posts out of the counters
+	if err = fr.DeleteThread(ctx, int(thread.Id), nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = fr.GetThreadInfo(ctx, int(thread.Id)); !errors.Is(err, domain.ErrNotFound) {
+		t.Errorf("GetThreadInfo of a deleted thread = %v", err)
+	}
+	if _, err = fr.GetThreadIdBySlug(ctx, "doomed"); !errors.Is(err, domain.ErrNotFound) {
+		t.Errorf("GetThreadIdBySlug of a deleted thread = %v", err)
+	}
+	if err = fr.DeleteThread(ctx, int(thread.Id), nil); !errors.Is(err, domain.ErrNotFound) {
+		t.Errorf("deleting a thread twice = %v", err)
+	}
+	// a deleted thread takes no votes or edits and its posts are gone with it
+	if err = fr.VoteThread(ctx, domain.Vote{Nickname: "bob", Voice: 1, IdThread: int64(thread.Id)}); !errors.Is(err, domain.ErrNotFound) {
+		t.Errorf("VoteThread on a deleted thread = %v", err)
+	}
+	var votes int
+	if err = db.Pool.QueryRow(ctx, "SELECT count(*) FROM Votes WHERE IdThread = $1", thread.Id).Scan(&votes); err != nil || votes != 0 {
+		t.Errorf("a vote on a deleted thread left %d rows (%v)", votes, err)
+	}
+	if _, err = fr.UpdateThread(ctx, domain.Thread{Id: thread.Id, Title: "back"}, ""); !errors.Is(err, domain.ErrNotFound) {
+		t.Errorf("UpdateThread of a deleted thread = %v", err)
+	}
+	if _, err = fr.GetPost(ctx, domain.Post{Id: root.Id}, nil); !errors.Is(err, domain.ErrNotFound) {
+		t.Errorf("post of a deleted thread = %v", err)
+	}
+	if forum := mustForum(t, fr, "go"); forum.Threads != 1 || forum.Posts != 2 {
+		t.Errorf("forum counts %d threads and %d posts, want 1 and 2", forum.Threads, forum.Posts)
+	}
+	if err = fr.PurgeThread(ctx, int(thread.Id), nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = fr.GetPost(ctx, domain.Post{Id: root.Id}, nil); !errors.Is(err, domain.ErrNotFound) {
+		t.Errorf("post of a purged thread = %v", err)
+	}
+	if forum := mustForum(t, fr, "go"); forum.Threads != 1 || forum.Posts != 2 {
+		t.Errorf("purging a deleted thread changed the counters to %d threads and %d posts", forum.Threads, forum.Posts)
+	}
+
+	// purging a post takes its replies along
+	parent := mustPosts(t, fr, kept, domain.Post{Author: "carol", Message: "parent"})[0]
+	child := mustPosts(t, fr, kept, domain.Post{Parent: parent.Id, Author: "carol", Message: "child"})[0]
+	if err = fr.PurgePost(ctx, parent.Id, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = fr.GetPost(ctx, domain.Post{Id: child.Id}, nil); !errors.Is(err, domain.ErrNotFound) {
+		t.Errorf("reply of a purged post = %v", err)
+	}
+	if err = fr.PurgePost(ctx, parent.Id, nil); !errors.Is(err, domain.ErrNotFound) {
+		t.Errorf("purging a post twice = %v", err)
+	}
+	if forum := mustForum(t, fr, "go"); forum.Posts != 2 {
+		t.Errorf("forum counts %d posts after a purge, want 2", forum.Posts)
+	}
+
+	if err = fr.DeleteForum(ctx, "go", nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = fr.GetForum(ctx, "go"); !errors.Is(err, domain.ErrNotFound) {
+		t.Errorf("GetForum of a deleted forum = %v", err)
+	}
+	if _, err = fr.GetThreadInfo(ctx, int(kept.Id)); !errors.Is(err, domain.ErrNotFound) {
+		t.Errorf("thread of a deleted forum = %v", err)
+	}
+	if err = fr.PurgeForum(ctx, "go", nil); err != nil {
+		t.Fatal(err)
+	}
+	var has bool
+	if err = db.Pool.QueryRow(ctx, "SELECT EXISTS(SELECT 1 FROM Threads WHERE Forum = 'go')").Scan(&has); err != nil || has {
+		t.Errorf("threads left after a purge = %v, %v", has, err)
+	}
+}
+
+func TestModeratorDeletesAreAudited(t *testing.T) {
+	fr := setup(t)
+	thread := mustThread(t, fr, domain.Thread{Title: "audited", Author: "bob"})
+	posts := mustPosts(t, fr, thread, domain.Post{Author: "bob", Message: "own"}, domain.Post{Author: "bob", Message: "moderated"})
+
+	logged := func(action string, target string) []domain.ModerationAction {
+		t.Helper()
+		rows, err := db.Pool.Query(ctx, "SELECT Forum, Moderator, Action, Target FROM moderation_log WHERE Action = $1 AND Target = $2", action, target)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer rows.Close()
+		var entries []domain.ModerationAction
+		for rows.Next() {
+			var e domain.ModerationAction
+			if err = rows.Scan(&e.Forum, &e.Moderator, &e.Action, &e.Target); err != nil {
+				t.Fatal(err)
+			}
+			entries = append(entries, e)
+		}
+		return entries
+	}
+
+	own := strconv.FormatInt(posts[0].Id, 10)
+	if err := fr.DeletePost(ctx, posts[0].Id, nil); err != nil {
+		t.Fatal(err)
+	}
+	if entries := logged(domain.ActionDelete, own); len(entries) != 0 {
+		t.Errorf("the author deleting their post was logged: %v", entries)
+	}
+
+	moderated := strconv.FormatInt(posts[1].Id, 10)
+	entry := &domain.ModerationAction{Forum: "go", Moderator: "alice", Action: domain.ActionDelete, Target: moderated}
+	if err := fr.DeletePost(ctx, posts[1].Id, entry); err != nil {
+		t.Fatal(err)
+	}
+	if entries := logged(domain.ActionDelete, moderated); len(entries) != 1 || entries[0] != *entry {
+		t.Errorf("moderator delete logged %v, want %v", entries, *entry)
+	}
+
+	// a purge by id learns the forum from the thread
+	target := strconv.Itoa(int(thread.Id))
+	entry = &domain.ModerationAction{Moderator: "alice", Action: domain.ActionPurgeThread, Target: target}
+	if err := fr.PurgeThread(ctx, int(thread.Id), entry); err != nil {
+		t.Fatal(err)
+	}
+	if entries := logged(domain.ActionPurgeThread, target); len(entries) != 1 || entries[0].Forum != "go" {
+		t.Errorf("purge logged %v, want one entry in forum go", entries)
+	}
+
+	// a failed change logs nothing
+	if err := fr.DeleteThread(ctx, int(thread.Id), &domain.ModerationAction{Forum: "go", Moderator: "alice", Action: domain.ActionDeleteThread, Target: target}); !errors.Is(err, domain.ErrNotFound) {
+		t.Errorf("deleting a purged thread = %v", err)
+	}
+	if entries := logged(domain.ActionDeleteThread, target); len(entries) != 0 {
+		t.Errorf("a failed delete was logged: %v", entries)
+	}
+}
+
+func TestServiceStatus(t *testing.T) {
+	fr := setup(t)
+	thread := mustThread(t, fr, domain.Thread{Title: "status", Author: "alice"})
+	mustPosts(t, fr, thread, domain.Post{Author: "bob", Message: "a"}, domain.Post{Author: "carol", Message: "b"})
+	if err := fr.VoteThread(ctx, domain.Vote{Nickname: "bob", Voice: 1, IdThread: int64(thread.Id)}); err != nil {
+		t.Fatal(err)
+	}
+
+	want := domain.Status{Users: 3, Forums: 1, Threads: 1, Posts: 2, Votes: 1, PostsLastHour: 2}
+	for _, exact := range []bool{false, true} {
+		st, err := fr.ServiceStatus(ctx, exact, 5)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(st.TopForums) != 1 || st.TopForums[0].Slug != "go" || st.TopForums[0].Posts != 2 {
+			t.Errorf("exact=%v: top forums %v", exact, st.TopForums)
+		}
+		st.TopForums = nil
+		if !reflect.DeepEqual(st, want) {
+			t.Errorf("exact=%v: ServiceStatus = %+v, want %+v", exact, st, want)
+		}
+	}
+
+	// the truncate triggers reset the counters
+	if err := fr.ServiceClear(ctx); err != nil {
+		t.Fatal(err)
+	}
+	st, err := fr.ServiceStatus(ctx, false, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	st.TopForums = nil
+	if !reflect.DeepEqual(st, domain.Status{}) {
+		t.Errorf("ServiceStatus after ServiceClear = %+v", st)
+	}
+}
+
+func TestServiceCountersAreSharded(t *testing.T) {
+	fr := setup(t)
+	// each backend adds to the shard of its pid
+	shards := map[int]bool{}
+	for i := 0; i < 4; i++ {
+		conn, err := db.Pool.Acquire(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Release()
+		var pid int
+		if err := conn.QueryRow(ctx, "SELECT pg_backend_pid()").Scan(&pid); err != nil {
+			t.Fatal(err)
+		}
+		nick := "user" + strconv.Itoa(i)
+		if _, err := conn.Exec(ctx, "INSERT INTO Users (Nickname, FullName, Email) VALUES ($1, $1, $1 || '@example.com')", nick); err != nil {
+			t.Fatal(err)
+		}
+		shards[pid%16] = true
+	}
+	for shard := range shards {
+		var value int
+		if err := db.Pool.QueryRow(ctx, "SELECT Value FROM service_counters WHERE Name = 'user' AND Shard = $1", shard).Scan(&value); err != nil || value <= 0 {
+			t.Errorf("shard %d of user counts %d (%v), want the inserts of its backends", shard, value, err)
+		}
+	}
+
+	// deletes subtract, a multi-row statement counts once per row
+	thread := mustThread(t, fr, domain.Thread{Title: "doomed", Author: "alice"})
+	mustPosts(t, fr, thread, domain.Post{Author: "bob", Message: "a"}, domain.Post{Author: "bob", Message: "b"}, domain.Post{Author: "carol", Message: "c"})
+	if err := fr.PurgeThread(ctx, int(thread.Id), nil); err != nil {
+		t.Fatal(err)
+	}
+	counted, err := fr.ServiceStatus(ctx, false, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	exact, err := fr.ServiceStatus(ctx, true, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(counted, exact) {
+		t.Errorf("counters %+v, exact counts %+v", counted, exact)
+	}
+	if counted.Users != 7 || counted.Threads != 0 || counted.Posts != 0 {
+		t.Errorf("counters %+v, want 7 users and no threads or posts", counted)
+	}
+}
+
+func TestServiceStatusSkipsDeleted(t *testing.T) {
+	fr := setup(t)
+	if _, err := fr.AddForum(ctx, domain.Forum{Title: "Rust", User: "bob", Slug: "rust"}); err != nil {
+		t.Fatal(err)
+	}
+	kept := mustThread(t, fr, domain.Thread{Title: "kept", Author: "alice"})
+	doomed := mustThread(t, fr, domain.Thread{Title: "doomed", Author: "alice"})
+	rust := mustThread(t, fr, domain.Thread{Title: "rust", Author: "bob", Forum: "rust"})
+	posts := mustPosts(t, fr, kept, domain.Post{Author: "bob", Message: "a"}, domain.Post{Author: "carol", Message: "b"})
+	mustPosts(t, fr, doomed, domain.Post{Author: "bob", Message: "c"}, domain.Post{Author: "bob", Message: "d"})
+	mustPosts(t, fr, rust, domain.Post{Author: "carol", Message: "e"})
+
+	// the counters and the exact counts agree with the forum counters at every step
+	check := func(step string, forums, threads, posts int) {
+		t.Helper()
+		for _, exact := range []bool{false, true} {
+			st, err := fr.ServiceStatus(ctx, exact, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if st.Forums != forums || st.Threads != threads || st.Posts != posts || st.PostsLastHour != posts {
+				t.Errorf("%s, exact=%v: %+v, want %d forums, %d threads and %d posts", step, exact, st, forums, threads, posts)
+			}
+		}
+	}
+	check("created", 2, 3, 5)
+	if err := fr.DeletePost(ctx, posts[0].Id, nil); err != nil {
+		t.Fatal(err)
+	}
+	check("post deleted", 2, 3, 4)
+	if err := fr.DeleteThread(ctx, int(doomed.Id), nil); err != nil {
+		t.Fatal(err)
+	}
+	check("thread deleted", 2, 2, 2)
+	// purging deleted content counts nothing twice
+	if err := fr.PurgeThread(ctx, int(doomed.Id), nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := fr.PurgePost(ctx, posts[0].Id, nil); err != nil {
+		t.Fatal(err)
+	}
+	check("purged", 2, 2, 2)
+	if err := fr.DeleteForum(ctx, "rust", nil); err != nil {
+		t.Fatal(err)
+	}
+	check("forum deleted", 1, 1, 1)
+	if err := fr.PurgeForum(ctx, "rust", nil); err != nil {
+		t.Fatal(err)
+	}
+	check("forum purged", 1, 1, 1)
+}
+
+func TestServiceStatusTop(t *testing.T) {
+	fr := setup(t)
+	for _, slug := range []string{"rust", "zig", "gone"} {
+		if _, err := fr.AddForum(ctx, domain.Forum{Title: slug, User: "bob", Slug: slug}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for slug, n := range map[string]int{"go": 1, "rust": 3, "zig": 1, "gone": 5} {
+		thread := mustThread(t, fr, domain.Thread{Title: slug, Author: "bob", Forum: slug})
+		for i := 0; i < n; i++ {
+			mustPosts(t, fr, thread, domain.Post{Author: "carol", Message: "post"})
+		}
+	}
+	if err := fr.DeleteForum(ctx, "gone", nil); err != nil {
+		t.Fatal(err)
+	}
+	// a post of yesterday is not one of the last hour
+	if _, err := db.Pool.Exec(ctx, "UPDATE Posts SET Created = now() - interval '1 day' WHERE Forum = 'zig'"); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		top  int
+		want []string
+	}{
+		{0, []string{}},
+		{1, []string{"rust"}},
+		// ties go by slug, deleted forums are left out
+		{5, []string{"rust", "go", "zig"}},
+	}
+	for _, c := range cases {
+		for _, exact := range []bool{false, true} {
+			st, err := fr.ServiceStatus(ctx, exact, c.top)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := []string{}
+			for _, forum := range st.TopForums {
+				got = append(got, forum.Slug)
+			}
+			if !reflect.DeepEqual(got, c.want) {
+				t.Errorf("top %d, exact=%v: forums %v, want %v", c.top, exact, got, c.want)
+			}
+			// the posts of the deleted forum are not counted either
+			if st.PostsLastHour != 4 {
+				t.Errorf("top %d, exact=%v: %d posts in the last hour, want 4", c.top, exact, st.PostsLastHour)
+			}
+		}
+	}
+}
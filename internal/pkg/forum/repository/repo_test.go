@@ -0,0 +1,65 @@
+package repository
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/jackc/pgconn"
+	"github.com/valyala/fasthttp"
+	"repo/internal/pkg/domain"
+	"repo/internal/pkg/utils"
+)
+
+// sent is the status and message SendError answers err with
+func sent(t *testing.T, err error) (int, string) {
+	t.Helper()
+	var ctx fasthttp.RequestCtx
+	utils.SendError(err, &ctx)
+	var resp domain.Response
+	if err := json.Unmarshal(ctx.Response.Body(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	return ctx.Response.StatusCode(), resp.Message
+}
+
+func TestPgErrors(t *testing.T) {
+	vote := domain.Vote{Nickname: "bob", Voice: 1, IdThread: 7}
+	// pgx returns the error of a batch insert wrapped when reading the rows
+	wrapped := func(pgErr *pgconn.PgError) error { return fmt.Errorf("reading rows: %w", pgErr) }
+	cases := []struct {
+		name    string
+		err     error
+		kind    error
+		status  int
+		message string
+	}{
+		{"post parent", postsError(wrapped(&pgconn.PgError{Code: utils.InvalidParent})),
+			domain.ErrInvalidParent, 409, "Parent post was created in another thread"},
+		{"post author", postsError(wrapped(&pgconn.PgError{Code: utils.ForeignKeyViolation, ConstraintName: "posts_author_fkey"})),
+			domain.ErrUserMissing, 404, "Can't find post author by nickname"},
+		{"vote twice", voteError(&pgconn.PgError{Code: utils.UniqueViolation}, vote),
+			domain.ErrConflict, 409, "User bob already voted for thread 7"},
+		{"vote user", voteError(&pgconn.PgError{Code: utils.ForeignKeyViolation, ConstraintName: "votes_nickname_fkey"}, vote),
+			domain.ErrUserMissing, 404, "Can't find user by nickname: bob"},
+		{"vote thread", voteError(&pgconn.PgError{Code: utils.ForeignKeyViolation, ConstraintName: "votes_idthread_fkey"}, vote),
+			domain.ErrNotFound, 404, "Can't find thread with id: 7"},
+	}
+	for _, c := range cases {
+		if !errors.Is(c.err, c.kind) {
+			t.Errorf("%s: error %v is not %v", c.name, c.err, c.kind)
+		}
+		if status, message := sent(t, c.err); status != c.status || message != c.message {
+			t.Errorf("%s: answered %d %q, want %d %q", c.name, status, message, c.status, c.message)
+		}
+	}
+
+	// other database errors are not translated and are not shown to the client
+	other := &pgconn.PgError{Code: "42P01", Message: `relation "posts" does not exist`}
+	for _, err := range []error{postsError(other), voteError(other, vote)} {
+		if status, message := sent(t, err); status != fasthttp.StatusInternalServerError || message != "internal server error" {
+			t.Errorf("untranslated %v answered %d %q", err, status, message)
+		}
+	}
+}
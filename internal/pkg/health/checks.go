@@ -0,0 +1,41 @@
+package health
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v4/pgxpool"
+	"repo/internal/pkg/migrate"
+)
+
+// Database acquires a connection from the pool and runs a trivial query.
+func Database(pool *pgxpool.Pool) Check {
+	return func(ctx context.Context) error {
+		var one int
+		return pool.QueryRow(ctx, "SELECT 1").Scan(&one)
+	}
+}
+
+// Migrations fails until the schema is at the version of the embedded migrations.
+// A newer schema passes: during a rolling deploy the new instances migrate
+// first and the old ones have to keep serving.
+func Migrations(pool *pgxpool.Pool) Check {
+	return schemaVersion(migrate.NewRunner(pool).Version, migrate.Latest)
+}
+
+func schemaVersion(version func(ctx context.Context) (int, error), latest func() (int, error)) Check {
+	return func(ctx context.Context) error {
+		want, err := latest()
+		if err != nil {
+			return err
+		}
+		got, err := version(ctx)
+		if err != nil {
+			return err
+		}
+		if got < want {
+			return fmt.Errorf("schema is at version %d, want %d", got, want)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,127 @@
+// Package health serves the liveness and readiness probes.
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/valyala/fasthttp"
+	"repo/internal/pkg/logging"
+)
+
+// Check reports whether a dependency is usable, it must honor ctx.
+type Check func(ctx context.Context) error
+
+// CheckResult is served without Latency and Error, the error text of a failing
+// dependency may tell more about it than an unauthenticated probe should see.
+type CheckResult struct {
+	Name    string  `json:"name"`
+	Status  string  `json:"status"`
+	Latency float64 `json:"-"`
+	Error   string  `json:"-"`
+}
+
+type Report struct {
+	Status string        `json:"status"`
+	Checks []CheckResult `json:"checks,omitempty"`
+}
+
+const (
+	StatusOK       = "ok"
+	StatusFailing  = "failing"
+	StatusReady    = "ready"
+	StatusNotReady = "not ready"
+	StatusDraining = "draining"
+)
+
+type named struct {
+	name  string
+	check Check
+}
+
+// Checker runs the readiness checks. Serving reports whether the server still
+// accepts traffic; once it returns false the probe fails without running the checks.
+type Checker struct {
+	Timeout time.Duration
+	Serving func() bool
+	checks  []named
+}
+
+func NewChecker(timeout time.Duration, serving func() bool) *Checker {
+	return &Checker{Timeout: timeout, Serving: serving}
+}
+
+// Add registers a check, reported under name in registration order.
+func (c *Checker) Add(name string, check Check) {
+	c.checks = append(c.checks, named{name: name, check: check})
+}
+
+// Run executes every check concurrently, each bounded by Timeout.
+func (c *Checker) Run(ctx context.Context) Report {
+	if c.Serving != nil && !c.Serving() {
+		return Report{Status: StatusDraining}
+	}
+	report := Report{Status: StatusReady, Checks: make([]CheckResult, len(c.checks))}
+	var wg sync.WaitGroup
+	for i, nc := range c.checks {
+		wg.Add(1)
+		go func(i int, nc named) {
+			defer wg.Done()
+			report.Checks[i] = c.run(ctx, nc)
+		}(i, nc)
+	}
+	wg.Wait()
+	for _, res := range report.Checks {
+		if res.Status != StatusOK {
+			report.Status = StatusNotReady
+		}
+	}
+	return report
+}
+
+func (c *Checker) run(ctx context.Context, nc named) CheckResult {
+	if c.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.Timeout)
+		defer cancel()
+	}
+	start := time.Now()
+	err := nc.check(ctx)
+	res := CheckResult{Name: nc.name, Status: StatusOK, Latency: float64(time.Since(start).Microseconds()) / 1000}
+	if err != nil {
+		res.Status, res.Error = StatusFailing, err.Error()
+	}
+	return res
+}
+
+// ReadyHandler answers 200 when every check passes and 503 otherwise.
+// Why a check fails is logged, not answered.
+func (c *Checker) ReadyHandler(ctx *fasthttp.RequestCtx) {
+	report := c.Run(context.Background())
+	status := fasthttp.StatusOK
+	if report.Status != StatusReady {
+		status = fasthttp.StatusServiceUnavailable
+	}
+	for _, res := range report.Checks {
+		if res.Status != StatusOK {
+			logging.FromRequest(ctx).Warn().Str("check", res.Name).Str("error", res.Error).
+				Float64("latency_ms", res.Latency).Msg("readiness check failing")
+		}
+	}
+	send(status, report, ctx)
+}
+
+// LiveHandler answers 200 as long as the process serves requests at all,
+// it checks no dependency so a database outage does not get the process restarted.
+func LiveHandler(ctx *fasthttp.RequestCtx) {
+	send(fasthttp.StatusOK, Report{Status: StatusOK}, ctx)
+}
+
+func send(status int, report Report, ctx *fasthttp.RequestCtx) {
+	body, _ := json.Marshal(report)
+	ctx.SetStatusCode(status)
+	ctx.SetContentType("application/json")
+	ctx.SetBody(body)
+}
@@ -0,0 +1,94 @@
+package health
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/valyala/fasthttp"
+	"repo/internal/pkg/logging"
+)
+
+func TestCheckerRun(t *testing.T) {
+	serving := true
+	c := NewChecker(20*time.Millisecond, func() bool { return serving })
+	c.Add("fine", func(ctx context.Context) error { return nil })
+	c.Add("slow", func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	c.Add("broken", func(ctx context.Context) error { return errors.New("boom") })
+
+	report := c.Run(context.Background())
+	if report.Status != StatusNotReady {
+		t.Errorf("status %q", report.Status)
+	}
+	want := []struct{ name, status, err string }{
+		{"fine", StatusOK, ""},
+		{"slow", StatusFailing, context.DeadlineExceeded.Error()},
+		{"broken", StatusFailing, "boom"},
+	}
+	for i, w := range want {
+		got := report.Checks[i]
+		if got.Name != w.name || got.Status != w.status || got.Error != w.err {
+			t.Errorf("check %d = %+v, want %+v", i, got, w)
+		}
+	}
+
+	serving = false
+	if report = c.Run(context.Background()); report.Status != StatusDraining || len(report.Checks) != 0 {
+		t.Errorf("draining report %+v", report)
+	}
+}
+
+func TestReadyHandlerHidesErrors(t *testing.T) {
+	const detail = `failed to connect to host=db user=forum database=forum: password authentication failed`
+	c := NewChecker(time.Second, nil)
+	c.Add("database", func(ctx context.Context) error { return errors.New(detail) })
+	c.Add("migrations", func(ctx context.Context) error { return nil })
+	var out bytes.Buffer
+	handler := logging.Middleware(zerolog.New(&out), 0, c.ReadyHandler)
+
+	var ctx fasthttp.RequestCtx
+	ctx.Request.SetRequestURI("/readyz")
+	handler(&ctx)
+	if status := ctx.Response.StatusCode(); status != fasthttp.StatusServiceUnavailable {
+		t.Errorf("status %d, want 503", status)
+	}
+	want := `{"status":"not ready","checks":[{"name":"database","status":"failing"},{"name":"migrations","status":"ok"}]}`
+	if body := string(ctx.Response.Body()); body != want {
+		t.Errorf("body %s, want %s", body, want)
+	}
+	if !strings.Contains(out.String(), detail) || !strings.Contains(out.String(), `"check":"database"`) {
+		t.Errorf("the failure is not logged: %s", out.String())
+	}
+}
+
+func TestSchemaVersion(t *testing.T) {
+	latest := func() (int, error) { return 9, nil }
+	cases := []struct {
+		version int
+		fails   bool
+	}{
+		{0, true},
+		{8, true},
+		{9, false},
+		// a database migrated by a newer binary
+		{10, false},
+	}
+	for _, c := range cases {
+		version := func(ctx context.Context) (int, error) { return c.version, nil }
+		err := schemaVersion(version, latest)(context.Background())
+		if (err != nil) != c.fails {
+			t.Errorf("schema at version %d: %v, want failing %v", c.version, err, c.fails)
+		}
+	}
+	broken := func(ctx context.Context) (int, error) { return 0, errors.New("boom") }
+	if err := schemaVersion(broken, latest)(context.Background()); err == nil {
+		t.Error("a failing version query passes")
+	}
+}
@@ -0,0 +1,139 @@
+package delivery
+
+import (
+	"github.com/fasthttp/router"
+	"github.com/valyala/fasthttp"
+	"repo/internal/pkg/domain"
+	"repo/internal/pkg/history"
+	"repo/internal/pkg/utils"
+	"strconv"
+)
+
+type HistoryHandler struct {
+	hr domain.HistoryRepository
+	fr domain.ForumRepository
+}
+
+func NewHistoryHandler(r *router.Router, hr domain.HistoryRepository, fr domain.ForumRepository, t utils.Timeouts) {
+	handler := HistoryHandler{hr: hr, fr: fr}
+	route := t.Router(r)
+	route.GET("/api/post/{id:[0-9]+}/history", handler.PostHistory)
+	route.GET("/api/post/{id:[0-9]+}/diff", handler.PostDiff)
+	route.GET("/api/thread/{slug_or_id}/history", handler.ThreadHistory)
+	route.GET("/api/thread/{slug_or_id}/diff", handler.ThreadDiff)
+}
+
+func (hh *HistoryHandler) PostHistory(ctx *fasthttp.RequestCtx) {
+	revisions, ok := hh.postHistory(ctx)
+	if !ok {
+		return
+	}
+	utils.Send(200, revisions, ctx)
+}
+
+// PostDiff compares two versions of a post, ?from= and ?to= default to the
+// previous and the latest version.
+func (hh *HistoryHandler) PostDiff(ctx *fasthttp.RequestCtx) {
+	revisions, ok := hh.postHistory(ctx)
+	if !ok {
+		return
+	}
+	from, to, ok := versions(ctx, len(revisions))
+	if !ok {
+		return
+	}
+	a, b := revisions[from-1], revisions[to-1]
+	utils.Send(200, domain.RevisionDiff{From: from, To: to, Message: history.Diff(a.Message, b.Message)}, ctx)
+}
+
+func (hh *HistoryHandler) ThreadHistory(ctx *fasthttp.RequestCtx) {
+	revisions, ok := hh.threadHistory(ctx)
+	if !ok {
+		return
+	}
+	utils.Send(200, revisions, ctx)
+}
+
+func (hh *HistoryHandler) ThreadDiff(ctx *fasthttp.RequestCtx) {
+	revisions, ok := hh.threadHistory(ctx)
+	if !ok {
+		return
+	}
+	from, to, ok := versions(ctx, len(revisions))
+	if !ok {
+		return
+	}
+	a, b := revisions[from-1], revisions[to-1]
+	diff := domain.RevisionDiff{From: from, To: to, Title: history.Diff(a.Title, b.Title), Message: history.Diff(a.Message, b.Message)}
+	utils.Send(200, diff, ctx)
+}
+
+// postHistory loads the history of the {id} post. Hidden and deleted posts have none to show.
+func (hh *HistoryHandler) postHistory(ctx *fasthttp.RequestCtx) ([]domain.Revision, bool) {
+	c := utils.Context(ctx)
+	param, _ := ctx.UserValue("id").(string)
+	id, err := strconv.ParseInt(param, 10, 64)
+	if err != nil {
+		utils.Send(400, domain.Response{Message: "post id must be a number"}, ctx)
+		return nil, false
+	}
+	full, err := hh.fr.GetPost(c, domain.Post{Id: id}, nil)
+	if err == nil && (full.Post.Hidden || full.Post.Deleted) {
+		err = domain.NewError(domain.ErrNotFound, "History of post %d is not available", id)
+	}
+	if err != nil {
+		utils.SendError(err, ctx)
+		return nil, false
+	}
+	revisions, err := hh.hr.PostHistory(c, id)
+	if err != nil {
+		utils.SendError(err, ctx)
+		return nil, false
+	}
+	return revisions, true
+}
+
+func (hh *HistoryHandler) threadHistory(ctx *fasthttp.RequestCtx) ([]domain.Revision, bool) {
+	c := utils.Context(ctx)
+	slugOrId, _ := ctx.UserValue("slug_or_id").(string)
+	id, err := strconv.Atoi(slugOrId)
+	if err != nil {
+		id, err = hh.fr.GetThreadIdBySlug(c, slugOrId)
+	} else {
+		// deleted threads have no history to show either
+		_, err = hh.fr.GetThreadInfo(c, id)
+	}
+	if err != nil {
+		utils.SendError(err, ctx)
+		return nil, false
+	}
+	revisions, err := hh.hr.ThreadHistory(c, id)
+	if err != nil {
+		utils.SendError(err, ctx)
+		return nil, false
+	}
+	return revisions, true
+}
+
+// versions reads ?from= and ?to= for a history of n versions
+func versions(ctx *fasthttp.RequestCtx, n int) (int, int, bool) {
+	to, err := utils.GetQueryInt(ctx, "to")
+	if err == nil && to == 0 {
+		to = n
+	}
+	from := 0
+	if err == nil {
+		from, err = utils.GetQueryInt(ctx, "from")
+	}
+	if err == nil && from == 0 {
+		from = to - 1
+		if from < 1 {
+			from = 1
+		}
+	}
+	if err != nil || from < 1 || to < 1 || from > n || to > n {
+		utils.Send(400, domain.Response{Message: "from and to must be versions between 1 and " + strconv.Itoa(n)}, ctx)
+		return 0, 0, false
+	}
+	return from, to, true
+}
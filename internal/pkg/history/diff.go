@@ -0,0 +1,144 @@
+// Package history compares revisions of posts and threads.
+package history
+
+import (
+	"strings"
+	"unicode"
+
+	"repo/internal/pkg/domain"
+)
+
+// maxCells bounds the LCS table to 1 MB. Texts with more words than that
+// are diffed line by line, and as a whole replacement when even the lines
+// do not fit.
+const maxCells = 1 << 18
+
+// Diff compares two texts word by word. Whitespace is kept with the words,
+// so joining the texts of the equal and delete ops gives a and joining the
+// equal and insert ops gives b.
+func Diff(a, b string) []domain.DiffOp {
+	x, y := tokens(a), tokens(b)
+	// common prefix and suffix need no table
+	pre := 0
+	for pre < len(x) && pre < len(y) && x[pre] == y[pre] {
+		pre++
+	}
+	suf := 0
+	for suf < len(x)-pre && suf < len(y)-pre && x[len(x)-1-suf] == y[len(y)-1-suf] {
+		suf++
+	}
+
+	var ops []domain.DiffOp
+	add := func(op string, text string) {
+		if text == "" {
+			return
+		}
+		if n := len(ops); n > 0 && ops[n-1].Op == op {
+			ops[n-1].Text += text
+			return
+		}
+		ops = append(ops, domain.DiffOp{Op: op, Text: text})
+	}
+	for _, t := range x[:pre] {
+		add(domain.DiffEqual, t)
+	}
+	middle(x[pre:len(x)-suf], y[pre:len(y)-suf], add)
+	for _, t := range x[len(x)-suf:] {
+		add(domain.DiffEqual, t)
+	}
+	if ops == nil {
+		ops = []domain.DiffOp{}
+	}
+	return ops
+}
+
+// middle diffs what is left between the common prefix and suffix with a
+// longest common subsequence table
+func middle(x, y []string, add func(op string, text string)) {
+	if len(x)*len(y) > maxCells {
+		x, y = lines(x), lines(y)
+	}
+	if len(x)*len(y) > maxCells {
+		for _, t := range x {
+			add(domain.DiffDelete, t)
+		}
+		for _, t := range y {
+			add(domain.DiffInsert, t)
+		}
+		return
+	}
+	// lcs[i][j] is the LCS length of x[i:] and y[j:]
+	lcs := make([][]int32, len(x)+1)
+	for i := range lcs {
+		lcs[i] = make([]int32, len(y)+1)
+	}
+	for i := len(x) - 1; i >= 0; i-- {
+		for j := len(y) - 1; j >= 0; j-- {
+			if x[i] == y[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+	i, j := 0, 0
+	for i < len(x) && j < len(y) {
+		switch {
+		case x[i] == y[j]:
+			add(domain.DiffEqual, x[i])
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			add(domain.DiffDelete, x[i])
+			i++
+		default:
+			add(domain.DiffInsert, y[j])
+			j++
+		}
+	}
+	for ; i < len(x); i++ {
+		add(domain.DiffDelete, x[i])
+	}
+	for ; j < len(y); j++ {
+		add(domain.DiffInsert, y[j])
+	}
+}
+
+// lines joins words back into lines, each ending with the word whose
+// whitespace holds its line break
+func lines(words []string) []string {
+	var out []string
+	var line strings.Builder
+	for _, w := range words {
+		line.WriteString(w)
+		if strings.ContainsRune(w, '\n') {
+			out = append(out, line.String())
+			line.Reset()
+		}
+	}
+	if line.Len() > 0 {
+		out = append(out, line.String())
+	}
+	return out
+}
+
+// tokens splits s into words, each followed by the whitespace after it
+func tokens(s string) []string {
+	var out []string
+	start := 0
+	inSpace := false
+	for i, r := range s {
+		space := unicode.IsSpace(r)
+		if !space && inSpace {
+			out = append(out, s[start:i])
+			start = i
+		}
+		inSpace = space
+	}
+	if start < len(s) {
+		out = append(out, s[start:])
+	}
+	return out
+}
@@ -0,0 +1,98 @@
+package history
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"repo/internal/pkg/domain"
+)
+
+func TestDiff(t *testing.T) {
+	cases := []struct {
+		a, b string
+		want []domain.DiffOp
+	}{
+		{"", "", []domain.DiffOp{}},
+		{"same text", "same text", []domain.DiffOp{{Op: domain.DiffEqual, Text: "same text"}}},
+		{"the quick fox", "the slow fox", []domain.DiffOp{
+			{Op: domain.DiffEqual, Text: "the "}, {Op: domain.DiffDelete, Text: "quick "}, {Op: domain.DiffInsert, Text: "slow "}, {Op: domain.DiffEqual, Text: "fox"},
+		}},
+		{"hello", "hello world", []domain.DiffOp{
+			{Op: domain.DiffDelete, Text: "hello"}, {Op: domain.DiffInsert, Text: "hello world"},
+		}},
+		{"a b c", "a c", []domain.DiffOp{{Op: domain.DiffEqual, Text: "a "}, {Op: domain.DiffDelete, Text: "b "}, {Op: domain.DiffEqual, Text: "c"}}},
+		{"", "new", []domain.DiffOp{{Op: domain.DiffInsert, Text: "new"}}},
+	}
+	for _, c := range cases {
+		if got := Diff(c.a, c.b); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("Diff(%q, %q) = %v, want %v", c.a, c.b, got, c.want)
+		}
+	}
+}
+
+func TestDiffRebuildsBothTexts(t *testing.T) {
+	a := "Привет, мир!  This is\tthe first version of a post."
+	b := "Привет мир! This is the second version of the post, edited."
+	var gotA, gotB string
+	for _, op := range Diff(a, b) {
+		if op.Op != domain.DiffInsert {
+			gotA += op.Text
+		}
+		if op.Op != domain.DiffDelete {
+			gotB += op.Text
+		}
+	}
+	if gotA != a || gotB != b {
+		t.Errorf("rebuilt %q / %q", gotA, gotB)
+	}
+}
+
+// rebuilt joins the text of the ops other than skip
+func rebuilt(ops []domain.DiffOp, skip string) string {
+	var b strings.Builder
+	for _, op := range ops {
+		if op.Op != skip {
+			b.WriteString(op.Text)
+		}
+	}
+	return b.String()
+}
+
+// text has n lines of ten words, line changed reads differently
+func text(n int, changed int) string {
+	var b strings.Builder
+	for i := 0; i < n; i++ {
+		word := "word"
+		if i == changed {
+			word = "edit"
+		}
+		b.WriteString(strings.Repeat(word+" ", 9) + word + "\n")
+	}
+	return b.String()
+}
+
+func TestDiffOfLongTexts(t *testing.T) {
+	// 2000 words on each side do not fit a word table, 200 lines do: the line
+	// that moved comes out whole
+	a, b := text(200, 50), text(200, 150)
+	ops := Diff(a, b)
+	line := func(word string) string { return strings.Repeat(word+" ", 9) + word + "\n" }
+	var changed []domain.DiffOp
+	for _, op := range ops {
+		if op.Op != domain.DiffEqual {
+			changed = append(changed, op)
+		}
+	}
+	want := []domain.DiffOp{{Op: domain.DiffDelete, Text: line("edit")}, {Op: domain.DiffInsert, Text: line("edit")}}
+	if !reflect.DeepEqual(changed, want) || rebuilt(ops, domain.DiffInsert) != a || rebuilt(ops, domain.DiffDelete) != b {
+		t.Errorf("changes %v, want %v", changed, want)
+	}
+
+	// lines too many for the table are replaced as a whole
+	a, b = text(1000, 0), text(1000, 999)
+	ops = Diff(a, b)
+	if len(ops) != 2 || ops[0] != (domain.DiffOp{Op: domain.DiffDelete, Text: a}) || ops[1] != (domain.DiffOp{Op: domain.DiffInsert, Text: b}) {
+		t.Errorf("diff of texts too long for any table: %d ops", len(ops))
+	}
+}
@@ -0,0 +1,75 @@
+package repository
+
+import (
+	"context"
+	"errors"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"repo/internal/pkg/domain"
+	"repo/internal/pkg/metrics"
+)
+
+type HistoryRepository struct {
+	dbm *pgxpool.Pool
+}
+
+func NewHistoryRep(pool *pgxpool.Pool) HistoryRepository {
+	return HistoryRepository{dbm: pool}
+}
+
+// PostHistory lists the versions of a post oldest first. A post that was never
+// edited has no stored revisions and its only version is the post itself.
+func (h *HistoryRepository) PostHistory(ctx context.Context, id int64) ([]domain.Revision, error) {
+	defer metrics.Query("history", "PostHistory")()
+	revisions, err := h.revisions(ctx, "SELECT '', Message, COALESCE(EditedBy, ''), Created FROM post_revisions WHERE Post = $1 ORDER BY Id", id)
+	if err != nil || len(revisions) > 0 {
+		return revisions, err
+	}
+	original := domain.Revision{Version: 1}
+	err = h.dbm.QueryRow(ctx, "SELECT Message, Author, Created FROM Posts WHERE Id = $1", id).
+		Scan(&original.Message, &original.EditedBy, &original.Created)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, domain.NewError(domain.ErrNotFound, "Can't find post with id: %d", id)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return []domain.Revision{original}, nil
+}
+
+// ThreadHistory lists the versions of a thread's title and message oldest first.
+func (h *HistoryRepository) ThreadHistory(ctx context.Context, id int) ([]domain.Revision, error) {
+	defer metrics.Query("history", "ThreadHistory")()
+	revisions, err := h.revisions(ctx, "SELECT Title, Message, COALESCE(EditedBy, ''), Created FROM thread_revisions WHERE Thread = $1 ORDER BY Id", id)
+	if err != nil || len(revisions) > 0 {
+		return revisions, err
+	}
+	original := domain.Revision{Version: 1}
+	err = h.dbm.QueryRow(ctx, "SELECT Title, COALESCE(Message, ''), Author, Created FROM Threads WHERE Id = $1", id).
+		Scan(&original.Title, &original.Message, &original.EditedBy, &original.Created)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, domain.NewError(domain.ErrNotFound, "Can't find thread with id: %d", id)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return []domain.Revision{original}, nil
+}
+
+func (h *HistoryRepository) revisions(ctx context.Context, query string, id interface{}) ([]domain.Revision, error) {
+	rows, err := h.dbm.Query(ctx, query, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var revisions []domain.Revision
+	for rows.Next() {
+		revision := domain.Revision{Version: len(revisions) + 1}
+		if err = rows.Scan(&revision.Title, &revision.Message, &revision.EditedBy, &revision.Created); err != nil {
+			return nil, err
+		}
+		revisions = append(revisions, revision)
+	}
+	return revisions, rows.Err()
+}
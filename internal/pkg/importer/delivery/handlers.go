@@ -0,0 +1,54 @@
+package delivery
+
+import (
+	"bytes"
+	"github.com/fasthttp/router"
+	"github.com/valyala/fasthttp"
+	"repo/internal/pkg/auth"
+	"repo/internal/pkg/domain"
+	"repo/internal/pkg/importer"
+	"repo/internal/pkg/policy"
+	"repo/internal/pkg/utils"
+	"strings"
+)
+
+type ImportHandler struct {
+	ir    domain.ImportRepository
+	authz auth.Authorizer
+}
+
+func NewImportHandler(r *router.Router, ir domain.ImportRepository, t utils.Timeouts, authz auth.Authorizer) {
+	handler := ImportHandler{ir: ir, authz: authz}
+	route := t.Router(r)
+	route.POST("/api/service/import/{kind}", handler.Import)
+}
+
+// Import reads the rows of one kind from the body, JSON Lines unless
+// ?format=csv or a text/csv content type says otherwise. Admins only.
+func (ih *ImportHandler) Import(ctx *fasthttp.RequestCtx) {
+	c := utils.Context(ctx)
+	kind, ok := ctx.UserValue("kind").(string)
+	if !ok {
+		utils.Send(400, "bad request", ctx)
+		return
+	}
+	if err := ih.authz.Check(ctx, "", policy.CanImport); err != nil {
+		utils.SendError(err, ctx)
+		return
+	}
+	format := utils.GetQueryString(ctx, "format")
+	if format == "" && strings.HasPrefix(string(ctx.Request.Header.ContentType()), "text/csv") {
+		format = importer.FormatCSV
+	}
+	source, err := importer.NewSource(kind, format, bytes.NewReader(ctx.PostBody()))
+	if err != nil {
+		utils.SendError(err, ctx)
+		return
+	}
+	result, err := ih.ir.Import(c, source)
+	if err != nil {
+		utils.SendError(err, ctx)
+		return
+	}
+	utils.Send(200, result, ctx)
+}
@@ -0,0 +1,355 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"repo/internal/pkg/domain"
+	"repo/internal/pkg/metrics"
+)
+
+// maxRejections bounds the rejected rows listed in a result, all of them are counted
+const maxRejections = 1000
+
+// step runs against the staging table import_rows. A step with a reason
+// rejects the rows its query deletes, the query returns their Line and the
+// detail the reason is formatted with.
+type step struct {
+	query  string
+	reason string
+}
+
+// kind is how the rows of one kind are staged, checked and inserted
+type kind struct {
+	// staging declares the columns of import_rows after Line, in the order of values
+	staging string
+	values  func(v interface{}) []interface{}
+	steps   []step
+	// triggers are disabled for the insert, rebuild does their work for all rows at once
+	triggers map[string][]string
+	insert   string
+	rebuild  []string
+}
+
+// repeated rejects the rows repeating the column of an earlier line
+func repeated(column, reason string) step {
+	return step{
+		query: fmt.Sprintf(`DELETE FROM import_rows r WHERE r.%[1]s IS NOT NULL AND EXISTS
+			(SELECT 1 FROM import_rows e WHERE e.%[1]s = r.%[1]s AND e.Line < r.Line) RETURNING r.Line, r.%[1]s::text`, column),
+		reason: reason,
+	}
+}
+
+// matching rejects the rows for which cond holds, r being the staged row
+func matching(cond, detail, reason string) step {
+	return step{
+		query:  "DELETE FROM import_rows r WHERE " + cond + " RETURNING r.Line, " + detail + "::text",
+		reason: reason,
+	}
+}
+
+// recount sets the counters of the forums in forums, a query of slugs, as the triggers keep them:
+// live threads, and live posts of live threads.
+func recount(forums string) string {
+	return `UPDATE Forum f SET
+		Threads = (SELECT COUNT(*) FROM Threads t WHERE t.Forum = f.Slug AND NOT t.IsDeleted),
+		Posts = (SELECT COUNT(*) FROM Posts p JOIN Threads t ON t.Id = p.Thread
+			WHERE t.Forum = f.Slug AND NOT p.IsDeleted AND NOT t.IsDeleted)
+		WHERE f.Slug IN (` + forums + `)`
+}
+
+// resequence moves the id sequence of table past the ids imported
+func resequence(table string) string {
+	return fmt.Sprintf("SELECT setval(pg_get_serial_sequence('%[1]s', 'id'), GREATEST((SELECT MAX(Id) FROM %[1]s), 1))", table)
+}
+
+// orNil is NULL for zero values, so that the column default or COALESCE applies
+func orNil(v interface{}) interface{} {
+	switch v := v.(type) {
+	case string:
+		if v == "" {
+			return nil
+		}
+	case int64:
+		if v == 0 {
+			return nil
+		}
+	case time.Time:
+		if v.IsZero() {
+			return nil
+		}
+	}
+	return v
+}
+
+var kinds = map[string]kind{
+	domain.ImportUsers: {
+		staging: "Nickname citext, FullName citext, About TEXT, Email citext",
+		values: func(v interface{}) []interface{} {
+			u := v.(domain.User)
+			return []interface{}{u.Nickname, u.FullName, u.About, u.Email}
+		},
+		steps: []step{
+			repeated("Nickname", "nickname %s repeats an earlier line"),
+			matching("EXISTS (SELECT 1 FROM users u WHERE u.Nickname = r.Nickname)", "r.Nickname", "nickname %s is taken"),
+			repeated("Email", "email %s repeats an earlier line"),
+			matching("EXISTS (SELECT 1 FROM users u WHERE u.Email = r.Email)", "r.Email", "email %s is taken"),
+		},
+		insert: "INSERT INTO users (Nickname, FullName, About, Email) SELECT Nickname, FullName, About, Email FROM import_rows",
+	},
+
+	domain.ImportForums: {
+		staging: "Title TEXT, Usr citext, Slug citext",
+		values: func(v interface{}) []interface{} {
+			f := v.(domain.Forum)
+			return []interface{}{f.Title, f.User, f.Slug}
+		},
+		steps: []step{
+			repeated("Slug", "slug %s repeats an earlier line"),
+			matching("EXISTS (SELECT 1 FROM Forum f WHERE f.Slug = r.Slug)", "r.Slug", "slug %s is taken"),
+			matching("NOT EXISTS (SELECT 1 FROM users u WHERE u.Nickname = r.Usr)", "r.Usr", "user %s is missing"),
+		},
+		insert: `INSERT INTO Forum (Title, Usr, Slug)
+			SELECT r.Title, u.Nickname, r.Slug FROM import_rows r JOIN users u ON u.Nickname = r.Usr`,
+	},
+
+	domain.ImportThreads: {
+		staging: "Id BIGINT, Title TEXT, Forum citext, Message TEXT, Author citext, Slug citext, Created TIMESTAMPTZ, IsPinned BOOLEAN, IsLocked BOOLEAN",
+		values: func(v interface{}) []interface{} {
+			t := v.(domain.Thread)
+			return []interface{}{int64(t.Id), t.Title, t.Forum, t.Message, t.Author, orNil(t.Slug), orNil(t.Created), t.Pinned, t.Locked}
+		},
+		steps: []step{
+			repeated("Id", "id %s repeats an earlier line"),
+			matching("EXISTS (SELECT 1 FROM Threads t WHERE t.Id = r.Id)", "r.Id", "id %s is taken"),
+			repeated("Slug", "slug %s repeats an earlier line"),
+			matching("EXISTS (SELECT 1 FROM Threads t WHERE t.Slug = r.Slug)", "r.Slug", "slug %s is taken"),
+			matching("NOT EXISTS (SELECT 1 FROM Forum f WHERE f.Slug = r.Forum AND NOT f.IsDeleted)", "r.Forum", "forum %s is missing"),
+			matching("NOT EXISTS (SELECT 1 FROM users u WHERE u.Nickname = r.Author)", "r.Author", "author %s is missing"),
+		},
+		triggers: map[string][]string{"Threads": {"newThreadCreated", "newThreadCreated1", "threadModerationCheck"}},
+		insert: `INSERT INTO Threads (Id, Title, Forum, Message, Author, Slug, Created, IsPinned, IsLocked)
+			SELECT r.Id, r.Title, f.Slug, r.Message, u.Nickname, r.Slug, COALESCE(r.Created, now()), r.IsPinned, r.IsLocked
+			FROM import_rows r JOIN Forum f ON f.Slug = r.Forum JOIN users u ON u.Nickname = r.Author`,
+		rebuild: []string{
+			`INSERT INTO forumUsers (Nickname, Slug)
+				SELECT DISTINCT t.Author, t.Forum FROM Threads t JOIN import_rows r ON r.Id = t.Id ON CONFLICT DO NOTHING`,
+			recount("SELECT Forum FROM import_rows"),
+			resequence("threads"),
+		},
+	},
+
+	domain.ImportPosts: {
+		staging: "Id BIGINT, Parent BIGINT, Author citext, Message TEXT, IsEdited BOOLEAN, Thread BIGINT, Created TIMESTAMPTZ, IsHidden BOOLEAN, IsDeleted BOOLEAN",
+		values: func(v interface{}) []interface{} {
+			p := v.(domain.Post)
+			return []interface{}{p.Id, orNil(p.Parent), p.Author, p.Message, p.IsEdited, int64(p.Thread), orNil(p.Created), p.Hidden, p.Deleted}
+		},
+		steps: []step{
+			repeated("Id", "id %s repeats an earlier line"),
+			matching("EXISTS (SELECT 1 FROM Posts p WHERE p.Id = r.Id)", "r.Id", "id %s is taken"),
+			matching("NOT EXISTS (SELECT 1 FROM Threads t WHERE t.Id = r.Thread AND NOT t.IsDeleted)", "r.Thread", "thread %s is missing"),
+			matching("NOT EXISTS (SELECT 1 FROM users u WHERE u.Nickname = r.Author)", "r.Author", "author %s is missing"),
+			matching(`EXISTS (SELECT 1 FROM Posts p WHERE p.Id = r.Parent AND p.Thread <> r.Thread)
+				OR EXISTS (SELECT 1 FROM import_rows q WHERE q.Id = r.Parent AND q.Thread <> r.Thread)`,
+				"r.Parent", "parent %s is in another thread"),
+			// the paths (treeOrder) of the posts that reach a root, through posts
+			// already stored or imported along with them
+			{query: `CREATE TEMP TABLE import_paths ON COMMIT DROP AS
+				WITH RECURSIVE tree (Id, Path) AS (
+					SELECT r.Id, COALESCE(p.treeOrder, ARRAY[]::BIGINT[]) || r.Id
+					FROM import_rows r LEFT JOIN Posts p ON p.Id = r.Parent
+					WHERE r.Parent IS NULL OR p.Id IS NOT NULL
+				UNION ALL
+					SELECT r.Id, t.Path || r.Id FROM import_rows r JOIN tree t ON t.Id = r.Parent
+				)
+				SELECT Id, Path FROM tree`},
+			matching("NOT EXISTS (SELECT 1 FROM import_paths p WHERE p.Id = r.Id)", "r.Parent", "parent %s is missing or rejected"),
+		},
+		triggers: map[string][]string{"Posts": {"newPostToAdd", "newPostCreated"}},
+		insert: `INSERT INTO Posts (Id, Parent, Author, Message, IsEdited, Forum, Thread, Created, IsHidden, IsDeleted, treeOrder)
+			SELECT r.Id, r.Parent, u.Nickname, r.Message, r.IsEdited, t.Forum, r.Thread, COALESCE(r.Created, now()), r.IsHidden, r.IsDeleted, p.Path
+			FROM import_rows r JOIN import_paths p ON p.Id = r.Id
+				JOIN Threads t ON t.Id = r.Thread JOIN users u ON u.Nickname = r.Author`,
+		rebuild: []string{
+			`INSERT INTO forumUsers (Nickname, Slug)
+				SELECT DISTINCT p.Author, p.Forum FROM Posts p JOIN import_rows r ON r.Id = p.Id ON CONFLICT DO NOTHING`,
+			recount("SELECT t.Forum FROM Threads t WHERE t.Id IN (SELECT Thread FROM import_rows)"),
+			resequence("posts"),
+		},
+	},
+
+	domain.ImportVotes: {
+		staging: "Nickname citext, Voice INT, Thread BIGINT",
+		values: func(v interface{}) []interface{} {
+			vote := v.(domain.Vote)
+			return []interface{}{vote.Nickname, vote.Voice, vote.IdThread}
+		},
+		steps: []step{
+			matching("NOT EXISTS (SELECT 1 FROM users u WHERE u.Nickname = r.Nickname)", "r.Nickname", "user %s is missing"),
+			matching("NOT EXISTS (SELECT 1 FROM Threads t WHERE t.Id = r.Thread AND NOT t.IsDeleted)", "r.Thread", "thread %s is missing"),
+		},
+		triggers: map[string][]string{"Votes": {"newVote", "changeVote"}},
+		// as through the API a later vote replaces an earlier one
+		insert: `INSERT INTO Votes (Nickname, Voice, IdThread)
+			SELECT DISTINCT ON (u.Nickname, r.Thread) u.Nickname, r.Voice, r.Thread
+			FROM import_rows r JOIN users u ON u.Nickname = r.Nickname
+			ORDER BY u.Nickname, r.Thread, r.Line DESC
+			ON CONFLICT (Nickname, IdThread) DO UPDATE SET Voice = EXCLUDED.Voice`,
+		rebuild: []string{
+			`UPDATE Threads t SET Votes = (SELECT COALESCE(SUM(v.Voice), 0) FROM Votes v WHERE v.IdThread = t.Id)
+				WHERE t.Id IN (SELECT Thread FROM import_rows)`,
+		},
+	},
+}
+
+type ImportRepository struct {
+	dbm *pgxpool.Pool
+}
+
+func NewImportRep(pool *pgxpool.Pool) ImportRepository {
+	return ImportRepository{dbm: pool}
+}
+
+// Import copies the rows of source into a staging table, rejects the rows
+// that conflict with stored data, with each other or refer to missing rows,
+// and inserts the rest in one statement. The triggers doing per row work are
+// off meanwhile: tree paths, forum users and counters are rebuilt afterwards.
+// Disabling them locks the tables until the import is over.
+func (i *ImportRepository) Import(ctx context.Context, source domain.ImportSource) (domain.ImportResult, error) {
+	defer metrics.Query("import", "Import")()
+	result := domain.ImportResult{Kind: source.Kind(), Rejections: []domain.Rejection{}}
+	k, ok := kinds[source.Kind()]
+	if !ok {
+		return result, domain.NewError(domain.ErrInvalid, "Unknown import kind: %s", source.Kind())
+	}
+
+	tx, err := i.dbm.Begin(ctx)
+	if err != nil {
+		return result, err
+	}
+	defer tx.Rollback(ctx)
+	if _, err = tx.Exec(ctx, "CREATE TEMP TABLE import_rows (Line INT NOT NULL, "+k.staging+") ON COMMIT DROP"); err != nil {
+		return result, err
+	}
+	rows := &copySource{source: source, values: k.values, result: &result}
+	if _, err = tx.CopyFrom(ctx, pgx.Identifier{"import_rows"}, stagingColumns(k.staging), rows); err != nil {
+		return result, err
+	}
+	for _, s := range k.steps {
+		if err = rejectRows(ctx, tx, s, &result); err != nil {
+			return result, err
+		}
+	}
+
+	if err = setTriggers(ctx, tx, k.triggers, "DISABLE"); err != nil {
+		return result, err
+	}
+	if _, err = tx.Exec(ctx, k.insert); err != nil {
+		return result, err
+	}
+	for _, query := range k.rebuild {
+		if _, err = tx.Exec(ctx, query); err != nil {
+			return result, err
+		}
+	}
+	if err = setTriggers(ctx, tx, k.triggers, "ENABLE"); err != nil {
+		return result, err
+	}
+	if err = tx.Commit(ctx); err != nil {
+		return result, err
+	}
+
+	result.Imported = result.Read - result.Rejected
+	sort.SliceStable(result.Rejections, func(a, b int) bool { return result.Rejections[a].Line < result.Rejections[b].Line })
+	if len(result.Rejections) > maxRejections {
+		result.Rejections = result.Rejections[:maxRejections]
+	}
+	return result, nil
+}
+
+// stagingColumns names the columns of import_rows from their declaration
+func stagingColumns(staging string) []string {
+	columns := []string{"line"}
+	for _, decl := range strings.Split(staging, ",") {
+		columns = append(columns, strings.ToLower(strings.Fields(decl)[0]))
+	}
+	return columns
+}
+
+func rejectRows(ctx context.Context, tx pgx.Tx, s step, result *domain.ImportResult) error {
+	if s.reason == "" {
+		_, err := tx.Exec(ctx, s.query)
+		return err
+	}
+	rows, err := tx.Query(ctx, s.query)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var line int
+		var detail string
+		if err = rows.Scan(&line, &detail); err != nil {
+			return err
+		}
+		reject(result, line, fmt.Sprintf(s.reason, detail))
+	}
+	return rows.Err()
+}
+
+func reject(result *domain.ImportResult, line int, reason string) {
+	result.Rejected++
+	result.Rejections = append(result.Rejections, domain.Rejection{Line: line, Reason: reason})
+}
+
+func setTriggers(ctx context.Context, tx pgx.Tx, triggers map[string][]string, action string) error {
+	for table, names := range triggers {
+		actions := make([]string, len(names))
+		for i, name := range names {
+			actions[i] = action + " TRIGGER " + name
+		}
+		if _, err := tx.Exec(ctx, "ALTER TABLE "+table+" "+strings.Join(actions, ", ")); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// copySource feeds the rows of an import to COPY, the rows that could not be
+// read are rejected on the way.
+type copySource struct {
+	source domain.ImportSource
+	values func(v interface{}) []interface{}
+	result *domain.ImportResult
+	row    []interface{}
+}
+
+func (c *copySource) Next() bool {
+	for {
+		row, ok := c.source.Next()
+		if !ok {
+			return false
+		}
+		c.result.Read++
+		if row.Reason != "" {
+			reject(c.result, row.Line, row.Reason)
+			continue
+		}
+		c.row = append([]interface{}{int32(row.Line)}, c.values(row.Value)...)
+		return true
+	}
+}
+
+func (c *copySource) Values() ([]interface{}, error) {
+	return c.row, nil
+}
+
+func (c *copySource) Err() error {
+	return c.source.Err()
+}
@@ -0,0 +1,123 @@
+//go:build integration
+
+package repository
+
+import (
+	"context"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"repo/internal/pkg/domain"
+	"repo/internal/pkg/importer"
+	"repo/internal/pkg/testdb"
+)
+
+var db *testdb.Cluster
+
+func TestMain(m *testing.M) {
+	os.Exit(testdb.Main(m, &db))
+}
+
+var ctx = context.Background()
+
+func mustImport(t *testing.T, ir *ImportRepository, kind, format, input string) domain.ImportResult {
+	t.Helper()
+	source, err := importer.NewSource(kind, format, strings.NewReader(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := ir.Import(ctx, source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return result
+}
+
+func lines(result domain.ImportResult) []int {
+	res := []int{}
+	for _, r := range result.Rejections {
+		res = append(res, r.Line)
+	}
+	return res
+}
+
+func TestImport(t *testing.T) {
+	db.Reset(t)
+	ir := NewImportRep(db.Pool)
+
+	users := mustImport(t, &ir, domain.ImportUsers, importer.FormatCSV, "nickname,fullname,email\n"+
+		"alice,Alice A,alice@example.com\n"+
+		"bob,Bob B,bob@example.com\n"+
+		"ALICE,Again,other@example.com\n"+
+		"carol,Carol C,BOB@example.com\n")
+	if users.Read != 4 || users.Imported != 2 || !reflect.DeepEqual(lines(users), []int{4, 5}) {
+		t.Errorf("users = %+v, want lines 4 and 5 rejected", users)
+	}
+
+	forums := mustImport(t, &ir, domain.ImportForums, importer.FormatJSONL, `{"title":"Go","user":"ALICE","slug":"go"}
+{"title":"Nobody's","user":"nobody","slug":"none"}`)
+	if forums.Imported != 1 || !reflect.DeepEqual(lines(forums), []int{2}) {
+		t.Errorf("forums = %+v, want line 2 rejected", forums)
+	}
+
+	threads := mustImport(t, &ir, domain.ImportThreads, importer.FormatJSONL, `{"id":10,"title":"first","message":"m","author":"bob","forum":"GO","slug":"first"}
+{"id":11,"title":"second","message":"m","author":"alice","forum":"go"}
+{"id":12,"title":"elsewhere","message":"m","author":"alice","forum":"missing"}`)
+	if threads.Imported != 2 || !reflect.DeepEqual(lines(threads), []int{3}) {
+		t.Errorf("threads = %+v, want line 3 rejected", threads)
+	}
+
+	// 104 answers a post of another thread, 106 a rejected one
+	posts := mustImport(t, &ir, domain.ImportPosts, importer.FormatJSONL, `{"id":103,"parent":101,"thread":10,"author":"alice","message":"c"}
+{"id":101,"thread":10,"author":"bob","message":"a"}
+{"id":102,"parent":101,"thread":10,"author":"alice","message":"b"}
+{"id":104,"parent":101,"thread":11,"author":"alice","message":"d"}
+{"id":105,"thread":10,"author":"nobody","message":"e"}
+{"id":106,"parent":105,"thread":10,"author":"bob","message":"f"}`)
+	if posts.Imported != 3 || !reflect.DeepEqual(lines(posts), []int{4, 5, 6}) {
+		t.Errorf("posts = %+v, want lines 4 to 6 rejected", posts)
+	}
+	rows, err := db.Pool.Query(ctx, "SELECT Id, treeOrder FROM Posts ORDER BY treeOrder")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var paths [][]int64
+	for rows.Next() {
+		var id int64
+		var path []int64
+		if err = rows.Scan(&id, &path); err != nil {
+			t.Fatal(err)
+		}
+		paths = append(paths, path)
+	}
+	if want := [][]int64{{101}, {101, 102}, {101, 103}}; !reflect.DeepEqual(paths, want) {
+		t.Errorf("paths = %v, want %v", paths, want)
+	}
+
+	votes := mustImport(t, &ir, domain.ImportVotes, importer.FormatCSV, "nickname,voice,thread\nalice,1,10\nbob,1,10\nalice,-1,10\nbob,1,99\n")
+	if votes.Imported != 3 || !reflect.DeepEqual(lines(votes), []int{5}) {
+		t.Errorf("votes = %+v, want line 5 rejected", votes)
+	}
+
+	// the counters and forum users are rebuilt as the triggers would keep them
+	var threadCount, postCount, votesOf10, forumUsers int
+	err = db.Pool.QueryRow(ctx, `SELECT f.Threads, f.Posts, (SELECT Votes FROM Threads WHERE Id = 10),
+		(SELECT COUNT(*) FROM forumUsers WHERE Slug = 'go') FROM Forum f WHERE f.Slug = 'go'`).Scan(&threadCount, &postCount, &votesOf10, &forumUsers)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if threadCount != 2 || postCount != 3 || votesOf10 != 0 || forumUsers != 2 {
+		t.Errorf("threads %d, posts %d, votes %d, forum users %d, want 2, 3, 0 and 2", threadCount, postCount, votesOf10, forumUsers)
+	}
+
+	// the sequences moved past the imported ids
+	var id int64
+	if err = db.Pool.QueryRow(ctx, "INSERT INTO Posts (Author, Message, Forum, Thread) VALUES ('bob', 'new', 'go', 11) RETURNING Id").Scan(&id); err != nil {
+		t.Fatal(err)
+	}
+	if id <= 103 {
+		t.Errorf("new post id %d, want past the imported ids", id)
+	}
+}
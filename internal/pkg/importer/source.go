@@ -0,0 +1,307 @@
+// Package importer reads the rows of a bulk import from JSON Lines or CSV.
+// Rows are decoded and validated one at a time as the input is read, a row
+// that fails is passed on with the reason rather than ending the import.
+package importer
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"repo/internal/pkg/domain"
+	"repo/internal/pkg/validation"
+)
+
+const (
+	FormatJSONL = "jsonl"
+	FormatCSV   = "csv"
+)
+
+// maxLine bounds a JSON line, a longer one ends the input
+const maxLine = 16 << 20
+
+// FormatOf tells the format of a file by its extension: .csv files are CSV,
+// anything else is taken for JSON Lines.
+func FormatOf(name string) string {
+	if strings.EqualFold(filepath.Ext(name), ".csv") {
+		return FormatCSV
+	}
+	return FormatJSONL
+}
+
+// vote is the imported form of a vote, which names its thread
+type vote struct {
+	Nickname string `json:"nickname" validate:"required,nickname"`
+	Voice    int32  `json:"voice" validate:"required,oneof=-1 1"`
+	Thread   int64  `json:"thread"`
+}
+
+// newRow returns a pointer to a zero row of kind
+func newRow(kind string) interface{} {
+	switch kind {
+	case domain.ImportUsers:
+		return &domain.User{}
+	case domain.ImportForums:
+		return &domain.Forum{}
+	case domain.ImportThreads:
+		return &domain.Thread{}
+	case domain.ImportPosts:
+		return &domain.Post{}
+	case domain.ImportVotes:
+		return &vote{}
+	}
+	return nil
+}
+
+// decoder reads the next row of the input into dst. It returns false once
+// the input is over and a reason when the row could not be read.
+type decoder interface {
+	decode(dst interface{}) (line int, reason string, ok bool)
+	err() error
+}
+
+type source struct {
+	kind string
+	dec  decoder
+}
+
+// NewSource reads rows of kind in format from r. CSV input starts with a
+// header naming the columns, after the JSON fields of the rows.
+func NewSource(kind, format string, r io.Reader) (domain.ImportSource, error) {
+	row := newRow(kind)
+	if row == nil {
+		return nil, domain.NewError(domain.ErrInvalid, "Unknown import kind: %s, expected one of %s", kind, strings.Join(domain.ImportKinds, ", "))
+	}
+	switch format {
+	case FormatJSONL, "":
+		sc := bufio.NewScanner(r)
+		sc.Buffer(make([]byte, 64<<10), maxLine)
+		return &source{kind: kind, dec: &jsonLines{sc: sc}}, nil
+	case FormatCSV:
+		dec, err := newCSVRows(r, reflect.TypeOf(row).Elem())
+		if err != nil {
+			return nil, err
+		}
+		return &source{kind: kind, dec: dec}, nil
+	}
+	return nil, domain.NewError(domain.ErrInvalid, "Unknown import format: %s, expected jsonl or csv", format)
+}
+
+func (s *source) Kind() string {
+	return s.kind
+}
+
+func (s *source) Err() error {
+	return s.dec.err()
+}
+
+func (s *source) Next() (domain.ImportRow, bool) {
+	row := newRow(s.kind)
+	line, reason, ok := s.dec.decode(row)
+	if !ok {
+		return domain.ImportRow{}, false
+	}
+	if reason == "" {
+		reason = check(row)
+	}
+	if reason != "" {
+		return domain.ImportRow{Line: line, Reason: reason}, true
+	}
+	var value interface{}
+	switch row := row.(type) {
+	case *vote:
+		value = domain.Vote{Nickname: row.Nickname, Voice: row.Voice, IdThread: row.Thread}
+	default:
+		value = reflect.ValueOf(row).Elem().Interface()
+	}
+	return domain.ImportRow{Line: line, Value: value}, true
+}
+
+// check applies the rules of the API to a row, plus the ids the rows of the
+// next kinds refer to. It returns why the row is rejected, empty if it is not.
+func check(row interface{}) string {
+	var reasons []string
+	for _, e := range validation.Validate(row) {
+		reasons = append(reasons, e.Field+" "+e.Message)
+	}
+	switch row := row.(type) {
+	case *domain.Thread:
+		if row.Id <= 0 {
+			reasons = append(reasons, "id is required")
+		}
+	case *domain.Post:
+		if row.Id <= 0 {
+			reasons = append(reasons, "id is required")
+		}
+		if row.Thread <= 0 {
+			reasons = append(reasons, "thread is required")
+		}
+		if row.Parent < 0 {
+			reasons = append(reasons, "parent must not be negative")
+		}
+	case *vote:
+		if row.Thread <= 0 {
+			reasons = append(reasons, "thread is required")
+		}
+	}
+	return strings.Join(reasons, "; ")
+}
+
+// jsonLines reads one JSON object per line, blank lines are skipped
+type jsonLines struct {
+	sc   *bufio.Scanner
+	line int
+}
+
+func (j *jsonLines) decode(dst interface{}) (int, string, bool) {
+	for j.sc.Scan() {
+		j.line++
+		text := bytes.TrimSpace(j.sc.Bytes())
+		if len(text) == 0 {
+			continue
+		}
+		if err := json.Unmarshal(text, dst); err != nil {
+			return j.line, "malformed JSON: " + err.Error(), true
+		}
+		return j.line, "", true
+	}
+	return 0, "", false
+}
+
+func (j *jsonLines) err() error {
+	if err := j.sc.Err(); err != nil {
+		return fmt.Errorf("after line %d: %w", j.line, err)
+	}
+	return nil
+}
+
+// csvRows reads records whose columns are named by the header
+type csvRows struct {
+	r       *csv.Reader
+	columns []string
+	// fields are the indexes of the row fields in column order
+	fields [][]int
+	failed error
+}
+
+func newCSVRows(r io.Reader, row reflect.Type) (*csvRows, error) {
+	cr := csv.NewReader(r)
+	header, err := cr.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, domain.NewError(domain.ErrInvalid, "The CSV input has no header")
+	}
+	if err != nil {
+		return nil, domain.NewError(domain.ErrInvalid, "Malformed CSV header: %s", err)
+	}
+	byName := jsonFields(row)
+	c := &csvRows{r: cr}
+	for _, name := range header {
+		name = strings.TrimSpace(name)
+		index, ok := byName[name]
+		if !ok {
+			return nil, domain.NewError(domain.ErrInvalid, "Unknown CSV column %q, expected some of %s", name, strings.Join(sortedNames(byName), ", "))
+		}
+		c.columns = append(c.columns, name)
+		c.fields = append(c.fields, index)
+	}
+	return c, nil
+}
+
+func (c *csvRows) decode(dst interface{}) (int, string, bool) {
+	if c.failed != nil {
+		return 0, "", false
+	}
+	record, err := c.r.Read()
+	if errors.Is(err, io.EOF) {
+		return 0, "", false
+	}
+	var parseErr *csv.ParseError
+	if errors.As(err, &parseErr) {
+		return parseErr.StartLine, "malformed CSV: " + parseErr.Err.Error(), true
+	}
+	if err != nil {
+		c.failed = err
+		return 0, "", false
+	}
+	line, _ := c.r.FieldPos(0)
+	v := reflect.ValueOf(dst).Elem()
+	for i, value := range record {
+		if value == "" {
+			continue
+		}
+		if err = setField(v.FieldByIndex(c.fields[i]), value); err != nil {
+			return line, fmt.Sprintf("%s: %s", c.columns[i], err), true
+		}
+	}
+	return line, "", true
+}
+
+func (c *csvRows) err() error {
+	return c.failed
+}
+
+// jsonFields indexes the fields of struct type t by their JSON names
+func jsonFields(t reflect.Type) map[string][]int {
+	fields := map[string][]int{}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name := strings.Split(f.Tag.Get("json"), ",")[0]
+		if name == "" || name == "-" || f.PkgPath != "" {
+			continue
+		}
+		fields[name] = f.Index
+	}
+	return fields
+}
+
+func sortedNames(fields map[string][]int) []string {
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// setField parses s into f as JSON would decode the same value
+func setField(f reflect.Value, s string) error {
+	if f.Type() == timeType {
+		t, err := time.Parse(time.RFC3339Nano, s)
+		if err != nil {
+			return err
+		}
+		f.Set(reflect.ValueOf(t))
+		return nil
+	}
+	switch f.Kind() {
+	case reflect.String:
+		f.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		f.SetBool(b)
+	case reflect.Int, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(s, 10, f.Type().Bits())
+		if err != nil {
+			return err
+		}
+		f.SetInt(n)
+	default:
+		return fmt.Errorf("unsupported field type %s", f.Type())
+	}
+	return nil
+}
@@ -0,0 +1,122 @@
+package importer
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"repo/internal/pkg/domain"
+)
+
+func readAll(t *testing.T, kind, format, input string) []domain.ImportRow {
+	t.Helper()
+	s, err := NewSource(kind, format, strings.NewReader(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rows []domain.ImportRow
+	for {
+		row, ok := s.Next()
+		if !ok {
+			break
+		}
+		rows = append(rows, row)
+	}
+	if err = s.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return rows
+}
+
+func TestJSONLines(t *testing.T) {
+	input := `{"nickname":"alice","fullname":"Alice A","email":"alice@example.com"}
+
+{"nickname":"bob","fullname":"Bob B"}
+{"nickname":
+{"nickname":"carol","fullname":"Carol C","email":"carol@example.com","about":"hi"}
+`
+	rows := readAll(t, domain.ImportUsers, FormatJSONL, input)
+	if len(rows) != 4 {
+		t.Fatalf("got %d rows, want 4: %v", len(rows), rows)
+	}
+	want := domain.User{Nickname: "alice", FullName: "Alice A", Email: "alice@example.com"}
+	if rows[0].Line != 1 || rows[0].Reason != "" || rows[0].Value != want {
+		t.Errorf("row 0 = %+v, want %v at line 1", rows[0], want)
+	}
+	if rows[1].Line != 3 || !strings.Contains(rows[1].Reason, "email") || rows[1].Value != nil {
+		t.Errorf("row 1 = %+v, want the missing email rejected at line 3", rows[1])
+	}
+	if rows[2].Line != 4 || !strings.HasPrefix(rows[2].Reason, "malformed JSON") {
+		t.Errorf("row 2 = %+v, want malformed JSON at line 4", rows[2])
+	}
+	if rows[3].Line != 5 || rows[3].Value.(domain.User).About != "hi" {
+		t.Errorf("row 3 = %+v, want carol at line 5", rows[3])
+	}
+}
+
+func TestCSV(t *testing.T) {
+	input := "id,thread,parent,author,message,created\n" +
+		"1,7,,alice,first,2021-03-04T05:06:07.5Z\n" +
+		"2,7,1,bob,\"a reply,\nover two lines\",2021-03-04T05:06:08Z\n" +
+		"3,7,x,bob,bad parent,\n" +
+		"4,,1,bob,no thread,\n"
+	rows := readAll(t, domain.ImportPosts, FormatCSV, input)
+	if len(rows) != 4 {
+		t.Fatalf("got %d rows, want 4: %v", len(rows), rows)
+	}
+	first := domain.Post{Id: 1, Thread: 7, Author: "alice", Message: "first", Created: time.Date(2021, 3, 4, 5, 6, 7, 5e8, time.UTC)}
+	if rows[0].Line != 2 || !reflect.DeepEqual(rows[0].Value, first) {
+		t.Errorf("row 0 = %+v, want %v at line 2", rows[0], first)
+	}
+	if rows[1].Line != 3 || rows[1].Value.(domain.Post).Message != "a reply,\nover two lines" {
+		t.Errorf("row 1 = %+v, want the quoted message at line 3", rows[1])
+	}
+	if rows[2].Line != 5 || !strings.HasPrefix(rows[2].Reason, "parent: ") {
+		t.Errorf("row 2 = %+v, want a bad parent at line 5", rows[2])
+	}
+	if rows[3].Line != 6 || rows[3].Reason != "thread is required" {
+		t.Errorf("row 3 = %+v, want a missing thread at line 6", rows[3])
+	}
+}
+
+func TestVotes(t *testing.T) {
+	rows := readAll(t, domain.ImportVotes, FormatCSV, "nickname,voice,thread\nalice,-1,3\nbob,2,3\n")
+	want := domain.Vote{Nickname: "alice", Voice: -1, IdThread: 3}
+	if len(rows) != 2 || rows[0].Value != want {
+		t.Fatalf("rows = %+v, want %v first", rows, want)
+	}
+	if !strings.HasPrefix(rows[1].Reason, "voice ") {
+		t.Errorf("row 1 = %+v, want the voice rejected", rows[1])
+	}
+}
+
+func TestThreadsNeedIds(t *testing.T) {
+	rows := readAll(t, domain.ImportThreads, "", `{"title":"t","message":"m","author":"alice","forum":"go"}`)
+	if len(rows) != 1 || rows[0].Reason != "id is required" {
+		t.Errorf("rows = %+v, want the missing id rejected", rows)
+	}
+}
+
+func TestNewSourceErrors(t *testing.T) {
+	cases := []struct{ kind, format, input string }{
+		{"likes", FormatJSONL, ""},
+		{domain.ImportUsers, "xml", ""},
+		{domain.ImportUsers, FormatCSV, ""},
+		{domain.ImportUsers, FormatCSV, "nickname,password\n"},
+	}
+	for _, c := range cases {
+		if _, err := NewSource(c.kind, c.format, strings.NewReader(c.input)); !errors.Is(err, domain.ErrInvalid) {
+			t.Errorf("NewSource(%s, %s, %q) = %v, want invalid", c.kind, c.format, c.input, err)
+		}
+	}
+}
+
+func TestFormatOf(t *testing.T) {
+	for name, want := range map[string]string{"posts.csv": FormatCSV, "POSTS.CSV": FormatCSV, "posts.jsonl": FormatJSONL, "-": FormatJSONL} {
+		if got := FormatOf(name); got != want {
+			t.Errorf("FormatOf(%s) = %s, want %s", name, got, want)
+		}
+	}
+}
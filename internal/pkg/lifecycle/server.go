@@ -0,0 +1,123 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/valyala/fasthttp"
+)
+
+var ErrDrainTimeout = errors.New("in-flight requests were not drained before the deadline")
+
+// Server wraps fasthttp.Server with signal handling and a readiness flag.
+// On SIGINT/SIGTERM it reports not ready, waits DrainDelay so load balancers
+// notice, stops accepting connections and waits up to ShutdownTimeout for
+// in-flight requests before running the registered closers. Requests still
+// running after ShutdownTimeout have Context cancelled before the closers run.
+// The closers also run when the server stops on an error.
+type Server struct {
+	srv             *fasthttp.Server
+	ready           int32
+	ctx             context.Context
+	cancel          context.CancelFunc
+	closers         []func()
+	DrainDelay      time.Duration
+	ShutdownTimeout time.Duration
+}
+
+func NewServer(handler fasthttp.RequestHandler) *Server {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Server{srv: &fasthttp.Server{Handler: handler}, ctx: ctx, cancel: cancel}
+}
+
+// Context is the parent of request contexts, cancelled when the drain deadline passes.
+func (s *Server) Context() context.Context {
+	return s.ctx
+}
+
+// OnShutdown registers a function run after the server is drained or has failed, in registration order.
+func (s *Server) OnShutdown(f func()) {
+	s.closers = append(s.closers, f)
+}
+
+func (s *Server) Ready() bool {
+	return atomic.LoadInt32(&s.ready) == 1
+}
+
+// ListenAndServe blocks until the listener fails or a termination signal is drained.
+func (s *Server) ListenAndServe(addr string) error {
+	ln, err := net.Listen("tcp4", addr)
+	if err != nil {
+		s.close()
+		return err
+	}
+	return s.Serve(ln)
+}
+
+// Serve is ListenAndServe on an existing listener, the server is ready from the start.
+func (s *Server) Serve(ln net.Listener) error {
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(sig)
+
+	errc := make(chan error, 1)
+	go func() {
+		errc <- s.srv.Serve(ln)
+	}()
+	atomic.StoreInt32(&s.ready, 1)
+
+	select {
+	case err := <-errc:
+		atomic.StoreInt32(&s.ready, 0)
+		s.close()
+		return err
+	case got := <-sig:
+		log.Info().Msgf("received %s, draining", got)
+	}
+	return s.shutdown()
+}
+
+func (s *Server) shutdown() error {
+	atomic.StoreInt32(&s.ready, 0)
+	if s.DrainDelay > 0 {
+		time.Sleep(s.DrainDelay)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- s.srv.Shutdown()
+	}()
+	var timeout <-chan time.Time
+	if s.ShutdownTimeout > 0 {
+		timeout = time.After(s.ShutdownTimeout)
+	}
+	var err error
+	select {
+	case err = <-done:
+	case <-timeout:
+		err = ErrDrainTimeout
+	}
+	s.close()
+	if err != nil {
+		return err
+	}
+	log.Info().Msg("shutdown complete")
+	return nil
+}
+
+// close runs the closers on every way out of Serve. It first cancels the
+// queries of stuck requests so they release their connections and the
+// closers, pgxpool.Pool.Close among them, do not wait on them.
+func (s *Server) close() {
+	s.cancel()
+	for _, closer := range s.closers {
+		closer()
+	}
+}
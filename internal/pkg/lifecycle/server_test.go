@@ -0,0 +1,167 @@
+package lifecycle
+
+import (
+	"errors"
+	"net"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/valyala/fasthttp"
+)
+
+// start serves handler on a loopback port and returns its address and the result of Serve.
+func start(t *testing.T, srv *Server) (string, <-chan error) {
+	t.Helper()
+	ln, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	errc := make(chan error, 1)
+	go func() {
+		errc <- srv.Serve(ln)
+	}()
+	for !srv.Ready() {
+		time.Sleep(time.Millisecond)
+	}
+	return "http://" + ln.Addr().String() + "/", errc
+}
+
+func terminate(t *testing.T) {
+	t.Helper()
+	if err := syscall.Kill(syscall.Getpid(), syscall.SIGTERM); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDrain(t *testing.T) {
+	entered, release := make(chan struct{}), make(chan struct{})
+	srv := NewServer(func(ctx *fasthttp.RequestCtx) {
+		close(entered)
+		<-release
+		ctx.SetStatusCode(fasthttp.StatusCreated)
+	})
+	srv.DrainDelay = 10 * time.Millisecond
+	srv.ShutdownTimeout = 5 * time.Second
+	var order []string
+	srv.OnShutdown(func() { order = append(order, "first") })
+	srv.OnShutdown(func() { order = append(order, "second") })
+	url, errc := start(t, srv)
+
+	status := make(chan int, 1)
+	go func() {
+		code, _, err := fasthttp.Get(nil, url)
+		if err != nil {
+			t.Error(err)
+		}
+		status <- code
+	}()
+	<-entered
+	terminate(t)
+	for srv.Ready() {
+		time.Sleep(time.Millisecond)
+	}
+	if len(order) != 0 {
+		t.Errorf("closers ran before the request finished: %v", order)
+	}
+	close(release)
+
+	if err := <-errc; err != nil {
+		t.Errorf("Serve = %v, want nil", err)
+	}
+	if got := <-status; got != fasthttp.StatusCreated {
+		t.Errorf("in-flight request answered %d, want %d", got, fasthttp.StatusCreated)
+	}
+	if len(order) != 2 || order[0] != "first" || order[1] != "second" {
+		t.Errorf("closers ran as %v, want [first second]", order)
+	}
+	if srv.Context().Err() == nil {
+		t.Error("server context not cancelled after shutdown")
+	}
+}
+
+func TestDrainTimeout(t *testing.T) {
+	entered := make(chan struct{})
+	var srv *Server
+	srv = NewServer(func(ctx *fasthttp.RequestCtx) {
+		close(entered)
+		// a stuck query, released only by cancellation
+		<-srv.Context().Done()
+		ctx.SetStatusCode(fasthttp.StatusServiceUnavailable)
+	})
+	srv.ShutdownTimeout = 20 * time.Millisecond
+	cancelledFirst := false
+	srv.OnShutdown(func() { cancelledFirst = srv.Context().Err() != nil })
+	url, errc := start(t, srv)
+
+	status := make(chan int, 1)
+	go func() {
+		code, _, _ := fasthttp.Get(nil, url)
+		status <- code
+	}()
+	<-entered
+	terminate(t)
+
+	if err := <-errc; err != ErrDrainTimeout {
+		t.Errorf("Serve = %v, want ErrDrainTimeout", err)
+	}
+	if !cancelledFirst {
+		t.Error("closers ran without the stuck request being cancelled first")
+	}
+	if got := <-status; got != fasthttp.StatusServiceUnavailable {
+		t.Errorf("stuck request answered %d, want %d", got, fasthttp.StatusServiceUnavailable)
+	}
+}
+
+func TestListenError(t *testing.T) {
+	ln, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	srv := NewServer(nil)
+	closed := false
+	srv.OnShutdown(func() { closed = true })
+	if err := srv.ListenAndServe(ln.Addr().String()); err == nil {
+		t.Error("ListenAndServe on a taken port = nil, want an error")
+	}
+	if srv.Ready() {
+		t.Error("server ready without a listener")
+	}
+	if !closed {
+		t.Error("closers did not run after the listen error")
+	}
+}
+
+// failingListener fails to accept, as a listener closed under the server
+type failingListener struct {
+	net.Listener
+}
+
+func (failingListener) Accept() (net.Conn, error) {
+	return nil, errors.New("accept failed")
+}
+
+func TestServeError(t *testing.T) {
+	ln, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	srv := NewServer(nil)
+	var order []string
+	srv.OnShutdown(func() { order = append(order, "first") })
+	srv.OnShutdown(func() { order = append(order, "second") })
+	if err := srv.Serve(failingListener{ln}); err == nil {
+		t.Error("Serve on a failing listener = nil, want an error")
+	}
+	if srv.Ready() {
+		t.Error("server still ready after Serve failed")
+	}
+	if len(order) != 2 || order[0] != "first" || order[1] != "second" {
+		t.Errorf("closers ran as %v, want [first second]", order)
+	}
+	if srv.Context().Err() == nil {
+		t.Error("server context not cancelled after Serve failed")
+	}
+}
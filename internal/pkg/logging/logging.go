@@ -0,0 +1,89 @@
+// Package logging writes the access log and carries a per-request logger
+// tagged with the request ID.
+package logging
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"time"
+
+	"github.com/fasthttp/router"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"github.com/valyala/fasthttp"
+)
+
+// RequestIDHeader carries the request ID, it is taken from the request when
+// present and always echoed in the response.
+const RequestIDHeader = "X-Request-ID"
+
+const loggerKey = "requestLogger"
+
+// longer or non printable IDs are replaced so they can't flood or forge log lines
+const maxRequestIDLen = 128
+
+// Middleware assigns the request ID, stores a logger carrying it for FromRequest
+// and writes one access log line per request. Only successful requests are
+// sampled, one in sample is logged; 4xx are logged at warn and 5xx at error.
+func Middleware(logger zerolog.Logger, sample int, next fasthttp.RequestHandler) fasthttp.RequestHandler {
+	access := logger
+	if sample > 1 {
+		access = logger.Sample(zerolog.LevelSampler{InfoSampler: &zerolog.BasicSampler{N: uint32(sample)}})
+	}
+	return func(ctx *fasthttp.RequestCtx) {
+		start := time.Now()
+		id := requestID(ctx.Request.Header.Peek(RequestIDHeader))
+		ctx.Response.Header.Set(RequestIDHeader, id)
+		l := logger.With().Str("request_id", id).Logger()
+		ctx.SetUserValue(loggerKey, &l)
+
+		next(ctx)
+
+		status := ctx.Response.StatusCode()
+		route, _ := ctx.UserValue(router.MatchedRoutePathParam).(string)
+		event := access.Info()
+		switch {
+		case status >= 500:
+			event = access.Error()
+		case status >= 400:
+			event = access.Warn()
+		}
+		event.Str("request_id", id).
+			Str("method", string(ctx.Method())).
+			Str("route", route).
+			Bytes("path", ctx.Path()).
+			Int("status", status).
+			Dur("latency", time.Since(start)).
+			Int("bytes", len(ctx.Response.Body())).
+			Str("remote", ctx.RemoteIP().String()).
+			Msg("request")
+	}
+}
+
+// FromRequest returns the logger of the request, or the global logger outside of Middleware.
+func FromRequest(ctx *fasthttp.RequestCtx) *zerolog.Logger {
+	if l, ok := ctx.UserValue(loggerKey).(*zerolog.Logger); ok {
+		return l
+	}
+	return &log.Logger
+}
+
+func requestID(header []byte) string {
+	if len(header) > 0 && len(header) <= maxRequestIDLen {
+		printable := true
+		for _, c := range header {
+			if c < 0x21 || c > 0x7e {
+				printable = false
+				break
+			}
+		}
+		if printable {
+			return string(header)
+		}
+	}
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return "unknown"
+	}
+	return hex.EncodeToString(id)
+}
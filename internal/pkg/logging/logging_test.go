@@ -0,0 +1,76 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/rs/zerolog"
+	"github.com/valyala/fasthttp"
+)
+
+func TestMiddlewareRequestID(t *testing.T) {
+	var out bytes.Buffer
+	handler := Middleware(zerolog.New(&out), 0, func(ctx *fasthttp.RequestCtx) {
+		FromRequest(ctx).Error().Msg("from handler")
+		ctx.SetStatusCode(500)
+	})
+
+	for _, tc := range []struct{ header, want string }{
+		{"abc-123", "abc-123"},
+		{"has space", ""},
+		{strings.Repeat("x", maxRequestIDLen+1), ""},
+		{"", ""},
+	} {
+		out.Reset()
+		ctx := &fasthttp.RequestCtx{}
+		ctx.Request.SetRequestURI("/api/service/status")
+		if tc.header != "" {
+			ctx.Request.Header.Set(RequestIDHeader, tc.header)
+		}
+		handler(ctx)
+
+		id := string(ctx.Response.Header.Peek(RequestIDHeader))
+		if tc.want != "" && id != tc.want || tc.want == "" && len(id) != 16 {
+			t.Errorf("header %q: request id %q", tc.header, id)
+		}
+		lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+		if len(lines) != 2 {
+			t.Fatalf("want the handler line and the access line, got %q", out.String())
+		}
+		for _, line := range lines {
+			var entry map[string]interface{}
+			if err := json.Unmarshal([]byte(line), &entry); err != nil {
+				t.Fatal(err)
+			}
+			if entry["request_id"] != id {
+				t.Errorf("line %s is not tagged with %s", line, id)
+			}
+		}
+	}
+}
+
+func TestPgxLoggerHidesArgs(t *testing.T) {
+	var out bytes.Buffer
+	logger := zerolog.New(&out)
+	ctx := logger.WithContext(context.Background())
+	data := map[string]interface{}{"sql": "SELECT $1, $2", "args": []interface{}{"hunter2", 42}}
+	PgxLogger{}.Log(ctx, pgx.LogLevelInfo, "Query", data)
+
+	if strings.Contains(out.String(), "hunter2") {
+		t.Errorf("query arguments reached the log: %s", out.String())
+	}
+	var entry map[string]interface{}
+	if err := json.Unmarshal(out.Bytes(), &entry); err != nil {
+		t.Fatal(err)
+	}
+	if entry["sql"] != "SELECT $1, $2" || entry["arg_count"] != float64(2) {
+		t.Errorf("log entry %v, want the query and its number of arguments", entry)
+	}
+	if _, ok := data["args"]; !ok {
+		t.Error("the map of pgx was changed")
+	}
+}
@@ -0,0 +1,51 @@
+package logging
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+	"github.com/rs/zerolog"
+)
+
+// PgxLogger writes the query errors of pgx with the logger of the request
+// context, so they carry its request ID. Constraint violations and the errors
+// raised by our triggers are expected outcomes the repositories translate,
+// they are logged at debug. Query arguments may hold passwords and user
+// content, only their number is logged.
+type PgxLogger struct{}
+
+func (PgxLogger) Log(ctx context.Context, level pgx.LogLevel, msg string, data map[string]interface{}) {
+	zlevel := zerolog.DebugLevel
+	switch level {
+	case pgx.LogLevelError:
+		zlevel = zerolog.ErrorLevel
+		if err, ok := data["err"].(error); ok && expected(err) {
+			zlevel = zerolog.DebugLevel
+		}
+	case pgx.LogLevelWarn:
+		zlevel = zerolog.WarnLevel
+	case pgx.LogLevelInfo:
+		zlevel = zerolog.InfoLevel
+	}
+	fields := make(map[string]interface{}, len(data))
+	for k, v := range data {
+		fields[k] = v
+	}
+	if args, ok := data["args"].([]interface{}); ok {
+		delete(fields, "args")
+		fields["arg_count"] = len(args)
+	}
+	zerolog.Ctx(ctx).WithLevel(zlevel).Str("module", "pgx").Fields(fields).Msg(msg)
+}
+
+func expected(err error) bool {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		// class 23 is integrity constraint violations, FP our own trigger errors
+		return strings.HasPrefix(pgErr.Code, "23") || strings.HasPrefix(pgErr.Code, "FP")
+	}
+	return errors.Is(err, pgx.ErrNoRows)
+}
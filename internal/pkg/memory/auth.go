@@ -0,0 +1,101 @@
+package memory
+
+import (
+	"context"
+	"time"
+
+	"repo/internal/pkg/domain"
+	"repo/internal/pkg/metrics"
+)
+
+// AuthRepository keeps credentials and sessions. There are no moderators in
+// memory, the owner of a forum is its only moderator.
+type AuthRepository struct {
+	s *Store
+}
+
+func NewAuthRep(s *Store) AuthRepository {
+	return AuthRepository{s: s}
+}
+
+// Register creates the user and their credentials together.
+func (ar *AuthRepository) Register(ctx context.Context, user domain.User, passwordHash string) error {
+	defer metrics.Query("auth", "Register")()
+	ar.s.mu.Lock()
+	defer ar.s.mu.Unlock()
+	if err := ar.s.addUser(user); err != nil {
+		return err
+	}
+	ar.s.credentials[fold(user.Nickname)] = &credential{nickname: user.Nickname, hash: passwordHash}
+	return nil
+}
+
+func (ar *AuthRepository) PasswordHash(ctx context.Context, nickname string) (string, string, error) {
+	defer metrics.Query("auth", "PasswordHash")()
+	ar.s.mu.RLock()
+	defer ar.s.mu.RUnlock()
+	c := ar.s.credentials[fold(nickname)]
+	if c == nil {
+		return "", "", domain.NewError(domain.ErrNotFound, "No credentials for user: %s", nickname)
+	}
+	return c.nickname, c.hash, nil
+}
+
+func (ar *AuthRepository) AddSession(ctx context.Context, nickname string, tokenHash []byte, expires time.Time) error {
+	defer metrics.Query("auth", "AddSession")()
+	ar.s.mu.Lock()
+	defer ar.s.mu.Unlock()
+	now := time.Now()
+	// expired sessions of the user are cleaned up on the next login
+	for key, s := range ar.s.sessions {
+		if fold(s.nickname) == fold(nickname) && !s.expires.After(now) {
+			delete(ar.s.sessions, key)
+		}
+	}
+	ar.s.sessions[string(tokenHash)] = session{nickname: nickname, expires: expires}
+	return nil
+}
+
+func (ar *AuthRepository) SessionUser(ctx context.Context, tokenHash []byte) (string, error) {
+	defer metrics.Query("auth", "SessionUser")()
+	ar.s.mu.RLock()
+	defer ar.s.mu.RUnlock()
+	s, ok := ar.s.sessions[string(tokenHash)]
+	if !ok || !s.expires.After(time.Now()) {
+		return "", domain.NewError(domain.ErrNotFound, "Session not found or expired")
+	}
+	return s.nickname, nil
+}
+
+func (ar *AuthRepository) DeleteSession(ctx context.Context, tokenHash []byte) error {
+	defer metrics.Query("auth", "DeleteSession")()
+	ar.s.mu.Lock()
+	defer ar.s.mu.Unlock()
+	delete(ar.s.sessions, string(tokenHash))
+	return nil
+}
+
+// Roles treats the owner of a forum as its moderator.
+func (ar *AuthRepository) Roles(ctx context.Context, nickname string, forum string) (bool, bool, error) {
+	defer metrics.Query("auth", "Roles")()
+	ar.s.mu.RLock()
+	defer ar.s.mu.RUnlock()
+	admin := false
+	if c := ar.s.credentials[fold(nickname)]; c != nil {
+		admin = c.admin
+	}
+	f := ar.s.forums[fold(forum)]
+	return admin, f != nil && fold(f.User) == fold(nickname), nil
+}
+
+// SetAdmin marks a registered user as an admin, there is no database to mark them in.
+func (ar *AuthRepository) SetAdmin(nickname string, admin bool) error {
+	ar.s.mu.Lock()
+	defer ar.s.mu.Unlock()
+	c := ar.s.credentials[fold(nickname)]
+	if c == nil {
+		return domain.NewError(domain.ErrNotFound, "No credentials for user: %s", nickname)
+	}
+	c.admin = admin
+	return nil
+}
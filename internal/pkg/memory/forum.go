@@ -0,0 +1,408 @@
+package memory
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/go-openapi/strfmt"
+	"repo/internal/pkg/domain"
+	"repo/internal/pkg/metrics"
+)
+
+type ForumRepository struct {
+	s *Store
+}
+
+func NewForumRep(s *Store) ForumRepository {
+	return ForumRepository{s: s}
+}
+
+func (f *ForumRepository) AddForum(ctx context.Context, forum domain.Forum) (domain.Forum, error) {
+	defer metrics.Query("forum", "AddForum")()
+	f.s.mu.Lock()
+	defer f.s.mu.Unlock()
+	user := f.s.nicknames[fold(forum.User)]
+	if user == nil {
+		return domain.Forum{}, domain.NewError(domain.ErrUserMissing, "Can't find user by nickname: %s", forum.User)
+	}
+	// deleted forums keep their slug
+	if f.s.forums[fold(forum.Slug)] != nil {
+		return domain.Forum{}, domain.NewError(domain.ErrConflict, "Forum with slug %s already exists", forum.Slug)
+	}
+	created := &forumRow{
+		Forum: domain.Forum{Title: forum.Title, User: user.Nickname, Slug: forum.Slug},
+		users: map[string]struct{}{},
+	}
+	f.s.forums[fold(forum.Slug)] = created
+	return created.Forum, nil
+}
+
+func (f *ForumRepository) GetForum(ctx context.Context, slug string) (domain.Forum, error) {
+	defer metrics.Query("forum", "GetForum")()
+	f.s.mu.RLock()
+	defer f.s.mu.RUnlock()
+	forum := f.s.liveForum(slug)
+	if forum == nil {
+		return domain.Forum{}, domain.NewError(domain.ErrNotFound, "Can't find forum with slug: %s", slug)
+	}
+	return forum.Forum, nil
+}
+
+func (f *ForumRepository) GetUsers(ctx context.Context, slug string, limit int, since string, desc bool, after *domain.Cursor) ([]domain.User, error) {
+	defer metrics.Query("forum", "GetUsers")()
+	f.s.mu.RLock()
+	defer f.s.mu.RUnlock()
+	users := []domain.User{}
+	forum := f.s.forums[fold(slug)]
+	if forum == nil {
+		return users, nil
+	}
+	if after != nil {
+		since = after.Nickname
+	}
+	for nickname := range forum.users {
+		if since != "" && !isAfter(compareStrings(nickname, fold(since)), desc) {
+			continue
+		}
+		users = append(users, *f.s.nicknames[nickname])
+	}
+	sort.Slice(users, func(i, j int) bool {
+		return isAfter(compareStrings(fold(users[j].Nickname), fold(users[i].Nickname)), desc)
+	})
+	if limit > 0 && len(users) > limit {
+		users = users[:limit]
+	}
+	return users, nil
+}
+
+func (f *ForumRepository) AddThread(ctx context.Context, thread domain.Thread) (domain.Thread, error) {
+	defer metrics.Query("forum", "AddThread")()
+	f.s.mu.Lock()
+	defer f.s.mu.Unlock()
+	forum := f.s.liveForum(thread.Forum)
+	if forum == nil {
+		return domain.Thread{}, domain.NewError(domain.ErrNotFound, "Can't find forum with slug: %s", thread.Forum)
+	}
+	if thread.Slug != "" && f.s.threadSlugs[fold(thread.Slug)] != nil {
+		return domain.Thread{}, domain.NewError(domain.ErrConflict, "Thread with slug %s already exists", thread.Slug)
+	}
+	if f.s.nicknames[fold(thread.Author)] == nil {
+		return domain.Thread{}, domain.NewError(domain.ErrUserMissing, "Can't find user by nickname: %s", thread.Author)
+	}
+	f.s.lastThread++
+	created := &threadRow{Thread: domain.Thread{
+		Id:      f.s.lastThread,
+		Title:   thread.Title,
+		Forum:   forum.Slug,
+		Message: thread.Message,
+		Author:  thread.Author,
+		Slug:    thread.Slug,
+		Created: thread.Created,
+	}}
+	f.s.threads[created.Id] = created
+	if created.Slug != "" {
+		f.s.threadSlugs[fold(created.Slug)] = created
+	}
+	forum.threads = append(forum.threads, created)
+	forum.Threads++
+	forum.users[fold(created.Author)] = struct{}{}
+	return created.Thread, nil
+}
+
+func (f *ForumRepository) GetThreads(ctx context.Context, slug string, since string, desc bool, limit int, after *domain.Cursor) ([]domain.Thread, error) {
+	defer metrics.Query("forum", "GetThreads")()
+	var from time.Time
+	if after == nil && since != "" {
+		parsed, err := strfmt.ParseDateTime(since)
+		if err != nil {
+			return []domain.Thread{}, domain.NewError(domain.ErrInvalid, "Invalid since: %s", since)
+		}
+		from = time.Time(parsed)
+	}
+	f.s.mu.RLock()
+	defer f.s.mu.RUnlock()
+	threads := []domain.Thread{}
+	forum := f.s.forums[fold(slug)]
+	if forum == nil {
+		return threads, nil
+	}
+	for _, t := range forum.threads {
+		if t.deleted {
+			continue
+		}
+		switch {
+		case after != nil:
+			// pinned threads come first whatever the direction
+			if t.Pinned != after.Pinned {
+				if t.Pinned {
+					continue
+				}
+			} else if !isAfter(compareThreads(t.Created, int64(t.Id), after.Created, after.Id), desc) {
+				continue
+			}
+		case since != "":
+			// unlike the other listings since is inclusive here
+			if c := compareTimes(t.Created, from); c != 0 && !isAfter(c, desc) {
+				continue
+			}
+		}
+		threads = append(threads, t.Thread)
+	}
+	sort.Slice(threads, func(i, j int) bool {
+		if threads[i].Pinned != threads[j].Pinned {
+			return threads[i].Pinned
+		}
+		return isAfter(compareThreads(threads[j].Created, int64(threads[j].Id), threads[i].Created, int64(threads[i].Id)), desc)
+	})
+	if limit > 0 && len(threads) > limit {
+		threads = threads[:limit]
+	}
+	return threads, nil
+}
+
+func (f *ForumRepository) GetThreadIdBySlug(ctx context.Context, slug string) (int, error) {
+	defer metrics.Query("forum", "GetThreadIdBySlug")()
+	f.s.mu.RLock()
+	defer f.s.mu.RUnlock()
+	t := f.s.threadSlugs[fold(slug)]
+	if t == nil || t.deleted {
+		return -1, domain.NewError(domain.ErrNotFound, "Can't find thread with slug: %s", slug)
+	}
+	return int(t.Id), nil
+}
+
+func (f *ForumRepository) GetThreadInfo(ctx context.Context, id int) (domain.Thread, error) {
+	defer metrics.Query("forum", "GetThreadInfo")()
+	f.s.mu.RLock()
+	defer f.s.mu.RUnlock()
+	t := f.s.liveThread(int32(id))
+	if t == nil {
+		return domain.Thread{}, domain.NewError(domain.ErrNotFound, "Can't find thread with id: %d", id)
+	}
+	return t.Thread, nil
+}
+
+// UpdateThread keeps the fields left empty. There is no history in memory, editor is ignored.
+func (f *ForumRepository) UpdateThread(ctx context.Context, thread domain.Thread, editor string) (domain.Thread, error) {
+	defer metrics.Query("forum", "UpdateThread")()
+	f.s.mu.Lock()
+	defer f.s.mu.Unlock()
+	t := f.s.liveThread(thread.Id)
+	if t == nil {
+		return domain.Thread{}, domain.NewError(domain.ErrNotFound, "Can't find thread with id: %d", thread.Id)
+	}
+	if thread.Title != "" {
+		t.Title = thread.Title
+	}
+	if thread.Message != "" {
+		t.Message = thread.Message
+	}
+	return t.Thread, nil
+}
+
+func (f *ForumRepository) VoteThread(ctx context.Context, v domain.Vote) error {
+	defer metrics.Query("forum", "VoteThread")()
+	f.s.mu.Lock()
+	defer f.s.mu.Unlock()
+	key := voteKey{nickname: fold(v.Nickname), thread: int32(v.IdThread)}
+	t := f.s.liveThread(key.thread)
+	if t == nil {
+		return domain.NewError(domain.ErrNotFound, "Can't find thread with id: %d", v.IdThread)
+	}
+	if _, ok := f.s.votes[key]; ok {
+		return domain.NewError(domain.ErrConflict, "User %s already voted for thread %d", v.Nickname, v.IdThread)
+	}
+	if f.s.nicknames[key.nickname] == nil {
+		return domain.NewError(domain.ErrUserMissing, "Can't find user by nickname: %s", v.Nickname)
+	}
+	f.s.votes[key] = v.Voice
+	t.Votes += v.Voice
+	return nil
+}
+
+// UpdateVote changes an existing vote, it does nothing when there is none.
+func (f *ForumRepository) UpdateVote(ctx context.Context, v domain.Vote) error {
+	defer metrics.Query("forum", "UpdateVote")()
+	f.s.mu.Lock()
+	defer f.s.mu.Unlock()
+	key := voteKey{nickname: fold(v.Nickname), thread: int32(v.IdThread)}
+	old, ok := f.s.votes[key]
+	if !ok || old == v.Voice {
+		return nil
+	}
+	f.s.votes[key] = v.Voice
+	f.s.threads[key.thread].Votes += v.Voice - old
+	return nil
+}
+
+func (f *ForumRepository) DeleteThread(ctx context.Context, id int, entry *domain.ModerationAction) error {
+	defer metrics.Query("forum", "DeleteThread")()
+	f.s.mu.Lock()
+	defer f.s.mu.Unlock()
+	t := f.s.liveThread(int32(id))
+	if t == nil {
+		return domain.NewError(domain.ErrNotFound, "Can't find thread with id: %d", id)
+	}
+	f.s.deleteThread(t)
+	f.s.audit(entry)
+	return nil
+}
+
+// deleteThread takes the thread and its live posts out of the forum counters
+func (s *Store) deleteThread(t *threadRow) {
+	for _, p := range t.posts {
+		if !p.Deleted {
+			s.countPost(p, -1)
+		}
+	}
+	t.deleted = true
+	if f := s.forums[fold(t.Forum)]; f != nil {
+		f.Threads--
+	}
+}
+
+// DeleteForum deletes the threads of the forum along with it.
+func (f *ForumRepository) DeleteForum(ctx context.Context, slug string, entry *domain.ModerationAction) error {
+	defer metrics.Query("forum", "DeleteForum")()
+	f.s.mu.Lock()
+	defer f.s.mu.Unlock()
+	forum := f.s.liveForum(slug)
+	if forum == nil {
+		return domain.NewError(domain.ErrNotFound, "Can't find forum with slug: %s", slug)
+	}
+	forum.deleted = true
+	for _, t := range forum.threads {
+		if !t.deleted {
+			f.s.deleteThread(t)
+		}
+	}
+	f.s.audit(entry)
+	return nil
+}
+
+func (f *ForumRepository) PurgeThread(ctx context.Context, id int, entry *domain.ModerationAction) error {
+	defer metrics.Query("forum", "PurgeThread")()
+	f.s.mu.Lock()
+	defer f.s.mu.Unlock()
+	t := f.s.threads[int32(id)]
+	if t == nil {
+		return domain.NewError(domain.ErrNotFound, "Can't find thread with id: %d", id)
+	}
+	f.s.purgeThread(t)
+	if forum := f.s.forums[fold(t.Forum)]; forum != nil {
+		forum.threads = removeThread(forum.threads, t)
+		if !t.deleted {
+			forum.Threads--
+		}
+	}
+	if entry != nil {
+		entry.Forum = t.Forum
+	}
+	f.s.audit(entry)
+	return nil
+}
+
+// purgeThread removes the thread with its posts and votes, but leaves it in its forum
+func (s *Store) purgeThread(t *threadRow) {
+	for _, p := range t.posts {
+		if !p.Deleted {
+			s.countPost(p, -1)
+		}
+		delete(s.posts, p.Id)
+	}
+	for key := range s.votes {
+		if key.thread == t.Id {
+			delete(s.votes, key)
+		}
+	}
+	delete(s.threads, t.Id)
+	if t.Slug != "" {
+		delete(s.threadSlugs, fold(t.Slug))
+	}
+}
+
+// PurgeForum removes the forum with everything in it.
+func (f *ForumRepository) PurgeForum(ctx context.Context, slug string, entry *domain.ModerationAction) error {
+	defer metrics.Query("forum", "PurgeForum")()
+	f.s.mu.Lock()
+	defer f.s.mu.Unlock()
+	forum := f.s.forums[fold(slug)]
+	if forum == nil {
+		return domain.NewError(domain.ErrNotFound, "Can't find forum with slug: %s", slug)
+	}
+	for _, t := range forum.threads {
+		f.s.purgeThread(t)
+	}
+	delete(f.s.forums, fold(slug))
+	f.s.audit(entry)
+	return nil
+}
+
+func (f *ForumRepository) ServiceClear(ctx context.Context) error {
+	defer metrics.Query("forum", "ServiceClear")()
+	f.s.mu.Lock()
+	defer f.s.mu.Unlock()
+	f.s.clear()
+	return nil
+}
+
+// ServiceStatus counts what is served, as the forum counters, exact or not.
+func (f *ForumRepository) ServiceStatus(ctx context.Context, exact bool, top int) (domain.Status, error) {
+	defer metrics.Query("forum", "ServiceStatus")()
+	f.s.mu.RLock()
+	defer f.s.mu.RUnlock()
+	st := domain.Status{
+		Users:     len(f.s.users),
+		Votes:     len(f.s.votes),
+		TopForums: []domain.Forum{},
+	}
+	for _, forum := range f.s.forums {
+		if !forum.deleted {
+			st.Forums++
+		}
+	}
+	for _, t := range f.s.threads {
+		if !t.deleted {
+			st.Threads++
+		}
+	}
+	hourAgo := f.s.Now().Add(-time.Hour)
+	for _, p := range f.s.posts {
+		if p.Deleted || f.s.liveThread(p.Thread) == nil {
+			continue
+		}
+		st.Posts++
+		if p.Created.After(hourAgo) {
+			st.PostsLastHour++
+		}
+	}
+	if top <= 0 {
+		return st, nil
+	}
+	for _, forum := range f.s.forums {
+		if !forum.deleted {
+			st.TopForums = append(st.TopForums, forum.Forum)
+		}
+	}
+	sort.Slice(st.TopForums, func(i, j int) bool {
+		a, b := st.TopForums[i], st.TopForums[j]
+		if a.Posts != b.Posts {
+			return a.Posts > b.Posts
+		}
+		return fold(a.Slug) < fold(b.Slug)
+	})
+	if len(st.TopForums) > top {
+		st.TopForums = st.TopForums[:top]
+	}
+	return st, nil
+}
+
+func removeThread(threads []*threadRow, t *threadRow) []*threadRow {
+	for i := range threads {
+		if threads[i] == t {
+			return append(threads[:i], threads[i+1:]...)
+		}
+	}
+	return threads
+}
@@ -0,0 +1,354 @@
+package memory
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"repo/internal/pkg/domain"
+)
+
+var ctx = context.Background()
+
+// setup creates the users alice, bob and carol and the forum "go" owned by alice.
+func setup(t *testing.T) (*ForumRepository, *UserRepository) {
+	t.Helper()
+	s := NewStore()
+	ur := NewUserRep(s)
+	for _, nick := range []string{"alice", "bob", "carol"} {
+		if err := ur.AddUser(ctx, domain.User{Nickname: nick, FullName: nick, Email: nick + "@example.com"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	fr := NewForumRep(s)
+	if _, err := fr.AddForum(ctx, domain.Forum{Title: "Go", User: "ALICE", Slug: "go"}); err != nil {
+		t.Fatal(err)
+	}
+	return &fr, &ur
+}
+
+func mustThread(t *testing.T, fr *ForumRepository, title string, created time.Time) domain.Thread {
+	t.Helper()
+	thread, err := fr.AddThread(ctx, domain.Thread{Title: title, Forum: "GO", Author: "alice", Message: title, Created: created})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return thread
+}
+
+func mustPost(t *testing.T, fr *ForumRepository, thread domain.Thread, parent int64, author string) int64 {
+	t.Helper()
+	posts, err := fr.AddPosts(ctx, int(thread.Id), thread.Forum, []domain.Post{{Parent: parent, Author: author, Message: "text"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return posts[0].Id
+}
+
+func postIds(t *testing.T, fr *ForumRepository, thread domain.Thread, limit, since int, sort string, desc bool) []int64 {
+	t.Helper()
+	posts, err := fr.GetPosts(ctx, int(thread.Id), limit, since, sort, desc, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids := []int64{}
+	for _, p := range posts {
+		ids = append(ids, p.Id)
+	}
+	return ids
+}
+
+func TestUsers(t *testing.T) {
+	_, ur := setup(t)
+	if err := ur.AddUser(ctx, domain.User{Nickname: "ALICE", Email: "new@example.com"}); !errors.Is(err, domain.ErrConflict) {
+		t.Errorf("AddUser with a taken nickname = %v", err)
+	}
+	found, _ := ur.GetUserByNickOrEmail(ctx, "Alice", "BOB@example.com")
+	if len(found) != 2 || found[0].Nickname != "alice" || found[1].Nickname != "bob" {
+		t.Errorf("GetUserByNickOrEmail = %v", found)
+	}
+	if _, err := ur.UpdateUser(ctx, domain.User{Nickname: "bob", Email: "Carol@example.com"}); !errors.Is(err, domain.ErrConflict) {
+		t.Errorf("UpdateUser to a taken email = %v", err)
+	}
+	updated, err := ur.UpdateUser(ctx, domain.User{Nickname: "BOB", About: "hi", Email: "robert@example.com"})
+	want := domain.User{Nickname: "bob", FullName: "bob", About: "hi", Email: "robert@example.com"}
+	if err != nil || updated != want {
+		t.Errorf("UpdateUser = %v, %v, want %v", updated, err, want)
+	}
+	if found, _ = ur.GetUserByNickOrEmail(ctx, "", "bob@example.com"); len(found) != 0 {
+		t.Errorf("old email still found: %v", found)
+	}
+}
+
+func TestPostSorts(t *testing.T) {
+	fr, _ := setup(t)
+	thread := mustThread(t, fr, "tree", time.Now())
+	a := mustPost(t, fr, thread, 0, "bob")
+	b := mustPost(t, fr, thread, 0, "carol")
+	a1 := mustPost(t, fr, thread, a, "alice")
+	a11 := mustPost(t, fr, thread, a1, "bob")
+	b1 := mustPost(t, fr, thread, b, "bob")
+	a2 := mustPost(t, fr, thread, a, "bob")
+
+	cases := []struct {
+		sort  string
+		limit int
+		since int64
+		desc  bool
+		want  []int64
+	}{
+		{"flat", 0, 0, false, []int64{a, b, a1, a11, b1, a2}},
+		{"flat", 3, a1, false, []int64{a11, b1, a2}},
+		{"flat", 2, 0, true, []int64{a2, b1}},
+		{"tree", 0, 0, false, []int64{a, a1, a11, a2, b, b1}},
+		{"tree", 2, a11, false, []int64{a2, b}},
+		{"tree", 0, b, true, []int64{a2, a11, a1, a}},
+		{"tree", 0, 1000, false, []int64{}},
+		{"parent_tree", 1, 0, false, []int64{a, a1, a11, a2}},
+		{"parent_tree", 1, 0, true, []int64{b, b1}},
+		{"parent_tree", 0, a11, false, []int64{b, b1}},
+		{"parent_tree", 0, b1, true, []int64{a, a1, a11, a2}},
+	}
+	for _, c := range cases {
+		got := postIds(t, fr, thread, c.limit, int(c.since), c.sort, c.desc)
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%s limit=%d since=%d desc=%v: %v, want %v", c.sort, c.limit, c.since, c.desc, got, c.want)
+		}
+	}
+	if _, err := fr.GetPosts(ctx, int(thread.Id), 0, 0, "sideways", false, nil); !errors.Is(err, domain.ErrInvalid) {
+		t.Errorf("GetPosts with an unknown sort = %v", err)
+	}
+}
+
+func TestAddPostsIsAtomic(t *testing.T) {
+	fr, _ := setup(t)
+	thread := mustThread(t, fr, "one", time.Now())
+	other := mustThread(t, fr, "other", time.Now())
+	foreign := mustPost(t, fr, other, 0, "bob")
+
+	// a reply to an earlier post of the batch is fine
+	posts, err := fr.AddPosts(ctx, int(thread.Id), "go", []domain.Post{
+		{Author: "bob", Message: "root"},
+		{Parent: foreign + 1, Author: "carol", Message: "reply"},
+	})
+	if err != nil || len(posts) != 2 || !reflect.DeepEqual(posts[1].Path, []int64{foreign + 1, foreign + 2}) {
+		t.Fatalf("AddPosts = %v, %v", posts, err)
+	}
+
+	_, err = fr.AddPosts(ctx, int(thread.Id), "go", []domain.Post{
+		{Author: "nobody", Message: "x"},
+		{Parent: foreign, Author: "bob", Message: "x"},
+	})
+	if !errors.Is(err, domain.ErrInvalidParent) {
+		t.Errorf("AddPosts with a parent in another thread = %v", err)
+	}
+	_, err = fr.AddPosts(ctx, int(thread.Id), "go", []domain.Post{{Author: "bob", Message: "x"}, {Author: "nobody", Message: "x"}})
+	if !errors.Is(err, domain.ErrUserMissing) {
+		t.Errorf("AddPosts by a missing user = %v", err)
+	}
+	if forum, _ := fr.GetForum(ctx, "go"); forum.Posts != 3 || forum.Threads != 2 {
+		t.Errorf("forum counts %d posts and %d threads, want 3 and 2", forum.Posts, forum.Threads)
+	}
+	users, _ := fr.GetUsers(ctx, "go", 0, "", true, nil)
+	if len(users) != 3 || users[0].Nickname != "carol" || users[2].Nickname != "alice" {
+		t.Errorf("GetUsers desc = %v", users)
+	}
+}
+
+func TestVotes(t *testing.T) {
+	fr, _ := setup(t)
+	thread := mustThread(t, fr, "vote", time.Now())
+	vote := func(nick string, voice int32) domain.Vote {
+		return domain.Vote{Nickname: nick, Voice: voice, IdThread: int64(thread.Id)}
+	}
+	if err := fr.VoteThread(ctx, vote("bob", 1)); err != nil {
+		t.Fatal(err)
+	}
+	if err := fr.VoteThread(ctx, vote("carol", 1)); err != nil {
+		t.Fatal(err)
+	}
+	if err := fr.VoteThread(ctx, vote("BOB", -1)); !errors.Is(err, domain.ErrConflict) {
+		t.Fatalf("second vote = %v", err)
+	}
+	for _, v := range []domain.Vote{vote("bob", -1), vote("bob", -1), vote("alice", -1)} {
+		if err := fr.UpdateVote(ctx, v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if info, _ := fr.GetThreadInfo(ctx, int(thread.Id)); info.Votes != 0 {
+		t.Errorf("votes %d, want 0", info.Votes)
+	}
+	if err := fr.VoteThread(ctx, vote("nobody", 1)); !errors.Is(err, domain.ErrUserMissing) {
+		t.Errorf("vote by a missing user = %v", err)
+	}
+}
+
+func TestDeleteAndPurge(t *testing.T) {
+	fr, _ := setup(t)
+	thread := mustThread(t, fr, "doomed", time.Now())
+	kept := mustThread(t, fr, "kept", time.Now())
+	root := mustPost(t, fr, thread, 0, "bob")
+	mustPost(t, fr, thread, root, "bob")
+	parent := mustPost(t, fr, kept, 0, "bob")
+	child := mustPost(t, fr, kept, parent, "carol")
+	mustPost(t, fr, kept, 0, "carol")
+
+	counts := func(threads int32, posts int64) {
+		t.Helper()
+		forum, err := fr.GetForum(ctx, "go")
+		if err != nil || forum.Threads != threads || forum.Posts != posts {
+			t.Errorf("forum counts %d threads and %d posts, want %d and %d (%v)", forum.Threads, forum.Posts, threads, posts, err)
+		}
+		// the only forum, the service counts the same
+		if st, _ := fr.ServiceStatus(ctx, false, 0); int32(st.Threads) != threads || int64(st.Posts) != posts {
+			t.Errorf("service counts %d threads and %d posts, want %d and %d", st.Threads, st.Posts, threads, posts)
+		}
+	}
+	if err := fr.DeletePost(ctx, root, nil); err != nil {
+		t.Fatal(err)
+	}
+	counts(2, 4)
+	if err := fr.DeletePost(ctx, root, nil); err != nil {
+		t.Errorf("DeletePost of a deleted post = %v", err)
+	}
+	if err := fr.DeletePost(ctx, 1<<40, nil); !errors.Is(err, domain.ErrNotFound) {
+		t.Errorf("DeletePost of a missing post = %v", err)
+	}
+	if full, _ := fr.GetPost(ctx, domain.Post{Id: root}, nil); !full.Post.Deleted || full.Post.Message != "" {
+		t.Errorf("deleted post = %+v", full.Post)
+	}
+	if _, err := fr.UpdatePost(ctx, domain.Post{Id: root, Message: "back"}, ""); !errors.Is(err, domain.ErrConflict) {
+		t.Errorf("UpdatePost of a deleted post = %v", err)
+	}
+	if err := fr.DeleteThread(ctx, int(thread.Id), nil); err != nil {
+		t.Fatal(err)
+	}
+	counts(1, 3)
+	// a deleted thread takes no votes or edits and its posts are gone with it
+	if err := fr.VoteThread(ctx, domain.Vote{Nickname: "bob", Voice: 1, IdThread: int64(thread.Id)}); !errors.Is(err, domain.ErrNotFound) {
+		t.Errorf("VoteThread on a deleted thread = %v", err)
+	}
+	if _, err := fr.UpdateThread(ctx, domain.Thread{Id: thread.Id, Title: "back"}, ""); !errors.Is(err, domain.ErrNotFound) {
+		t.Errorf("UpdateThread of a deleted thread = %v", err)
+	}
+	if _, err := fr.GetPost(ctx, domain.Post{Id: root}, nil); !errors.Is(err, domain.ErrNotFound) {
+		t.Errorf("post of a deleted thread = %v", err)
+	}
+	if err := fr.PurgeThread(ctx, int(thread.Id), nil); err != nil {
+		t.Fatal(err)
+	}
+	counts(1, 3)
+	if err := fr.PurgePost(ctx, parent, nil); err != nil {
+		t.Fatal(err)
+	}
+	counts(1, 1)
+	if _, err := fr.GetPost(ctx, domain.Post{Id: child}, nil); !errors.Is(err, domain.ErrNotFound) {
+		t.Errorf("reply of a purged post = %v", err)
+	}
+
+	if err := fr.DeleteForum(ctx, "go", nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fr.GetThreadInfo(ctx, int(kept.Id)); !errors.Is(err, domain.ErrNotFound) {
+		t.Errorf("thread of a deleted forum = %v", err)
+	}
+	if _, err := fr.AddForum(ctx, domain.Forum{Title: "again", User: "bob", Slug: "go"}); !errors.Is(err, domain.ErrConflict) {
+		t.Errorf("reusing the slug of a deleted forum = %v", err)
+	}
+	want := domain.Status{Users: 3, TopForums: []domain.Forum{}}
+	if st, _ := fr.ServiceStatus(ctx, false, 5); !reflect.DeepEqual(st, want) {
+		t.Errorf("status after deleting = %+v, want %+v", st, want)
+	}
+	if err := fr.PurgeForum(ctx, "go", nil); err != nil {
+		t.Fatal(err)
+	}
+	if st, _ := fr.ServiceStatus(ctx, true, 5); !reflect.DeepEqual(st, want) {
+		t.Errorf("status after purging = %+v, want %+v", st, want)
+	}
+}
+
+func TestConcurrentPosts(t *testing.T) {
+	fr, _ := setup(t)
+	thread := mustThread(t, fr, "busy", time.Now())
+	root := mustPost(t, fr, thread, 0, "bob")
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				post := domain.Post{Parent: root, Author: "carol", Message: fmt.Sprint(i, j)}
+				if _, err := fr.AddPosts(ctx, int(thread.Id), "go", []domain.Post{post}); err != nil {
+					t.Error(err)
+					return
+				}
+				if _, err := fr.GetPosts(ctx, int(thread.Id), 10, 0, "tree", true, nil); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+	if forum, _ := fr.GetForum(ctx, "go"); forum.Posts != 401 {
+		t.Errorf("forum counts %d posts, want 401", forum.Posts)
+	}
+}
+
+func TestServiceStatusTop(t *testing.T) {
+	fr, _ := setup(t)
+	for _, slug := range []string{"rust", "zig", "gone"} {
+		if _, err := fr.AddForum(ctx, domain.Forum{Title: slug, User: "bob", Slug: slug}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for slug, n := range map[string]int{"go": 1, "rust": 3, "zig": 1, "gone": 5} {
+		thread, err := fr.AddThread(ctx, domain.Thread{Title: slug, Forum: slug, Author: "bob", Message: slug, Created: time.Now()})
+		if err != nil {
+			t.Fatal(err)
+		}
+		// a post of yesterday is not one of the last hour
+		fr.s.Now = time.Now
+		if slug == "zig" {
+			fr.s.Now = func() time.Time { return time.Now().Add(-24 * time.Hour) }
+		}
+		for i := 0; i < n; i++ {
+			mustPost(t, fr, thread, 0, "carol")
+		}
+	}
+	fr.s.Now = time.Now
+	if err := fr.DeleteForum(ctx, "gone", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		top  int
+		want []string
+	}{
+		{0, []string{}},
+		{1, []string{"rust"}},
+		// ties go by slug, deleted forums are left out
+		{5, []string{"rust", "go", "zig"}},
+	}
+	for _, c := range cases {
+		st, err := fr.ServiceStatus(ctx, false, c.top)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := []string{}
+		for _, forum := range st.TopForums {
+			got = append(got, forum.Slug)
+		}
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("top %d: forums %v, want %v", c.top, got, c.want)
+		}
+		// the posts of the deleted forum are not counted either
+		if st.PostsLastHour != 4 {
+			t.Errorf("top %d: %d posts in the last hour, want 4", c.top, st.PostsLastHour)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package memory
+
+import (
+	"strings"
+	"time"
+)
+
+// The compare functions return a negative number when a sorts before b,
+// zero when they are equal and a positive number otherwise.
+
+func compareStrings(a, b string) int {
+	return strings.Compare(a, b)
+}
+
+func compareInts(a, b int64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+func compareTimes(a, b time.Time) int {
+	switch {
+	case a.Before(b):
+		return -1
+	case a.After(b):
+		return 1
+	}
+	return 0
+}
+
+// compareThreads orders threads by creation time, id breaking ties
+func compareThreads(createdA time.Time, idA int64, createdB time.Time, idB int64) int {
+	if c := compareTimes(createdA, createdB); c != 0 {
+		return c
+	}
+	return compareInts(idA, idB)
+}
+
+// comparePaths orders materialized paths as PostgreSQL orders arrays,
+// element by element with a prefix first
+func comparePaths(a, b []int64) int {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if c := compareInts(a[i], b[i]); c != 0 {
+			return c
+		}
+	}
+	return compareInts(int64(len(a)), int64(len(b)))
+}
+
+// isAfter tells whether c, the comparison of a row with the key of a listing,
+// puts the row past the key in the direction of the listing
+func isAfter(c int, desc bool) bool {
+	if desc {
+		return c < 0
+	}
+	return c > 0
+}
@@ -0,0 +1,311 @@
+package memory
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"repo/internal/pkg/domain"
+	"repo/internal/pkg/metrics"
+)
+
+// AddPosts adds the batch as a whole or not at all. A post may reply to one
+// added before it in the same batch.
+func (f *ForumRepository) AddPosts(ctx context.Context, id int, forumSlug string, posts []domain.Post) ([]domain.Post, error) {
+	defer metrics.Query("forum", "AddPosts")()
+	f.s.mu.Lock()
+	defer f.s.mu.Unlock()
+	newPosts := []domain.Post{}
+	t := f.s.threads[int32(id)]
+	if t == nil {
+		return newPosts, domain.NewError(domain.ErrNotFound, "Can't find thread with id: %d", id)
+	}
+	forum := f.s.forums[fold(forumSlug)]
+	if forum == nil {
+		return newPosts, domain.NewError(domain.ErrNotFound, "Can't find forum with slug: %s", forumSlug)
+	}
+
+	// as in the database parents are checked before authors
+	created := f.s.Now().Truncate(time.Second)
+	batch := map[int64]*postRow{}
+	rows := make([]*postRow, 0, len(posts))
+	var authorErr error
+	for i, p := range posts {
+		row := &postRow{Post: domain.Post{
+			Id:      f.s.lastPost + int64(i) + 1,
+			Parent:  p.Parent,
+			Author:  p.Author,
+			Message: p.Message,
+			Forum:   forumSlug,
+			Thread:  t.Id,
+			Created: created,
+		}}
+		if p.Parent == 0 {
+			row.Path = []int64{row.Id}
+		} else {
+			parent := f.s.posts[p.Parent]
+			if parent == nil {
+				parent = batch[p.Parent]
+			}
+			if parent == nil || parent.Thread != t.Id {
+				return newPosts, domain.NewError(domain.ErrInvalidParent, "Parent post was created in another thread")
+			}
+			row.Path = append(append([]int64(nil), parent.Path...), row.Id)
+		}
+		if f.s.nicknames[fold(p.Author)] == nil && authorErr == nil {
+			authorErr = domain.NewError(domain.ErrUserMissing, "Can't find post author by nickname")
+		}
+		batch[row.Id] = row
+		rows = append(rows, row)
+	}
+	if authorErr != nil {
+		return newPosts, authorErr
+	}
+
+	f.s.lastPost += int64(len(rows))
+	for _, row := range rows {
+		f.s.posts[row.Id] = row
+		t.posts = append(t.posts, row)
+		forum.Posts++
+		forum.users[fold(row.Author)] = struct{}{}
+		newPosts = append(newPosts, row.served())
+	}
+	return newPosts, nil
+}
+
+func (f *ForumRepository) GetPosts(ctx context.Context, id int, limit int, since int, sort string, desc bool, after *domain.Cursor) ([]domain.Post, error) {
+	defer metrics.Query("forum", "GetPosts")()
+	f.s.mu.RLock()
+	defer f.s.mu.RUnlock()
+	var rows []*postRow
+	switch sort {
+	case "flat", "":
+		rows = f.s.flatPosts(int32(id), limit, int64(since), desc, after)
+	case "tree":
+		rows = f.s.treePosts(int32(id), limit, int64(since), desc, after)
+	case "parent_tree":
+		rows = f.s.parentTreePosts(int32(id), limit, int64(since), desc, after)
+	default:
+		return nil, domain.NewError(domain.ErrInvalid, "Unknown sort: %s", sort)
+	}
+	posts := []domain.Post{}
+	for _, row := range rows {
+		posts = append(posts, row.served())
+	}
+	return posts, nil
+}
+
+// threadPosts returns the posts of the thread passing keep
+func (s *Store) threadPosts(id int32, keep func(p *postRow) bool) []*postRow {
+	t := s.threads[id]
+	if t == nil {
+		return nil
+	}
+	var rows []*postRow
+	for _, p := range t.posts {
+		if keep(p) {
+			rows = append(rows, p)
+		}
+	}
+	return rows
+}
+
+func (s *Store) flatPosts(id int32, limit int, since int64, desc bool, cur *domain.Cursor) []*postRow {
+	if cur != nil {
+		since = cur.Id
+	}
+	rows := s.threadPosts(id, func(p *postRow) bool {
+		return since <= 0 || isAfter(compareInts(p.Id, since), desc)
+	})
+	sort.Slice(rows, func(i, j int) bool {
+		return isAfter(compareInts(rows[j].Id, rows[i].Id), desc)
+	})
+	return limitPosts(rows, limit)
+}
+
+func (s *Store) treePosts(id int32, limit int, since int64, desc bool, cur *domain.Cursor) []*postRow {
+	var from []int64
+	switch {
+	case cur != nil:
+		from = cur.Path
+	case since > 0:
+		// continuing after a post that does not exist matches nothing
+		p := s.posts[since]
+		if p == nil {
+			return nil
+		}
+		from = p.Path
+	}
+	rows := s.threadPosts(id, func(p *postRow) bool {
+		return from == nil || isAfter(comparePaths(p.Path, from), desc)
+	})
+	sort.Slice(rows, func(i, j int) bool {
+		if c := comparePaths(rows[j].Path, rows[i].Path); c != 0 {
+			return isAfter(c, desc)
+		}
+		return isAfter(compareInts(rows[j].Id, rows[i].Id), desc)
+	})
+	return limitPosts(rows, limit)
+}
+
+// parentTreePosts limits the number of root posts, each comes with all its replies
+func (s *Store) parentTreePosts(id int32, limit int, since int64, desc bool, cur *domain.Cursor) []*postRow {
+	var from int64
+	switch {
+	case cur != nil:
+		from = cur.Id
+	case since > 0:
+		p := s.posts[since]
+		if p == nil {
+			return nil
+		}
+		from = p.Path[0]
+	}
+	roots := s.threadPosts(id, func(p *postRow) bool {
+		return p.Parent == 0 && (from == 0 || isAfter(compareInts(p.Id, from), desc))
+	})
+	sort.Slice(roots, func(i, j int) bool {
+		return isAfter(compareInts(roots[j].Id, roots[i].Id), desc)
+	})
+	roots = limitPosts(roots, limit)
+	picked := map[int64]bool{}
+	for _, root := range roots {
+		picked[root.Id] = true
+	}
+	rows := s.threadPosts(id, func(p *postRow) bool {
+		return picked[p.Path[0]]
+	})
+	sort.Slice(rows, func(i, j int) bool {
+		if c := compareInts(rows[j].Path[0], rows[i].Path[0]); c != 0 {
+			return isAfter(c, desc)
+		}
+		if c := comparePaths(rows[i].Path, rows[j].Path); c != 0 {
+			return c < 0
+		}
+		return rows[i].Id < rows[j].Id
+	})
+	return rows
+}
+
+// limitPosts bounds rows, a non-positive limit means no limit
+func limitPosts(rows []*postRow, limit int) []*postRow {
+	if limit > 0 && len(rows) > limit {
+		return rows[:limit]
+	}
+	return rows
+}
+
+func (f *ForumRepository) GetPost(ctx context.Context, post domain.Post, related []string) (domain.PostFull, error) {
+	defer metrics.Query("forum", "GetPost")()
+	f.s.mu.RLock()
+	defer f.s.mu.RUnlock()
+	p := f.s.livePost(post.Id)
+	if p == nil {
+		return domain.PostFull{}, domain.NewError(domain.ErrNotFound, "Can't find post with id: %d", post.Id)
+	}
+	gotten := p.served()
+	result := domain.PostFull{Post: &gotten}
+
+	for _, relType := range related {
+		switch relType {
+		case "user":
+			u := f.s.nicknames[fold(gotten.Author)]
+			if u == nil {
+				return result, domain.NewError(domain.ErrNotFound, "Can't find user by nickname: %s", gotten.Author)
+			}
+			us := *u
+			result.Author = &us
+		case "forum":
+			forum := f.s.liveForum(gotten.Forum)
+			if forum == nil {
+				return result, domain.NewError(domain.ErrNotFound, "Can't find forum with slug: %s", gotten.Forum)
+			}
+			fr := forum.Forum
+			result.Forum = &fr
+		case "thread":
+			t := f.s.liveThread(gotten.Thread)
+			if t == nil {
+				return result, domain.NewError(domain.ErrNotFound, "Can't find thread with id: %d", gotten.Thread)
+			}
+			th := t.Thread
+			result.Thread = &th
+		}
+	}
+	return result, nil
+}
+
+// UpdatePost leaves the post alone when the message is empty or unchanged.
+// There is no history in memory, editor is ignored.
+func (f *ForumRepository) UpdatePost(ctx context.Context, post domain.Post, editor string) (domain.Post, error) {
+	defer metrics.Query("forum", "UpdatePost")()
+	f.s.mu.Lock()
+	defer f.s.mu.Unlock()
+	p := f.s.livePost(post.Id)
+	if p == nil {
+		return domain.Post{}, domain.NewError(domain.ErrNotFound, "Can't find post with id: %d", post.Id)
+	}
+	if p.Deleted {
+		return domain.Post{}, domain.NewError(domain.ErrConflict, "Post %d was deleted", post.Id)
+	}
+	old := p.served()
+	if old.Message == post.Message || post.Message == "" {
+		return old, nil
+	}
+	p.Message = post.Message
+	p.IsEdited = true
+	return p.served(), nil
+}
+
+func (f *ForumRepository) DeletePost(ctx context.Context, id int64, entry *domain.ModerationAction) error {
+	defer metrics.Query("forum", "DeletePost")()
+	f.s.mu.Lock()
+	defer f.s.mu.Unlock()
+	p := f.s.posts[id]
+	if p == nil {
+		return domain.NewError(domain.ErrNotFound, "Can't find post with id: %d", id)
+	}
+	// deleting twice is not an error, the tombstone is still there
+	if p.Deleted {
+		return nil
+	}
+	p.Deleted = true
+	p.Message = ""
+	f.s.countPost(p, -1)
+	f.s.audit(entry)
+	return nil
+}
+
+// PurgePost removes the post with all its replies, the posts whose path goes through it.
+func (f *ForumRepository) PurgePost(ctx context.Context, id int64, entry *domain.ModerationAction) error {
+	defer metrics.Query("forum", "PurgePost")()
+	f.s.mu.Lock()
+	defer f.s.mu.Unlock()
+	p := f.s.posts[id]
+	if p == nil {
+		return domain.NewError(domain.ErrNotFound, "Can't find post with id: %d", id)
+	}
+	t := f.s.threads[p.Thread]
+	kept := t.posts[:0]
+	for _, q := range t.posts {
+		if !inPath(q.Path, id) {
+			kept = append(kept, q)
+			continue
+		}
+		if !q.Deleted {
+			f.s.countPost(q, -1)
+		}
+		delete(f.s.posts, q.Id)
+	}
+	t.posts = kept
+	f.s.audit(entry)
+	return nil
+}
+
+func inPath(path []int64, id int64) bool {
+	for _, step := range path {
+		if step == id {
+			return true
+		}
+	}
+	return false
+}
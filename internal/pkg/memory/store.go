@@ -0,0 +1,169 @@
+// Package memory implements the forum, user and auth repositories in process
+// memory, for handler tests and demos without a database. It follows the
+// semantics of the PostgreSQL repositories and the triggers behind them:
+// nicknames, emails and slugs compare case-insensitively, the forum counters
+// only count what is served and deleted content stays until purged.
+package memory
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"repo/internal/pkg/domain"
+)
+
+// Store holds the data shared by the repositories of this package, as the
+// database is shared by the PostgreSQL ones. Every repository method runs
+// under its lock, so each call is atomic.
+type Store struct {
+	// Now stamps new posts, tests may stop the clock
+	Now func() time.Time
+
+	mu sync.RWMutex
+
+	// users in registration order, the order a sequential scan returns them in
+	users     []*domain.User
+	nicknames map[string]*domain.User
+	emails    map[string]*domain.User
+
+	credentials map[string]*credential
+	sessions    map[string]session
+
+	forums      map[string]*forumRow
+	threads     map[int32]*threadRow
+	threadSlugs map[string]*threadRow
+	posts       map[int64]*postRow
+	votes       map[voteKey]int32
+	lastThread  int32
+	lastPost    int64
+
+	// moderationLog keeps the audited deletions, like moderation_log it survives a clear
+	moderationLog []domain.ModerationAction
+}
+
+type credential struct {
+	nickname string
+	hash     string
+	admin    bool
+}
+
+type session struct {
+	nickname string
+	expires  time.Time
+}
+
+type forumRow struct {
+	domain.Forum
+	deleted bool
+	threads []*threadRow
+	// users who created a thread or post in the forum, by folded nickname
+	users map[string]struct{}
+}
+
+type threadRow struct {
+	domain.Thread
+	deleted bool
+	// posts in creation order
+	posts []*postRow
+}
+
+type postRow struct {
+	domain.Post
+}
+
+type voteKey struct {
+	nickname string
+	thread   int32
+}
+
+func NewStore() *Store {
+	s := &Store{Now: time.Now}
+	s.clear()
+	return s
+}
+
+func (s *Store) clear() {
+	s.users = nil
+	s.nicknames = map[string]*domain.User{}
+	s.emails = map[string]*domain.User{}
+	s.credentials = map[string]*credential{}
+	s.sessions = map[string]session{}
+	s.forums = map[string]*forumRow{}
+	s.threads = map[int32]*threadRow{}
+	s.threadSlugs = map[string]*threadRow{}
+	s.posts = map[int64]*postRow{}
+	s.votes = map[voteKey]int32{}
+	s.lastThread, s.lastPost = 0, 0
+}
+
+// ModerationLog returns the audit entries of the deletions by moderators and
+// admins, oldest first. Memory storage serves no moderation routes, the log is
+// there for tests.
+func (s *Store) ModerationLog() []domain.ModerationAction {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return append([]domain.ModerationAction(nil), s.moderationLog...)
+}
+
+// audit records entry unless it is nil
+func (s *Store) audit(entry *domain.ModerationAction) {
+	if entry == nil {
+		return
+	}
+	logged := *entry
+	logged.Id = int64(len(s.moderationLog) + 1)
+	logged.Created = s.Now()
+	s.moderationLog = append(s.moderationLog, logged)
+}
+
+// fold is the key of a case-insensitive (citext) value
+func fold(s string) string {
+	return strings.ToLower(s)
+}
+
+func (s *Store) liveForum(slug string) *forumRow {
+	f := s.forums[fold(slug)]
+	if f == nil || f.deleted {
+		return nil
+	}
+	return f
+}
+
+func (s *Store) liveThread(id int32) *threadRow {
+	t := s.threads[id]
+	if t == nil || t.deleted {
+		return nil
+	}
+	return t
+}
+
+// livePost is the post unless it or its thread is gone, deleted posts are tombstones and stay
+func (s *Store) livePost(id int64) *postRow {
+	p := s.posts[id]
+	if p == nil || s.liveThread(p.Thread) == nil {
+		return nil
+	}
+	return p
+}
+
+// served is the post as the repositories return it, hidden and deleted posts lose their text
+func (p *postRow) served() domain.Post {
+	res := p.Post
+	if res.Hidden || res.Deleted {
+		res.Message = ""
+	}
+	res.Path = append([]int64(nil), p.Path...)
+	return res
+}
+
+// countPost moves the post counter of the forum of p by delta,
+// posts of deleted threads are not counted
+func (s *Store) countPost(p *postRow, delta int64) {
+	if t := s.threads[p.Thread]; t != nil && t.deleted {
+		return
+	}
+	if f := s.forums[fold(p.Forum)]; f != nil {
+		f.Posts += delta
+	}
+}
@@ -0,0 +1,85 @@
+package memory
+
+import (
+	"context"
+
+	"repo/internal/pkg/domain"
+	"repo/internal/pkg/metrics"
+)
+
+type UserRepository struct {
+	s *Store
+}
+
+func NewUserRep(s *Store) UserRepository {
+	return UserRepository{s: s}
+}
+
+func (ur *UserRepository) AddUser(ctx context.Context, user domain.User) error {
+	defer metrics.Query("user", "AddUser")()
+	ur.s.mu.Lock()
+	defer ur.s.mu.Unlock()
+	return ur.s.addUser(user)
+}
+
+// addUser inserts a copy of user unless its nickname or email is taken
+func (s *Store) addUser(user domain.User) error {
+	if s.nicknames[fold(user.Nickname)] != nil || s.emails[fold(user.Email)] != nil {
+		return domain.NewError(domain.ErrConflict, "User with nickname %s or email %s already exists", user.Nickname, user.Email)
+	}
+	u := user
+	s.users = append(s.users, &u)
+	s.nicknames[fold(u.Nickname)] = &u
+	s.emails[fold(u.Email)] = &u
+	return nil
+}
+
+func (ur *UserRepository) GetUserByNickOrEmail(ctx context.Context, nickname string, email string) ([]domain.User, error) {
+	defer metrics.Query("user", "GetUserByNickOrEmail")()
+	ur.s.mu.RLock()
+	defer ur.s.mu.RUnlock()
+	var rows []domain.User
+	for _, u := range ur.s.users {
+		if fold(u.Nickname) == fold(nickname) || fold(u.Email) == fold(email) {
+			rows = append(rows, *u)
+		}
+	}
+	return rows, nil
+}
+
+func (ur *UserRepository) GetUser(ctx context.Context, nickname string) ([]domain.User, error) {
+	defer metrics.Query("user", "GetUser")()
+	ur.s.mu.RLock()
+	defer ur.s.mu.RUnlock()
+	u := ur.s.nicknames[fold(nickname)]
+	if u == nil {
+		return nil, domain.NewError(domain.ErrNotFound, "Can't find user by nickname: %s", nickname)
+	}
+	return []domain.User{*u}, nil
+}
+
+// UpdateUser keeps the fields left empty.
+func (ur *UserRepository) UpdateUser(ctx context.Context, user domain.User) (domain.User, error) {
+	defer metrics.Query("user", "UpdateUser")()
+	ur.s.mu.Lock()
+	defer ur.s.mu.Unlock()
+	u := ur.s.nicknames[fold(user.Nickname)]
+	if u == nil {
+		return domain.User{}, domain.NewError(domain.ErrNotFound, "Can't find user by nickname: %s", user.Nickname)
+	}
+	if user.Email != "" {
+		if other := ur.s.emails[fold(user.Email)]; other != nil && other != u {
+			return domain.User{}, domain.NewError(domain.ErrConflict, "Email %s is already in use", user.Email)
+		}
+		delete(ur.s.emails, fold(u.Email))
+		u.Email = user.Email
+		ur.s.emails[fold(u.Email)] = u
+	}
+	if user.FullName != "" {
+		u.FullName = user.FullName
+	}
+	if user.About != "" {
+		u.About = user.About
+	}
+	return *u, nil
+}
@@ -0,0 +1,79 @@
+// Package metrics exposes Prometheus metrics of the HTTP and database layers.
+package metrics
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/fasthttp/router"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/valyala/fasthttp"
+	"github.com/valyala/fasthttp/fasthttpadaptor"
+)
+
+const namespace = "forum"
+
+// Registry holds every metric of the service, served by Handler.
+var Registry = prometheus.NewRegistry()
+
+var (
+	requests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "HTTP requests by route pattern, method and status code.",
+	}, []string{"route", "method", "code"})
+	requestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "HTTP request latency by route pattern and method.",
+		Buckets:   prometheus.ExponentialBuckets(0.0005, 2, 14),
+	}, []string{"route", "method"})
+	queryDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "repository_duration_seconds",
+		Help:      "Latency of repository methods, including every query they run.",
+		Buckets:   prometheus.ExponentialBuckets(0.0002, 2, 15),
+	}, []string{"repository", "method"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		requests, requestDuration, queryDuration,
+	)
+}
+
+// Middleware counts and times every request. The route label is the pattern
+// the router matched, which needs router.SaveMatchedRoutePath; requests that
+// matched nothing are labelled "unmatched" to keep the label set bounded.
+func Middleware(next fasthttp.RequestHandler) fasthttp.RequestHandler {
+	return func(ctx *fasthttp.RequestCtx) {
+		start := time.Now()
+		next(ctx)
+		route, ok := ctx.UserValue(router.MatchedRoutePathParam).(string)
+		if !ok {
+			route = "unmatched"
+		}
+		method := string(ctx.Method())
+		requests.WithLabelValues(route, method, strconv.Itoa(ctx.Response.StatusCode())).Inc()
+		requestDuration.WithLabelValues(route, method).Observe(time.Since(start).Seconds())
+	}
+}
+
+// Query starts timing a repository method, call the returned func when it is done:
+//
+//	defer metrics.Query("forum", "GetPosts")()
+func Query(repository, method string) func() {
+	start := time.Now()
+	return func() {
+		queryDuration.WithLabelValues(repository, method).Observe(time.Since(start).Seconds())
+	}
+}
+
+// Handler serves the registry in the Prometheus text format.
+func Handler() fasthttp.RequestHandler {
+	return fasthttpadaptor.NewFastHTTPHandler(promhttp.HandlerFor(Registry, promhttp.HandlerOpts{}))
+}
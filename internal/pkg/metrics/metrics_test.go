@@ -0,0 +1,39 @@
+package metrics
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/fasthttp/router"
+	"github.com/valyala/fasthttp"
+)
+
+func TestMiddlewareLabelsRoutePattern(t *testing.T) {
+	r := router.New()
+	r.SaveMatchedRoutePath = true
+	r.GET("/api/post/{id:[0-9]+}/details", func(ctx *fasthttp.RequestCtx) { ctx.SetStatusCode(404) })
+	r.GET("/metrics", Handler())
+	handler := Middleware(r.Handler)
+
+	for _, uri := range []string{"/api/post/1/details", "/api/post/2/details", "/nowhere"} {
+		ctx := &fasthttp.RequestCtx{}
+		ctx.Request.SetRequestURI(uri)
+		handler(ctx)
+	}
+
+	ctx := &fasthttp.RequestCtx{}
+	ctx.Request.SetRequestURI("/metrics")
+	handler(ctx)
+	if ct := string(ctx.Response.Header.ContentType()); !strings.HasPrefix(ct, "text/plain") {
+		t.Errorf("content type %q", ct)
+	}
+	body := string(ctx.Response.Body())
+	for _, want := range []string{
+		`forum_http_requests_total{code="404",method="GET",route="/api/post/{id:[0-9]+}/details"} 2`,
+		`forum_http_requests_total{code="404",method="GET",route="unmatched"} 1`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("metrics are missing %s", want)
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package metrics
+
+import (
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// poolCollector reads the pgxpool statistics at scrape time.
+type poolCollector struct {
+	pool *pgxpool.Pool
+
+	acquired, idle, total, max, constructing *prometheus.Desc
+	acquires, emptyAcquires, canceled        *prometheus.Desc
+	acquireWait                              *prometheus.Desc
+}
+
+// RegisterPool adds the statistics of the connection pool to the Registry.
+func RegisterPool(pool *pgxpool.Pool) {
+	desc := func(name, help string) *prometheus.Desc {
+		return prometheus.NewDesc(prometheus.BuildFQName(namespace, "db_pool", name), help, nil, nil)
+	}
+	Registry.MustRegister(&poolCollector{
+		pool:          pool,
+		acquired:      desc("acquired_conns", "Connections currently acquired by requests."),
+		idle:          desc("idle_conns", "Idle connections in the pool."),
+		total:         desc("total_conns", "Connections open in the pool."),
+		max:           desc("max_conns", "Maximum size of the pool."),
+		constructing:  desc("constructing_conns", "Connections being established."),
+		acquires:      desc("acquires_total", "Successful connection acquires."),
+		emptyAcquires: desc("empty_acquires_total", "Acquires that had to wait for a connection."),
+		canceled:      desc("canceled_acquires_total", "Acquires canceled by their context."),
+		acquireWait:   desc("acquire_wait_seconds_total", "Total time spent waiting for a connection."),
+	})
+}
+
+func (c *poolCollector) Describe(ch chan<- *prometheus.Desc) {
+	for _, d := range []*prometheus.Desc{c.acquired, c.idle, c.total, c.max, c.constructing, c.acquires, c.emptyAcquires, c.canceled, c.acquireWait} {
+		ch <- d
+	}
+}
+
+func (c *poolCollector) Collect(ch chan<- prometheus.Metric) {
+	s := c.pool.Stat()
+	gauge := func(d *prometheus.Desc, v float64) {
+		ch <- prometheus.MustNewConstMetric(d, prometheus.GaugeValue, v)
+	}
+	counter := func(d *prometheus.Desc, v float64) {
+		ch <- prometheus.MustNewConstMetric(d, prometheus.CounterValue, v)
+	}
+	gauge(c.acquired, float64(s.AcquiredConns()))
+	gauge(c.idle, float64(s.IdleConns()))
+	gauge(c.total, float64(s.TotalConns()))
+	gauge(c.max, float64(s.MaxConns()))
+	gauge(c.constructing, float64(s.ConstructingConns()))
+	counter(c.acquires, float64(s.AcquireCount()))
+	counter(c.emptyAcquires, float64(s.EmptyAcquireCount()))
+	counter(c.canceled, float64(s.CanceledAcquireCount()))
+	counter(c.acquireWait, s.AcquireDuration().Seconds())
+}
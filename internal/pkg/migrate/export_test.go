@@ -0,0 +1,4 @@
+package migrate
+
+// LockKey is the advisory lock key, for the integration tests
+const LockKey = lockKey
@@ -0,0 +1,276 @@
+// Package migrate applies the numbered SQL migrations embedded in the binary.
+//
+// Migrations live in migrations/NNNN_name.up.sql with an optional matching
+// NNNN_name.down.sql. Applied versions are recorded in schema_version, and a
+// session advisory lock keeps concurrent runners from interleaving.
+package migrate
+
+import (
+	"context"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/rs/zerolog/log"
+)
+
+//go:embed migrations/*.sql
+var files embed.FS
+
+// lockKey identifies the advisory lock held while migrating
+const lockKey = 7361524401
+
+var fileRe = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// Migrations returns the embedded migrations ordered by version.
+func Migrations() ([]Migration, error) {
+	return parse(files)
+}
+
+// parse reads the migrations directory of fsys.
+func parse(fsys fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, "migrations")
+	if err != nil {
+		return nil, err
+	}
+	byVersion := map[int]*Migration{}
+	for _, entry := range entries {
+		m := fileRe.FindStringSubmatch(entry.Name())
+		if m == nil {
+			return nil, fmt.Errorf("migrate: unexpected file %s", entry.Name())
+		}
+		version, _ := strconv.Atoi(m[1])
+		body, err := fs.ReadFile(fsys, path.Join("migrations", entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		mig, ok := byVersion[version]
+		if !ok {
+			mig = &Migration{Version: version, Name: m[2]}
+			byVersion[version] = mig
+		}
+		if mig.Name != m[2] {
+			return nil, fmt.Errorf("migrate: version %d has two names, %s and %s", version, mig.Name, m[2])
+		}
+		if m[3] == "up" {
+			mig.Up = string(body)
+		} else {
+			mig.Down = string(body)
+		}
+	}
+	var res []Migration
+	for _, mig := range byVersion {
+		if mig.Up == "" {
+			return nil, fmt.Errorf("migrate: version %d has no up migration", mig.Version)
+		}
+		res = append(res, *mig)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Version < res[j].Version })
+	return res, nil
+}
+
+// Latest is the version the embedded migrations bring the schema to.
+func Latest() (int, error) {
+	migs, err := Migrations()
+	if err != nil || len(migs) == 0 {
+		return 0, err
+	}
+	return migs[len(migs)-1].Version, nil
+}
+
+type Runner struct {
+	pool *pgxpool.Pool
+}
+
+func NewRunner(pool *pgxpool.Pool) *Runner {
+	return &Runner{pool: pool}
+}
+
+// Status describes one migration and whether it is applied.
+type Status struct {
+	Migration
+	Applied bool
+}
+
+// Version returns the highest applied version, 0 for an empty database.
+func (r *Runner) Version(ctx context.Context) (int, error) {
+	var version int
+	err := r.pool.QueryRow(ctx, "SELECT COALESCE(MAX(version), 0) FROM schema_version").Scan(&version)
+	if err != nil && isUndefinedTable(err) {
+		return 0, nil
+	}
+	return version, err
+}
+
+func (r *Runner) Status(ctx context.Context) ([]Status, error) {
+	migs, err := Migrations()
+	if err != nil {
+		return nil, err
+	}
+	var res []Status
+	err = r.locked(ctx, func(conn *pgxpool.Conn) error {
+		applied, err := appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+		for _, mig := range migs {
+			res = append(res, Status{Migration: mig, Applied: applied[mig.Version]})
+		}
+		return nil
+	})
+	return res, err
+}
+
+// Up applies every pending migration in order.
+func (r *Runner) Up(ctx context.Context) error {
+	migs, err := Migrations()
+	if err != nil {
+		return err
+	}
+	return r.locked(ctx, func(conn *pgxpool.Conn) error {
+		applied, err := appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+		for _, mig := range migs {
+			if applied[mig.Version] {
+				continue
+			}
+			log.Info().Msgf("applying migration %04d_%s", mig.Version, mig.Name)
+			err = apply(ctx, conn, mig.Up,
+				"INSERT INTO schema_version (version, name) VALUES ($1, $2)", mig.Version, mig.Name)
+			if err != nil {
+				return fmt.Errorf("migration %04d_%s: %w", mig.Version, mig.Name, err)
+			}
+		}
+		return nil
+	})
+}
+
+// Down reverts the last steps applied migrations.
+func (r *Runner) Down(ctx context.Context, steps int) error {
+	migs, err := Migrations()
+	if err != nil {
+		return err
+	}
+	return r.locked(ctx, func(conn *pgxpool.Conn) error {
+		applied, err := appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+		for i := len(migs) - 1; i >= 0 && steps > 0; i-- {
+			mig := migs[i]
+			if !applied[mig.Version] {
+				continue
+			}
+			if mig.Down == "" {
+				return fmt.Errorf("migration %04d_%s cannot be reverted", mig.Version, mig.Name)
+			}
+			log.Info().Msgf("reverting migration %04d_%s", mig.Version, mig.Name)
+			err = apply(ctx, conn, mig.Down, "DELETE FROM schema_version WHERE version = $1", mig.Version)
+			if err != nil {
+				return fmt.Errorf("migration %04d_%s: %w", mig.Version, mig.Name, err)
+			}
+			steps--
+		}
+		return nil
+	})
+}
+
+// locked runs f on a dedicated connection holding the migration advisory lock.
+func (r *Runner) locked(ctx context.Context, f func(conn *pgxpool.Conn) error) error {
+	conn, err := r.pool.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Release()
+
+	if _, err = conn.Exec(ctx, "SELECT pg_advisory_lock($1)", lockKey); err != nil {
+		return err
+	}
+	defer func() {
+		// unlock even if ctx is already done, the lock would outlive the request otherwise
+		if _, err := conn.Exec(context.Background(), "SELECT pg_advisory_unlock($1)", lockKey); err != nil {
+			log.Error().Msgf("releasing migration lock: %s", err)
+		}
+	}()
+
+	_, err = conn.Exec(ctx, `CREATE TABLE IF NOT EXISTS schema_version (
+		version INT PRIMARY KEY,
+		name TEXT NOT NULL,
+		applied_at TIMESTAMP WITH TIME ZONE DEFAULT now()
+	)`)
+	if err != nil {
+		return err
+	}
+	if err = baseline(ctx, conn); err != nil {
+		return err
+	}
+	return f(conn)
+}
+
+// baseline marks the initial migration applied on databases created from the
+// former db/db.sql, which have the tables but no schema_version rows.
+func baseline(ctx context.Context, conn *pgxpool.Conn) error {
+	var versioned, legacy bool
+	err := conn.QueryRow(ctx, `SELECT EXISTS(SELECT 1 FROM schema_version), to_regclass('forumusers') IS NOT NULL`).
+		Scan(&versioned, &legacy)
+	if err != nil || versioned || !legacy {
+		return err
+	}
+	log.Info().Msg("existing schema without version, marking 0001_init as applied")
+	_, err = conn.Exec(ctx, "INSERT INTO schema_version (version, name) VALUES (1, 'init')")
+	return err
+}
+
+func appliedVersions(ctx context.Context, conn *pgxpool.Conn) (map[int]bool, error) {
+	rows, err := conn.Query(ctx, "SELECT version FROM schema_version")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	applied := map[int]bool{}
+	for rows.Next() {
+		var version int
+		if err = rows.Scan(&version); err != nil {
+			return nil, err
+		}
+		applied[version] = true
+	}
+	return applied, rows.Err()
+}
+
+// apply runs a migration script and its bookkeeping statement in one transaction.
+func apply(ctx context.Context, conn *pgxpool.Conn, script string, record string, args ...interface{}) error {
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+	if _, err = tx.Exec(ctx, script); err != nil {
+		return err
+	}
+	if _, err = tx.Exec(ctx, record, args...); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+func isUndefinedTable(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "42P01"
+}
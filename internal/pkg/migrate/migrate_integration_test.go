@@ -0,0 +1,142 @@
+//go:build integration
+
+package migrate_test
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"repo/internal/pkg/migrate"
+	"repo/internal/pkg/testdb"
+)
+
+var db *testdb.Cluster
+
+func TestMain(m *testing.M) {
+	os.Exit(testdb.Main(m, &db))
+}
+
+var ctx = context.Background()
+
+// schema lists the tables, indexes, sequences, functions and triggers of the public schema
+func schema(t *testing.T) string {
+	t.Helper()
+	var objects string
+	err := db.Pool.QueryRow(ctx, `SELECT COALESCE(string_agg(object, ', ' ORDER BY object), '') FROM (
+		SELECT relkind || ' ' || relname FROM pg_class c JOIN pg_namespace n ON n.oid = c.relnamespace
+			WHERE nspname = 'public' AND relkind IN ('r', 'i', 'S', 'v')
+		UNION ALL SELECT 'function ' || proname FROM pg_proc p JOIN pg_namespace n ON n.oid = p.pronamespace
+			WHERE nspname = 'public'
+		UNION ALL SELECT 'trigger ' || tgname FROM pg_trigger WHERE NOT tgisinternal
+	) AS objects(object)`).Scan(&objects)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return objects
+}
+
+func version(t *testing.T, r *migrate.Runner) int {
+	t.Helper()
+	v, err := r.Version(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return v
+}
+
+func TestDownReversesUp(t *testing.T) {
+	r := migrate.NewRunner(db.Pool)
+	latest, err := migrate.Latest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := version(t, r); got != latest {
+		t.Fatalf("migrated schema at version %d, want %d", got, latest)
+	}
+	full := schema(t)
+
+	// each down migration leaves a schema its up migration applies to again
+	for steps := 1; steps <= latest; steps++ {
+		if err := r.Down(ctx, steps); err != nil {
+			t.Fatalf("down %d: %v", steps, err)
+		}
+		if got := version(t, r); got != latest-steps {
+			t.Errorf("down %d: version %d, want %d", steps, got, latest-steps)
+		}
+		if err := r.Up(ctx); err != nil {
+			t.Fatalf("up after down %d: %v", steps, err)
+		}
+		if got := schema(t); got != full {
+			t.Errorf("up after down %d: schema\n%s\nwant\n%s", steps, got, full)
+		}
+	}
+
+	if err := r.Down(ctx, latest); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := schema(t), "i schema_version_pkey, r schema_version"; got != want {
+		t.Errorf("schema after reverting every migration: %s, want %s", got, want)
+	}
+	if err := r.Up(ctx); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBaseline(t *testing.T) {
+	r := migrate.NewRunner(db.Pool)
+	latest, _ := migrate.Latest()
+	migs, err := migrate.Migrations()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a database created from the former db/db.sql: the tables of 0001_init, no schema_version
+	if err := r.Down(ctx, latest); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Pool.Exec(ctx, "DROP TABLE schema_version"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Pool.Exec(ctx, migs[0].Up); err != nil {
+		t.Fatal(err)
+	}
+	if got := version(t, r); got != 0 {
+		t.Errorf("legacy schema at version %d, want 0", got)
+	}
+
+	// 0001_init is adopted, not applied over the existing tables
+	if err := r.Up(ctx); err != nil {
+		t.Fatalf("up on a legacy schema: %v", err)
+	}
+	if got := version(t, r); got != latest {
+		t.Errorf("version after up %d, want %d", got, latest)
+	}
+}
+
+func TestLock(t *testing.T) {
+	r := migrate.NewRunner(db.Pool)
+	conn, err := db.Pool.Acquire(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Release()
+	if _, err := conn.Exec(ctx, "SELECT pg_advisory_lock($1)", migrate.LockKey); err != nil {
+		t.Fatal(err)
+	}
+
+	// another runner waits for the lock
+	waiting, cancel := context.WithTimeout(ctx, 200*time.Millisecond)
+	defer cancel()
+	if err := r.Down(waiting, 1); err == nil || waiting.Err() == nil {
+		t.Errorf("Down while the lock is held = %v, want to wait until the deadline", err)
+	}
+
+	if _, err := conn.Exec(ctx, "SELECT pg_advisory_unlock($1)", migrate.LockKey); err != nil {
+		t.Fatal(err)
+	}
+	latest, _ := migrate.Latest()
+	if err := r.Up(ctx); err != nil || version(t, r) != latest {
+		t.Errorf("Up after the lock is released = %v, version %d", err, version(t, r))
+	}
+}
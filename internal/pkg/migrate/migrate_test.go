@@ -0,0 +1,72 @@
+package migrate
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func dir(names ...string) fstest.MapFS {
+	fsys := fstest.MapFS{}
+	for _, name := range names {
+		fsys["migrations/"+name] = &fstest.MapFile{Data: []byte("-- " + name)}
+	}
+	return fsys
+}
+
+func TestParse(t *testing.T) {
+	migs, err := parse(dir("0010_tenth.up.sql", "0002_second.up.sql", "0002_second.down.sql", "0001_init.up.sql", "0001_init.down.sql"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Migration{
+		{Version: 1, Name: "init", Up: "-- 0001_init.up.sql", Down: "-- 0001_init.down.sql"},
+		{Version: 2, Name: "second", Up: "-- 0002_second.up.sql", Down: "-- 0002_second.down.sql"},
+		// ordered by number, not by name, and a down migration is optional
+		{Version: 10, Name: "tenth", Up: "-- 0010_tenth.up.sql"},
+	}
+	if !reflect.DeepEqual(migs, want) {
+		t.Errorf("parse = %+v, want %+v", migs, want)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	cases := []struct {
+		name  string
+		files []string
+		want  string
+	}{
+		{"stray file", []string{"0001_init.up.sql", "README.md"}, "unexpected file README.md"},
+		{"no direction", []string{"0001_init.sql"}, "unexpected file 0001_init.sql"},
+		{"no version", []string{"init.up.sql"}, "unexpected file init.up.sql"},
+		{"two names", []string{"0001_init.up.sql", "0001_other.down.sql"}, "version 1 has two names"},
+		{"down only", []string{"0001_init.down.sql"}, "version 1 has no up migration"},
+	}
+	for _, c := range cases {
+		_, err := parse(dir(c.files...))
+		if err == nil || !strings.Contains(err.Error(), c.want) {
+			t.Errorf("%s: parse = %v, want an error mentioning %q", c.name, err, c.want)
+		}
+	}
+}
+
+func TestEmbedded(t *testing.T) {
+	migs, err := Migrations()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, mig := range migs {
+		if mig.Version != i+1 {
+			t.Errorf("migration %04d_%s, want version %d: versions must have no gaps", mig.Version, mig.Name, i+1)
+		}
+		// every migration can be reverted
+		if strings.TrimSpace(mig.Down) == "" {
+			t.Errorf("migration %04d_%s has no down migration", mig.Version, mig.Name)
+		}
+	}
+	latest, err := Latest()
+	if err != nil || latest != len(migs) {
+		t.Errorf("Latest = %d, %v, want %d", latest, err, len(migs))
+	}
+}
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS forumUsers, Votes, Posts, Threads, Forum, users;
+DROP FUNCTION IF EXISTS forumAddUser(), forumAddThread(), forumCheckPost(), threadAddVote(), threadChangeVote();
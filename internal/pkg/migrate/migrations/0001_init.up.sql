@@ -105,7 +105,7 @@ CREATE OR REPLACE FUNCTION forumCheckPost() RETURNS TRIGGER AS
         IF (NEW.Parent <> 0) THEN
             SELECT Thread from Posts WHERE Id = NEW.Parent INTO parentThread;
             IF NOT FOUND OR parentThread != NEW.thread THEN
-                RAISE EXCEPTION 'DIFFERENT PARENT' USING ERRCODE = '23505';
+                RAISE EXCEPTION 'DIFFERENT PARENT' USING ERRCODE = 'FP001';
             end if;
         end if;
         -- update post count and paths
@@ -0,0 +1,29 @@
+ALTER TABLE Posts DROP CONSTRAINT IF EXISTS posts_parent_fkey;
+UPDATE Posts SET Parent = 0 WHERE Parent IS NULL;
+ALTER TABLE Posts ALTER COLUMN Parent SET DEFAULT 0;
+
+CREATE OR REPLACE FUNCTION forumCheckPost() RETURNS TRIGGER AS
+    $forumCheckPost$
+    DECLARE
+        parentThread BIGINT;
+        parentTreeOrder BIGINT[];
+    BEGIN
+        -- check post for parent of thread
+        IF (NEW.Parent <> 0) THEN
+            SELECT Thread from Posts WHERE Id = NEW.Parent INTO parentThread;
+            IF NOT FOUND OR parentThread != NEW.thread THEN
+                RAISE EXCEPTION 'DIFFERENT PARENT' USING ERRCODE = 'FP001';
+            end if;
+        end if;
+        -- update post count and paths
+        UPDATE Forum SET Posts=Posts+1 WHERE LOWER(Slug) = LOWER(NEW.Forum);
+        IF (NEW.Parent = 0) THEN
+            NEW.treeOrder = NEW.treeOrder || NEW.Id;
+        ELSE
+            SELECT treeOrder FROM Posts WHERE id = NEW.Parent INTO parentTreeOrder;
+            NEW.treeOrder = NEW.treeOrder || parentTreeOrder || NEW.Id;
+        end if;
+    RETURN NEW;
+    end;
+    $forumCheckPost$
+LANGUAGE plpgsql;
@@ -0,0 +1,31 @@
+-- root posts have a NULL parent instead of 0, so that Parent can carry
+-- a foreign key in the durable profile. Inserting 0 is still accepted.
+ALTER TABLE Posts ALTER COLUMN Parent DROP DEFAULT;
+UPDATE Posts SET Parent = NULL WHERE Parent = 0;
+
+CREATE OR REPLACE FUNCTION forumCheckPost() RETURNS TRIGGER AS
+    $forumCheckPost$
+    DECLARE
+        parentThread BIGINT;
+        parentTreeOrder BIGINT[];
+    BEGIN
+        NEW.Parent = NULLIF(NEW.Parent, 0);
+        -- check post for parent of thread
+        IF (NEW.Parent IS NOT NULL) THEN
+            SELECT Thread from Posts WHERE Id = NEW.Parent INTO parentThread;
+            IF NOT FOUND OR parentThread != NEW.thread THEN
+                RAISE EXCEPTION 'DIFFERENT PARENT' USING ERRCODE = 'FP001';
+            end if;
+        end if;
+        -- update post count and paths
+        UPDATE Forum SET Posts=Posts+1 WHERE LOWER(Slug) = LOWER(NEW.Forum);
+        IF (NEW.Parent IS NULL) THEN
+            NEW.treeOrder = NEW.treeOrder || NEW.Id;
+        ELSE
+            SELECT treeOrder FROM Posts WHERE id = NEW.Parent INTO parentTreeOrder;
+            NEW.treeOrder = NEW.treeOrder || parentTreeOrder || NEW.Id;
+        end if;
+    RETURN NEW;
+    end;
+    $forumCheckPost$
+LANGUAGE plpgsql;
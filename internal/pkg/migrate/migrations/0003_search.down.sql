@@ -0,0 +1,8 @@
+DROP INDEX IF EXISTS postSearchIndex;
+DROP INDEX IF EXISTS threadSearchIndex;
+DROP TRIGGER IF EXISTS postSearchUpdate ON Posts;
+DROP TRIGGER IF EXISTS threadSearchUpdate ON Threads;
+DROP FUNCTION IF EXISTS postSearchVector();
+DROP FUNCTION IF EXISTS threadSearchVector();
+ALTER TABLE Posts DROP COLUMN IF EXISTS Search;
+ALTER TABLE Threads DROP COLUMN IF EXISTS Search;
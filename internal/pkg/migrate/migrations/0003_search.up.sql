@@ -0,0 +1,35 @@
+-- full-text search over thread titles/messages and post messages
+ALTER TABLE Threads ADD COLUMN Search tsvector;
+ALTER TABLE Posts ADD COLUMN Search tsvector;
+
+CREATE OR REPLACE FUNCTION threadSearchVector() RETURNS TRIGGER AS
+    $threadSearchVector$
+    BEGIN
+        NEW.Search = setweight(to_tsvector('english', COALESCE(NEW.Title, '')), 'A') ||
+                     setweight(to_tsvector('english', COALESCE(NEW.Message, '')), 'B');
+        RETURN NEW;
+    end;
+    $threadSearchVector$
+LANGUAGE plpgsql;
+CREATE TRIGGER threadSearchUpdate BEFORE INSERT OR UPDATE OF Title, Message
+    ON Threads FOR EACH ROW
+    EXECUTE PROCEDURE threadSearchVector();
+
+CREATE OR REPLACE FUNCTION postSearchVector() RETURNS TRIGGER AS
+    $postSearchVector$
+    BEGIN
+        NEW.Search = to_tsvector('english', COALESCE(NEW.Message, ''));
+        RETURN NEW;
+    end;
+    $postSearchVector$
+LANGUAGE plpgsql;
+CREATE TRIGGER postSearchUpdate BEFORE INSERT OR UPDATE OF Message
+    ON Posts FOR EACH ROW
+    EXECUTE PROCEDURE postSearchVector();
+
+-- fill in existing rows, the triggers recompute the vectors
+UPDATE Threads SET Title = Title;
+UPDATE Posts SET Message = Message;
+
+CREATE INDEX threadSearchIndex ON Threads USING GIN (Search);
+CREATE INDEX postSearchIndex ON Posts USING GIN (Search);
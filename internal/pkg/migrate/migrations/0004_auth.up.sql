@@ -0,0 +1,16 @@
+-- password hashes (bcrypt) of users who registered with a password
+CREATE UNLOGGED TABLE credentials (
+    Nickname citext PRIMARY KEY,
+    PasswordHash TEXT NOT NULL,
+    FOREIGN KEY (Nickname) REFERENCES users(Nickname)
+);
+-- login sessions, only a SHA-256 of the token is kept
+CREATE UNLOGGED TABLE sessions (
+    TokenHash BYTEA PRIMARY KEY,
+    Nickname citext NOT NULL,
+    Created TIMESTAMP WITH TIME ZONE DEFAULT now(),
+    Expires TIMESTAMP WITH TIME ZONE NOT NULL,
+    FOREIGN KEY (Nickname) REFERENCES users(Nickname)
+);
+CREATE INDEX sessionsNicknameIndex ON sessions (Nickname);
+CREATE INDEX sessionsExpiresIndex ON sessions (Expires);
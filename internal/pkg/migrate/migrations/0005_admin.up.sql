@@ -0,0 +1,2 @@
+-- admins may edit any post or thread
+ALTER TABLE credentials ADD COLUMN IsAdmin BOOLEAN NOT NULL DEFAULT FALSE;
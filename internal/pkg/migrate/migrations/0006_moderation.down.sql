@@ -0,0 +1,10 @@
+DROP TRIGGER IF EXISTS threadModerationCheck ON Threads;
+DROP FUNCTION IF EXISTS threadCheckModeration();
+DROP INDEX IF EXISTS threadForumPinnedCreatedIndex;
+ALTER TABLE Posts DROP COLUMN IF EXISTS IsDeleted;
+ALTER TABLE Posts DROP COLUMN IF EXISTS IsHidden;
+ALTER TABLE Threads DROP COLUMN IF EXISTS IsLocked;
+ALTER TABLE Threads DROP COLUMN IF EXISTS IsPinned;
+DROP TABLE IF EXISTS moderation_log;
+DROP TABLE IF EXISTS forum_bans;
+DROP TABLE IF EXISTS forum_moderators;
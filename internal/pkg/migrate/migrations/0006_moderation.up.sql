@@ -0,0 +1,56 @@
+-- moderators assigned to a forum, its owner moderates it implicitly
+CREATE UNLOGGED TABLE forum_moderators (
+    Forum citext NOT NULL,
+    Nickname citext NOT NULL,
+    AddedBy citext,
+    Created TIMESTAMP WITH TIME ZONE DEFAULT now(),
+    PRIMARY KEY (Forum, Nickname),
+    FOREIGN KEY (Forum) REFERENCES Forum(Slug),
+    FOREIGN KEY (Nickname) REFERENCES users(Nickname)
+);
+-- users who may not create threads or posts in a forum
+CREATE UNLOGGED TABLE forum_bans (
+    Forum citext NOT NULL,
+    Nickname citext NOT NULL,
+    BannedBy citext,
+    Reason TEXT NOT NULL DEFAULT '',
+    Created TIMESTAMP WITH TIME ZONE DEFAULT now(),
+    PRIMARY KEY (Forum, Nickname),
+    FOREIGN KEY (Forum) REFERENCES Forum(Slug),
+    FOREIGN KEY (Nickname) REFERENCES users(Nickname)
+);
+-- every moderation action, Target is the thread id, post id or nickname acted on
+CREATE UNLOGGED TABLE moderation_log (
+    Id BIGSERIAL PRIMARY KEY,
+    Forum citext NOT NULL,
+    Moderator citext,
+    Action TEXT NOT NULL,
+    Target TEXT NOT NULL,
+    Reason TEXT NOT NULL DEFAULT '',
+    Created TIMESTAMP WITH TIME ZONE DEFAULT now()
+);
+CREATE INDEX moderationLogForumIndex ON moderation_log (Forum, Id);
+
+ALTER TABLE Threads ADD COLUMN IsPinned BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE Threads ADD COLUMN IsLocked BOOLEAN NOT NULL DEFAULT FALSE;
+-- hidden and deleted posts keep their place in the tree but not their text
+ALTER TABLE Posts ADD COLUMN IsHidden BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE Posts ADD COLUMN IsDeleted BOOLEAN NOT NULL DEFAULT FALSE;
+
+CREATE INDEX threadForumPinnedCreatedIndex ON Threads (Forum, IsPinned, Created, Id);
+
+-- banned users may not open threads in the forum; posts are checked for a
+-- lock and bans once per batch by AddPosts, not row by row here
+CREATE OR REPLACE FUNCTION threadCheckModeration() RETURNS TRIGGER AS
+    $threadCheckModeration$
+    BEGIN
+        IF EXISTS (SELECT 1 FROM forum_bans WHERE Forum = NEW.Forum AND Nickname = NEW.Author) THEN
+            RAISE EXCEPTION 'USER BANNED' USING ERRCODE = 'FP003';
+        end if;
+        RETURN NEW;
+    end;
+    $threadCheckModeration$
+LANGUAGE plpgsql;
+CREATE TRIGGER threadModerationCheck BEFORE INSERT
+    ON Threads FOR EACH ROW
+    EXECUTE PROCEDURE threadCheckModeration();
@@ -0,0 +1,10 @@
+DROP TRIGGER IF EXISTS threadPurged ON Threads;
+DROP TRIGGER IF EXISTS threadDeleted ON Threads;
+DROP TRIGGER IF EXISTS postPurged ON Posts;
+DROP TRIGGER IF EXISTS postDeleted ON Posts;
+DROP FUNCTION IF EXISTS threadPurgedCount();
+DROP FUNCTION IF EXISTS threadDeletedCount();
+DROP FUNCTION IF EXISTS postPurgedCount();
+DROP FUNCTION IF EXISTS postDeletedCount();
+ALTER TABLE Forum DROP COLUMN IF EXISTS IsDeleted;
+ALTER TABLE Threads DROP COLUMN IF EXISTS IsDeleted;
@@ -0,0 +1,69 @@
+-- deleted threads and forums stay in place but are no longer served,
+-- deleted posts are tombstones (Posts.IsDeleted, added with moderation)
+ALTER TABLE Threads ADD COLUMN IsDeleted BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE Forum ADD COLUMN IsDeleted BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- forum counters only count what is served: live posts of live threads
+CREATE OR REPLACE FUNCTION postDeletedCount() RETURNS TRIGGER AS
+    $postDeletedCount$
+    BEGIN
+        IF NEW.IsDeleted <> OLD.IsDeleted AND
+           NOT EXISTS (SELECT 1 FROM Threads WHERE Id = NEW.Thread AND IsDeleted) THEN
+            UPDATE Forum SET Posts = Posts + CASE WHEN NEW.IsDeleted THEN -1 ELSE 1 END WHERE Slug = NEW.Forum;
+        end if;
+        RETURN NEW;
+    end;
+    $postDeletedCount$
+LANGUAGE plpgsql;
+CREATE TRIGGER postDeleted AFTER UPDATE OF IsDeleted
+    ON Posts FOR EACH ROW
+    EXECUTE PROCEDURE postDeletedCount();
+
+CREATE OR REPLACE FUNCTION postPurgedCount() RETURNS TRIGGER AS
+    $postPurgedCount$
+    BEGIN
+        IF NOT OLD.IsDeleted AND
+           NOT EXISTS (SELECT 1 FROM Threads WHERE Id = OLD.Thread AND IsDeleted) THEN
+            UPDATE Forum SET Posts = Posts - 1 WHERE Slug = OLD.Forum;
+        end if;
+        RETURN OLD;
+    end;
+    $postPurgedCount$
+LANGUAGE plpgsql;
+CREATE TRIGGER postPurged AFTER DELETE
+    ON Posts FOR EACH ROW
+    EXECUTE PROCEDURE postPurgedCount();
+
+CREATE OR REPLACE FUNCTION threadDeletedCount() RETURNS TRIGGER AS
+    $threadDeletedCount$
+    DECLARE
+        delta INT;
+    BEGIN
+        IF NEW.IsDeleted <> OLD.IsDeleted THEN
+            delta = CASE WHEN NEW.IsDeleted THEN -1 ELSE 1 END;
+            UPDATE Forum SET Threads = Threads + delta,
+                Posts = Posts + delta * (SELECT COUNT(*) FROM Posts WHERE Thread = NEW.Id AND NOT IsDeleted)
+                WHERE Slug = NEW.Forum;
+        end if;
+        RETURN NEW;
+    end;
+    $threadDeletedCount$
+LANGUAGE plpgsql;
+CREATE TRIGGER threadDeleted AFTER UPDATE OF IsDeleted
+    ON Threads FOR EACH ROW
+    EXECUTE PROCEDURE threadDeletedCount();
+
+-- the posts of a purged thread are purged first and counted by postPurged
+CREATE OR REPLACE FUNCTION threadPurgedCount() RETURNS TRIGGER AS
+    $threadPurgedCount$
+    BEGIN
+        IF NOT OLD.IsDeleted THEN
+            UPDATE Forum SET Threads = Threads - 1 WHERE Slug = OLD.Forum;
+        end if;
+        RETURN OLD;
+    end;
+    $threadPurgedCount$
+LANGUAGE plpgsql;
+CREATE TRIGGER threadPurged AFTER DELETE
+    ON Threads FOR EACH ROW
+    EXECUTE PROCEDURE threadPurgedCount();
@@ -0,0 +1,8 @@
+DROP TRIGGER IF EXISTS threadRevisionAdd ON Threads;
+DROP TRIGGER IF EXISTS postRevisionAdd ON Posts;
+DROP FUNCTION IF EXISTS threadRevision();
+DROP FUNCTION IF EXISTS postRevision();
+DROP TABLE IF EXISTS thread_revisions;
+DROP TABLE IF EXISTS post_revisions;
+ALTER TABLE Threads DROP COLUMN IF EXISTS EditedBy;
+ALTER TABLE Posts DROP COLUMN IF EXISTS EditedBy;
@@ -0,0 +1,69 @@
+-- who last edited a post or thread, set by the service on update
+ALTER TABLE Posts ADD COLUMN EditedBy citext;
+ALTER TABLE Threads ADD COLUMN EditedBy citext;
+
+-- every version of an edited post, the original included
+CREATE UNLOGGED TABLE post_revisions (
+    Id BIGSERIAL PRIMARY KEY,
+    Post BIGINT NOT NULL,
+    Message TEXT NOT NULL,
+    EditedBy citext,
+    Created TIMESTAMP WITH TIME ZONE DEFAULT now(),
+    FOREIGN KEY (Post) REFERENCES Posts(Id) ON DELETE CASCADE
+);
+CREATE INDEX postRevisionsPostIndex ON post_revisions (Post, Id);
+
+CREATE UNLOGGED TABLE thread_revisions (
+    Id BIGSERIAL PRIMARY KEY,
+    Thread BIGINT NOT NULL,
+    Title TEXT NOT NULL,
+    Message TEXT NOT NULL,
+    EditedBy citext,
+    Created TIMESTAMP WITH TIME ZONE DEFAULT now(),
+    FOREIGN KEY (Thread) REFERENCES Threads(Id) ON DELETE CASCADE
+);
+CREATE INDEX threadRevisionsThreadIndex ON thread_revisions (Thread, Id);
+
+-- posts that are never edited cost nothing: the original version is only
+-- stored along with the first edit
+CREATE OR REPLACE FUNCTION postRevision() RETURNS TRIGGER AS
+    $postRevision$
+    BEGIN
+        IF NEW.IsDeleted THEN
+            -- a deleted post keeps no trace of its text
+            DELETE FROM post_revisions WHERE Post = NEW.Id;
+            RETURN NEW;
+        end if;
+        IF NEW.Message IS DISTINCT FROM OLD.Message THEN
+            IF NOT EXISTS (SELECT 1 FROM post_revisions WHERE Post = NEW.Id) THEN
+                INSERT INTO post_revisions (Post, Message, EditedBy, Created)
+                    VALUES (OLD.Id, OLD.Message, OLD.Author, OLD.Created);
+            end if;
+            INSERT INTO post_revisions (Post, Message, EditedBy) VALUES (NEW.Id, NEW.Message, NEW.EditedBy);
+        end if;
+        RETURN NEW;
+    end;
+    $postRevision$
+LANGUAGE plpgsql;
+CREATE TRIGGER postRevisionAdd AFTER UPDATE OF Message
+    ON Posts FOR EACH ROW
+    EXECUTE PROCEDURE postRevision();
+
+CREATE OR REPLACE FUNCTION threadRevision() RETURNS TRIGGER AS
+    $threadRevision$
+    BEGIN
+        IF NEW.Title IS DISTINCT FROM OLD.Title OR NEW.Message IS DISTINCT FROM OLD.Message THEN
+            IF NOT EXISTS (SELECT 1 FROM thread_revisions WHERE Thread = NEW.Id) THEN
+                INSERT INTO thread_revisions (Thread, Title, Message, EditedBy, Created)
+                    VALUES (OLD.Id, OLD.Title, COALESCE(OLD.Message, ''), OLD.Author, OLD.Created);
+            end if;
+            INSERT INTO thread_revisions (Thread, Title, Message, EditedBy)
+                VALUES (NEW.Id, NEW.Title, COALESCE(NEW.Message, ''), NEW.EditedBy);
+        end if;
+        RETURN NEW;
+    end;
+    $threadRevision$
+LANGUAGE plpgsql;
+CREATE TRIGGER threadRevisionAdd AFTER UPDATE OF Title, Message
+    ON Threads FOR EACH ROW
+    EXECUTE PROCEDURE threadRevision();
@@ -0,0 +1,27 @@
+DROP TRIGGER IF EXISTS postDeletedCounted ON Posts;
+DROP TRIGGER IF EXISTS threadDeletedCounted ON Threads;
+DROP TRIGGER IF EXISTS forumDeletedCounted ON Forum;
+DROP FUNCTION IF EXISTS servicePostDeleted();
+DROP FUNCTION IF EXISTS serviceThreadDeleted();
+DROP FUNCTION IF EXISTS serviceForumDeleted();
+DROP TRIGGER IF EXISTS votesTruncated ON Votes;
+DROP TRIGGER IF EXISTS votesUncounted ON Votes;
+DROP TRIGGER IF EXISTS votesCounted ON Votes;
+DROP TRIGGER IF EXISTS postsTruncated ON Posts;
+DROP TRIGGER IF EXISTS postsUncounted ON Posts;
+DROP TRIGGER IF EXISTS postsCounted ON Posts;
+DROP TRIGGER IF EXISTS threadsTruncated ON Threads;
+DROP TRIGGER IF EXISTS threadsUncounted ON Threads;
+DROP TRIGGER IF EXISTS threadsCounted ON Threads;
+DROP TRIGGER IF EXISTS forumTruncated ON Forum;
+DROP TRIGGER IF EXISTS forumUncounted ON Forum;
+DROP TRIGGER IF EXISTS forumCounted ON Forum;
+DROP TRIGGER IF EXISTS usersTruncated ON Users;
+DROP TRIGGER IF EXISTS usersUncounted ON Users;
+DROP TRIGGER IF EXISTS usersCounted ON Users;
+DROP FUNCTION IF EXISTS serviceResetRows();
+DROP FUNCTION IF EXISTS serviceAddPosts();
+DROP FUNCTION IF EXISTS serviceAddLiveRows();
+DROP FUNCTION IF EXISTS serviceAddRows();
+DROP FUNCTION IF EXISTS serviceAdd(TEXT, BIGINT);
+DROP TABLE IF EXISTS service_counters;
@@ -0,0 +1,175 @@
+-- row counts of the service status, kept by statement triggers instead of
+-- COUNT(*) over every table. Each backend adds to its own shard so concurrent
+-- inserts don't queue on one row lock; the status sums the shards. Like the
+-- forum counters they only count what is served: forums, threads and posts
+-- that are not deleted, and no posts of deleted threads.
+CREATE UNLOGGED TABLE service_counters (
+    Name  TEXT NOT NULL,
+    Shard INT NOT NULL,
+    Value BIGINT NOT NULL DEFAULT 0,
+    PRIMARY KEY (Name, Shard)
+);
+
+CREATE OR REPLACE FUNCTION serviceAdd(counter TEXT, delta BIGINT) RETURNS VOID AS
+    $serviceAdd$
+    BEGIN
+        IF delta <> 0 THEN
+            INSERT INTO service_counters (Name, Shard, Value) VALUES (counter, pg_backend_pid() % 16, delta)
+                ON CONFLICT (Name, Shard) DO UPDATE SET Value = service_counters.Value + EXCLUDED.Value;
+        end if;
+    end;
+    $serviceAdd$
+LANGUAGE plpgsql;
+
+CREATE OR REPLACE FUNCTION serviceAddRows() RETURNS TRIGGER AS
+    $serviceAddRows$
+    DECLARE
+        delta BIGINT;
+    BEGIN
+        IF TG_OP = 'INSERT' THEN
+            SELECT COUNT(*) FROM inserted INTO delta;
+        ELSE
+            SELECT -COUNT(*) FROM removed INTO delta;
+        end if;
+        PERFORM serviceAdd(TG_ARGV[0], delta);
+        RETURN NULL;
+    end;
+    $serviceAddRows$
+LANGUAGE plpgsql;
+
+-- forums and threads, a purged row that was deleted before is no longer counted
+CREATE OR REPLACE FUNCTION serviceAddLiveRows() RETURNS TRIGGER AS
+    $serviceAddLiveRows$
+    DECLARE
+        delta BIGINT;
+    BEGIN
+        IF TG_OP = 'INSERT' THEN
+            SELECT COUNT(*) FROM inserted WHERE NOT IsDeleted INTO delta;
+        ELSE
+            SELECT -COUNT(*) FROM removed WHERE NOT IsDeleted INTO delta;
+        end if;
+        PERFORM serviceAdd(TG_ARGV[0], delta);
+        RETURN NULL;
+    end;
+    $serviceAddLiveRows$
+LANGUAGE plpgsql;
+
+-- the posts of a purged thread go first, while the thread still tells if they were counted
+CREATE OR REPLACE FUNCTION serviceAddPosts() RETURNS TRIGGER AS
+    $serviceAddPosts$
+    DECLARE
+        delta BIGINT;
+    BEGIN
+        IF TG_OP = 'INSERT' THEN
+            SELECT COUNT(*) FROM inserted p WHERE NOT p.IsDeleted AND
+                NOT EXISTS (SELECT 1 FROM Threads t WHERE t.Id = p.Thread AND t.IsDeleted) INTO delta;
+        ELSE
+            SELECT -COUNT(*) FROM removed p WHERE NOT p.IsDeleted AND
+                NOT EXISTS (SELECT 1 FROM Threads t WHERE t.Id = p.Thread AND t.IsDeleted) INTO delta;
+        end if;
+        PERFORM serviceAdd('post', delta);
+        RETURN NULL;
+    end;
+    $serviceAddPosts$
+LANGUAGE plpgsql;
+
+-- TRUNCATE fires no row or delete triggers
+CREATE OR REPLACE FUNCTION serviceResetRows() RETURNS TRIGGER AS
+    $serviceResetRows$
+    BEGIN
+        DELETE FROM service_counters WHERE Name = TG_ARGV[0];
+        RETURN NULL;
+    end;
+    $serviceResetRows$
+LANGUAGE plpgsql;
+
+CREATE TRIGGER usersCounted AFTER INSERT ON Users REFERENCING NEW TABLE AS inserted
+    FOR EACH STATEMENT EXECUTE PROCEDURE serviceAddRows('user');
+CREATE TRIGGER usersUncounted AFTER DELETE ON Users REFERENCING OLD TABLE AS removed
+    FOR EACH STATEMENT EXECUTE PROCEDURE serviceAddRows('user');
+CREATE TRIGGER usersTruncated AFTER TRUNCATE ON Users
+    FOR EACH STATEMENT EXECUTE PROCEDURE serviceResetRows('user');
+
+CREATE TRIGGER forumCounted AFTER INSERT ON Forum REFERENCING NEW TABLE AS inserted
+    FOR EACH STATEMENT EXECUTE PROCEDURE serviceAddLiveRows('forum');
+CREATE TRIGGER forumUncounted AFTER DELETE ON Forum REFERENCING OLD TABLE AS removed
+    FOR EACH STATEMENT EXECUTE PROCEDURE serviceAddLiveRows('forum');
+CREATE TRIGGER forumTruncated AFTER TRUNCATE ON Forum
+    FOR EACH STATEMENT EXECUTE PROCEDURE serviceResetRows('forum');
+
+CREATE TRIGGER threadsCounted AFTER INSERT ON Threads REFERENCING NEW TABLE AS inserted
+    FOR EACH STATEMENT EXECUTE PROCEDURE serviceAddLiveRows('thread');
+CREATE TRIGGER threadsUncounted AFTER DELETE ON Threads REFERENCING OLD TABLE AS removed
+    FOR EACH STATEMENT EXECUTE PROCEDURE serviceAddLiveRows('thread');
+CREATE TRIGGER threadsTruncated AFTER TRUNCATE ON Threads
+    FOR EACH STATEMENT EXECUTE PROCEDURE serviceResetRows('thread');
+
+CREATE TRIGGER postsCounted AFTER INSERT ON Posts REFERENCING NEW TABLE AS inserted
+    FOR EACH STATEMENT EXECUTE PROCEDURE serviceAddPosts();
+CREATE TRIGGER postsUncounted AFTER DELETE ON Posts REFERENCING OLD TABLE AS removed
+    FOR EACH STATEMENT EXECUTE PROCEDURE serviceAddPosts();
+CREATE TRIGGER postsTruncated AFTER TRUNCATE ON Posts
+    FOR EACH STATEMENT EXECUTE PROCEDURE serviceResetRows('post');
+
+CREATE TRIGGER votesCounted AFTER INSERT ON Votes REFERENCING NEW TABLE AS inserted
+    FOR EACH STATEMENT EXECUTE PROCEDURE serviceAddRows('vote');
+CREATE TRIGGER votesUncounted AFTER DELETE ON Votes REFERENCING OLD TABLE AS removed
+    FOR EACH STATEMENT EXECUTE PROCEDURE serviceAddRows('vote');
+CREATE TRIGGER votesTruncated AFTER TRUNCATE ON Votes
+    FOR EACH STATEMENT EXECUTE PROCEDURE serviceResetRows('vote');
+
+-- soft deletes, as the forum counters in 0007
+CREATE OR REPLACE FUNCTION serviceForumDeleted() RETURNS TRIGGER AS
+    $serviceForumDeleted$
+    BEGIN
+        IF NEW.IsDeleted <> OLD.IsDeleted THEN
+            PERFORM serviceAdd('forum', CASE WHEN NEW.IsDeleted THEN -1 ELSE 1 END);
+        end if;
+        RETURN NEW;
+    end;
+    $serviceForumDeleted$
+LANGUAGE plpgsql;
+CREATE TRIGGER forumDeletedCounted AFTER UPDATE OF IsDeleted
+    ON Forum FOR EACH ROW
+    EXECUTE PROCEDURE serviceForumDeleted();
+
+CREATE OR REPLACE FUNCTION serviceThreadDeleted() RETURNS TRIGGER AS
+    $serviceThreadDeleted$
+    DECLARE
+        delta INT;
+    BEGIN
+        IF NEW.IsDeleted <> OLD.IsDeleted THEN
+            delta = CASE WHEN NEW.IsDeleted THEN -1 ELSE 1 END;
+            PERFORM serviceAdd('thread', delta);
+            PERFORM serviceAdd('post', delta * (SELECT COUNT(*) FROM Posts WHERE Thread = NEW.Id AND NOT IsDeleted));
+        end if;
+        RETURN NEW;
+    end;
+    $serviceThreadDeleted$
+LANGUAGE plpgsql;
+CREATE TRIGGER threadDeletedCounted AFTER UPDATE OF IsDeleted
+    ON Threads FOR EACH ROW
+    EXECUTE PROCEDURE serviceThreadDeleted();
+
+CREATE OR REPLACE FUNCTION servicePostDeleted() RETURNS TRIGGER AS
+    $servicePostDeleted$
+    BEGIN
+        IF NEW.IsDeleted <> OLD.IsDeleted AND
+           NOT EXISTS (SELECT 1 FROM Threads WHERE Id = NEW.Thread AND IsDeleted) THEN
+            PERFORM serviceAdd('post', CASE WHEN NEW.IsDeleted THEN -1 ELSE 1 END);
+        end if;
+        RETURN NEW;
+    end;
+    $servicePostDeleted$
+LANGUAGE plpgsql;
+CREATE TRIGGER postDeletedCounted AFTER UPDATE OF IsDeleted
+    ON Posts FOR EACH ROW
+    EXECUTE PROCEDURE servicePostDeleted();
+
+INSERT INTO service_counters (Name, Shard, Value)
+    SELECT 'user', 0, COUNT(*) FROM Users
+    UNION ALL SELECT 'forum', 0, COUNT(*) FROM Forum WHERE NOT IsDeleted
+    UNION ALL SELECT 'thread', 0, COUNT(*) FROM Threads WHERE NOT IsDeleted
+    UNION ALL SELECT 'post', 0, COUNT(*) FROM Posts p WHERE NOT p.IsDeleted AND
+        NOT EXISTS (SELECT 1 FROM Threads t WHERE t.Id = p.Thread AND t.IsDeleted)
+    UNION ALL SELECT 'vote', 0, COUNT(*) FROM Votes;
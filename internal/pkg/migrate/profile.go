@@ -0,0 +1,193 @@
+package migrate
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/rs/zerolog/log"
+)
+
+// Storage profiles. Bench keeps every table UNLOGGED for throughput and loses
+// data on a crash, durable makes them logged and adds the Posts.Parent foreign key.
+const (
+	ProfileBench   = "bench"
+	ProfileDurable = "durable"
+)
+
+const parentFkey = "posts_parent_fkey"
+
+type table struct {
+	oid      uint32
+	name     string
+	unlogged bool
+}
+
+// ApplyProfile converts the schema to the profile. Tables are rewritten with
+// ALTER TABLE SET [UN]LOGGED, which keeps their rows. It is a no-op when the
+// schema already matches.
+func (r *Runner) ApplyProfile(ctx context.Context, profile string) error {
+	if profile != ProfileBench && profile != ProfileDurable {
+		return fmt.Errorf("unknown profile %q", profile)
+	}
+	return r.locked(ctx, func(conn *pgxpool.Conn) error {
+		tables, err := tablesByDependency(ctx, conn)
+		if err != nil {
+			return err
+		}
+		tx, err := conn.Begin(ctx)
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback(ctx)
+
+		if profile == ProfileDurable {
+			// referenced tables have to become logged before the ones referencing them
+			for _, t := range tables {
+				if err = setLogged(ctx, tx, t, true); err != nil {
+					return err
+				}
+			}
+			_, err = tx.Exec(ctx, `DO $$ BEGIN
+				IF NOT EXISTS (SELECT 1 FROM pg_constraint WHERE conname = '`+parentFkey+`') THEN
+					ALTER TABLE Posts ADD CONSTRAINT `+parentFkey+` FOREIGN KEY (Parent) REFERENCES Posts(Id);
+				END IF;
+			END $$`)
+			if err != nil {
+				return err
+			}
+		} else {
+			if _, err = tx.Exec(ctx, "ALTER TABLE Posts DROP CONSTRAINT IF EXISTS "+parentFkey); err != nil {
+				return err
+			}
+			for i := len(tables) - 1; i >= 0; i-- {
+				if err = setLogged(ctx, tx, tables[i], false); err != nil {
+					return err
+				}
+			}
+		}
+		return tx.Commit(ctx)
+	})
+}
+
+// Profile reports the profile the schema is in, judging by table persistence.
+// A schema without tables yet has no profile, reported as "".
+func (r *Runner) Profile(ctx context.Context) (string, error) {
+	var tables int
+	var unlogged bool
+	err := r.pool.QueryRow(ctx, `SELECT COUNT(*), COALESCE(bool_or(c.relpersistence = 'u'), FALSE) FROM pg_class c
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		WHERE n.nspname = current_schema() AND c.relkind = 'r' AND c.relname <> 'schema_version'`).Scan(&tables, &unlogged)
+	if err != nil {
+		return "", err
+	}
+	if tables == 0 {
+		return "", nil
+	}
+	if unlogged {
+		return ProfileBench, nil
+	}
+	return ProfileDurable, nil
+}
+
+// UpKeepingProfile applies the pending migrations and leaves the schema in
+// profile. An empty profile keeps the one the schema had before, so that new
+// UNLOGGED tables do not make a durable schema partly unlogged; an empty
+// schema then stays as the migrations create it, bench.
+func (r *Runner) UpKeepingProfile(ctx context.Context, profile string) error {
+	if profile == "" {
+		var err error
+		if profile, err = r.Profile(ctx); err != nil {
+			return err
+		}
+	}
+	if err := r.Up(ctx); err != nil {
+		return err
+	}
+	if profile == "" {
+		return nil
+	}
+	return r.ApplyProfile(ctx, profile)
+}
+
+func setLogged(ctx context.Context, tx pgx.Tx, t table, logged bool) error {
+	if t.unlogged != logged {
+		return nil
+	}
+	mode := "UNLOGGED"
+	if logged {
+		mode = "LOGGED"
+	}
+	log.Info().Msgf("setting table %s %s", t.name, mode)
+	_, err := tx.Exec(ctx, "ALTER TABLE "+pgx.Identifier{t.name}.Sanitize()+" SET "+mode)
+	return err
+}
+
+// tablesByDependency lists the tables of the current schema, except
+// schema_version which always stays logged, with every table placed after
+// the tables it references.
+func tablesByDependency(ctx context.Context, conn *pgxpool.Conn) ([]table, error) {
+	rows, err := conn.Query(ctx, `SELECT c.oid, c.relname, c.relpersistence = 'u' FROM pg_class c
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		WHERE n.nspname = current_schema() AND c.relkind = 'r' AND c.relname <> 'schema_version'
+		ORDER BY c.relname`)
+	if err != nil {
+		return nil, err
+	}
+	var all []table
+	for rows.Next() {
+		var t table
+		if err = rows.Scan(&t.oid, &t.name, &t.unlogged); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		all = append(all, t)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = conn.Query(ctx, `SELECT conrelid::oid, confrelid::oid FROM pg_constraint
+		WHERE contype = 'f' AND conrelid <> confrelid`)
+	if err != nil {
+		return nil, err
+	}
+	references := map[uint32][]uint32{}
+	for rows.Next() {
+		var from, to uint32
+		if err = rows.Scan(&from, &to); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		references[from] = append(references[from], to)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	byOid := map[uint32]table{}
+	for _, t := range all {
+		byOid[t.oid] = t
+	}
+	var ordered []table
+	visited := map[uint32]bool{}
+	var visit func(oid uint32)
+	visit = func(oid uint32) {
+		t, ok := byOid[oid]
+		if !ok || visited[oid] {
+			return
+		}
+		visited[oid] = true
+		for _, ref := range references[oid] {
+			visit(ref)
+		}
+		ordered = append(ordered, t)
+	}
+	for _, t := range all {
+		visit(t.oid)
+	}
+	return ordered, nil
+}
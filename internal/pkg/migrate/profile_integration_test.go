@@ -0,0 +1,57 @@
+//go:build integration
+
+package migrate_test
+
+import (
+	"context"
+	"testing"
+
+	"repo/internal/pkg/migrate"
+)
+
+func profileOf(t *testing.T, r *migrate.Runner) string {
+	t.Helper()
+	profile, err := r.Profile(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return profile
+}
+
+func TestUpKeepsProfile(t *testing.T) {
+	ctx := context.Background()
+	r := migrate.NewRunner(db.Pool)
+	if got := profileOf(t, r); got != migrate.ProfileBench {
+		t.Fatalf("fresh schema is %q, want bench", got)
+	}
+
+	// the last migration creates an UNLOGGED table, reapplying it must not
+	// make a durable schema bench
+	if err := r.ApplyProfile(ctx, migrate.ProfileDurable); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Down(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.UpKeepingProfile(ctx, ""); err != nil {
+		t.Fatal(err)
+	}
+	if got := profileOf(t, r); got != migrate.ProfileDurable {
+		t.Errorf("after up the schema is %q, want durable", got)
+	}
+	var fkey bool
+	if err := db.Pool.QueryRow(ctx, "SELECT EXISTS(SELECT 1 FROM pg_constraint WHERE conname = 'posts_parent_fkey')").Scan(&fkey); err != nil {
+		t.Fatal(err)
+	}
+	if !fkey {
+		t.Error("up dropped the Posts.Parent foreign key")
+	}
+
+	// an explicit profile still switches
+	if err := r.UpKeepingProfile(ctx, migrate.ProfileBench); err != nil {
+		t.Fatal(err)
+	}
+	if got := profileOf(t, r); got != migrate.ProfileBench {
+		t.Errorf("after up with bench the schema is %q", got)
+	}
+}
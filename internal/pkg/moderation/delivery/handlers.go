@@ -0,0 +1,295 @@
+package delivery
+
+import (
+	"context"
+	"fmt"
+	"github.com/fasthttp/router"
+	"github.com/valyala/fasthttp"
+	"repo/internal/pkg/auth"
+	"repo/internal/pkg/cursor"
+	"repo/internal/pkg/domain"
+	"repo/internal/pkg/policy"
+	"repo/internal/pkg/utils"
+	"strconv"
+	"strings"
+)
+
+const logLimit = 100
+
+type ModerationHandler struct {
+	mr      domain.ModerationRepository
+	fr      domain.ForumRepository
+	authz   auth.Authorizer
+	cursors cursor.Codec
+}
+
+func NewModerationHandler(r *router.Router, mr domain.ModerationRepository, fr domain.ForumRepository, t utils.Timeouts,
+	authz auth.Authorizer, cursors cursor.Codec) {
+	handler := ModerationHandler{mr: mr, fr: fr, authz: authz, cursors: cursors}
+	route := t.Router(r)
+	route.GET("/api/forum/{slug}/moderators", handler.GetModerators)
+	route.POST("/api/forum/{slug}/moderators", handler.AddModerator)
+	route.DELETE("/api/forum/{slug}/moderators/{nickname}", handler.RemoveModerator)
+	route.GET("/api/forum/{slug}/bans", handler.GetBans)
+	route.POST("/api/forum/{slug}/bans", handler.Ban)
+	route.DELETE("/api/forum/{slug}/bans/{nickname}", handler.Unban)
+	route.GET("/api/forum/{slug}/moderation/log", handler.GetLog)
+
+	route.POST("/api/thread/{slug_or_id}/lock", handler.threadAction(domain.ActionLock))
+	route.POST("/api/thread/{slug_or_id}/unlock", handler.threadAction(domain.ActionUnlock))
+	route.POST("/api/thread/{slug_or_id}/pin", handler.threadAction(domain.ActionPin))
+	route.POST("/api/thread/{slug_or_id}/unpin", handler.threadAction(domain.ActionUnpin))
+
+	route.POST("/api/post/{id:[0-9]+}/hide", handler.postAction(domain.ActionHide))
+	route.POST("/api/post/{id:[0-9]+}/unhide", handler.postAction(domain.ActionUnhide))
+}
+
+func (mh *ModerationHandler) GetModerators(ctx *fasthttp.RequestCtx) {
+	c := utils.Context(ctx)
+	forum, ok := mh.forum(ctx)
+	if !ok {
+		return
+	}
+	moderators, err := mh.mr.GetModerators(c, forum.Slug)
+	if err != nil {
+		utils.SendError(err, ctx)
+		return
+	}
+	utils.Send(200, moderators, ctx)
+}
+
+func (mh *ModerationHandler) AddModerator(ctx *fasthttp.RequestCtx) {
+	c := utils.Context(ctx)
+	forum, ok := mh.forum(ctx)
+	if !ok || !mh.check(ctx, forum.Slug, func(a policy.Actor) error { return policy.CanAssignModerators(a, forum) }) {
+		return
+	}
+	var moderator domain.Moderator
+	if !utils.ParseBody(ctx, &moderator) {
+		return
+	}
+	added, err := mh.mr.AddModerator(c, forum.Slug, moderator.Nickname, auth.Nickname(ctx))
+	if err != nil {
+		utils.SendError(err, ctx)
+		return
+	}
+	utils.Send(201, added, ctx)
+}
+
+func (mh *ModerationHandler) RemoveModerator(ctx *fasthttp.RequestCtx) {
+	c := utils.Context(ctx)
+	forum, ok := mh.forum(ctx)
+	if !ok || !mh.check(ctx, forum.Slug, func(a policy.Actor) error { return policy.CanAssignModerators(a, forum) }) {
+		return
+	}
+	nickname, _ := ctx.UserValue("nickname").(string)
+	err := mh.mr.RemoveModerator(c, forum.Slug, nickname, auth.Nickname(ctx))
+	if err != nil {
+		utils.SendError(err, ctx)
+		return
+	}
+	utils.Send(200, domain.Response{Message: fmt.Sprintf("%s no longer moderates %s", nickname, forum.Slug)}, ctx)
+}
+
+func (mh *ModerationHandler) GetBans(ctx *fasthttp.RequestCtx) {
+	c := utils.Context(ctx)
+	forum, ok := mh.forum(ctx)
+	if !ok || !mh.check(ctx, forum.Slug, policy.CanModerate) {
+		return
+	}
+	bans, err := mh.mr.GetBans(c, forum.Slug)
+	if err != nil {
+		utils.SendError(err, ctx)
+		return
+	}
+	utils.Send(200, bans, ctx)
+}
+
+func (mh *ModerationHandler) Ban(ctx *fasthttp.RequestCtx) {
+	c := utils.Context(ctx)
+	forum, ok := mh.forum(ctx)
+	if !ok || !mh.check(ctx, forum.Slug, policy.CanModerate) {
+		return
+	}
+	var ban domain.Ban
+	if !utils.ParseBody(ctx, &ban) {
+		return
+	}
+	ban.Forum, ban.BannedBy = forum.Slug, auth.Nickname(ctx)
+	banned, err := mh.mr.BanUser(c, ban)
+	if err != nil {
+		utils.SendError(err, ctx)
+		return
+	}
+	utils.Send(201, banned, ctx)
+}
+
+func (mh *ModerationHandler) Unban(ctx *fasthttp.RequestCtx) {
+	c := utils.Context(ctx)
+	forum, ok := mh.forum(ctx)
+	if !ok || !mh.check(ctx, forum.Slug, policy.CanModerate) {
+		return
+	}
+	nickname, _ := ctx.UserValue("nickname").(string)
+	err := mh.mr.UnbanUser(c, forum.Slug, nickname, auth.Nickname(ctx))
+	if err != nil {
+		utils.SendError(err, ctx)
+		return
+	}
+	utils.Send(200, domain.Response{Message: fmt.Sprintf("%s is no longer banned in %s", nickname, forum.Slug)}, ctx)
+}
+
+// GetLog pages through the audit log of a forum newest first, ?limit= and ?cursor= as for the listings.
+func (mh *ModerationHandler) GetLog(ctx *fasthttp.RequestCtx) {
+	c := utils.Context(ctx)
+	forum, ok := mh.forum(ctx)
+	if !ok || !mh.check(ctx, forum.Slug, policy.CanModerate) {
+		return
+	}
+	limit, err := utils.GetQueryInt(ctx, "limit")
+	if err != nil || limit < 0 {
+		utils.Send(400, domain.Response{Message: "limit must be a positive number"}, ctx)
+		return
+	}
+	if limit == 0 || limit > logLimit {
+		limit = logLimit
+	}
+	scope := "moderation:" + strings.ToLower(forum.Slug)
+	var after *domain.Cursor
+	if token := utils.GetQueryString(ctx, "cursor"); token != "" {
+		key, err := mh.cursors.Decode(scope, token)
+		if err != nil {
+			utils.SendError(err, ctx)
+			return
+		}
+		after = &key
+	}
+	entries, err := mh.mr.GetLog(c, forum.Slug, limit, after)
+	if err != nil {
+		utils.SendError(err, ctx)
+		return
+	}
+	if len(entries) == limit {
+		next := domain.Cursor{Id: entries[len(entries)-1].Id}
+		ctx.Response.Header.Set(cursor.Header, mh.cursors.Encode(scope, next))
+	}
+	utils.Send(200, entries, ctx)
+}
+
+// threadAction locks, unlocks, pins or unpins a thread and answers with the thread
+func (mh *ModerationHandler) threadAction(action string) fasthttp.RequestHandler {
+	return func(ctx *fasthttp.RequestCtx) {
+		c := utils.Context(ctx)
+		slugOrId, _ := ctx.UserValue("slug_or_id").(string)
+		thread, err := mh.thread(c, slugOrId)
+		if err != nil {
+			utils.SendError(err, ctx)
+			return
+		}
+		if !mh.check(ctx, thread.Forum, policy.CanModerate) {
+			return
+		}
+		reason, ok := parseReason(ctx)
+		if !ok {
+			return
+		}
+		by := auth.Nickname(ctx)
+		switch action {
+		case domain.ActionLock, domain.ActionUnlock:
+			err = mh.mr.LockThread(c, thread, action == domain.ActionLock, by, reason)
+		case domain.ActionPin, domain.ActionUnpin:
+			err = mh.mr.PinThread(c, thread, action == domain.ActionPin, by, reason)
+		}
+		if err != nil {
+			utils.SendError(err, ctx)
+			return
+		}
+		thread, err = mh.fr.GetThreadInfo(c, int(thread.Id))
+		if err != nil {
+			utils.SendError(err, ctx)
+			return
+		}
+		utils.Send(200, thread, ctx)
+	}
+}
+
+// postAction hides or unhides a post and answers with the post
+func (mh *ModerationHandler) postAction(action string) fasthttp.RequestHandler {
+	return func(ctx *fasthttp.RequestCtx) {
+		c := utils.Context(ctx)
+		param, _ := ctx.UserValue("id").(string)
+		id, err := strconv.ParseInt(param, 10, 64)
+		if err != nil {
+			utils.Send(400, domain.Response{Message: "post id must be a number"}, ctx)
+			return
+		}
+		full, err := mh.fr.GetPost(c, domain.Post{Id: id}, nil)
+		if err != nil {
+			utils.SendError(err, ctx)
+			return
+		}
+		post := *full.Post
+		if !mh.check(ctx, post.Forum, policy.CanModerate) {
+			return
+		}
+		reason, ok := parseReason(ctx)
+		if !ok {
+			return
+		}
+		by := auth.Nickname(ctx)
+		err = mh.mr.HidePost(c, post, action == domain.ActionHide, by, reason)
+		if err != nil {
+			utils.SendError(err, ctx)
+			return
+		}
+		full, err = mh.fr.GetPost(c, domain.Post{Id: id}, nil)
+		if err != nil {
+			utils.SendError(err, ctx)
+			return
+		}
+		utils.Send(200, full.Post, ctx)
+	}
+}
+
+// forum loads the forum of the {slug} path parameter, answering 404 when there is none
+func (mh *ModerationHandler) forum(ctx *fasthttp.RequestCtx) (domain.Forum, bool) {
+	slug, _ := ctx.UserValue("slug").(string)
+	forum, err := mh.fr.GetForum(utils.Context(ctx), slug)
+	if err != nil {
+		utils.SendError(err, ctx)
+		return domain.Forum{}, false
+	}
+	return forum, true
+}
+
+// check answers 401/403 unless the caller passes check, moderation is always enforced
+func (mh *ModerationHandler) check(ctx *fasthttp.RequestCtx, forum string, check func(policy.Actor) error) bool {
+	if err := mh.authz.Check(ctx, forum, check); err != nil {
+		utils.SendError(err, ctx)
+		return false
+	}
+	return true
+}
+
+func (mh *ModerationHandler) thread(c context.Context, slugOrId string) (domain.Thread, error) {
+	id, err := strconv.Atoi(slugOrId)
+	if err != nil {
+		id, err = mh.fr.GetThreadIdBySlug(c, slugOrId)
+		if err != nil {
+			return domain.Thread{}, err
+		}
+	}
+	return mh.fr.GetThreadInfo(c, id)
+}
+
+// parseReason reads the optional {"reason": ...} body of an action
+func parseReason(ctx *fasthttp.RequestCtx) (string, bool) {
+	if len(ctx.PostBody()) == 0 {
+		return "", true
+	}
+	var reason domain.Reason
+	if !utils.ParseBody(ctx, &reason) {
+		return "", false
+	}
+	return reason.Reason, true
+}
@@ -0,0 +1,203 @@
+package repository
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"repo/internal/pkg/domain"
+	"repo/internal/pkg/metrics"
+	"repo/internal/pkg/utils"
+)
+
+type ModerationRepository struct {
+	dbm *pgxpool.Pool
+}
+
+func NewModerationRep(pool *pgxpool.Pool) ModerationRepository {
+	return ModerationRepository{dbm: pool}
+}
+
+// audited runs change and records the action in moderation_log within one transaction.
+func (m *ModerationRepository) audited(ctx context.Context, entry domain.ModerationAction, change func(tx pgx.Tx) error) error {
+	tx, err := m.dbm.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+	if err = change(tx); err != nil {
+		return err
+	}
+	_, err = tx.Exec(ctx, "INSERT INTO moderation_log (Forum, Moderator, Action, Target, Reason) VALUES ($1, $2, $3, $4, $5)",
+		entry.Forum, entry.Moderator, entry.Action, entry.Target, entry.Reason)
+	if err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// affected fails with NotFound when a statement changed nothing
+func affected(err error, n int64, format string, args ...interface{}) error {
+	if err == nil && n == 0 {
+		return domain.NewError(domain.ErrNotFound, format, args...)
+	}
+	return err
+}
+
+func (m *ModerationRepository) AddModerator(ctx context.Context, forum string, nickname string, by string) (domain.Moderator, error) {
+	defer metrics.Query("moderation", "AddModerator")()
+	var moderator domain.Moderator
+	entry := domain.ModerationAction{Forum: forum, Moderator: by, Action: domain.ActionAddModerator, Target: nickname}
+	err := m.audited(ctx, entry, func(tx pgx.Tx) error {
+		row := tx.QueryRow(ctx, "INSERT INTO forum_moderators (Forum, Nickname, AddedBy) VALUES ($1, $2, $3)"+
+			" RETURNING Forum, Nickname, COALESCE(AddedBy, ''), Created", forum, nickname, by)
+		return row.Scan(&moderator.Forum, &moderator.Nickname, &moderator.AddedBy, &moderator.Created)
+	})
+	if pgErr := utils.PgError(err); pgErr != nil {
+		switch pgErr.Code {
+		case utils.UniqueViolation:
+			return domain.Moderator{}, domain.NewError(domain.ErrConflict, "%s already moderates forum %s", nickname, forum)
+		case utils.ForeignKeyViolation:
+			return domain.Moderator{}, domain.NewError(domain.ErrUserMissing, "Can't find user by nickname: %s", nickname)
+		}
+	}
+	return moderator, err
+}
+
+func (m *ModerationRepository) RemoveModerator(ctx context.Context, forum string, nickname string, by string) error {
+	defer metrics.Query("moderation", "RemoveModerator")()
+	entry := domain.ModerationAction{Forum: forum, Moderator: by, Action: domain.ActionRemoveModerator, Target: nickname}
+	return m.audited(ctx, entry, func(tx pgx.Tx) error {
+		tag, err := tx.Exec(ctx, "DELETE FROM forum_moderators WHERE Forum = $1 AND Nickname = $2", forum, nickname)
+		return affected(err, tag.RowsAffected(), "%s does not moderate forum %s", nickname, forum)
+	})
+}
+
+func (m *ModerationRepository) GetModerators(ctx context.Context, forum string) ([]domain.Moderator, error) {
+	defer metrics.Query("moderation", "GetModerators")()
+	rows, err := m.dbm.Query(ctx, "SELECT Forum, Nickname, COALESCE(AddedBy, ''), Created FROM forum_moderators"+
+		" WHERE Forum = $1 ORDER BY Nickname", forum)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	moderators := []domain.Moderator{}
+	for rows.Next() {
+		var moderator domain.Moderator
+		if err = rows.Scan(&moderator.Forum, &moderator.Nickname, &moderator.AddedBy, &moderator.Created); err != nil {
+			return nil, err
+		}
+		moderators = append(moderators, moderator)
+	}
+	return moderators, rows.Err()
+}
+
+func (m *ModerationRepository) LockThread(ctx context.Context, thread domain.Thread, locked bool, by string, reason string) error {
+	defer metrics.Query("moderation", "LockThread")()
+	action := domain.ActionUnlock
+	if locked {
+		action = domain.ActionLock
+	}
+	return m.setThreadFlag(ctx, thread, "IsLocked", locked, domain.ModerationAction{Moderator: by, Action: action, Reason: reason})
+}
+
+func (m *ModerationRepository) PinThread(ctx context.Context, thread domain.Thread, pinned bool, by string, reason string) error {
+	defer metrics.Query("moderation", "PinThread")()
+	action := domain.ActionUnpin
+	if pinned {
+		action = domain.ActionPin
+	}
+	return m.setThreadFlag(ctx, thread, "IsPinned", pinned, domain.ModerationAction{Moderator: by, Action: action, Reason: reason})
+}
+
+// setThreadFlag sets one of the boolean columns of a thread, column is never user input
+func (m *ModerationRepository) setThreadFlag(ctx context.Context, thread domain.Thread, column string, value bool, entry domain.ModerationAction) error {
+	entry.Forum, entry.Target = thread.Forum, strconv.Itoa(int(thread.Id))
+	return m.audited(ctx, entry, func(tx pgx.Tx) error {
+		tag, err := tx.Exec(ctx, "UPDATE Threads SET "+column+" = $1 WHERE Id = $2", value, thread.Id)
+		return affected(err, tag.RowsAffected(), "Can't find thread with id: %d", thread.Id)
+	})
+}
+
+func (m *ModerationRepository) HidePost(ctx context.Context, post domain.Post, hidden bool, by string, reason string) error {
+	defer metrics.Query("moderation", "HidePost")()
+	action := domain.ActionUnhide
+	if hidden {
+		action = domain.ActionHide
+	}
+	entry := domain.ModerationAction{Forum: post.Forum, Moderator: by, Action: action, Target: strconv.FormatInt(post.Id, 10), Reason: reason}
+	return m.audited(ctx, entry, func(tx pgx.Tx) error {
+		tag, err := tx.Exec(ctx, "UPDATE Posts SET IsHidden = $1 WHERE Id = $2", hidden, post.Id)
+		return affected(err, tag.RowsAffected(), "Can't find post with id: %d", post.Id)
+	})
+}
+
+func (m *ModerationRepository) BanUser(ctx context.Context, ban domain.Ban) (domain.Ban, error) {
+	defer metrics.Query("moderation", "BanUser")()
+	var banned domain.Ban
+	entry := domain.ModerationAction{Forum: ban.Forum, Moderator: ban.BannedBy, Action: domain.ActionBan, Target: ban.Nickname, Reason: ban.Reason}
+	err := m.audited(ctx, entry, func(tx pgx.Tx) error {
+		// banning again updates the reason
+		row := tx.QueryRow(ctx, "INSERT INTO forum_bans (Forum, Nickname, BannedBy, Reason) VALUES ($1, $2, $3, $4)"+
+			" ON CONFLICT (Forum, Nickname) DO UPDATE SET BannedBy = EXCLUDED.BannedBy, Reason = EXCLUDED.Reason"+
+			" RETURNING Forum, Nickname, COALESCE(BannedBy, ''), Reason, Created", ban.Forum, ban.Nickname, ban.BannedBy, ban.Reason)
+		return row.Scan(&banned.Forum, &banned.Nickname, &banned.BannedBy, &banned.Reason, &banned.Created)
+	})
+	if pgErr := utils.PgError(err); pgErr != nil && pgErr.Code == utils.ForeignKeyViolation {
+		return domain.Ban{}, domain.NewError(domain.ErrUserMissing, "Can't find user by nickname: %s", ban.Nickname)
+	}
+	return banned, err
+}
+
+func (m *ModerationRepository) UnbanUser(ctx context.Context, forum string, nickname string, by string) error {
+	defer metrics.Query("moderation", "UnbanUser")()
+	entry := domain.ModerationAction{Forum: forum, Moderator: by, Action: domain.ActionUnban, Target: nickname}
+	return m.audited(ctx, entry, func(tx pgx.Tx) error {
+		tag, err := tx.Exec(ctx, "DELETE FROM forum_bans WHERE Forum = $1 AND Nickname = $2", forum, nickname)
+		return affected(err, tag.RowsAffected(), "%s is not banned in forum %s", nickname, forum)
+	})
+}
+
+func (m *ModerationRepository) GetBans(ctx context.Context, forum string) ([]domain.Ban, error) {
+	defer metrics.Query("moderation", "GetBans")()
+	rows, err := m.dbm.Query(ctx, "SELECT Forum, Nickname, COALESCE(BannedBy, ''), Reason, Created FROM forum_bans"+
+		" WHERE Forum = $1 ORDER BY Created DESC", forum)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	bans := []domain.Ban{}
+	for rows.Next() {
+		var ban domain.Ban
+		if err = rows.Scan(&ban.Forum, &ban.Nickname, &ban.BannedBy, &ban.Reason, &ban.Created); err != nil {
+			return nil, err
+		}
+		bans = append(bans, ban)
+	}
+	return bans, rows.Err()
+}
+
+// GetLog lists the audit log of a forum, newest first.
+func (m *ModerationRepository) GetLog(ctx context.Context, forum string, limit int, after *domain.Cursor) ([]domain.ModerationAction, error) {
+	defer metrics.Query("moderation", "GetLog")()
+	var before int64
+	if after != nil {
+		before = after.Id
+	}
+	rows, err := m.dbm.Query(ctx, "SELECT Id, Forum, COALESCE(Moderator, ''), Action, Target, Reason, Created FROM moderation_log"+
+		" WHERE Forum = $1 AND ($2 = 0 OR Id < $2) ORDER BY Id DESC LIMIT $3", forum, before, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	log := []domain.ModerationAction{}
+	for rows.Next() {
+		var entry domain.ModerationAction
+		if err = rows.Scan(&entry.Id, &entry.Forum, &entry.Moderator, &entry.Action, &entry.Target, &entry.Reason, &entry.Created); err != nil {
+			return nil, err
+		}
+		log = append(log, entry)
+	}
+	return log, rows.Err()
+}
@@ -0,0 +1,121 @@
+//go:build integration
+
+package repository
+
+import (
+	"context"
+	"errors"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	"repo/internal/pkg/domain"
+	forumRepository "repo/internal/pkg/forum/repository"
+	"repo/internal/pkg/testdb"
+	userRepository "repo/internal/pkg/user/repository"
+)
+
+var db *testdb.Cluster
+
+func TestMain(m *testing.M) {
+	os.Exit(testdb.Main(m, &db))
+}
+
+var ctx = context.Background()
+
+// setup empties the database and creates the users alice, bob and carol and the forum "go" owned by alice.
+func setup(t *testing.T) (*ModerationRepository, *forumRepository.ForumRepository) {
+	t.Helper()
+	db.Reset(t)
+	ur := userRepository.NewUserRep(db.Pool)
+	for _, nick := range []string{"alice", "bob", "carol"} {
+		if err := ur.AddUser(ctx, domain.User{Nickname: nick, FullName: nick, Email: nick + "@example.com"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	fr := forumRepository.NewForumRep(db.Pool, &ur)
+	if _, err := fr.AddForum(ctx, domain.Forum{Title: "Go", User: "alice", Slug: "go"}); err != nil {
+		t.Fatal(err)
+	}
+	mr := NewModerationRep(db.Pool)
+	return &mr, &fr
+}
+
+func mustThread(t *testing.T, fr *forumRepository.ForumRepository, title string, created time.Time) domain.Thread {
+	t.Helper()
+	thread, err := fr.AddThread(ctx, domain.Thread{Title: title, Forum: "go", Author: "bob", Message: title, Created: created})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return thread
+}
+
+func TestLockedThreadTakesNoPosts(t *testing.T) {
+	mr, fr := setup(t)
+	thread := mustThread(t, fr, "locked", time.Now())
+	if err := mr.LockThread(ctx, thread, true, "alice", ""); err != nil {
+		t.Fatal(err)
+	}
+	posts := []domain.Post{{Author: "bob", Message: "one"}, {Author: "carol", Message: "two"}}
+	if _, err := fr.AddPosts(ctx, int(thread.Id), thread.Forum, posts); !errors.Is(err, domain.ErrForbidden) {
+		t.Errorf("AddPosts to a locked thread = %v", err)
+	}
+	if err := mr.LockThread(ctx, thread, false, "alice", ""); err != nil {
+		t.Fatal(err)
+	}
+	if created, err := fr.AddPosts(ctx, int(thread.Id), thread.Forum, posts); err != nil || len(created) != 2 {
+		t.Errorf("AddPosts to an unlocked thread = %v, %v", created, err)
+	}
+}
+
+func TestBannedUserCannotPost(t *testing.T) {
+	mr, fr := setup(t)
+	thread := mustThread(t, fr, "open", time.Now())
+	if _, err := mr.BanUser(ctx, domain.Ban{Forum: "go", Nickname: "carol", BannedBy: "alice"}); err != nil {
+		t.Fatal(err)
+	}
+	// one banned author fails the whole batch, whatever the case of the nickname
+	posts := []domain.Post{{Author: "bob", Message: "one"}, {Author: "CAROL", Message: "two"}}
+	if _, err := fr.AddPosts(ctx, int(thread.Id), thread.Forum, posts); !errors.Is(err, domain.ErrForbidden) {
+		t.Errorf("AddPosts by a banned user = %v", err)
+	}
+	_, err := fr.AddThread(ctx, domain.Thread{Title: "new", Forum: "go", Author: "carol", Message: "new", Created: time.Now()})
+	if !errors.Is(err, domain.ErrForbidden) {
+		t.Errorf("AddThread by a banned user = %v", err)
+	}
+	if created, err := fr.AddPosts(ctx, int(thread.Id), thread.Forum, posts[:1]); err != nil || len(created) != 1 {
+		t.Errorf("AddPosts by a user who is not banned = %v, %v", created, err)
+	}
+}
+
+func TestPinnedThreadsComeFirst(t *testing.T) {
+	mr, fr := setup(t)
+	start := time.Now().Add(-time.Hour)
+	var threads []domain.Thread
+	for i, title := range []string{"first", "second", "third"} {
+		threads = append(threads, mustThread(t, fr, title, start.Add(time.Duration(i)*time.Minute)))
+	}
+	if err := mr.PinThread(ctx, threads[1], true, "alice", ""); err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []struct {
+		desc bool
+		want []string
+	}{
+		{false, []string{"second", "first", "third"}},
+		{true, []string{"second", "third", "first"}},
+	} {
+		listed, err := fr.GetThreads(ctx, "go", "", c.desc, 10, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := []string{}
+		for _, thread := range listed {
+			got = append(got, thread.Title)
+		}
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("GetThreads desc=%v = %v, want %v", c.desc, got, c.want)
+		}
+	}
+}
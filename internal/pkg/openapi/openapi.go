@@ -0,0 +1,303 @@
+// Package openapi builds the OpenAPI 3 document of the service from the routes
+// registered on the router and the descriptions in Routes.
+package openapi
+
+import (
+	"encoding/json"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/valyala/fasthttp"
+)
+
+type Document struct {
+	OpenAPI    string                          `json:"openapi"`
+	Info       Info                            `json:"info"`
+	Paths      map[string]map[string]Operation `json:"paths"`
+	Components Components                      `json:"components"`
+}
+
+type Info struct {
+	Title   string `json:"title"`
+	Version string `json:"version"`
+}
+
+type Components struct {
+	Schemas         map[string]*Schema        `json:"schemas"`
+	SecuritySchemes map[string]SecurityScheme `json:"securitySchemes"`
+}
+
+type SecurityScheme struct {
+	Type   string `json:"type"`
+	Scheme string `json:"scheme,omitempty"`
+	In     string `json:"in,omitempty"`
+	Name   string `json:"name,omitempty"`
+}
+
+type Operation struct {
+	Summary     string                `json:"summary"`
+	Tags        []string              `json:"tags,omitempty"`
+	Parameters  []Parameter           `json:"parameters,omitempty"`
+	RequestBody *RequestBody          `json:"requestBody,omitempty"`
+	Responses   map[string]Response   `json:"responses"`
+	Security    []map[string][]string `json:"security,omitempty"`
+}
+
+type Parameter struct {
+	Name        string  `json:"name"`
+	In          string  `json:"in"`
+	Description string  `json:"description,omitempty"`
+	Required    bool    `json:"required,omitempty"`
+	Schema      *Schema `json:"schema"`
+}
+
+type RequestBody struct {
+	Required bool                 `json:"required"`
+	Content  map[string]MediaType `json:"content"`
+}
+
+type Response struct {
+	Description string               `json:"description"`
+	Headers     map[string]Header    `json:"headers,omitempty"`
+	Content     map[string]MediaType `json:"content,omitempty"`
+}
+
+type Header struct {
+	Description string  `json:"description"`
+	Schema      *Schema `json:"schema"`
+}
+
+type MediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+type Schema struct {
+	Ref        string             `json:"$ref,omitempty"`
+	Type       string             `json:"type,omitempty"`
+	Format     string             `json:"format,omitempty"`
+	Enum       []string           `json:"enum,omitempty"`
+	Minimum    *int               `json:"minimum,omitempty"`
+	Maximum    *int               `json:"maximum,omitempty"`
+	Default    interface{}        `json:"default,omitempty"`
+	Items      *Schema            `json:"items,omitempty"`
+	Properties map[string]*Schema `json:"properties,omitempty"`
+	Required   []string           `json:"required,omitempty"`
+}
+
+// Route describes one registered route. Body and the Responses values are
+// samples of the Go types sent, nil when there is no body.
+type Route struct {
+	Summary      string
+	Tag          string
+	Params       []Param
+	Body         interface{}
+	OptionalBody bool
+	Responses    map[int]interface{}
+	// Auth marks routes that need a session
+	Auth bool
+	// Cursor marks listings that return the next page cursor in cursor.Header
+	Cursor bool
+}
+
+type Param struct {
+	Name        string
+	In          string
+	Type        string
+	Description string
+	Required    bool
+	Enum        []string
+	Default     interface{}
+	Min, Max    *int
+}
+
+// Build describes every route in routes (method -> paths, as router.List returns).
+// Routes without a description in described are listed in missing and documented
+// with their path only.
+func Build(routes map[string][]string, described map[string]Route) (doc Document, missing []string) {
+	doc = Document{
+		OpenAPI: "3.0.3",
+		Info:    Info{Title: "Forum API", Version: "1.0"},
+		Paths:   map[string]map[string]Operation{},
+		Components: Components{
+			Schemas: map[string]*Schema{},
+			SecuritySchemes: map[string]SecurityScheme{
+				"bearer":  {Type: "http", Scheme: "bearer"},
+				"session": {Type: "apiKey", In: "cookie", Name: "session"},
+			},
+		},
+	}
+	g := generator{schemas: doc.Components.Schemas}
+	for method, paths := range routes {
+		for _, path := range paths {
+			key := method + " " + path
+			route, ok := described[key]
+			if !ok {
+				missing = append(missing, key)
+			}
+			specPath := pathPattern.ReplaceAllString(path, "{$1}")
+			if doc.Paths[specPath] == nil {
+				doc.Paths[specPath] = map[string]Operation{}
+			}
+			doc.Paths[specPath][strings.ToLower(method)] = g.operation(path, route)
+		}
+	}
+	sort.Strings(missing)
+	return doc, missing
+}
+
+// pathPattern strips the regexp of a router parameter, {id:[0-9]+} is {id} in the document
+var pathPattern = regexp.MustCompile(`\{([^}:]+)(:[^}]*)?\}`)
+
+type generator struct {
+	schemas map[string]*Schema
+}
+
+func (g generator) operation(path string, route Route) Operation {
+	op := Operation{Summary: route.Summary, Responses: map[string]Response{}}
+	if route.Tag != "" {
+		op.Tags = []string{route.Tag}
+	}
+	for _, m := range pathPattern.FindAllStringSubmatch(path, -1) {
+		schema := &Schema{Type: "string"}
+		if m[2] == ":[0-9]+" {
+			schema = &Schema{Type: "integer", Format: "int64"}
+		}
+		op.Parameters = append(op.Parameters, Parameter{Name: m[1], In: "path", Required: true, Schema: schema})
+	}
+	for _, p := range route.Params {
+		in := p.In
+		if in == "" {
+			in = "query"
+		}
+		typ := p.Type
+		if typ == "" {
+			typ = "string"
+		}
+		schema := &Schema{Type: typ, Enum: p.Enum, Default: p.Default, Minimum: p.Min, Maximum: p.Max}
+		op.Parameters = append(op.Parameters, Parameter{Name: p.Name, In: in, Description: p.Description, Required: p.Required, Schema: schema})
+	}
+	if route.Body != nil {
+		op.RequestBody = &RequestBody{Required: !route.OptionalBody, Content: jsonContent(g.schema(reflect.TypeOf(route.Body)))}
+	}
+	for status, body := range route.Responses {
+		resp := Response{Description: fasthttp.StatusMessage(status)}
+		if body != nil {
+			resp.Content = jsonContent(g.schema(reflect.TypeOf(body)))
+		}
+		if route.Cursor && status == fasthttp.StatusOK {
+			resp.Headers = map[string]Header{"X-Next-Cursor": {Description: "cursor of the next page, absent on the last one", Schema: &Schema{Type: "string"}}}
+		}
+		op.Responses[strconv.Itoa(status)] = resp
+	}
+	if len(op.Responses) == 0 {
+		op.Responses["default"] = Response{Description: "undocumented"}
+	}
+	if route.Auth {
+		op.Security = []map[string][]string{{"bearer": {}}, {"session": {}}}
+	}
+	return op
+}
+
+func jsonContent(schema *Schema) map[string]MediaType {
+	return map[string]MediaType{"application/json": {Schema: schema}}
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// schema describes t, named structs are added to the components and referenced.
+func (g generator) schema(t reflect.Type) *Schema {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch {
+	case t == timeType:
+		return &Schema{Type: "string", Format: "date-time"}
+	case t.Kind() == reflect.Struct:
+		if t.Name() == "" {
+			return g.object(t)
+		}
+		if _, ok := g.schemas[t.Name()]; !ok {
+			// reserve the name first so recursive types terminate
+			g.schemas[t.Name()] = &Schema{}
+			*g.schemas[t.Name()] = *g.object(t)
+		}
+		return &Schema{Ref: "#/components/schemas/" + t.Name()}
+	case t.Kind() == reflect.Slice || t.Kind() == reflect.Array:
+		return &Schema{Type: "array", Items: g.schema(t.Elem())}
+	case t.Kind() == reflect.Map:
+		return &Schema{Type: "object"}
+	case t.Kind() == reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case t.Kind() == reflect.String:
+		return &Schema{Type: "string"}
+	case t.Kind() == reflect.Float32:
+		return &Schema{Type: "number", Format: "float"}
+	case t.Kind() == reflect.Float64:
+		return &Schema{Type: "number", Format: "double"}
+	case t.Kind() == reflect.Int64 || t.Kind() == reflect.Uint64:
+		return &Schema{Type: "integer", Format: "int64"}
+	case t.Kind() >= reflect.Int && t.Kind() <= reflect.Uint32:
+		return &Schema{Type: "integer", Format: "int32"}
+	}
+	return &Schema{}
+}
+
+func (g generator) object(t reflect.Type) *Schema {
+	s := &Schema{Type: "object", Properties: map[string]*Schema{}}
+	g.fields(t, s)
+	return s
+}
+
+func (g generator) fields(t reflect.Type, s *Schema) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" {
+			continue
+		}
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name := strings.Split(tag, ",")[0]
+		if f.Anonymous && name == "" {
+			// embedded structs are flattened by encoding/json
+			g.fields(f.Type, s)
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		s.Properties[name] = g.schema(f.Type)
+		for _, rule := range strings.Split(f.Tag.Get("validate"), ",") {
+			if rule == "required" {
+				s.Required = append(s.Required, name)
+			}
+		}
+	}
+}
+
+// Spec serves the document at /api/openapi.json. It is registered before the
+// other routes and loaded once they all are.
+type Spec struct {
+	body []byte
+}
+
+// Load builds the document from the routes and returns the undocumented ones.
+func (s *Spec) Load(routes map[string][]string) ([]string, error) {
+	doc, missing := Build(routes, Routes)
+	body, err := json.Marshal(doc)
+	if err != nil {
+		return nil, err
+	}
+	s.body = body
+	return missing, nil
+}
+
+func (s *Spec) Handler(ctx *fasthttp.RequestCtx) {
+	ctx.SetContentType("application/json")
+	ctx.SetBody(s.body)
+}
@@ -0,0 +1,307 @@
+package openapi
+
+import (
+	"repo/internal/pkg/domain"
+	"repo/internal/pkg/health"
+)
+
+func intp(n int) *int {
+	return &n
+}
+
+// common parameters and responses
+var (
+	desc   = Param{Name: "desc", Type: "boolean", Description: "sort in descending order"}
+	cursor = Param{Name: "cursor", Description: "X-Next-Cursor of the previous page, continues after its last row"}
+	purge  = Param{Name: "purge", Type: "boolean", Description: "remove for good instead of soft deleting, admins only"}
+
+	limit = func(def string) Param {
+		return Param{Name: "limit", Type: "integer", Min: intp(1), Description: "page size, " + def}
+	}
+	diffRange = []Param{
+		{Name: "from", Type: "integer", Min: intp(1), Description: "older version, defaults to the one before to"},
+		{Name: "to", Type: "integer", Min: intp(1), Description: "newer version, defaults to the latest"},
+	}
+
+	message    = domain.Response{}
+	validation = domain.ValidationResponse{}
+	// the answers of every route that loads by path parameter
+	notFound = map[int]interface{}{404: message}
+)
+
+// with adds the statuses of extra to responses
+func with(responses map[int]interface{}, extra ...map[int]interface{}) map[int]interface{} {
+	res := map[int]interface{}{}
+	for _, m := range append([]map[int]interface{}{responses}, extra...) {
+		for status, body := range m {
+			res[status] = body
+		}
+	}
+	return res
+}
+
+var (
+	authErrors       = map[int]interface{}{401: message, 403: message}
+	validationErrors = map[int]interface{}{400: validation}
+)
+
+// Routes documents every route of the API, keyed by "METHOD pattern" as registered on the router.
+var Routes = map[string]Route{
+	// users
+	"POST /api/user/{nickname}/create": {
+		Tag: "user", Summary: "Create a user",
+		Body:      domain.User{},
+		Responses: with(map[int]interface{}{201: domain.User{}, 409: []domain.User{}}, validationErrors),
+	},
+	"GET /api/user/{nickname}/profile": {
+		Tag: "user", Summary: "Get a user profile",
+		Responses: with(map[int]interface{}{200: domain.User{}}, notFound),
+	},
+	"POST /api/user/{nickname}/profile": {
+		Tag: "user", Summary: "Update a user profile, omitted fields are kept",
+		Body: domain.User{}, Auth: true,
+		Responses: with(map[int]interface{}{200: domain.User{}, 409: message}, notFound, validationErrors, authErrors),
+	},
+
+	// auth
+	"POST /api/auth/register": {
+		Tag: "auth", Summary: "Create a user with a password",
+		Body:      domain.Registration{},
+		Responses: with(map[int]interface{}{201: domain.User{}, 409: message}, validationErrors),
+	},
+	"POST /api/auth/login": {
+		Tag: "auth", Summary: "Start a session, the token is also set as the session cookie",
+		Body:      domain.Credentials{},
+		Responses: with(map[int]interface{}{200: domain.Session{}, 401: message}, validationErrors),
+	},
+	"POST /api/auth/logout": {
+		Tag: "auth", Summary: "End the current session",
+		Auth:      true,
+		Responses: map[int]interface{}{200: message},
+	},
+	"GET /api/auth/me": {
+		Tag: "auth", Summary: "Get the user of the current session",
+		Auth:      true,
+		Responses: map[int]interface{}{200: domain.User{}, 401: message},
+	},
+
+	// forums
+	"POST /api/forum/create": {
+		Tag: "forum", Summary: "Create a forum",
+		Body:      domain.Forum{},
+		Responses: with(map[int]interface{}{201: domain.Forum{}, 409: domain.Forum{}}, notFound, validationErrors),
+	},
+	"GET /api/forum/{slug}/details": {
+		Tag: "forum", Summary: "Get a forum",
+		Responses: with(map[int]interface{}{200: domain.Forum{}}, notFound),
+	},
+	"GET /api/forum/{slug}/users": {
+		Tag: "forum", Summary: "List the users who posted in a forum, by nickname",
+		Params:    []Param{limit("unlimited by default"), {Name: "since", Description: "nickname to start after"}, desc, cursor},
+		Cursor:    true,
+		Responses: with(map[int]interface{}{200: []domain.User{}, 400: message}, notFound),
+	},
+	"DELETE /api/forum/{slug}": {
+		Tag: "forum", Summary: "Delete a forum with its threads, owner or admin",
+		Params: []Param{purge}, Auth: true,
+		Responses: with(map[int]interface{}{200: message}, notFound, authErrors),
+	},
+
+	// threads
+	"POST /api/forum/{slug}/create": {
+		Tag: "thread", Summary: "Create a thread",
+		Body:      domain.Thread{},
+		Responses: with(map[int]interface{}{201: domain.Thread{}, 409: domain.Thread{}}, notFound, validationErrors, authErrors),
+	},
+	"GET /api/forum/{slug}/threads": {
+		Tag: "thread", Summary: "List the threads of a forum, pinned first then by creation time",
+		Params:    []Param{limit("unlimited by default"), {Name: "since", Description: "creation time to start from"}, desc, cursor},
+		Cursor:    true,
+		Responses: with(map[int]interface{}{200: []domain.Thread{}, 400: message}, notFound),
+	},
+	"GET /api/thread/{slug_or_id}/details": {
+		Tag: "thread", Summary: "Get a thread",
+		Responses: with(map[int]interface{}{200: domain.Thread{}}, notFound),
+	},
+	"POST /api/thread/{slug_or_id}/details": {
+		Tag: "thread", Summary: "Edit the title or message of a thread, omitted fields are kept",
+		Body: domain.Thread{}, Auth: true,
+		Responses: with(map[int]interface{}{200: domain.Thread{}}, notFound, validationErrors, authErrors),
+	},
+	"DELETE /api/thread/{slug_or_id}": {
+		Tag: "thread", Summary: "Delete a thread, author, moderator or admin",
+		Params: []Param{purge}, Auth: true,
+		Responses: with(map[int]interface{}{200: message}, notFound, authErrors),
+	},
+	"POST /api/thread/{slug_or_id}/vote": {
+		Tag: "thread", Summary: "Vote for a thread, a second vote replaces the first",
+		Body:      domain.Vote{},
+		Responses: with(map[int]interface{}{200: domain.Thread{}}, notFound, validationErrors),
+	},
+
+	// posts
+	"POST /api/thread/{slug_or_id}/create": {
+		Tag: "post", Summary: "Add posts to a thread",
+		Body:      []domain.Post{},
+		Responses: with(map[int]interface{}{201: []domain.Post{}, 409: message}, notFound, validationErrors, authErrors),
+	},
+	"GET /api/thread/{slug_or_id}/posts": {
+		Tag: "post", Summary: "List the posts of a thread",
+		Params: []Param{
+			limit("unlimited by default"),
+			{Name: "since", Type: "integer", Description: "id of the post to start after"},
+			{Name: "sort", Enum: []string{"flat", "tree", "parent_tree"}, Default: "flat", Description: "flat by creation, tree by path, parent_tree pages over root posts"},
+			desc, cursor,
+		},
+		Cursor:    true,
+		Responses: with(map[int]interface{}{200: []domain.Post{}, 400: message}, notFound),
+	},
+	"GET /api/post/{id:[0-9]+}/details": {
+		Tag: "post", Summary: "Get a post",
+		Params:    []Param{{Name: "related", Description: "comma separated objects to include: user, thread, forum"}},
+		Responses: with(map[int]interface{}{200: domain.PostFull{}}, notFound),
+	},
+	"POST /api/post/{id:[0-9]+}/details": {
+		Tag: "post", Summary: "Edit the message of a post",
+		Body: domain.Post{}, Auth: true,
+		Responses: with(map[int]interface{}{200: domain.Post{}, 409: message}, notFound, validationErrors, authErrors),
+	},
+	"DELETE /api/post/{id:[0-9]+}": {
+		Tag: "post", Summary: "Delete a post, leaving a tombstone; author, moderator or admin",
+		Params: []Param{purge}, Auth: true,
+		Responses: with(map[int]interface{}{200: domain.Post{}}, notFound, authErrors),
+	},
+
+	// history
+	"GET /api/post/{id:[0-9]+}/history": {
+		Tag: "history", Summary: "List the versions of a post, oldest first",
+		Responses: with(map[int]interface{}{200: []domain.Revision{}}, notFound),
+	},
+	"GET /api/post/{id:[0-9]+}/diff": {
+		Tag: "history", Summary: "Compare two versions of a post word by word",
+		Params:    diffRange,
+		Responses: with(map[int]interface{}{200: domain.RevisionDiff{}, 400: message}, notFound),
+	},
+	"GET /api/thread/{slug_or_id}/history": {
+		Tag: "history", Summary: "List the versions of a thread, oldest first",
+		Responses: with(map[int]interface{}{200: []domain.Revision{}}, notFound),
+	},
+	"GET /api/thread/{slug_or_id}/diff": {
+		Tag: "history", Summary: "Compare two versions of a thread word by word",
+		Params:    diffRange,
+		Responses: with(map[int]interface{}{200: domain.RevisionDiff{}, 400: message}, notFound),
+	},
+
+	// moderation
+	"GET /api/forum/{slug}/moderators": {
+		Tag: "moderation", Summary: "List the moderators of a forum",
+		Responses: with(map[int]interface{}{200: []domain.Moderator{}}, notFound),
+	},
+	"POST /api/forum/{slug}/moderators": {
+		Tag: "moderation", Summary: "Make a user moderator of a forum, owner or admin",
+		Body: domain.Moderator{}, Auth: true,
+		Responses: with(map[int]interface{}{201: domain.Moderator{}, 409: message}, notFound, validationErrors, authErrors),
+	},
+	"DELETE /api/forum/{slug}/moderators/{nickname}": {
+		Tag: "moderation", Summary: "Remove a moderator, owner or admin",
+		Auth:      true,
+		Responses: with(map[int]interface{}{200: message}, notFound, authErrors),
+	},
+	"GET /api/forum/{slug}/bans": {
+		Tag: "moderation", Summary: "List the users banned from a forum, moderators only",
+		Auth:      true,
+		Responses: with(map[int]interface{}{200: []domain.Ban{}}, notFound, authErrors),
+	},
+	"POST /api/forum/{slug}/bans": {
+		Tag: "moderation", Summary: "Ban a user from posting in a forum",
+		Body: domain.Ban{}, Auth: true,
+		Responses: with(map[int]interface{}{201: domain.Ban{}, 409: message}, notFound, validationErrors, authErrors),
+	},
+	"DELETE /api/forum/{slug}/bans/{nickname}": {
+		Tag: "moderation", Summary: "Lift a ban",
+		Auth:      true,
+		Responses: with(map[int]interface{}{200: message}, notFound, authErrors),
+	},
+	"GET /api/forum/{slug}/moderation/log": {
+		Tag: "moderation", Summary: "List the moderation actions of a forum, newest first",
+		Params: []Param{limit("100 at most"), cursor}, Auth: true, Cursor: true,
+		Responses: with(map[int]interface{}{200: []domain.ModerationAction{}, 400: message}, notFound, authErrors),
+	},
+	"POST /api/thread/{slug_or_id}/lock":   threadAction("Lock a thread, it takes no new posts"),
+	"POST /api/thread/{slug_or_id}/unlock": threadAction("Unlock a thread"),
+	"POST /api/thread/{slug_or_id}/pin":    threadAction("Pin a thread to the top of its forum"),
+	"POST /api/thread/{slug_or_id}/unpin":  threadAction("Unpin a thread"),
+	"POST /api/post/{id:[0-9]+}/hide":      postAction("Hide a post"),
+	"POST /api/post/{id:[0-9]+}/unhide":    postAction("Show a hidden post again"),
+
+	// search
+	"GET /api/search": {
+		Tag: "search", Summary: "Full-text search over threads and posts, best match first",
+		Params: []Param{
+			{Name: "q", Required: true, Description: "web search syntax: words, \"phrases\", -excluded, or"},
+			{Name: "forum", Description: "forum slug"},
+			{Name: "author", Description: "author nickname"},
+			{Name: "type", Enum: []string{domain.SearchThreads, domain.SearchPosts}, Description: "search only threads or only posts"},
+			{Name: "since", Description: "created at or after, date-time"},
+			{Name: "until", Description: "created before, date-time"},
+			{Name: "limit", Type: "integer", Min: intp(1), Max: intp(100), Default: 20},
+			cursor,
+		},
+		Cursor:    true,
+		Responses: map[int]interface{}{200: []domain.SearchHit{}, 400: validation},
+	},
+
+	// service
+	"GET /api/service/status": {
+		Tag: "service", Summary: "Row counts and activity of the service",
+		Params: []Param{
+			{Name: "exact", Type: "boolean", Description: "count the tables instead of reading the counters"},
+			{Name: "top", Type: "integer", Min: intp(0), Max: intp(100), Default: 0, Description: "number of forums listed by post count, none by default"},
+		},
+		Responses: map[int]interface{}{200: domain.Status{}, 400: message},
+	},
+	"POST /api/service/clear": {
+		Tag: "service", Summary: "Remove all data",
+		Responses: map[int]interface{}{200: ""},
+	},
+	"POST /api/service/import/{kind}": {
+		Tag: "service", Summary: "Import users, forums, threads, posts or votes in bulk, admins only",
+		Params: []Param{
+			{Name: "format", Enum: []string{"jsonl", "csv"}, Default: "jsonl", Description: "format of the body, text/csv bodies default to csv"},
+		},
+		Auth:      true,
+		Responses: with(map[int]interface{}{200: domain.ImportResult{}, 400: message}, authErrors),
+	},
+	"GET /api/openapi.json": {
+		Tag: "service", Summary: "This document",
+		Responses: map[int]interface{}{200: map[string]interface{}{}},
+	},
+	"GET /healthz": {
+		Tag: "service", Summary: "Liveness probe",
+		Responses: map[int]interface{}{200: health.Report{}},
+	},
+	"GET /readyz": {
+		Tag: "service", Summary: "Readiness probe: database and schema checks",
+		Responses: map[int]interface{}{200: health.Report{}, 503: health.Report{}},
+	},
+	"GET /metrics": {
+		Tag: "service", Summary: "Prometheus metrics in the text format",
+		Responses: map[int]interface{}{200: nil},
+	},
+}
+
+func threadAction(summary string) Route {
+	return Route{
+		Tag: "moderation", Summary: summary + ", moderators only",
+		Body: domain.Reason{}, OptionalBody: true, Auth: true,
+		Responses: with(map[int]interface{}{200: domain.Thread{}}, notFound, validationErrors, authErrors),
+	}
+}
+
+func postAction(summary string) Route {
+	return Route{
+		Tag: "moderation", Summary: summary + ", moderators only",
+		Body: domain.Reason{}, OptionalBody: true, Auth: true,
+		Responses: with(map[int]interface{}{200: domain.Post{}}, notFound, validationErrors, authErrors),
+	}
+}
@@ -0,0 +1,127 @@
+// Package policy decides who may change what. The rules only look at the actor
+// and the resource, so they are independent of HTTP and storage.
+package policy
+
+import (
+	"strings"
+
+	"repo/internal/pkg/domain"
+)
+
+// Actor is the caller of a request along with its roles relative to the forum
+// of the resource at hand.
+type Actor struct {
+	// Nickname is empty for anonymous callers
+	Nickname  string
+	Admin     bool
+	Moderator bool
+}
+
+func (a Actor) Authenticated() bool {
+	return a.Nickname != ""
+}
+
+// Is reports whether the actor is the user with nickname, nicknames are case insensitive.
+func (a Actor) Is(nickname string) bool {
+	return a.Authenticated() && strings.EqualFold(a.Nickname, nickname)
+}
+
+// CanEditPost lets the author of the post, a moderator of its forum or an admin edit it.
+func CanEditPost(a Actor, post domain.Post) error {
+	return authorOrModerator(a, post.Author, "edit this post")
+}
+
+// CanEditThread lets the author of the thread, a moderator of its forum or an admin edit it.
+func CanEditThread(a Actor, thread domain.Thread) error {
+	return authorOrModerator(a, thread.Author, "edit this thread")
+}
+
+// CanDeletePost lets the author of the post, a moderator of its forum or an admin delete it.
+func CanDeletePost(a Actor, post domain.Post) error {
+	return authorOrModerator(a, post.Author, "delete this post")
+}
+
+// CanDeleteThread lets the author of the thread, a moderator of its forum or an admin delete it.
+func CanDeleteThread(a Actor, thread domain.Thread) error {
+	return authorOrModerator(a, thread.Author, "delete this thread")
+}
+
+// CanDeleteForum lets the owner of the forum or an admin delete it.
+func CanDeleteForum(a Actor, forum domain.Forum) error {
+	if !a.Authenticated() {
+		return unauthenticated()
+	}
+	if a.Is(forum.User) || a.Admin {
+		return nil
+	}
+	return domain.NewError(domain.ErrForbidden, "Only the owner may delete forum %s", forum.Slug)
+}
+
+// CanPurge lets only admins remove content for good.
+func CanPurge(a Actor) error {
+	if !a.Authenticated() {
+		return unauthenticated()
+	}
+	if a.Admin {
+		return nil
+	}
+	return domain.NewError(domain.ErrForbidden, "Only an admin may purge")
+}
+
+// CanImport lets only admins import data in bulk.
+func CanImport(a Actor) error {
+	if !a.Authenticated() {
+		return unauthenticated()
+	}
+	if a.Admin {
+		return nil
+	}
+	return domain.NewError(domain.ErrForbidden, "Only an admin may import")
+}
+
+// CanEditProfile lets only the user edit their own profile.
+func CanEditProfile(a Actor, nickname string) error {
+	if !a.Authenticated() {
+		return unauthenticated()
+	}
+	if !a.Is(nickname) {
+		return domain.NewError(domain.ErrForbidden, "Only %s may edit their profile", nickname)
+	}
+	return nil
+}
+
+// CanModerate lets moderators of the forum and admins lock, pin, hide, delete and ban.
+func CanModerate(a Actor) error {
+	if !a.Authenticated() {
+		return unauthenticated()
+	}
+	if a.Moderator || a.Admin {
+		return nil
+	}
+	return domain.NewError(domain.ErrForbidden, "Only a moderator may do this")
+}
+
+// CanAssignModerators lets the owner of the forum or an admin appoint and dismiss moderators.
+func CanAssignModerators(a Actor, forum domain.Forum) error {
+	if !a.Authenticated() {
+		return unauthenticated()
+	}
+	if a.Is(forum.User) || a.Admin {
+		return nil
+	}
+	return domain.NewError(domain.ErrForbidden, "Only the owner of forum %s may assign moderators", forum.Slug)
+}
+
+func authorOrModerator(a Actor, author string, action string) error {
+	if !a.Authenticated() {
+		return unauthenticated()
+	}
+	if a.Is(author) || a.Moderator || a.Admin {
+		return nil
+	}
+	return domain.NewError(domain.ErrForbidden, "Only the author or a moderator may %s", action)
+}
+
+func unauthenticated() error {
+	return domain.NewError(domain.ErrUnauthorized, "Log in to do this")
+}
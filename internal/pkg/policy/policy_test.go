@@ -0,0 +1,131 @@
+package policy
+
+import (
+	"errors"
+	"testing"
+
+	"repo/internal/pkg/domain"
+)
+
+var (
+	anonymous = Actor{}
+	author    = Actor{Nickname: "Author"}
+	stranger  = Actor{Nickname: "stranger"}
+	moderator = Actor{Nickname: "mod", Moderator: true}
+	admin     = Actor{Nickname: "root", Admin: true}
+)
+
+func TestCanEditPostAndThread(t *testing.T) {
+	cases := []struct {
+		name  string
+		actor Actor
+		want  error
+	}{
+		{"anonymous", anonymous, domain.ErrUnauthorized},
+		{"author", author, nil},
+		{"author in other case", Actor{Nickname: "aUTHOR"}, nil},
+		{"stranger", stranger, domain.ErrForbidden},
+		{"moderator", moderator, nil},
+		{"admin", admin, nil},
+	}
+	for _, c := range cases {
+		post := domain.Post{Author: "author"}
+		if err := CanEditPost(c.actor, post); !matches(err, c.want) {
+			t.Errorf("post, %s: got %v, want %v", c.name, err, c.want)
+		}
+		thread := domain.Thread{Author: "author"}
+		if err := CanEditThread(c.actor, thread); !matches(err, c.want) {
+			t.Errorf("thread, %s: got %v, want %v", c.name, err, c.want)
+		}
+		if err := CanDeletePost(c.actor, post); !matches(err, c.want) {
+			t.Errorf("delete post, %s: got %v, want %v", c.name, err, c.want)
+		}
+		if err := CanDeleteThread(c.actor, thread); !matches(err, c.want) {
+			t.Errorf("delete thread, %s: got %v, want %v", c.name, err, c.want)
+		}
+	}
+}
+
+func TestCanEditProfile(t *testing.T) {
+	cases := []struct {
+		name  string
+		actor Actor
+		want  error
+	}{
+		{"anonymous", anonymous, domain.ErrUnauthorized},
+		{"owner", author, nil},
+		{"stranger", stranger, domain.ErrForbidden},
+		// roles in a forum grant nothing over profiles
+		{"moderator", moderator, domain.ErrForbidden},
+		{"admin", admin, domain.ErrForbidden},
+	}
+	for _, c := range cases {
+		if err := CanEditProfile(c.actor, "author"); !matches(err, c.want) {
+			t.Errorf("%s: got %v, want %v", c.name, err, c.want)
+		}
+	}
+}
+
+func TestModeration(t *testing.T) {
+	forum := domain.Forum{Slug: "f", User: "owner"}
+	owner := Actor{Nickname: "OWNER", Moderator: true}
+	cases := []struct {
+		name     string
+		actor    Actor
+		moderate error
+		assign   error
+	}{
+		{"anonymous", anonymous, domain.ErrUnauthorized, domain.ErrUnauthorized},
+		{"stranger", stranger, domain.ErrForbidden, domain.ErrForbidden},
+		{"moderator", moderator, nil, domain.ErrForbidden},
+		{"owner", owner, nil, nil},
+		{"admin", admin, nil, nil},
+	}
+	for _, c := range cases {
+		if err := CanModerate(c.actor); !matches(err, c.moderate) {
+			t.Errorf("moderate, %s: got %v, want %v", c.name, err, c.moderate)
+		}
+		if err := CanAssignModerators(c.actor, forum); !matches(err, c.assign) {
+			t.Errorf("assign, %s: got %v, want %v", c.name, err, c.assign)
+		}
+		// deleting a forum takes the same as assigning its moderators
+		if err := CanDeleteForum(c.actor, forum); !matches(err, c.assign) {
+			t.Errorf("delete forum, %s: got %v, want %v", c.name, err, c.assign)
+		}
+	}
+}
+
+func TestCanPurge(t *testing.T) {
+	for _, actor := range []Actor{author, moderator, {Nickname: "owner", Moderator: true}} {
+		if err := CanPurge(actor); !errors.Is(err, domain.ErrForbidden) {
+			t.Errorf("%s: got %v, want forbidden", actor.Nickname, err)
+		}
+	}
+	if err := CanPurge(anonymous); !errors.Is(err, domain.ErrUnauthorized) {
+		t.Errorf("anonymous: got %v, want unauthorized", err)
+	}
+	if err := CanPurge(admin); err != nil {
+		t.Errorf("admin: got %v", err)
+	}
+}
+
+func TestCanImport(t *testing.T) {
+	for _, actor := range []Actor{author, moderator} {
+		if err := CanImport(actor); !errors.Is(err, domain.ErrForbidden) {
+			t.Errorf("%s: got %v, want forbidden", actor.Nickname, err)
+		}
+	}
+	if err := CanImport(anonymous); !errors.Is(err, domain.ErrUnauthorized) {
+		t.Errorf("anonymous: got %v, want unauthorized", err)
+	}
+	if err := CanImport(admin); err != nil {
+		t.Errorf("admin: got %v", err)
+	}
+}
+
+func matches(err, want error) bool {
+	if want == nil {
+		return err == nil
+	}
+	return errors.Is(err, want)
+}
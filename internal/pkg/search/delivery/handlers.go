@@ -0,0 +1,95 @@
+package delivery
+
+import (
+	"fmt"
+	"github.com/fasthttp/router"
+	"github.com/valyala/fasthttp"
+	"repo/internal/pkg/cursor"
+	"repo/internal/pkg/domain"
+	"repo/internal/pkg/utils"
+	"repo/internal/pkg/validation"
+	"strings"
+)
+
+const (
+	defaultLimit = 20
+	maxLimit     = 100
+)
+
+type SearchHandler struct {
+	sr      domain.SearchRepository
+	cursors cursor.Codec
+}
+
+func NewSearchHandler(r *router.Router, sr domain.SearchRepository, t utils.Timeouts, cursors cursor.Codec) {
+	handler := SearchHandler{sr: sr, cursors: cursors}
+	route := t.Router(r)
+	route.GET("/api/search", handler.Search)
+}
+
+// Search answers /api/search?q=...&forum=&author=&type=thread|post&since=&until=&limit=&cursor=
+func (sh *SearchHandler) Search(ctx *fasthttp.RequestCtx) {
+	c := utils.Context(ctx)
+	query := domain.SearchQuery{
+		Query:  strings.TrimSpace(utils.GetQueryString(ctx, "q")),
+		Forum:  utils.GetQueryString(ctx, "forum"),
+		Author: utils.GetQueryString(ctx, "author"),
+		Kind:   utils.GetQueryString(ctx, "type"),
+		Since:  utils.GetQueryString(ctx, "since"),
+		Until:  utils.GetQueryString(ctx, "until"),
+	}
+	var errs []domain.FieldError
+	if query.Query == "" {
+		errs = append(errs, domain.FieldError{Field: "q", Message: "is required"})
+	}
+	if query.Kind != "" && query.Kind != domain.SearchThreads && query.Kind != domain.SearchPosts {
+		errs = append(errs, domain.FieldError{Field: "type", Message: "must be one of: thread post"})
+	}
+	if query.Since != "" && !validation.Format("date-time", query.Since) {
+		errs = append(errs, domain.FieldError{Field: "since", Message: "must be a valid date-time"})
+	}
+	if query.Until != "" && !validation.Format("date-time", query.Until) {
+		errs = append(errs, domain.FieldError{Field: "until", Message: "must be a valid date-time"})
+	}
+	limit, err := utils.GetQueryInt(ctx, "limit")
+	if err != nil || limit < 0 {
+		errs = append(errs, domain.FieldError{Field: "limit", Message: "must be a positive number"})
+	}
+	if len(errs) > 0 {
+		utils.Send(400, domain.ValidationResponse{Message: "validation failed", Errors: errs}, ctx)
+		return
+	}
+	switch {
+	case limit == 0:
+		limit = defaultLimit
+	case limit > maxLimit:
+		limit = maxLimit
+	}
+	query.Limit = limit
+
+	// a cursor continues exactly the search it was issued for
+	scope := fmt.Sprintf("search:%q:%q:%q:%q:%q:%q", query.Query, strings.ToLower(query.Forum),
+		strings.ToLower(query.Author), query.Kind, query.Since, query.Until)
+	var after *domain.Cursor
+	if token := utils.GetQueryString(ctx, "cursor"); token != "" {
+		key, err := sh.cursors.Decode(scope, token)
+		if err != nil {
+			utils.SendError(err, ctx)
+			return
+		}
+		after = &key
+	}
+
+	hits, err := sh.sr.Search(c, query, after)
+	if err != nil {
+		utils.SendError(err, ctx)
+		return
+	}
+	if len(hits) == limit {
+		last := hits[len(hits)-1]
+		key := domain.Cursor{Rank: last.Rank, Kind: last.Kind, Id: last.Id}
+		ctx.Response.Header.Set(cursor.Header, sh.cursors.Encode(scope, key))
+	}
+	utils.Send(200, hits, ctx)
+	return
+}
@@ -0,0 +1,126 @@
+package repository
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"repo/internal/pkg/domain"
+)
+
+// assertPlaceholders checks that every value is used and every placeholder has a value
+func assertPlaceholders(t *testing.T, sql string, args []interface{}) {
+	t.Helper()
+	for i := range args {
+		if !strings.Contains(sql, "$"+strconv.Itoa(i+1)+"") {
+			t.Errorf("parameter $%d unused in %s", i+1, sql)
+		}
+	}
+	if strings.Contains(sql, "$"+strconv.Itoa(len(args)+1)) {
+		t.Errorf("placeholder $%d has no value in %s", len(args)+1, sql)
+	}
+}
+
+func TestSearchQueryKinds(t *testing.T) {
+	cases := []struct {
+		kind           string
+		threads, posts bool
+	}{
+		{"", true, true},
+		{domain.SearchThreads, true, false},
+		{domain.SearchPosts, false, true},
+	}
+	for _, c := range cases {
+		sql, args := searchQuery(domain.SearchQuery{Query: "tea", Kind: c.kind}, nil)
+		if got := strings.Contains(sql, "FROM Threads AS t"); got != c.threads {
+			t.Errorf("kind %q searches threads: %v", c.kind, got)
+		}
+		if got := strings.Contains(sql, "FROM Posts AS p"); got != c.posts {
+			t.Errorf("kind %q searches posts: %v", c.kind, got)
+		}
+		if got := strings.Contains(sql, "UNION ALL"); got != (c.threads && c.posts) {
+			t.Errorf("kind %q has a UNION: %v", c.kind, got)
+		}
+		if !reflect.DeepEqual(args, []interface{}{"tea"}) {
+			t.Errorf("kind %q binds %v", c.kind, args)
+		}
+		assertPlaceholders(t, sql, args)
+	}
+}
+
+func TestSearchQueryFilters(t *testing.T) {
+	query := domain.SearchQuery{Query: "tea", Forum: "wonderland", Author: "alice",
+		Since: "2021-01-01T00:00:00Z", Until: "2021-12-31T00:00:00Z", Limit: 20}
+	sql, args := searchQuery(query, nil)
+	// every filter is bound once, even though both sides of the UNION apply it
+	want := []interface{}{"tea", "wonderland", "alice", "2021-01-01T00:00:00Z", "2021-12-31T00:00:00Z", 20}
+	if !reflect.DeepEqual(args, want) {
+		t.Errorf("args %v, want %v", args, want)
+	}
+	assertPlaceholders(t, sql, args)
+	for _, cond := range []string{
+		"t.Forum = $2::citext", "p.Forum = $2::citext",
+		"t.Author = $3::citext", "p.Author = $3::citext",
+		"t.Created >= $4::timestamptz", "p.Created >= $4::timestamptz",
+		"t.Created <= $5::timestamptz", "p.Created <= $5::timestamptz",
+		"LIMIT $6",
+	} {
+		if !strings.Contains(sql, cond) {
+			t.Errorf("missing %q in %s", cond, sql)
+		}
+	}
+
+	// filters left out are not applied
+	sql, args = searchQuery(domain.SearchQuery{Query: "tea", Author: "alice"}, nil)
+	if strings.Contains(sql, "Forum =") || strings.Contains(sql, "Created >=") || strings.Contains(sql, "LIMIT") {
+		t.Errorf("unset filters applied: %s", sql)
+	}
+	if !reflect.DeepEqual(args, []interface{}{"tea", "alice"}) {
+		t.Errorf("args %v", args)
+	}
+}
+
+func TestSearchQueryKeyset(t *testing.T) {
+	after := &domain.Cursor{Rank: 0.5, Kind: "post", Id: 42}
+	sql, args := searchQuery(domain.SearchQuery{Query: "tea", Forum: "go", Limit: 10}, after)
+	want := []interface{}{"tea", "go", float32(0.5), "post", int64(42), 10}
+	if !reflect.DeepEqual(args, want) {
+		t.Errorf("args %v, want %v", args, want)
+	}
+	assertPlaceholders(t, sql, args)
+	keyset := "WHERE (rank, kind, id) < ($3::real, $4::text, $5::bigint) ORDER BY rank DESC, kind DESC, id DESC LIMIT $6"
+	if !strings.Contains(sql, keyset) {
+		t.Errorf("missing the keyset condition %q in %s", keyset, sql)
+	}
+	if first, _ := searchQuery(domain.SearchQuery{Query: "tea"}, nil); strings.Contains(first, "(rank, kind, id) <") {
+		t.Errorf("the first page has a keyset condition: %s", first)
+	}
+}
+
+func TestSearchQueryBindsValues(t *testing.T) {
+	hostile := "x'; DROP TABLE users; --"
+	build := func(v string) (string, []interface{}) {
+		return searchQuery(domain.SearchQuery{Query: v, Forum: v, Author: v, Since: v, Until: v}, &domain.Cursor{Kind: v})
+	}
+	want, _ := build("benign")
+	sql, args := build(hostile)
+	if sql != want {
+		t.Errorf("SQL depends on the values:\n got %s\nwant %s", sql, want)
+	}
+	assertPlaceholders(t, sql, args)
+}
+
+func TestSearchQueryEscapesSnippets(t *testing.T) {
+	sql, _ := searchQuery(domain.SearchQuery{Query: "tea"}, nil)
+	// & first, so that the entities of the other replacements are kept
+	escaped := `ts_headline('english', replace(replace(replace(replace(replace(h.body, '&', '&amp;'), '<', '&lt;'), '>', '&gt;'), '"', '&quot;'), '''', '&#39;'), q.query`
+	if !strings.Contains(sql, escaped) {
+		t.Errorf("missing the escaped headline %q in %s", escaped, sql)
+	}
+	for _, body := range []string{"COALESCE(t.Message, '') AS body", "COALESCE(p.Message, '')"} {
+		if !strings.Contains(sql, body) {
+			t.Errorf("missing %q in %s", body, sql)
+		}
+	}
+}
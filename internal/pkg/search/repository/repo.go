@@ -0,0 +1,121 @@
+package repository
+
+import (
+	"context"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"repo/internal/pkg/domain"
+	"repo/internal/pkg/metrics"
+	"strconv"
+	"strings"
+)
+
+// Both sides of a search are ranked and highlighted with the configuration the
+// triggers of the search migration build the vectors with.
+const (
+	tsConfig = "'english'"
+	headline = "'StartSel=<b>, StopSel=</b>, MaxFragments=2, MaxWords=30, MinWords=10'"
+)
+
+// escapeHTML is the SQL expression escaping the markup of the text expr, the
+// snippet is HTML once ts_headline wraps the matches in <b>
+func escapeHTML(expr string) string {
+	for _, r := range [][2]string{{"&", "&amp;"}, {"<", "&lt;"}, {">", "&gt;"}, {`"`, "&quot;"}, {"'", "&#39;"}} {
+		expr = "replace(" + expr + ", '" + strings.ReplaceAll(r[0], "'", "''") + "', '" + r[1] + "')"
+	}
+	return expr
+}
+
+type SearchRepository struct {
+	dbm *pgxpool.Pool
+}
+
+func NewSearchRep(pool *pgxpool.Pool) SearchRepository {
+	return SearchRepository{dbm: pool}
+}
+
+func (s *SearchRepository) Search(ctx context.Context, query domain.SearchQuery, after *domain.Cursor) ([]domain.SearchHit, error) {
+	defer metrics.Query("search", "Search")()
+	sql, args := searchQuery(query, after)
+	rows, err := s.dbm.Query(ctx, sql, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	hits := make([]domain.SearchHit, 0)
+	for rows.Next() {
+		var hit domain.SearchHit
+		err = rows.Scan(&hit.Kind, &hit.Id, &hit.Thread, &hit.Forum, &hit.Author, &hit.Title, &hit.Snippet, &hit.Rank, &hit.Created)
+		if err != nil {
+			return nil, err
+		}
+		hits = append(hits, hit)
+	}
+	return hits, rows.Err()
+}
+
+// params numbers the values of a query in the order they are bound
+type params []interface{}
+
+func (p *params) bind(v interface{}) string {
+	*p = append(*p, v)
+	return "$" + strconv.Itoa(len(*p))
+}
+
+// searchQuery ranks matching threads and posts together, best first. Snippets are
+// only highlighted for the rows of the page as ts_headline reparses the text.
+func searchQuery(query domain.SearchQuery, after *domain.Cursor) (string, []interface{}) {
+	var args params
+	tsq := "websearch_to_tsquery(" + tsConfig + ", " + args.bind(query.Query) + ")"
+
+	// each filter value is bound once, both sides of the UNION share its placeholder
+	var conds []string
+	if query.Forum != "" {
+		conds = append(conds, "Forum = "+args.bind(query.Forum)+"::citext")
+	}
+	if query.Author != "" {
+		conds = append(conds, "Author = "+args.bind(query.Author)+"::citext")
+	}
+	if query.Since != "" {
+		conds = append(conds, "Created >= "+args.bind(query.Since)+"::timestamptz")
+	}
+	if query.Until != "" {
+		conds = append(conds, "Created <= "+args.bind(query.Until)+"::timestamptz")
+	}
+	filters := func(alias string) string {
+		where := []string{alias + ".Search @@ q.query"}
+		for _, cond := range conds {
+			where = append(where, alias+"."+cond)
+		}
+		return strings.Join(where, " AND ")
+	}
+
+	var parts []string
+	if query.Kind != domain.SearchPosts {
+		parts = append(parts, "SELECT 'thread' AS kind, t.Id AS id, t.Id AS thread, t.Forum AS forum, t.Author AS author,"+
+			" t.Title AS title, COALESCE(t.Message, '') AS body, ts_rank(t.Search, q.query) AS rank, t.Created AS created"+
+			" FROM Threads AS t, q WHERE NOT t.IsDeleted AND "+filters("t"))
+	}
+	if query.Kind != domain.SearchThreads {
+		parts = append(parts, "SELECT 'post', p.Id, p.Thread, p.Forum, p.Author,"+
+			" '', COALESCE(p.Message, ''), ts_rank(p.Search, q.query), p.Created"+
+			" FROM Posts AS p, q WHERE NOT p.IsHidden AND NOT p.IsDeleted AND "+filters("p")+
+			" AND NOT EXISTS (SELECT 1 FROM Threads WHERE Id = p.Thread AND IsDeleted)")
+	}
+
+	var b strings.Builder
+	b.WriteString("WITH q AS (SELECT " + tsq + " AS query) ")
+	b.WriteString("SELECT h.kind, h.id, h.thread, h.forum, h.author, h.title, ")
+	b.WriteString("ts_headline(" + tsConfig + ", " + escapeHTML("h.body") + ", q.query, " + headline + "), h.rank, h.created FROM (")
+	b.WriteString("SELECT * FROM (" + strings.Join(parts, " UNION ALL ") + ") AS hits")
+	if after != nil {
+		b.WriteString(" WHERE (rank, kind, id) < (" + args.bind(after.Rank) + "::real, " +
+			args.bind(after.Kind) + "::text, " + args.bind(after.Id) + "::bigint)")
+	}
+	b.WriteString(" ORDER BY rank DESC, kind DESC, id DESC")
+	if query.Limit > 0 {
+		b.WriteString(" LIMIT " + args.bind(query.Limit))
+	}
+	b.WriteString(") AS h, q ORDER BY h.rank DESC, h.kind DESC, h.id DESC")
+	return b.String(), args
+}
@@ -0,0 +1,54 @@
+//go:build integration
+
+package repository
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+
+	"repo/internal/pkg/domain"
+	"repo/internal/pkg/testdb"
+)
+
+var db *testdb.Cluster
+
+func TestMain(m *testing.M) {
+	os.Exit(testdb.Main(m, &db))
+}
+
+var ctx = context.Background()
+
+func TestSearchSnippets(t *testing.T) {
+	db.Reset(t)
+	for _, stmt := range []string{
+		"INSERT INTO users (Nickname, FullName, Email) VALUES ('alice', 'Alice', 'alice@example.com')",
+		"INSERT INTO Forum (Title, Usr, Slug) VALUES ('Go', 'alice', 'go')",
+		// a thread without a message still has its title to match
+		"INSERT INTO Threads (Id, Title, Forum, Author, Message) VALUES (1, 'tea party', 'go', 'alice', NULL)",
+		`INSERT INTO Posts (Author, Message, Forum, Thread) VALUES ('alice', '<script>alert("tea")</script> & more tea', 'go', 1)`,
+	} {
+		if _, err := db.Pool.Exec(ctx, stmt); err != nil {
+			t.Fatal(err)
+		}
+	}
+	sr := NewSearchRep(db.Pool)
+	hits, err := sr.Search(ctx, domain.SearchQuery{Query: "tea", Limit: 10}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	snippets := map[string]string{}
+	for _, hit := range hits {
+		snippets[hit.Kind] = hit.Snippet
+	}
+	if snippet, ok := snippets["thread"]; !ok || snippet != "" {
+		t.Errorf("thread snippet %q (found %v), want an empty one", snippet, ok)
+	}
+	// the only markup left is the highlighting
+	post := snippets["post"]
+	text := strings.NewReplacer("<b>", "", "</b>", "").Replace(post)
+	if !strings.Contains(post, "<b>tea</b>") || strings.ContainsAny(text, `<>"`) || !strings.Contains(text, "&lt;script&gt;") {
+		t.Errorf("post snippet %q is not escaped", post)
+	}
+}
@@ -0,0 +1,8 @@
+// Package testdb runs a throwaway PostgreSQL server for the integration tests,
+// which are built with the integration tag:
+//
+//	go test -tags integration ./...
+//
+// The server binaries are taken from $PG_BIN, the PATH or /usr/lib/postgresql,
+// and initdb refuses to run as root.
+package testdb
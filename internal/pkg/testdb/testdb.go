@@ -0,0 +1,136 @@
+//go:build integration
+
+package testdb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v4/pgxpool"
+	"repo/internal/pkg/migrate"
+)
+
+// ErrNoServer is returned by Start when no PostgreSQL binaries are installed.
+var ErrNoServer = errors.New("testdb: initdb not found, set PG_BIN to the PostgreSQL bin directory")
+
+// Cluster is a PostgreSQL server in a temporary directory, listening on a unix
+// socket only, with every migration applied.
+type Cluster struct {
+	Pool *pgxpool.Pool
+	dir  string
+	bin  string
+}
+
+func Start(ctx context.Context) (*Cluster, error) {
+	bin, err := binDir()
+	if err != nil {
+		return nil, err
+	}
+	dir, err := ioutil.TempDir("", "forum-pg-")
+	if err != nil {
+		return nil, err
+	}
+	c := &Cluster{dir: dir, bin: bin}
+	data := filepath.Join(dir, "data")
+	if err = c.run("initdb", "-D", data, "-U", "postgres", "-A", "trust", "-E", "UTF8", "--no-sync"); err != nil {
+		os.RemoveAll(dir)
+		return nil, err
+	}
+	// durability is pointless for a server that is thrown away
+	opts := fmt.Sprintf("-k %s -c listen_addresses='' -c fsync=off -c synchronous_commit=off -c full_page_writes=off", dir)
+	if err = c.run("pg_ctl", "-D", data, "-l", filepath.Join(dir, "server.log"), "-o", opts, "-w", "start"); err != nil {
+		os.RemoveAll(dir)
+		return nil, err
+	}
+	c.Pool, err = pgxpool.Connect(ctx, fmt.Sprintf("host=%s user=postgres dbname=postgres pool_max_conns=8", dir))
+	if err == nil {
+		err = migrate.NewRunner(c.Pool).Up(ctx)
+	}
+	if err != nil {
+		c.Stop()
+		return nil, err
+	}
+	return c, nil
+}
+
+// Stop shuts the server down and removes its directory.
+func (c *Cluster) Stop() {
+	if c.Pool != nil {
+		c.Pool.Close()
+	}
+	c.run("pg_ctl", "-D", filepath.Join(c.dir, "data"), "-m", "immediate", "-w", "stop")
+	os.RemoveAll(c.dir)
+}
+
+// Reset empties every table between tests.
+func (c *Cluster) Reset(t *testing.T) {
+	t.Helper()
+	_, err := c.Pool.Exec(context.Background(), "TRUNCATE Users, Forum, Threads, Posts, Votes, forumUsers CASCADE")
+	if err != nil {
+		t.Fatalf("resetting the database: %v", err)
+	}
+}
+
+func (c *Cluster) run(name string, args ...string) error {
+	out, err := exec.Command(filepath.Join(c.bin, name), args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("testdb: %s: %w\n%s", name, err, out)
+	}
+	return nil
+}
+
+// Main starts a cluster for the tests of a package, it is meant for TestMain:
+//
+//	func TestMain(m *testing.M) { os.Exit(testdb.Main(m, &db)) }
+//
+// Without PostgreSQL binaries the tests are skipped.
+func Main(m *testing.M, cluster **Cluster) int {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	c, err := Start(ctx)
+	cancel()
+	if errors.Is(err, ErrNoServer) {
+		fmt.Fprintln(os.Stderr, "skipping integration tests:", err)
+		return 0
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer c.Stop()
+	*cluster = c
+	return m.Run()
+}
+
+func binDir() (string, error) {
+	if dir := os.Getenv("PG_BIN"); dir != "" {
+		return dir, nil
+	}
+	if path, err := exec.LookPath("initdb"); err == nil {
+		return filepath.Dir(path), nil
+	}
+	// Debian and Ubuntu keep the server binaries off the PATH, take the newest version
+	dirs, _ := filepath.Glob("/usr/lib/postgresql/*/bin")
+	sort.Slice(dirs, func(i, j int) bool {
+		return versionOf(dirs[i]) < versionOf(dirs[j])
+	})
+	for i := len(dirs) - 1; i >= 0; i-- {
+		if _, err := os.Stat(filepath.Join(dirs[i], "initdb")); err == nil {
+			return dirs[i], nil
+		}
+	}
+	return "", ErrNoServer
+}
+
+func versionOf(binDir string) int {
+	var v int
+	fmt.Sscanf(filepath.Base(filepath.Dir(binDir)), "%d", &v)
+	return v
+}
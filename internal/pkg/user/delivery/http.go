@@ -1,31 +1,30 @@
 package delivery
 
 import (
-	"encoding/json"
 	"errors"
-	"fmt"
 	"github.com/fasthttp/router"
-	"github.com/jackc/pgconn"
 	"github.com/valyala/fasthttp"
+	"repo/internal/pkg/auth"
 	"repo/internal/pkg/domain"
+	"repo/internal/pkg/policy"
 	"repo/internal/pkg/utils"
 )
-var (
-	UniqueViolation              = "23505"
-)
 
 type UserHandler struct {
-	ur domain.UserRepository
+	ur    domain.UserRepository
+	authz auth.Authorizer
 }
 
-func NewUserHandler(r *router.Router, ur domain.UserRepository) {
-	handler := UserHandler{ur: ur}
-	r.POST("/api/user/{nickname}/create", handler.Add)
-	r.GET("/api/user/{nickname}/profile", handler.Get)
-	r.POST("/api/user/{nickname}/profile", handler.Update)
+func NewUserHandler(r *router.Router, ur domain.UserRepository, t utils.Timeouts, authz auth.Authorizer) {
+	handler := UserHandler{ur: ur, authz: authz}
+	route := t.Router(r)
+	route.POST("/api/user/{nickname}/create", handler.Add)
+	route.GET("/api/user/{nickname}/profile", handler.Get)
+	route.POST("/api/user/{nickname}/profile", handler.Update)
 }
 
 func (uh *UserHandler) Add (ctx *fasthttp.RequestCtx) {
+	c := utils.Context(ctx)
 	nickname, ok := ctx.UserValue("nickname").(string)
 	if !ok {
 		utils.Send(400, "bad request", ctx)
@@ -33,37 +32,40 @@ func (uh *UserHandler) Add (ctx *fasthttp.RequestCtx) {
 	}
 
 	newUser := domain.User{Nickname: nickname}
-	err := json.Unmarshal(ctx.PostBody(), &newUser)
-	if err != nil {
-		utils.Send(500, "SE"+err.Error(), ctx)
+	if !utils.ParseBody(ctx, &newUser) {
+		return
 	}
 
-	err = uh.ur.AddUser(newUser)
-	if err != nil {
-		users, err := uh.ur.GetUserByNickOrEmail(newUser.Nickname, newUser.Email)
+	err := uh.ur.AddUser(c, newUser)
+	if errors.Is(err, domain.ErrConflict) {
+		users, err := uh.ur.GetUserByNickOrEmail(c, newUser.Nickname, newUser.Email)
 		if err != nil {
-			utils.Send(500, "SE"+err.Error(), ctx)
+			utils.SendError(err, ctx)
 			return
 		}
 		utils.Send(409, users, ctx)
 		return
 	}
+	if err != nil {
+		utils.SendError(err, ctx)
+		return
+	}
 	utils.Send(201, newUser, ctx)
 	return
 }
 
 
 func (uh *UserHandler) Get (ctx *fasthttp.RequestCtx) {
+	c := utils.Context(ctx)
 	nickname, ok := ctx.UserValue("nickname").(string)
 	if !ok {
 		utils.Send(400, "bad request", ctx)
 		return
 	}
 
-	users, err := uh.ur.GetUser(nickname)
-	if err != nil || len(users) == 0 {
-		resp := domain.Response{Message: fmt.Sprintf("Can't find user by id %s", nickname)}
-		utils.Send(404, resp, ctx)
+	users, err := uh.ur.GetUser(c, nickname)
+	if err != nil {
+		utils.SendError(err, ctx)
 		return
 	}
 	utils.Send(200, users[0], ctx)
@@ -71,30 +73,28 @@ func (uh *UserHandler) Get (ctx *fasthttp.RequestCtx) {
 }
 
 func (uh *UserHandler) Update (ctx *fasthttp.RequestCtx) {
+	c := utils.Context(ctx)
 	nickname, ok := ctx.UserValue("nickname").(string)
 	if !ok {
 		utils.Send(400, "bad request", ctx)
 		return
 	}
-	newUser := domain.User{Nickname: nickname}
-	err := json.Unmarshal(ctx.PostBody(), &newUser)
+	err := uh.authz.Authorize(ctx, "", func(a policy.Actor) error {
+		return policy.CanEditProfile(a, nickname)
+	})
 	if err != nil {
-		utils.Send(500, "SE"+err.Error(), ctx)
+		utils.SendError(err, ctx)
+		return
+	}
+	newUser := domain.User{Nickname: nickname}
+	if !utils.ParseBodyPartial(ctx, &newUser) {
+		return
 	}
 
-	us, err := uh.ur.UpdateUser(newUser)
+	us, err := uh.ur.UpdateUser(c, newUser)
 
 	if err != nil {
-		var pgErr *pgconn.PgError
-		if errors.As(err, &pgErr) {
-			if pgErr.Code == UniqueViolation {
-				resp := domain.Response{Message: fmt.Sprintf("already in use by %s", nickname)}
-				utils.Send(409, resp, ctx)
-				return
-			}
-		}
-		resp := domain.Response{Message: fmt.Sprintf("Can't find user by id %s", nickname)}
-		utils.Send(404, resp, ctx)
+		utils.SendError(err, ctx)
 		return
 	}
 	utils.Send(200, us, ctx)
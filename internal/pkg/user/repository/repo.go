@@ -2,8 +2,12 @@ package repository
 
 import (
 	"context"
+	"errors"
+	"github.com/jackc/pgx/v4"
 	"github.com/jackc/pgx/v4/pgxpool"
 	"repo/internal/pkg/domain"
+	"repo/internal/pkg/metrics"
+	"repo/internal/pkg/utils"
 )
 
 
@@ -15,17 +19,22 @@ func NewUserRep (pool *pgxpool.Pool) UserRepository {
 	return UserRepository{dbm: pool}
 }
 
-func (ur *UserRepository) AddUser(user domain.User) error {
+func (ur *UserRepository) AddUser(ctx context.Context, user domain.User) error {
+	defer metrics.Query("user", "AddUser")()
 	query := "INSERT INTO users (nickname, fullname, about, email) VALUES ($1, $2, $3, $4)"
-	_, err := ur.dbm.Exec(context.Background(), query, user.Nickname, user.FullName, user.About, user.Email)
+	_, err := ur.dbm.Exec(ctx, query, user.Nickname, user.FullName, user.About, user.Email)
+	if pgErr := utils.PgError(err); pgErr != nil && pgErr.Code == utils.UniqueViolation {
+		return domain.NewError(domain.ErrConflict, "User with nickname %s or email %s already exists", user.Nickname, user.Email)
+	}
 	return err
 }
 
-func (ur *UserRepository) GetUserByNickOrEmail(nickname string, email string) ([]domain.User, error) {
+func (ur *UserRepository) GetUserByNickOrEmail(ctx context.Context, nickname string, email string) ([]domain.User, error) {
+	defer metrics.Query("user", "GetUserByNickOrEmail")()
 	query := `SELECT * FROM users WHERE LOWER(Nickname)=LOWER($1) OR Email=$2`
 
 	var rows []domain.User
-	row, err := ur.dbm.Query(context.Background(), query, nickname, email)
+	row, err := ur.dbm.Query(ctx, query, nickname, email)
 	if err != nil {
 		return nil, err
 	}
@@ -42,11 +51,12 @@ func (ur *UserRepository) GetUserByNickOrEmail(nickname string, email string) ([
 	return rows, err
 }
 
-func (ur *UserRepository) GetUser(nickname string) ([]domain.User, error) {
+func (ur *UserRepository) GetUser(ctx context.Context, nickname string) ([]domain.User, error) {
+	defer metrics.Query("user", "GetUser")()
 	query := `SELECT * FROM users WHERE LOWER(Nickname)=LOWER($1)`
 
 	var rows []domain.User
-	row, err := ur.dbm.Query(context.Background(), query, nickname)
+	row, err := ur.dbm.Query(ctx, query, nickname)
 	if err != nil {
 		return nil, err
 	}
@@ -60,14 +70,27 @@ func (ur *UserRepository) GetUser(nickname string) ([]domain.User, error) {
 		}
 		rows = append(rows, user)
 	}
-	return rows, err
+	if err = row.Err(); err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, domain.NewError(domain.ErrNotFound, "Can't find user by nickname: %s", nickname)
+	}
+	return rows, nil
 }
 
-func (ur *UserRepository) UpdateUser(user domain.User) (domain.User, error) {
+func (ur *UserRepository) UpdateUser(ctx context.Context, user domain.User) (domain.User, error) {
+	defer metrics.Query("user", "UpdateUser")()
 	query := "UPDATE users SET FullName = COALESCE(NULLIF($1, ''), FullName), About = COALESCE(NULLIF($2, ''), About), Email = COALESCE(NULLIF($3, ''), Email) WHERE LOWER(nickname) = LOWER($4) RETURNING *"
-	row:= ur.dbm.QueryRow(context.Background(), query, user.FullName, user.About, user.Email, user.Nickname)
+	row:= ur.dbm.QueryRow(ctx, query, user.FullName, user.About, user.Email, user.Nickname)
 	us:= domain.User{Nickname: user.Nickname}
 	err := row.Scan(&us.Nickname, &us.FullName, &us.About, &us.Email)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return domain.User{}, domain.NewError(domain.ErrNotFound, "Can't find user by nickname: %s", user.Nickname)
+	}
+	if pgErr := utils.PgError(err); pgErr != nil && pgErr.Code == utils.UniqueViolation {
+		return domain.User{}, domain.NewError(domain.ErrConflict, "Email %s is already in use", user.Email)
+	}
 	if err != nil {
 		return domain.User{}, err
 	}
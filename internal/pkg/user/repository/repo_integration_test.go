@@ -0,0 +1,70 @@
+//go:build integration
+
+package repository
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+
+	"repo/internal/pkg/domain"
+	"repo/internal/pkg/testdb"
+)
+
+var db *testdb.Cluster
+
+func TestMain(m *testing.M) {
+	os.Exit(testdb.Main(m, &db))
+}
+
+func TestUserRepository(t *testing.T) {
+	db.Reset(t)
+	ctx := context.Background()
+	ur := NewUserRep(db.Pool)
+
+	alice := domain.User{Nickname: "Alice", FullName: "Alice A", About: "first", Email: "alice@example.com"}
+	if err := ur.AddUser(ctx, alice); err != nil {
+		t.Fatal(err)
+	}
+	bob := domain.User{Nickname: "bob", FullName: "Bob B", Email: "bob@example.com"}
+	if err := ur.AddUser(ctx, bob); err != nil {
+		t.Fatal(err)
+	}
+
+	// nicknames and emails are case insensitive
+	for _, dup := range []domain.User{
+		{Nickname: "ALICE", FullName: "x", Email: "other@example.com"},
+		{Nickname: "carol", FullName: "x", Email: "BOB@example.com"},
+	} {
+		if err := ur.AddUser(ctx, dup); !errors.Is(err, domain.ErrConflict) {
+			t.Errorf("AddUser(%s, %s) = %v, want a conflict", dup.Nickname, dup.Email, err)
+		}
+	}
+	conflicting, err := ur.GetUserByNickOrEmail(ctx, "alice", "bob@example.com")
+	if err != nil || len(conflicting) != 2 {
+		t.Errorf("GetUserByNickOrEmail = %v, %v, want alice and bob", conflicting, err)
+	}
+
+	got, err := ur.GetUser(ctx, "aLiCe")
+	if err != nil || len(got) != 1 || got[0] != alice {
+		t.Errorf("GetUser = %v, %v, want %v", got, err, alice)
+	}
+	if _, err = ur.GetUser(ctx, "nobody"); !errors.Is(err, domain.ErrNotFound) {
+		t.Errorf("GetUser of a missing user = %v", err)
+	}
+
+	// empty fields are kept
+	updated, err := ur.UpdateUser(ctx, domain.User{Nickname: "alice", About: "second"})
+	want := alice
+	want.About = "second"
+	if err != nil || updated != want {
+		t.Errorf("UpdateUser = %v, %v, want %v", updated, err, want)
+	}
+	if _, err = ur.UpdateUser(ctx, domain.User{Nickname: "alice", Email: "bob@example.com"}); !errors.Is(err, domain.ErrConflict) {
+		t.Errorf("UpdateUser to a taken email = %v", err)
+	}
+	if _, err = ur.UpdateUser(ctx, domain.User{Nickname: "nobody", About: "x"}); !errors.Is(err, domain.ErrNotFound) {
+		t.Errorf("UpdateUser of a missing user = %v", err)
+	}
+}
@@ -0,0 +1,83 @@
+package utils
+
+import (
+	"context"
+	"time"
+
+	"github.com/fasthttp/router"
+	"github.com/valyala/fasthttp"
+	"repo/internal/pkg/logging"
+)
+
+const requestContextKey = "requestContext"
+
+// Timeouts holds the deadline given to repository calls of each route.
+// Routes are keyed by the registered path pattern, e.g. "/api/thread/{slug_or_id}/create".
+// Base is the parent of every request context, context.Background when nil.
+type Timeouts struct {
+	Base    context.Context
+	Default time.Duration
+	Routes  map[string]time.Duration
+}
+
+func (t Timeouts) For(path string) time.Duration {
+	if d, ok := t.Routes[path]; ok {
+		return d
+	}
+	return t.Default
+}
+
+// TimeoutRouter registers handlers on a router, attaching the route's deadline to every request.
+type TimeoutRouter struct {
+	r *router.Router
+	t Timeouts
+}
+
+func (t Timeouts) Router(r *router.Router) TimeoutRouter {
+	return TimeoutRouter{r: r, t: t}
+}
+
+func (tr TimeoutRouter) GET(path string, handler fasthttp.RequestHandler) {
+	tr.r.GET(path, WithTimeout(tr.t.Base, tr.t.For(path), handler))
+}
+
+func (tr TimeoutRouter) POST(path string, handler fasthttp.RequestHandler) {
+	tr.r.POST(path, WithTimeout(tr.t.Base, tr.t.For(path), handler))
+}
+
+func (tr TimeoutRouter) DELETE(path string, handler fasthttp.RequestHandler) {
+	tr.r.DELETE(path, WithTimeout(tr.t.Base, tr.t.For(path), handler))
+}
+
+// WithTimeout derives the request context used by repositories, carrying the
+// request logger for zerolog.Ctx.
+// It does not inherit from the fasthttp.RequestCtx, whose Done channel closes
+// on server shutdown, but from parent so that draining requests are allowed
+// to finish and only cancelled once the drain deadline passes. It is also
+// cancelled when the client disconnects before the answer.
+func WithTimeout(parent context.Context, timeout time.Duration, next fasthttp.RequestHandler) fasthttp.RequestHandler {
+	if parent == nil {
+		parent = context.Background()
+	}
+	return func(ctx *fasthttp.RequestCtx) {
+		c := logging.FromRequest(ctx).WithContext(parent)
+		var cancel context.CancelFunc
+		if timeout > 0 {
+			c, cancel = context.WithTimeout(c, timeout)
+		} else {
+			c, cancel = context.WithCancel(c)
+		}
+		defer cancel()
+		defer watchDisconnect(ctx.Conn(), cancel)()
+		ctx.SetUserValue(requestContextKey, c)
+		next(ctx)
+	}
+}
+
+// Context returns the request context set by WithTimeout, or context.Background.
+func Context(ctx *fasthttp.RequestCtx) context.Context {
+	if c, ok := ctx.UserValue(requestContextKey).(context.Context); ok {
+		return c
+	}
+	return context.Background()
+}
@@ -0,0 +1,89 @@
+package utils
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/fasthttp/router"
+	"github.com/valyala/fasthttp"
+)
+
+// serve runs one request through r and returns its context as the handler saw it
+func serve(r *router.Router, method, path string) *fasthttp.RequestCtx {
+	var ctx fasthttp.RequestCtx
+	ctx.Request.Header.SetMethod(method)
+	ctx.Request.SetRequestURI(path)
+	r.Handler(&ctx)
+	return &ctx
+}
+
+func TestRouteTimeouts(t *testing.T) {
+	timeouts := Timeouts{
+		Default: time.Minute,
+		Routes:  map[string]time.Duration{"/api/thread/{slug_or_id}/create": time.Hour},
+	}
+	cases := []struct {
+		method, route, path string
+		want                time.Duration
+	}{
+		{fasthttp.MethodPost, "/api/thread/{slug_or_id}/create", "/api/thread/42/create", time.Hour},
+		{fasthttp.MethodGet, "/api/thread/{slug_or_id}/details", "/api/thread/42/details", time.Minute},
+		{fasthttp.MethodDelete, "/api/forum/{slug}", "/api/forum/go", time.Minute},
+	}
+	for _, c := range cases {
+		r := router.New()
+		route := timeouts.Router(r)
+		var deadline time.Time
+		var ok bool
+		handler := func(ctx *fasthttp.RequestCtx) {
+			deadline, ok = Context(ctx).Deadline()
+		}
+		switch c.method {
+		case fasthttp.MethodGet:
+			route.GET(c.route, handler)
+		case fasthttp.MethodPost:
+			route.POST(c.route, handler)
+		case fasthttp.MethodDelete:
+			route.DELETE(c.route, handler)
+		}
+		start := time.Now()
+		serve(r, c.method, c.path)
+		if !ok {
+			t.Errorf("%s %s: no deadline", c.method, c.path)
+			continue
+		}
+		if got := deadline.Sub(start); got < c.want || got > c.want+time.Second {
+			t.Errorf("%s %s: deadline in %s, want %s", c.method, c.path, got, c.want)
+		}
+	}
+}
+
+func TestNoTimeout(t *testing.T) {
+	r := router.New()
+	var ok bool
+	Timeouts{}.Router(r).GET("/", func(ctx *fasthttp.RequestCtx) {
+		_, ok = Context(ctx).Deadline()
+	})
+	serve(r, fasthttp.MethodGet, "/")
+	if ok {
+		t.Error("a zero timeout set a deadline")
+	}
+	if Context(&fasthttp.RequestCtx{}) != context.Background() {
+		t.Error("Context outside WithTimeout is not context.Background")
+	}
+}
+
+func TestBaseCancels(t *testing.T) {
+	base, cancel := context.WithCancel(context.Background())
+	cancel()
+	r := router.New()
+	var err error
+	Timeouts{Base: base, Default: time.Minute}.Router(r).GET("/", func(ctx *fasthttp.RequestCtx) {
+		err = Context(ctx).Err()
+	})
+	serve(r, fasthttp.MethodGet, "/")
+	if err != context.Canceled {
+		t.Errorf("request context error %v, want context.Canceled", err)
+	}
+}
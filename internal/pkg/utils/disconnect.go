@@ -0,0 +1,52 @@
+//go:build linux || darwin
+// +build linux darwin
+
+package utils
+
+import (
+	"context"
+	"net"
+	"syscall"
+	"time"
+)
+
+// watchDisconnect calls cancel when the client closes conn while the handler
+// runs. fasthttp does not read the connection again before the handler
+// returns, so the socket is peeked at without consuming anything: end of
+// stream or an error means the client is gone, pending bytes are a pipelined
+// request and end the watch. Connections without a file descriptor (TLS,
+// in-memory) are not watched. stop ends the watch and clears the read deadline
+// it uses to do so.
+func watchDisconnect(conn net.Conn, cancel context.CancelFunc) (stop func()) {
+	sc, ok := conn.(syscall.Conn)
+	if !ok {
+		return func() {}
+	}
+	raw, err := sc.SyscallConn()
+	if err != nil {
+		return func() {}
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		var buf [1]byte
+		gone := false
+		// Read waits for the socket to be readable every time the callback returns false
+		err := raw.Read(func(fd uintptr) bool {
+			n, _, err := syscall.Recvfrom(int(fd), buf[:], syscall.MSG_PEEK|syscall.MSG_DONTWAIT)
+			if err == syscall.EAGAIN || err == syscall.EINTR {
+				return false
+			}
+			gone = err != nil || n == 0
+			return true
+		})
+		if err == nil && gone {
+			cancel()
+		}
+	}()
+	return func() {
+		conn.SetReadDeadline(time.Now())
+		<-done
+		conn.SetReadDeadline(time.Time{})
+	}
+}
@@ -0,0 +1,15 @@
+//go:build !linux && !darwin
+// +build !linux,!darwin
+
+package utils
+
+import (
+	"context"
+	"net"
+)
+
+// watchDisconnect does not notice client disconnects on this platform, the
+// request context only ends with its deadline or the server.
+func watchDisconnect(conn net.Conn, cancel context.CancelFunc) (stop func()) {
+	return func() {}
+}
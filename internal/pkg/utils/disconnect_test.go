@@ -0,0 +1,91 @@
+//go:build linux || darwin
+// +build linux darwin
+
+package utils
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fasthttp/router"
+	"github.com/valyala/fasthttp"
+)
+
+const request = "GET / HTTP/1.1\r\nHost: forum\r\n\r\n"
+
+// listen serves handler on a TCP port of the loopback and returns its address
+func listen(t *testing.T, handler fasthttp.RequestHandler) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := router.New()
+	Timeouts{Default: time.Minute}.Router(r).GET("/", handler)
+	srv := &fasthttp.Server{Handler: r.Handler}
+	go srv.Serve(ln)
+	t.Cleanup(func() { srv.Shutdown() })
+	return ln.Addr().String()
+}
+
+func TestDisconnectCancels(t *testing.T) {
+	ended := make(chan error, 1)
+	addr := listen(t, func(ctx *fasthttp.RequestCtx) {
+		c := Context(ctx)
+		select {
+		case <-c.Done():
+		case <-time.After(5 * time.Second):
+		}
+		ended <- c.Err()
+	})
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = conn.Write([]byte(request)); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	conn.Close()
+	if err := <-ended; !errors.Is(err, context.Canceled) {
+		t.Errorf("request context after the client left: %v, want context.Canceled", err)
+	}
+}
+
+func TestConnectedClientKeepsContext(t *testing.T) {
+	addr := listen(t, func(ctx *fasthttp.RequestCtx) {
+		time.Sleep(20 * time.Millisecond)
+		if err := Context(ctx).Err(); err != nil {
+			ctx.SetStatusCode(fasthttp.StatusServiceUnavailable)
+		}
+	})
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	// the second request on the connection is read after the watch of the first
+	// one, and a pipelined request does not count as a disconnect
+	if _, err = conn.Write([]byte(request)); err != nil {
+		t.Fatal(err)
+	}
+	br := bufio.NewReader(conn)
+	var resp fasthttp.Response
+	if err = resp.Read(br); err != nil || resp.StatusCode() != fasthttp.StatusOK {
+		t.Fatalf("first answer %d, %v", resp.StatusCode(), err)
+	}
+	if _, err = conn.Write([]byte(strings.Repeat(request, 2))); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if err = resp.Read(br); err != nil || resp.StatusCode() != fasthttp.StatusOK {
+			t.Fatalf("answer %d: %d, %v", i+2, resp.StatusCode(), err)
+		}
+	}
+}
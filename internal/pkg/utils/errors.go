@@ -0,0 +1,78 @@
+package utils
+
+import (
+	"context"
+	"errors"
+
+	"github.com/jackc/pgconn"
+	"github.com/valyala/fasthttp"
+	"repo/internal/pkg/domain"
+	"repo/internal/pkg/logging"
+)
+
+// SQLSTATE codes the repositories translate into domain errors
+const (
+	ForeignKeyViolation = "23503"
+	UniqueViolation     = "23505"
+	// raised by the forumCheckPost trigger
+	InvalidParent = "FP001"
+	// raised by the moderation trigger on Threads
+	UserBanned = "FP003"
+)
+
+// PgError returns the PostgreSQL error behind err, or nil.
+func PgError(err error) *pgconn.PgError {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		return pgErr
+	}
+	return nil
+}
+
+// StatusOf maps an error returned by a repository to an HTTP status.
+func StatusOf(err error) int {
+	switch {
+	case errors.Is(err, domain.ErrNotFound), errors.Is(err, domain.ErrUserMissing):
+		return fasthttp.StatusNotFound
+	case errors.Is(err, domain.ErrConflict), errors.Is(err, domain.ErrInvalidParent):
+		return fasthttp.StatusConflict
+	case errors.Is(err, domain.ErrInvalid):
+		return fasthttp.StatusBadRequest
+	case errors.Is(err, domain.ErrUnauthorized):
+		return fasthttp.StatusUnauthorized
+	case errors.Is(err, domain.ErrForbidden):
+		return fasthttp.StatusForbidden
+	case errors.Is(err, context.DeadlineExceeded):
+		return fasthttp.StatusGatewayTimeout
+	// request contexts are cancelled when the client disconnects or the server
+	// gives up draining them
+	case errors.Is(err, context.Canceled):
+		return fasthttp.StatusServiceUnavailable
+	default:
+		return fasthttp.StatusInternalServerError
+	}
+}
+
+// SendError answers with the status of err and a domain.Response body.
+// Errors of unknown kind are not echoed to the client but logged with the request ID.
+func SendError(err error, ctx *fasthttp.RequestCtx) {
+	// pgx does not always wrap the context error, trust the request context instead
+	if cerr := Context(ctx).Err(); cerr != nil && !errors.Is(err, cerr) {
+		err = cerr
+	}
+	status := StatusOf(err)
+	resp := domain.Response{Message: err.Error()}
+	var derr *domain.Error
+	switch {
+	case errors.As(err, &derr):
+		resp.Message = derr.Message
+	case status == fasthttp.StatusGatewayTimeout:
+		resp.Message = "request deadline exceeded"
+	case status == fasthttp.StatusServiceUnavailable:
+		resp.Message = "request cancelled"
+	default:
+		resp.Message = "internal server error"
+		logging.FromRequest(ctx).Error().Err(err).Bytes("path", ctx.Path()).Msg("request failed")
+	}
+	Send(status, resp, ctx)
+}
@@ -0,0 +1,58 @@
+package utils
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/fasthttp/router"
+	"github.com/valyala/fasthttp"
+	"repo/internal/pkg/domain"
+)
+
+func TestSendError(t *testing.T) {
+	cases := []struct {
+		name    string
+		timeout time.Duration
+		cancel  bool
+		err     error
+		status  int
+		message string
+	}{
+		{"not found", time.Minute, false, domain.NewError(domain.ErrNotFound, "no forum"), fasthttp.StatusNotFound, "no forum"},
+		{"deadline", time.Minute, false, fmt.Errorf("query: %w", context.DeadlineExceeded), fasthttp.StatusGatewayTimeout, "request deadline exceeded"},
+		// pgx may return its own error once the request context expires
+		{"expired context", time.Nanosecond, false, errors.New("conn closed"), fasthttp.StatusGatewayTimeout, "request deadline exceeded"},
+		{"cancelled", time.Minute, true, errors.New("conn closed"), fasthttp.StatusServiceUnavailable, "request cancelled"},
+		{"unknown", time.Minute, false, errors.New("secret detail"), fasthttp.StatusInternalServerError, "internal server error"},
+	}
+	for _, c := range cases {
+		base, cancel := context.WithCancel(context.Background())
+		if c.cancel {
+			cancel()
+		}
+		r := router.New()
+		Timeouts{Base: base, Default: c.timeout}.Router(r).GET("/", func(ctx *fasthttp.RequestCtx) {
+			if c.timeout < time.Millisecond {
+				<-Context(ctx).Done()
+			}
+			SendError(c.err, ctx)
+		})
+		ctx := serve(r, fasthttp.MethodGet, "/")
+		cancel()
+
+		if got := ctx.Response.StatusCode(); got != c.status {
+			t.Errorf("%s: status = %d, want %d", c.name, got, c.status)
+		}
+		var resp domain.Response
+		if err := json.Unmarshal(ctx.Response.Body(), &resp); err != nil {
+			t.Errorf("%s: %v", c.name, err)
+		}
+		if resp.Message != c.message {
+			t.Errorf("%s: message = %q, want %q", c.name, resp.Message, c.message)
+		}
+	}
+}
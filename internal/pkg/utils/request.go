@@ -0,0 +1,32 @@
+package utils
+
+import (
+	"encoding/json"
+
+	"github.com/valyala/fasthttp"
+	"repo/internal/pkg/domain"
+	"repo/internal/pkg/validation"
+)
+
+// ParseBody decodes the JSON body into v and validates it.
+// On failure it answers 400 and returns false.
+func ParseBody(ctx *fasthttp.RequestCtx, v interface{}) bool {
+	return parseBody(ctx, v, validation.Validate)
+}
+
+// ParseBodyPartial is ParseBody for update payloads where omitted fields are kept.
+func ParseBodyPartial(ctx *fasthttp.RequestCtx, v interface{}) bool {
+	return parseBody(ctx, v, validation.ValidatePartial)
+}
+
+func parseBody(ctx *fasthttp.RequestCtx, v interface{}, validate func(interface{}) []domain.FieldError) bool {
+	if err := json.Unmarshal(ctx.PostBody(), v); err != nil {
+		Send(fasthttp.StatusBadRequest, domain.Response{Message: "malformed JSON: " + err.Error()}, ctx)
+		return false
+	}
+	if errs := validate(v); len(errs) > 0 {
+		Send(fasthttp.StatusBadRequest, domain.ValidationResponse{Message: "validation failed", Errors: errs}, ctx)
+		return false
+	}
+	return true
+}
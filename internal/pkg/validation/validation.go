@@ -0,0 +1,200 @@
+// Package validation checks request payloads against rules declared in
+// `validate` struct tags, e.g. `validate:"required,format=email,max=64"`.
+//
+// Supported rules:
+//
+//	required     the value must not be the zero value
+//	nickname     letters, digits, '_' and '.'
+//	slug         letters, digits, '_' and '-'
+//	format=NAME  a go-openapi/strfmt format such as email or date-time
+//	min=N        at least N characters
+//	max=N        at most N characters
+//	oneof=A B    the integer value is one of the listed ones
+//
+// Format rules are not applied to empty strings, combine them with required
+// where the field is mandatory.
+package validation
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/go-openapi/strfmt"
+	"repo/internal/pkg/domain"
+)
+
+var (
+	nicknameRe = regexp.MustCompile(`^[A-Za-z0-9_.]+$`)
+	slugRe     = regexp.MustCompile(`^(\d|\w|-|_)*(\w|-|_)(\d|\w|-|_)*$`)
+)
+
+type rule struct {
+	name  string
+	arg   string
+	check func(v reflect.Value, arg string) string
+}
+
+type field struct {
+	index int
+	name  string
+	rules []rule
+	// embedded structs are validated as if their fields were declared inline
+	embedded bool
+}
+
+var cache sync.Map // reflect.Type -> []field
+
+// Validate checks v, a struct or a slice of structs, and returns every violated rule.
+func Validate(v interface{}) []domain.FieldError {
+	return validate(reflect.ValueOf(v), "", false)
+}
+
+// ValidatePartial is Validate for partial updates: required is not enforced
+// and empty fields are skipped, as they mean "keep the current value".
+func ValidatePartial(v interface{}) []domain.FieldError {
+	return validate(reflect.ValueOf(v), "", true)
+}
+
+// Format checks a single value against a strfmt format.
+func Format(name, value string) bool {
+	return strfmt.Default.Validates(name, value)
+}
+
+func validate(v reflect.Value, prefix string, partial bool) []domain.FieldError {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+	var errs []domain.FieldError
+	switch v.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			errs = append(errs, validate(v.Index(i), fmt.Sprintf("%s[%d]", prefix, i), partial)...)
+		}
+	case reflect.Struct:
+		for _, f := range fieldsOf(v.Type()) {
+			fv := v.Field(f.index)
+			if f.embedded {
+				errs = append(errs, validate(fv, prefix, partial)...)
+				continue
+			}
+			name := f.name
+			if prefix != "" {
+				name = prefix + "." + name
+			}
+			if partial && fv.IsZero() {
+				continue
+			}
+			for _, r := range f.rules {
+				if r.name == "required" && partial {
+					continue
+				}
+				if r.name != "required" && fv.IsZero() {
+					continue
+				}
+				if msg := r.check(fv, r.arg); msg != "" {
+					errs = append(errs, domain.FieldError{Field: name, Message: msg})
+					break
+				}
+			}
+		}
+	}
+	return errs
+}
+
+func fieldsOf(t reflect.Type) []field {
+	if cached, ok := cache.Load(t); ok {
+		return cached.([]field)
+	}
+	var fields []field
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if sf.Anonymous && sf.Type.Kind() == reflect.Struct {
+			fields = append(fields, field{index: i, embedded: true})
+			continue
+		}
+		tag, ok := sf.Tag.Lookup("validate")
+		if !ok || tag == "" {
+			continue
+		}
+		name := sf.Name
+		if js := strings.Split(sf.Tag.Get("json"), ",")[0]; js != "" && js != "-" {
+			name = js
+		}
+		f := field{index: i, name: name}
+		for _, spec := range strings.Split(tag, ",") {
+			f.rules = append(f.rules, parseRule(t, sf.Name, spec))
+		}
+		fields = append(fields, f)
+	}
+	cache.Store(t, fields)
+	return fields
+}
+
+func parseRule(t reflect.Type, fieldName, spec string) rule {
+	name, arg := spec, ""
+	if i := strings.IndexByte(spec, '='); i >= 0 {
+		name, arg = spec[:i], spec[i+1:]
+	}
+	check, ok := checks[name]
+	if !ok {
+		panic(fmt.Sprintf("validation: unknown rule %q on %s.%s", name, t.Name(), fieldName))
+	}
+	return rule{name: name, arg: arg, check: check}
+}
+
+var checks = map[string]func(v reflect.Value, arg string) string{
+	"required": func(v reflect.Value, _ string) string {
+		if v.IsZero() || (v.Kind() == reflect.String && strings.TrimSpace(v.String()) == "") {
+			return "is required"
+		}
+		return ""
+	},
+	"nickname": func(v reflect.Value, _ string) string {
+		if !nicknameRe.MatchString(v.String()) {
+			return "may contain only latin letters, digits, '_' and '.'"
+		}
+		return ""
+	},
+	"slug": func(v reflect.Value, _ string) string {
+		if !slugRe.MatchString(v.String()) {
+			return "must be a slug of latin letters, digits, '_' and '-'"
+		}
+		return ""
+	},
+	"format": func(v reflect.Value, arg string) string {
+		if !Format(arg, v.String()) {
+			return "must be a valid " + arg
+		}
+		return ""
+	},
+	"min": func(v reflect.Value, arg string) string {
+		n, _ := strconv.Atoi(arg)
+		if utf8.RuneCountInString(v.String()) < n {
+			return fmt.Sprintf("must be at least %d characters", n)
+		}
+		return ""
+	},
+	"max": func(v reflect.Value, arg string) string {
+		n, _ := strconv.Atoi(arg)
+		if utf8.RuneCountInString(v.String()) > n {
+			return fmt.Sprintf("must be at most %d characters", n)
+		}
+		return ""
+	},
+	"oneof": func(v reflect.Value, arg string) string {
+		for _, option := range strings.Fields(arg) {
+			if n, err := strconv.ParseInt(option, 10, 64); err == nil && n == v.Int() {
+				return ""
+			}
+		}
+		return "must be one of " + strings.Join(strings.Fields(arg), ", ")
+	},
+}
@@ -0,0 +1,129 @@
+package validation
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"repo/internal/pkg/domain"
+)
+
+type sample struct {
+	Name     string `json:"name" validate:"required,nickname"`
+	Slug     string `json:"slug" validate:"slug"`
+	Email    string `json:"email" validate:"format=email"`
+	Title    string `json:"title" validate:"min=3,max=5"`
+	Voice    int32  `json:"voice" validate:"oneof=-1 1"`
+	NoTag    string `json:"noTag"`
+	Untagged string
+	Go       string `validate:"required"`
+}
+
+// valid returns a sample passing every rule
+func valid() sample {
+	return sample{Name: "alice", Go: "x"}
+}
+
+func TestRules(t *testing.T) {
+	cases := []struct {
+		name   string
+		change func(s *sample)
+		want   []domain.FieldError
+	}{
+		{"valid", func(s *sample) {}, nil},
+		{"required empty", func(s *sample) { s.Name = "" }, []domain.FieldError{{Field: "name", Message: "is required"}}},
+		{"required blank", func(s *sample) { s.Name = "  " }, []domain.FieldError{{Field: "name", Message: "is required"}}},
+		{"field without json name", func(s *sample) { s.Go = "" }, []domain.FieldError{{Field: "Go", Message: "is required"}}},
+		{"nickname", func(s *sample) { s.Name = "al ice" }, []domain.FieldError{{Field: "name", Message: "may contain only latin letters, digits, '_' and '.'"}}},
+		{"nickname dots", func(s *sample) { s.Name = "a.l_1" }, nil},
+		{"slug", func(s *sample) { s.Slug = "my slug" }, []domain.FieldError{{Field: "slug", Message: "must be a slug of latin letters, digits, '_' and '-'"}}},
+		{"slug of digits", func(s *sample) { s.Slug = "123" }, nil},
+		{"slug with a dot", func(s *sample) { s.Slug = "a.b" }, []domain.FieldError{{Field: "slug", Message: "must be a slug of latin letters, digits, '_' and '-'"}}},
+		{"slug dashes", func(s *sample) { s.Slug = "my-slug_2" }, nil},
+		{"format", func(s *sample) { s.Email = "not an email" }, []domain.FieldError{{Field: "email", Message: "must be a valid email"}}},
+		{"format valid", func(s *sample) { s.Email = "alice@example.com" }, nil},
+		{"min", func(s *sample) { s.Title = "ab" }, []domain.FieldError{{Field: "title", Message: "must be at least 3 characters"}}},
+		{"max", func(s *sample) { s.Title = "abcdef" }, []domain.FieldError{{Field: "title", Message: "must be at most 5 characters"}}},
+		{"max counts runes", func(s *sample) { s.Title = "ёжики" }, nil},
+		{"oneof", func(s *sample) { s.Voice = 2 }, []domain.FieldError{{Field: "voice", Message: "must be one of -1, 1"}}},
+		{"oneof valid", func(s *sample) { s.Voice = -1 }, nil},
+		{"untagged fields are free", func(s *sample) { s.NoTag, s.Untagged = "a b", "a b" }, nil},
+		{"every field reported, first rule only", func(s *sample) { s.Name, s.Title = "", "ab" }, []domain.FieldError{
+			{Field: "name", Message: "is required"}, {Field: "title", Message: "must be at least 3 characters"},
+		}},
+	}
+	for _, c := range cases {
+		s := valid()
+		c.change(&s)
+		if got := Validate(s); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%s: Validate = %v, want %v", c.name, got, c.want)
+		}
+		// pointers are followed
+		if got := Validate(&s); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%s: Validate(pointer) = %v, want %v", c.name, got, c.want)
+		}
+	}
+}
+
+func TestPartial(t *testing.T) {
+	// zero fields mean "keep the current value": neither required nor checked
+	if errs := ValidatePartial(sample{}); errs != nil {
+		t.Errorf("ValidatePartial of an empty update = %v", errs)
+	}
+	if errs := ValidatePartial(sample{Title: "abcdef", Email: "x"}); !reflect.DeepEqual(errs, []domain.FieldError{
+		{Field: "email", Message: "must be a valid email"}, {Field: "title", Message: "must be at most 5 characters"},
+	}) {
+		t.Errorf("ValidatePartial of set fields = %v", errs)
+	}
+	if errs := Validate(sample{}); len(errs) != 2 {
+		t.Errorf("Validate of an empty payload = %v, want name and Go required", errs)
+	}
+}
+
+type base struct {
+	Author string `json:"author" validate:"required"`
+}
+
+type withBase struct {
+	base
+	Message string `json:"message" validate:"required"`
+}
+
+func TestEmbeddedAndSlices(t *testing.T) {
+	want := []domain.FieldError{{Field: "author", Message: "is required"}, {Field: "message", Message: "is required"}}
+	if errs := Validate(withBase{}); !reflect.DeepEqual(errs, want) {
+		t.Errorf("embedded = %v, want %v", errs, want)
+	}
+	posts := []withBase{{base: base{Author: "a"}, Message: "m"}, {Message: "m"}}
+	want = []domain.FieldError{{Field: "[1].author", Message: "is required"}}
+	if errs := Validate(posts); !reflect.DeepEqual(errs, want) {
+		t.Errorf("slice = %v, want %v", errs, want)
+	}
+	var missing *withBase
+	if errs := Validate(missing); errs != nil {
+		t.Errorf("nil pointer = %v", errs)
+	}
+}
+
+func TestResponseFormat(t *testing.T) {
+	resp := domain.ValidationResponse{Message: "validation failed", Errors: Validate(sample{Name: "a b", Go: "x"})}
+	out, err := json.Marshal(resp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"message":"validation failed","errors":[{"field":"name","message":"may contain only latin letters, digits, '_' and '.'"}]}`
+	if string(out) != want {
+		t.Errorf("response %s, want %s", out, want)
+	}
+}
+
+func TestUnknownRulePanics(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("an unknown rule was accepted")
+		}
+	}()
+	Validate(struct {
+		A string `validate:"shiny"`
+	}{})
+}